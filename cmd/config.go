@@ -121,6 +121,7 @@ func runConfigInit(cmd *cobra.Command, args []string) {
 		logLevel = "info"
 	}
 	config["logging.level"] = logLevel
+	config["config_version"] = currentConfigVersion
 
 	home, _ := os.UserHomeDir()
 	configDir := filepath.Join(home, ".config", "ollama-router")
@@ -160,17 +161,63 @@ func runConfigShow(cmd *cobra.Command, args []string) {
 		title string
 	}{
 		{"openrouter.api_key", "OpenRouter API Key"},
+		{"openrouter.max_retries", "上游重试次数"},
+		{"openrouter.timeout", "上游请求超时"},
+		{"openrouter.stream_timeout", "流式响应超时"},
+		{"openrouter.model_list_ttl", "模型列表缓存有效期"},
+		{"openrouter.referer", "归属 HTTP-Referer"},
+		{"openrouter.title", "归属 X-Title"},
+		{"openrouter.proxy_url", "上游代理"},
 		{"server.port", "服务器端口"},
 		{"server.host", "服务器地址"},
+		{"server.tls_cert", "TLS 证书"},
+		{"server.tls_key", "TLS 私钥"},
 		{"mode.free_mode", "免费模式"},
 		{"mode.tool_use_only", "仅工具模型"},
+		{"free.prefer_free_variant", "优先免费变体"},
+		{"free.first_attempt_grace", "首次尝试宽限时间"},
+		{"free.direct_paid_models", "可直接请求的付费模型"},
+		{"free.min_context", "免费模型最小上下文长度"},
 		{"logging.level", "日志级别"},
+		{"logging.capture_path", "请求捕获日志"},
+		{"logging.capture_sample_rate", "捕获采样比例"},
+		{"ratelimit.max_concurrent_per_model", "每模型最大并发"},
+		{"ratelimit.client_rpm", "每客户端每分钟请求数"},
+		{"quotas.reset", "配额重置方式"},
+		{"quotas.clients", "客户端每日配额"},
+		{"server.auth_token", "代理鉴权令牌"},
+		{"server.max_concurrent_requests", "最大并发请求数"},
+		{"server.trusted_proxies", "可信反向代理"},
+		{"server.queue.max_depth", "请求队列长度"},
+		{"server.queue.max_wait", "请求队列最长等待"},
+		{"chat.streaming_only", "仅流式模型"},
+		{"chat.detect_empty_stream", "空流检测"},
+		{"compat.case_insensitive_models", "模型名忽略大小写"},
+		{"features.include_reasoning", "返回推理内容"},
+		{"filter.use_default", "内置默认过滤器"},
+		{"privacy.scrub_pii", "请求脱敏"},
+		{"prompt.system_prefix", "系统提示词前缀"},
+		{"aliases", "模型别名"},
+		{"provider.order", "服务商优先顺序"},
+		{"provider.allow_fallbacks", "允许回退服务商"},
+		{"provider.require_parameters", "要求支持全部参数"},
+		{"provider.data_collection", "数据收集策略"},
+		{"admin.enabled", "管理端点"},
+		{"admin.timeout", "管理端点超时"},
+		{"circuit_breaker.threshold", "熔断连续失败次数"},
+		{"circuit_breaker.window", "熔断统计窗口"},
+		{"circuit_breaker.cooldown", "熔断冷却时间"},
+		{"failover.strategy", "故障转移策略"},
+		{"failover.pin_model", "固定指定模型"},
+		{"failover.auto_disable_min_attempts", "自动停用最少尝试次数"},
+		{"failover.auto_disable_failure_rate", "自动停用失败率"},
+		{"failover.auto_disable_reprobe", "自动停用重新探测间隔"},
 	}
 
 	for _, s := range settings {
 		value := viper.Get(s.key)
-		if s.key == "openrouter.api_key" && value != "" {
-			value = maskAPIKey(value.(string))
+		if isSecretKey(s.key) && value != nil && value != "" {
+			value = maskAPIKey(fmt.Sprint(value))
 		}
 		fmt.Printf("%s: %v\n", yellow(s.title), value)
 	}
@@ -191,7 +238,14 @@ func runConfigSet(cmd *cobra.Command, args []string) {
 	var typedValue interface{}
 	typedValue = value
 
-	if boolVal, err := strconv.ParseBool(value); err == nil {
+	if isDurationKey(key) {
+		d, err := parseDuration(value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %s: %v\n", key, err)
+			os.Exit(1)
+		}
+		typedValue = d.String()
+	} else if boolVal, err := strconv.ParseBool(value); err == nil {
 		typedValue = boolVal
 	} else if intVal, err := strconv.Atoi(value); err == nil {
 		typedValue = intVal
@@ -226,13 +280,18 @@ func runConfigGet(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	if key == "openrouter.api_key" && value != "" {
-		value = maskAPIKey(value.(string))
+	if isSecretKey(key) && value != nil && value != "" {
+		value = maskAPIKey(fmt.Sprint(value))
 	}
 
 	fmt.Println(value)
 }
 
+// isSecretKey 判断配置项是否需要脱敏显示
+func isSecretKey(key string) bool {
+	return key == "openrouter.api_key" || key == "server.auth_token"
+}
+
 func maskAPIKey(key string) string {
 	if len(key) <= 8 {
 		return "****"
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// currentConfigVersion 是当前配置文件结构的版本，由 config init 和 config migrate 写入配置项 config_version。
+// 没有 config_version 的文件视为版本 0
+const currentConfigVersion = 1
+
+// configKeyRename 描述一次配置项改名
+type configKeyRename struct {
+	from string
+	to   string
+}
+
+// legacyConfigKeys 列出旧版本中存在、之后改名的配置项。目前发布的版本都使用分组后的配置项
+// （openrouter.*、server.*、mode.* 等），尚无需要迁移的改名；以后改名时在此追加
+var legacyConfigKeys []configKeyRename
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "升级配置文件结构",
+	Long: `将旧版本的配置文件迁移到当前结构：应用已知的配置项改名，写入版本号 config_version，
+并在修改前把原文件备份为 <配置文件>.bak。`,
+	Run: runConfigMigrate,
+}
+
+func init() {
+	configCmd.AddCommand(configMigrateCmd)
+}
+
+// configVersion 返回配置的结构版本，未设置 config_version 时为 0
+func configVersion(v *viper.Viper) int {
+	if !v.InConfig("config_version") {
+		return 0
+	}
+	return v.GetInt("config_version")
+}
+
+// legacyKeysIn 返回配置中仍在使用的旧配置项
+func legacyKeysIn(v *viper.Viper) []configKeyRename {
+	var found []configKeyRename
+	for _, r := range legacyConfigKeys {
+		if v.InConfig(r.from) {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+// migrateSettings 把扁平化配置中的旧配置项改为新名称，返回迁移说明。
+// 新旧配置项同时存在时保留新配置项的值
+func migrateSettings(settings map[string]interface{}, renames []configKeyRename) []string {
+	var changes []string
+	for _, r := range renames {
+		value, ok := settings[r.from]
+		if !ok {
+			continue
+		}
+		delete(settings, r.from)
+		if _, exists := settings[r.to]; exists {
+			changes = append(changes, fmt.Sprintf("删除 %s（已存在 %s）", r.from, r.to))
+			continue
+		}
+		settings[r.to] = value
+		changes = append(changes, fmt.Sprintf("%s → %s", r.from, r.to))
+	}
+	return changes
+}
+
+// migrateConfigFile 迁移 path 指向的配置文件，返回迁移说明和备份路径；
+// 已是当前版本且没有旧配置项时不修改文件，备份路径为空
+func migrateConfigFile(path string) ([]string, string, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, "", err
+	}
+
+	version := configVersion(v)
+	renames := legacyKeysIn(v)
+	if version >= currentConfigVersion && len(renames) == 0 {
+		return nil, "", nil
+	}
+
+	settings := make(map[string]interface{})
+	for _, key := range v.AllKeys() {
+		settings[key] = v.Get(key)
+	}
+	changes := migrateSettings(settings, renames)
+	if version < currentConfigVersion {
+		settings["config_version"] = currentConfigVersion
+		changes = append(changes, fmt.Sprintf("config_version: %d → %d", version, currentConfigVersion))
+	}
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	backup := path + ".bak"
+	if err := os.WriteFile(backup, original, 0600); err != nil {
+		return nil, "", fmt.Errorf("备份配置失败: %w", err)
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := viper.New()
+	for _, key := range keys {
+		out.Set(key, settings[key])
+	}
+	if err := out.WriteConfigAs(path); err != nil {
+		return nil, backup, err
+	}
+	return changes, backup, nil
+}
+
+func runConfigMigrate(cmd *cobra.Command, args []string) {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "错误: 未找到配置文件")
+		os.Exit(1)
+	}
+
+	changes, backup, err := migrateConfigFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 迁移配置失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	green := color.New(color.FgGreen).SprintFunc()
+	if backup == "" {
+		fmt.Printf("%s 配置文件已是最新版本 (v%d)\n", green("✓"), currentConfigVersion)
+		return
+	}
+
+	for _, c := range changes {
+		fmt.Println("  •", c)
+	}
+	fmt.Printf("%s 配置已迁移到 v%d: %s\n", green("✓"), currentConfigVersion, path)
+	fmt.Println("原配置备份:", backup)
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const currentConfig = `config_version: 1
+openrouter:
+  api_key: sk-or-test
+server:
+  port: "8080"
+`
+
+func TestMigrateConfigFileAtCurrentVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(currentConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, backup, err := migrateConfigFile(path)
+	if err != nil || backup != "" || len(changes) != 0 {
+		t.Errorf("migrateConfigFile() = %v, %q, %v; want no-op", changes, backup, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != currentConfig {
+		t.Errorf("current config rewritten: %q", data)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if legacy := legacyKeysIn(v); len(legacy) != 0 {
+		t.Errorf("legacyKeysIn() = %v, want none", legacy)
+	}
+}
+
+func TestMigrateConfigFileStampsMissingVersion(t *testing.T) {
+	const unversioned = `openrouter:
+  api_key: sk-or-test
+server:
+  port: "8080"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(unversioned), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, backup, err := migrateConfigFile(path)
+	if err != nil {
+		t.Fatalf("migrateConfigFile() error = %v", err)
+	}
+	if len(changes) != 1 {
+		t.Errorf("changes = %v, want only the version bump", changes)
+	}
+	if data, err := os.ReadFile(backup); err != nil || string(data) != unversioned {
+		t.Errorf("backup = %q, %v; want the original file", data, err)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("read migrated config: %v", err)
+	}
+	if got := configVersion(v); got != currentConfigVersion {
+		t.Errorf("config_version = %d, want %d", got, currentConfigVersion)
+	}
+	if got := v.GetString("openrouter.api_key"); got != "sk-or-test" {
+		t.Errorf("openrouter.api_key = %q, existing settings must be kept", got)
+	}
+
+	changes, backup, err = migrateConfigFile(path)
+	if err != nil || backup != "" || len(changes) != 0 {
+		t.Errorf("second migration = %v, %q, %v; want no-op", changes, backup, err)
+	}
+}
+
+func TestMigrateConfigFileRenamesLegacyKeys(t *testing.T) {
+	saved := legacyConfigKeys
+	legacyConfigKeys = []configKeyRename{
+		{"ratelimit.per_model", "ratelimit.max_concurrent_per_model"},
+		{"server.bind", "server.host"},
+	}
+	t.Cleanup(func() { legacyConfigKeys = saved })
+
+	const oldConfig = `ratelimit:
+  per_model: 3
+server:
+  bind: 0.0.0.0
+  host: 127.0.0.1
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(oldConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, backup, err := migrateConfigFile(path)
+	if err != nil {
+		t.Fatalf("migrateConfigFile() error = %v", err)
+	}
+	// 两处改名加上版本号
+	if len(changes) != 3 {
+		t.Errorf("changes = %v, want 3 entries", changes)
+	}
+	if data, err := os.ReadFile(backup); err != nil || string(data) != oldConfig {
+		t.Errorf("backup = %q, %v; want the original file", data, err)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("read migrated config: %v", err)
+	}
+	// 新旧配置项同时存在时保留新配置项的值
+	want := map[string]interface{}{
+		"ratelimit.max_concurrent_per_model": 3,
+		"server.host":                        "127.0.0.1",
+	}
+	for key, value := range want {
+		if got := v.Get(key); got != value {
+			t.Errorf("%s = %#v, want %#v", key, got, value)
+		}
+	}
+	if legacy := legacyKeysIn(v); len(legacy) != 0 {
+		t.Errorf("legacy keys still present after migration: %v", legacy)
+	}
+
+	changes, backup, err = migrateConfigFile(path)
+	if err != nil || backup != "" || len(changes) != 0 {
+		t.Errorf("second migration = %v, %q, %v; want no-op", changes, backup, err)
+	}
+}
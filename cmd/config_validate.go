@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "校验配置",
+	Long: `检查端口、监听地址、日志级别、API Key 和各时长配置项是否有效，逐项输出结果，
+任一项无效时以非零状态退出，避免到 start 时才报出难以理解的错误。`,
+	Run: runConfigValidate,
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+}
+
+// logLevels 为 logging.level 支持的取值
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// fieldCheck 是单个配置项的校验结果，Err 为 nil 表示通过
+type fieldCheck struct {
+	Key   string
+	Title string
+	Value string
+	Err   error
+}
+
+// validateConfig 校验 v 中的关键配置项；未设置的端口、地址和日志级别视为使用默认值
+func validateConfig(v *viper.Viper) []fieldCheck {
+	port := v.GetString("server.port")
+	host := v.GetString("server.host")
+	level := v.GetString("logging.level")
+	key := apiKeyFrom(v)
+
+	masked := ""
+	if key != "" {
+		masked = maskAPIKey(key)
+	}
+	checks := []fieldCheck{
+		{Key: "server.port", Title: "服务器端口", Value: port, Err: validatePort(port)},
+		{Key: "server.host", Title: "服务器地址", Value: host, Err: validateHost(host)},
+		{Key: "logging.level", Title: "日志级别", Value: level, Err: validateLogLevel(level)},
+		{Key: "openrouter.api_key", Title: "OpenRouter API Key", Value: masked, Err: validateAPIKey(key)},
+	}
+	// 时长配置项只在设置了（或有默认值）时校验
+	for _, k := range durationKeys {
+		if !v.IsSet(k) {
+			continue
+		}
+		d, err := durationValue(v, k)
+		checks = append(checks, fieldCheck{Key: k, Title: "时长", Value: d.String(), Err: err})
+	}
+	return checks
+}
+
+// validatePort 要求端口为 1-65535 之间的整数
+func validatePort(port string) error {
+	if port == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("不是整数: %q", port)
+	}
+	if n < 1 || n > 65535 {
+		return fmt.Errorf("超出范围 1-65535: %d", n)
+	}
+	return nil
+}
+
+// validateHost 要求监听地址为 IP 地址或合法主机名
+func validateHost(host string) error {
+	if host == "" || net.ParseIP(host) != nil {
+		return nil
+	}
+	if len(host) > 253 {
+		return errors.New("主机名过长")
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if !validHostLabel(label) {
+			return fmt.Errorf("不是有效的 IP 地址或主机名: %q", host)
+		}
+	}
+	return nil
+}
+
+// validHostLabel 判断主机名中的一段是否只由字母、数字和连字符组成，且不以连字符开头或结尾
+func validHostLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, r := range label {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateLogLevel 要求日志级别为 logLevels 之一
+func validateLogLevel(level string) error {
+	if level == "" {
+		return nil
+	}
+	for _, known := range logLevels {
+		if level == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("未知的日志级别 %q，可选: %s", level, strings.Join(logLevels, ", "))
+}
+
+// validateAPIKey 要求配置了 API Key（配置文件、命令行参数或环境变量）
+func validateAPIKey(key string) error {
+	if strings.TrimSpace(key) == "" {
+		return errors.New("未设置（openrouter.api_key、--api-key 或环境变量 OLLAMA_ROUTER_OPENROUTER_API_KEY / OPENROUTER_API_KEY）")
+	}
+	return nil
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) {
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+
+	failed := 0
+	for _, check := range validateConfig(viper.GetViper()) {
+		if check.Err != nil {
+			failed++
+			fmt.Printf("%s %s (%s): %v\n", red("✗"), check.Title, check.Key, check.Err)
+			continue
+		}
+		value := check.Value
+		if value == "" {
+			value = "默认值"
+		}
+		fmt.Printf("%s %s (%s): %s\n", green("✓"), check.Title, check.Key, value)
+	}
+
+	if path := viper.ConfigFileUsed(); path != "" {
+		fmt.Println()
+		fmt.Println("配置文件:", path)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d 项配置无效\n", failed)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// configFrom 用 settings 构造一个独立的 viper 实例
+func configFrom(settings map[string]interface{}) *viper.Viper {
+	v := viper.New()
+	for key, value := range settings {
+		v.Set(key, value)
+	}
+	return v
+}
+
+func TestValidateConfig(t *testing.T) {
+	t.Setenv("OPENROUTER_API_KEY", "")
+	t.Setenv("OLLAMA_ROUTER_OPENROUTER_API_KEY", "")
+
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		failing  []string
+	}{
+		{
+			name: "valid",
+			settings: map[string]interface{}{
+				"server.port":        "11434",
+				"server.host":        "0.0.0.0",
+				"logging.level":      "debug",
+				"openrouter.api_key": "sk-or-test-key",
+			},
+		},
+		{
+			name: "hostname and integer port",
+			settings: map[string]interface{}{
+				"server.port":        8080,
+				"server.host":        "my-host.local",
+				"openrouter.api_key": "sk-or-test-key",
+			},
+		},
+		{
+			name: "ipv6 host",
+			settings: map[string]interface{}{
+				"server.host":        "::1",
+				"openrouter.api_key": "sk-or-test-key",
+			},
+		},
+		{
+			name: "non-numeric port",
+			settings: map[string]interface{}{
+				"server.port":        "abc",
+				"openrouter.api_key": "sk-or-test-key",
+			},
+			failing: []string{"server.port"},
+		},
+		{
+			name: "port out of range",
+			settings: map[string]interface{}{
+				"server.port":        70000,
+				"openrouter.api_key": "sk-or-test-key",
+			},
+			failing: []string{"server.port"},
+		},
+		{
+			name: "everything wrong",
+			settings: map[string]interface{}{
+				"server.port":   "0",
+				"server.host":   "bad host!",
+				"logging.level": "verbose",
+			},
+			failing: []string{"server.port", "server.host", "logging.level", "openrouter.api_key"},
+		},
+		{
+			name: "host label starting with hyphen",
+			settings: map[string]interface{}{
+				"server.host":        "-bad.example.com",
+				"openrouter.api_key": "sk-or-test-key",
+			},
+			failing: []string{"server.host"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := make(map[string]bool)
+			for _, key := range tt.failing {
+				want[key] = true
+			}
+
+			checks := validateConfig(configFrom(tt.settings))
+			if len(checks) != 4 {
+				t.Fatalf("checks = %d, want 4", len(checks))
+			}
+			for _, check := range checks {
+				if failed := check.Err != nil; failed != want[check.Key] {
+					t.Errorf("%s: err = %v, want failure %v", check.Key, check.Err, want[check.Key])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateConfigAPIKeyFromEnv(t *testing.T) {
+	// 与 start 一致，两个环境变量都可以提供 API Key
+	for _, env := range []string{"OPENROUTER_API_KEY", "OLLAMA_ROUTER_OPENROUTER_API_KEY"} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv("OPENROUTER_API_KEY", "")
+			t.Setenv("OLLAMA_ROUTER_OPENROUTER_API_KEY", "")
+			t.Setenv(env, "sk-or-from-env")
+
+			for _, check := range validateConfig(configFrom(nil)) {
+				if check.Err != nil {
+					t.Errorf("%s: err = %v, want pass", check.Key, check.Err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateConfigDurations(t *testing.T) {
+	t.Setenv("OPENROUTER_API_KEY", "sk-or-from-env")
+
+	checks := validateConfig(configFrom(map[string]interface{}{
+		"openrouter.timeout":        "90s",
+		"openrouter.stream_timeout": 120,
+		"admin.timeout":             "500ms",
+		"server.queue.max_wait":     "soon",
+	}))
+	failing := map[string]bool{"admin.timeout": true, "server.queue.max_wait": true}
+	seen := 0
+	for _, check := range checks {
+		if !isDurationKey(check.Key) {
+			continue
+		}
+		seen++
+		if failed := check.Err != nil; failed != failing[check.Key] {
+			t.Errorf("%s: err = %v, want failure %v", check.Key, check.Err, failing[check.Key])
+		}
+	}
+	if seen != 4 {
+		t.Errorf("duration checks = %d, want 4", seen)
+	}
+}
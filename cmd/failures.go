@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"ollama-to-openrouter-proxy/internal/server"
+)
+
+var failuresCmd = &cobra.Command{
+	Use:   "failures",
+	Short: "查看模型失败与冷却状态",
+	Long:  `读取 failures.db，列出每个模型的失败类型、失败次数和剩余冷却时间。`,
+	Run:   runFailures,
+}
+
+var failuresExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "导出失败数据库为 JSON",
+	Long: `把 failures.db 中的冷却记录、永久失败标记、自动停用统计和冷却覆盖导出为 JSON，
+用于备份、排查或迁移；未指定文件时输出到标准输出。`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runFailuresExport,
+}
+
+var failuresImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "从 JSON 导入失败数据库",
+	Long: `把 'failures export' 导出的 JSON 写回 failures.db，使冷却状态在数据库迁移后得以保留。
+同名模型的现有记录被覆盖，其余记录保留。`,
+	Args: cobra.ExactArgs(1),
+	Run:  runFailuresImport,
+}
+
+func init() {
+	rootCmd.AddCommand(failuresCmd)
+	failuresCmd.AddCommand(failuresExportCmd)
+	failuresCmd.AddCommand(failuresImportCmd)
+
+	failuresCmd.Flags().Bool("json", false, "以 JSON 格式输出")
+}
+
+// failureEntry 是 failures 命令的 JSON 输出格式
+type failureEntry struct {
+	Model           string    `json:"model"`
+	FailureType     string    `json:"failure_type"`
+	FailureCount    int       `json:"failure_count"`
+	FailedAt        time.Time `json:"failed_at"`
+	CooldownSeconds int       `json:"cooldown_remaining_seconds"`
+	InCooldown      bool      `json:"in_cooldown"`
+}
+
+func toFailureEntries(records []server.FailureRecord) []failureEntry {
+	entries := make([]failureEntry, 0, len(records))
+	for _, r := range records {
+		entries = append(entries, failureEntry{
+			Model:           r.Model,
+			FailureType:     r.Type,
+			FailureCount:    r.Count,
+			FailedAt:        r.FailedAt,
+			CooldownSeconds: int(r.Remaining.Round(time.Second) / time.Second),
+			InCooldown:      r.Active(),
+		})
+	}
+	return entries
+}
+
+// listFailures 读取 dbPath 中的全部失败记录
+func listFailures(dbPath string) ([]server.FailureRecord, error) {
+	store, err := server.NewFailureStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	return store.ListFailures()
+}
+
+func runFailures(cmd *cobra.Command, args []string) {
+	jsonOutput, _ := cmd.Flags().GetBool("json")
+
+	dbPath := failureDBPath()
+	var records []server.FailureRecord
+	if _, err := os.Stat(dbPath); err == nil {
+		records, err = listFailures(dbPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 读取失败记录失败: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(toFailureEntries(records))
+		return
+	}
+
+	if len(records) == 0 {
+		fmt.Println("✅ 没有失败记录")
+		return
+	}
+
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	cyan := color.New(color.FgCyan).SprintFunc()
+
+	fmt.Printf("\n%-40s %12s %8s %12s\n", "模型名称", "失败类型", "次数", "剩余冷却")
+	fmt.Println(strings.Repeat("-", 80))
+
+	for _, r := range records {
+		remaining := green("可用")
+		if r.Active() {
+			remaining = red(r.Remaining.Round(time.Second).String())
+		}
+		fmt.Printf("%-40s %12s %8d %12s\n", cyan(r.Model), r.Type, r.Count, remaining)
+	}
+
+	fmt.Println()
+	fmt.Println("💡 使用 'ollama-router reset-failures [model]' 清除失败记录")
+}
+
+// exportFailures 把 dbPath 中的冷却状态以 JSON 写入 w
+func exportFailures(dbPath string, w io.Writer) error {
+	store, err := server.NewFailureStore(dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	export, err := store.Export()
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
+
+// importFailures 从 r 读取 exportFailures 的输出并写入 dbPath，返回写入的行数
+func importFailures(dbPath string, r io.Reader) (int, error) {
+	var export server.FailureExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return 0, fmt.Errorf("解析导出文件失败: %w", err)
+	}
+
+	store, err := server.NewFailureStore(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+
+	return store.Import(export)
+}
+
+func runFailuresExport(cmd *cobra.Command, args []string) {
+	var w io.Writer = os.Stdout
+	if len(args) > 0 {
+		file, err := os.Create(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 创建导出文件失败: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if err := exportFailures(failureDBPath(), w); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 导出失败记录失败: %v\n", err)
+		os.Exit(1)
+	}
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "✅ 已导出到 %s\n", args[0])
+	}
+}
+
+func runFailuresImport(cmd *cobra.Command, args []string) {
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 打开导入文件失败: %v\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	n, err := importFailures(failureDBPath(), file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 导入失败记录失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ 已导入 %d 条记录\n", n)
+}
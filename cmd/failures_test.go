@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"ollama-to-openrouter-proxy/internal/server"
+)
+
+func TestFailuresExportImport(t *testing.T) {
+	src := filepath.Join(t.TempDir(), server.FailureDBName)
+	store, err := server.NewFailureStore(src)
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	store.MarkFailureWithType("org/a:free", "rate_limit")
+	store.SetCooldownOverride("org/a:free", 45)
+	store.Close()
+
+	var buf bytes.Buffer
+	if err := exportFailures(src, &buf); err != nil {
+		t.Fatalf("exportFailures() error = %v", err)
+	}
+
+	dst := filepath.Join(t.TempDir(), server.FailureDBName)
+	n, err := importFailures(dst, &buf)
+	if err != nil || n != 2 {
+		t.Fatalf("importFailures() = %d, %v, want 2, nil", n, err)
+	}
+
+	records, err := listFailures(dst)
+	if err != nil {
+		t.Fatalf("listFailures() error = %v", err)
+	}
+	if len(records) != 1 || records[0].Model != "org/a:free" || !records[0].Active() {
+		t.Errorf("records after import = %+v, want org/a:free in cooldown", records)
+	}
+
+	if _, err := importFailures(dst, bytes.NewBufferString("not json")); err == nil {
+		t.Error("importFailures() accepted invalid JSON")
+	}
+}
@@ -11,6 +11,9 @@ import (
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"ollama-to-openrouter-proxy/internal/server"
 )
 
 var listModelsCmd = &cobra.Command{
@@ -26,6 +29,16 @@ func init() {
 	listModelsCmd.Flags().Bool("tool-use-only", false, "仅显示支持工具调用的模型")
 	listModelsCmd.Flags().Bool("json", false, "以 JSON 格式输出")
 	listModelsCmd.Flags().String("filter", "", "过滤模型名称（支持部分匹配）")
+	listModelsCmd.Flags().Int("min-context", 0, "仅显示上下文长度不小于该值的模型（默认使用 free.min_context）")
+}
+
+// listMinContext 返回 list-models 使用的最小上下文长度：传入 --min-context 时使用该值，否则使用 free.min_context
+func listMinContext(cmd *cobra.Command) int {
+	if cmd.Flags().Changed("min-context") {
+		minContext, _ := cmd.Flags().GetInt("min-context")
+		return minContext
+	}
+	return viper.GetInt("free.min_context")
 }
 
 type modelDetail struct {
@@ -71,7 +84,7 @@ func runListModels(cmd *cobra.Command, args []string) {
 
 	fmt.Println("⏳ 正在获取免费模型列表...")
 
-	models, err := fetchFreeModelsWithDetails(apiKey, toolUseOnly)
+	models, err := fetchFreeModelsWithDetails(apiKey, toolUseOnly, listMinContext(cmd))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "错误: 获取模型失败: %v\n", err)
 		os.Exit(1)
@@ -94,9 +107,15 @@ func runListModels(cmd *cobra.Command, args []string) {
 	}
 }
 
-func fetchFreeModelsWithDetails(apiKey string, toolUseOnly bool) ([]modelDetail, error) {
+// fetchORModels 获取 OpenRouter 的完整模型列表
+func fetchORModels(apiKey string) (*orModelsResponse, error) {
+	transport, err := upstreamTransport()
+	if err != nil {
+		return nil, err
+	}
 	client := &http.Client{
-		Timeout: 10 * time.Second,
+		Transport: transport,
+		Timeout:   10 * time.Second,
 	}
 
 	req, err := http.NewRequest("GET", "https://openrouter.ai/api/v1/models", nil)
@@ -120,46 +139,48 @@ func fetchFreeModelsWithDetails(apiKey string, toolUseOnly bool) ([]modelDetail,
 		return nil, err
 	}
 
-	var models []modelDetail
-	for _, m := range result.Data {
-		if m.Pricing.Prompt != "0" || m.Pricing.Completion != "0" {
-			continue
-		}
+	return &result, nil
+}
 
-		supportsTools := supportsToolUseCheck(m.SupportedParameters)
-		if toolUseOnly && !supportsTools {
-			continue
-		}
+// fetchFreeModelsWithDetails 返回上下文长度不小于 minContext 的免费模型详情，
+// 优先读取 SQLite 中未过期的缓存（与服务器共用）
+func fetchFreeModelsWithDetails(apiKey string, toolUseOnly bool, minContext int) ([]modelDetail, error) {
+	transport, err := upstreamTransport()
+	if err != nil {
+		return nil, err
+	}
+	os.MkdirAll(defaultConfigDir(), 0755)
+	store, err := server.NewFailureStore(failureDBPath())
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	infos, err := server.CachedFreeModels(store, server.DefaultModelsURL, apiKey, transport)
+	if err != nil {
+		return nil, err
+	}
+	return toModelDetails(server.FilterMinContext(infos, minContext), toolUseOnly), nil
+}
 
-		ctx := m.TopProvider.ContextLength
-		if ctx == 0 {
-			ctx = m.ContextLength
+// toModelDetails 将缓存的模型元数据转换为 list-models 的输出格式
+func toModelDetails(infos []server.ModelInfo, toolUseOnly bool) []modelDetail {
+	var models []modelDetail
+	for _, m := range infos {
+		if toolUseOnly && !m.SupportsTools {
+			continue
 		}
 
-		models = append(models, modelDetail{
+		detail := modelDetail{
 			ID:            m.ID,
-			ContextLength: ctx,
-			SupportsTools: supportsTools,
-			Pricing: struct {
-				Prompt     string `json:"prompt"`
-				Completion string `json:"completion"`
-			}{
-				Prompt:     m.Pricing.Prompt,
-				Completion: m.Pricing.Completion,
-			},
-		})
-	}
-
-	return models, nil
-}
-
-func supportsToolUseCheck(supportedParams []string) bool {
-	for _, param := range supportedParams {
-		if param == "tools" || param == "tool_choice" {
-			return true
+			ContextLength: m.ContextLength,
+			SupportsTools: m.SupportsTools,
 		}
+		detail.Pricing.Prompt = m.PromptPrice
+		detail.Pricing.Completion = m.CompletionPrice
+		models = append(models, detail)
 	}
-	return false
+	return models
 }
 
 func outputJSON(models []modelDetail) {
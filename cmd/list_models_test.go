@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"ollama-to-openrouter-proxy/internal/server"
+)
+
+func TestListModelsMinContext(t *testing.T) {
+	infos := []server.ModelInfo{
+		{ID: "org/big:free", ContextLength: 131072},
+		{ID: "org/medium:free", ContextLength: 8192},
+		{ID: "org/small:free", ContextLength: 4096},
+	}
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().Int("min-context", 0, "")
+		return cmd
+	}
+
+	viper.Set("free.min_context", 4097)
+	t.Cleanup(func() { viper.Set("free.min_context", 0) })
+
+	// 未传 --min-context 时使用配置值
+	got := toModelDetails(server.FilterMinContext(infos, listMinContext(newCmd())), false)
+	if len(got) != 2 || got[0].ID != "org/big:free" || got[1].ID != "org/medium:free" {
+		t.Errorf("with free.min_context = %+v, want big and medium", got)
+	}
+
+	// --min-context 优先于配置，0 表示不过滤
+	for flag, want := range map[string]int{"16384": 1, "0": 3} {
+		cmd := newCmd()
+		if err := cmd.Flags().Set("min-context", flag); err != nil {
+			t.Fatal(err)
+		}
+		if got := toModelDetails(server.FilterMinContext(infos, listMinContext(cmd)), false); len(got) != want {
+			t.Errorf("--min-context %s = %+v, want %d models", flag, got, want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"ollama-to-openrouter-proxy/internal/server"
+)
+
+var refreshModelsCmd = &cobra.Command{
+	Use:   "refresh-models",
+	Short: "强制刷新免费模型缓存",
+	Long:  `忽略缓存有效期，立即从 OpenRouter 重新获取免费模型列表并写入缓存。`,
+	Run:   runRefreshModels,
+}
+
+func init() {
+	rootCmd.AddCommand(refreshModelsCmd)
+
+	refreshModelsCmd.Flags().Bool("tool-use-only", false, "仅统计支持工具调用的模型（与 start 的同名选项一致）")
+}
+
+// refreshModels 从 modelsURL 获取免费模型并覆盖 dbPath 中的缓存，返回写入的全部模型
+func refreshModels(dbPath, modelsURL, apiKey string) ([]server.ModelInfo, error) {
+	transport, err := upstreamTransport()
+	if err != nil {
+		return nil, err
+	}
+	models, err := server.FetchFreeModels(modelsURL, apiKey, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := server.NewFailureStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	if err := store.SaveModels(models); err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+func runRefreshModels(cmd *cobra.Command, args []string) {
+	apiKey := getAPIKey()
+	if apiKey == "" {
+		fmt.Fprintln(os.Stderr, "错误: 未设置 OpenRouter API Key")
+		os.Exit(1)
+	}
+	toolUseOnly, _ := cmd.Flags().GetBool("tool-use-only")
+
+	fmt.Println("⏳ 正在刷新免费模型列表...")
+
+	os.MkdirAll(defaultConfigDir(), 0755)
+	models, err := refreshModels(failureDBPath(), server.DefaultModelsURL, apiKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 刷新模型失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	green := color.New(color.FgGreen).SprintFunc()
+	count := len(toModelDetails(models, toolUseOnly))
+	if toolUseOnly {
+		fmt.Printf("%s 已缓存 %d 个免费模型，其中 %d 个支持工具调用\n", green("✓"), len(models), count)
+	} else {
+		fmt.Printf("%s 已缓存 %d 个免费模型\n", green("✓"), count)
+	}
+	fmt.Println("重启服务器后生效")
+}
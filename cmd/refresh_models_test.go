@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"ollama-to-openrouter-proxy/internal/server"
+)
+
+func TestRefreshModelsRewritesCache(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		w.Write([]byte(`{"data":[
+			{"id":"org/new:free","context_length":32768,"supported_parameters":["tools"],"pricing":{"prompt":"0","completion":"0"}},
+			{"id":"org/other:free","context_length":4096,"pricing":{"prompt":"0","completion":"0"}},
+			{"id":"org/paid","context_length":8192,"pricing":{"prompt":"0.1","completion":"0.1"}}]}`))
+	}))
+	defer srv.Close()
+
+	dbPath := filepath.Join(t.TempDir(), server.FailureDBName)
+	store, err := server.NewFailureStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	if err := store.SaveModels([]server.ModelInfo{{ID: "org/stale:free"}}); err != nil {
+		t.Fatalf("SaveModels() error = %v", err)
+	}
+	store.Close()
+
+	models, err := refreshModels(dbPath, srv.URL, "test-key")
+	if err != nil {
+		t.Fatalf("refreshModels() error = %v", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("refreshModels() = %+v, want 2 free models", models)
+	}
+	if got := toModelDetails(models, true); len(got) != 1 || got[0].ID != "org/new:free" {
+		t.Errorf("tool-use-only models = %+v", got)
+	}
+
+	store, err = server.NewFailureStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	defer store.Close()
+	cached, _, err := store.LoadModels()
+	if err != nil {
+		t.Fatalf("LoadModels() error = %v", err)
+	}
+	if len(cached) != 2 || cached[0].ID != "org/new:free" || cached[1].ID != "org/other:free" {
+		t.Errorf("cached models = %+v, want the refreshed list", cached)
+	}
+}
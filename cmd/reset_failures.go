@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"ollama-to-openrouter-proxy/internal/server"
+)
+
+var resetFailuresCmd = &cobra.Command{
+	Use:   "reset-failures [model]",
+	Short: "清除模型失败记录",
+	Long: `清除 failures.db 中的失败记录，使处于冷却期的模型立即恢复可用。
+不指定模型时清除全部记录；指定模型时只删除该模型的记录（支持完整 ID 或显示名）。`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runResetFailures,
+}
+
+func init() {
+	rootCmd.AddCommand(resetFailuresCmd)
+}
+
+// failureDBPath 返回失败记录数据库路径
+func failureDBPath() string {
+	return filepath.Join(defaultConfigDir(), server.FailureDBName)
+}
+
+// resetFailures 删除 dbPath 中的失败记录，model 为空时删除全部，返回受影响的行数
+func resetFailures(dbPath, model string) (int64, error) {
+	store, err := server.NewFailureStore(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+
+	if model == "" {
+		return store.ResetAllFailures()
+	}
+	return store.DeleteFailure(model)
+}
+
+func runResetFailures(cmd *cobra.Command, args []string) {
+	var model string
+	if len(args) > 0 {
+		model = args[0]
+	}
+
+	dbPath := failureDBPath()
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		fmt.Println("⚠️  未找到失败记录数据库:", dbPath)
+		return
+	}
+
+	affected, err := resetFailures(dbPath, model)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 清除失败记录失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	green := color.New(color.FgGreen).SprintFunc()
+	if model == "" {
+		fmt.Printf("%s 已清除全部失败记录，共 %d 条\n", green("✓"), affected)
+	} else {
+		fmt.Printf("%s 已清除模型 %s 的失败记录，共 %d 条\n", green("✓"), model, affected)
+	}
+}
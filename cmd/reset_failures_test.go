@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"ollama-to-openrouter-proxy/internal/server"
+)
+
+func TestResetFailures(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), server.FailureDBName)
+
+	store, err := server.NewFailureStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	for _, m := range []string{"org/a:free", "org/b:free", "org/c:free"} {
+		if err := store.MarkFailure(m); err != nil {
+			t.Fatalf("MarkFailure(%s) error = %v", m, err)
+		}
+	}
+	store.Close()
+
+	affected, err := resetFailures(dbPath, "b:free")
+	if err != nil || affected != 1 {
+		t.Fatalf("resetFailures(single) = %d, %v, want 1, nil", affected, err)
+	}
+
+	store, err = server.NewFailureStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	skip, err := store.ShouldSkip("org/b:free")
+	store.Close()
+	if err != nil || skip {
+		t.Errorf("ShouldSkip(org/b:free) = %v, %v after reset, want false", skip, err)
+	}
+
+	affected, err = resetFailures(dbPath, "")
+	if err != nil || affected != 2 {
+		t.Fatalf("resetFailures(all) = %d, %v, want 2, nil", affected, err)
+	}
+}
@@ -2,11 +2,17 @@ package cmd
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"ollama-to-openrouter-proxy/internal/server"
 )
 
 var (
@@ -69,6 +75,7 @@ func initConfig() {
 	}
 
 	viper.SetEnvPrefix("OLLAMA_ROUTER")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err == nil {
@@ -78,10 +85,136 @@ func initConfig() {
 	}
 }
 
+// defaultConfigDir 返回默认配置目录 $HOME/.config/ollama-router
+func defaultConfigDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "ollama-router")
+}
+
+// modelFilterPath 返回模型过滤文件路径，优先使用配置项 filter.model_filter_path
+func modelFilterPath() string {
+	if path := viper.GetString("filter.model_filter_path"); path != "" {
+		return path
+	}
+	return filepath.Join(defaultConfigDir(), "models-filter")
+}
+
+// stringList 读取列表配置项，兼容 YAML 列表和 config set 写入的逗号分隔字符串
+func stringList(key string) []string {
+	raw := viper.GetStringSlice(key)
+	if value, ok := viper.Get(key).(string); ok {
+		raw = strings.Split(value, ",")
+	}
+
+	var list []string
+	for _, item := range raw {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// piiPatterns 读取 privacy.patterns 并逐个编译校验：YAML 列表中每项为一个正则；
+// config set 写入的字符串整体作为一个正则，不按空白或逗号拆分，因为正则本身可能包含它们
+func piiPatterns() ([]string, error) {
+	var patterns []string
+	switch value := viper.Get("privacy.patterns").(type) {
+	case nil:
+	case string:
+		if strings.TrimSpace(value) != "" {
+			patterns = []string{value}
+		}
+	case []string, []interface{}:
+		patterns = viper.GetStringSlice("privacy.patterns")
+	default:
+		patterns = []string{fmt.Sprint(value)}
+	}
+	if _, err := server.NewPIIScrubber(patterns); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// durationKeys 列出取值为时长的配置项
+var durationKeys = []string{
+	"openrouter.timeout",
+	"openrouter.stream_timeout",
+	"openrouter.model_list_ttl",
+	"server.queue.max_wait",
+	"chat.response_cache_ttl",
+	"free.first_attempt_grace",
+	"admin.timeout",
+	"circuit_breaker.window",
+	"circuit_breaker.cooldown",
+	"failover.auto_disable_reprobe",
+}
+
+// isDurationKey 判断配置项是否取值为时长
+func isDurationKey(key string) bool {
+	for _, k := range durationKeys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDuration 解析时长配置值：不带单位的整数按秒计（如 "60"），其余按 time.ParseDuration 解析（如 "90s"、"5m"）。
+// 负数和非零但不足一秒的值多半是单位写错，视为无效
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	var d time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if d, err = time.ParseDuration(value); err != nil {
+		return 0, fmt.Errorf("无效的时长 %q（如 30s、5m，不带单位的整数按秒计）", value)
+	}
+	return d, checkDuration(d)
+}
+
+// checkDuration 要求时长为 0 或不少于一秒
+func checkDuration(d time.Duration) error {
+	if d < 0 || (d > 0 && d < time.Second) {
+		return fmt.Errorf("时长 %s 无效，须为 0 或不少于 1s", d)
+	}
+	return nil
+}
+
+// durationValue 读取 v 中的时长配置项，配置文件中的整数同样按秒计
+func durationValue(v *viper.Viper, key string) (time.Duration, error) {
+	switch value := v.Get(key).(type) {
+	case nil:
+		return 0, nil
+	case time.Duration:
+		return value, checkDuration(value)
+	default:
+		return parseDuration(fmt.Sprint(value))
+	}
+}
+
+// durationSettings 读取所有时长配置项，任一项无效时返回带配置项名称的错误
+func durationSettings() (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration, len(durationKeys))
+	for _, key := range durationKeys {
+		d, err := durationValue(viper.GetViper(), key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		durations[key] = d
+	}
+	return durations, nil
+}
+
 // getAPIKey 获取 API 密钥，优先级：命令行参数 > 环境变量 OLLAMA_ROUTER_OPENROUTER_API_KEY > 环境变量 OPENROUTER_API_KEY > 配置文件
 func getAPIKey() string {
+	return apiKeyFrom(viper.GetViper())
+}
+
+// apiKeyFrom 按 getAPIKey 的优先级从 v 和环境变量中解析 API 密钥
+func apiKeyFrom(v *viper.Viper) string {
 	// 1. 命令行参数（通过 viper 绑定）
-	key := viper.GetString("openrouter.api_key")
+	key := v.GetString("openrouter.api_key")
 	if key != "" {
 		return key
 	}
@@ -100,3 +233,8 @@ func getAPIKey() string {
 
 	return ""
 }
+
+// upstreamTransport 按 openrouter.proxy_url 返回访问 OpenRouter 使用的 Transport，未设置时遵循 HTTPS_PROXY
+func upstreamTransport() (http.RoundTripper, error) {
+	return server.NewUpstreamTransport(viper.GetString("openrouter.proxy_url"))
+}
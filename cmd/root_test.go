@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestStringList(t *testing.T) {
+	defer viper.Set("failover.priority", nil)
+
+	viper.Set("failover.priority", "model-a, model-b,,")
+	if got, want := stringList("failover.priority"), []string{"model-a", "model-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stringList(comma string) = %v, want %v", got, want)
+	}
+
+	viper.Set("failover.priority", []string{"model-c", " model-d "})
+	if got, want := stringList("failover.priority"), []string{"model-c", "model-d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stringList(list) = %v, want %v", got, want)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"60", time.Minute, false},
+		{"90s", 90 * time.Second, false},
+		{"0", 0, false},
+		{"1m30s", 90 * time.Second, false},
+		{"500ms", 0, true},
+		{"-5", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.value)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestConfigSetDurationReadsBackAsDuration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	viper.SetConfigFile(path)
+	t.Cleanup(func() {
+		viper.SetConfigFile("")
+		viper.Set("openrouter.timeout", nil)
+	})
+
+	runConfigSet(nil, []string{"openrouter.timeout", "60"})
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	got, err := durationValue(v, "openrouter.timeout")
+	if err != nil || got != time.Minute {
+		t.Errorf("openrouter.timeout = %v, %v; want 1m", got, err)
+	}
+	if got := v.GetDuration("openrouter.timeout"); got != time.Minute {
+		t.Errorf("viper.GetDuration = %v, want 1m", got)
+	}
+}
+
+func TestPIIPatterns(t *testing.T) {
+	defer viper.Set("privacy.patterns", nil)
+
+	// config set 写入的字符串整体作为一个正则，即使包含空格和逗号
+	viper.Set("privacy.patterns", `\d{4} \d{4},\d{2}`)
+	if got, err := piiPatterns(); err != nil || !reflect.DeepEqual(got, []string{`\d{4} \d{4},\d{2}`}) {
+		t.Errorf("piiPatterns(string) = %q, %v; want a single pattern", got, err)
+	}
+
+	viper.Set("privacy.patterns", []interface{}{`secret-\w+`, `\d{3} \d{3}`})
+	if got, err := piiPatterns(); err != nil || !reflect.DeepEqual(got, []string{`secret-\w+`, `\d{3} \d{3}`}) {
+		t.Errorf("piiPatterns(list) = %q, %v; want both patterns", got, err)
+	}
+
+	viper.Set("privacy.patterns", "([unclosed")
+	if _, err := piiPatterns(); err == nil || !strings.Contains(err.Error(), "([unclosed") {
+		t.Errorf("piiPatterns(invalid) error = %v, want one naming the pattern", err)
+	}
+}
@@ -3,14 +3,16 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 	"time"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
@@ -32,12 +34,46 @@ func init() {
 	startCmd.Flags().Bool("free-mode", true, "启用免费模式")
 	startCmd.Flags().Bool("tool-use-only", false, "仅使用支持工具调用的模型")
 	startCmd.Flags().String("log-level", "info", "日志级别 (debug, info, warn, error)")
+	startCmd.Flags().Bool("dry-run", false, "仅检查配置（API Key、免费模型、过滤文件）后退出，不监听端口")
 
 	viper.BindPFlag("server.port", startCmd.Flags().Lookup("port"))
 	viper.BindPFlag("server.host", startCmd.Flags().Lookup("host"))
 	viper.BindPFlag("mode.free_mode", startCmd.Flags().Lookup("free-mode"))
 	viper.BindPFlag("mode.tool_use_only", startCmd.Flags().Lookup("tool-use-only"))
 	viper.BindPFlag("logging.level", startCmd.Flags().Lookup("log-level"))
+
+	viper.SetDefault("ratelimit.max_concurrent_per_model", 2)
+	viper.SetDefault("metrics.enabled", true)
+	viper.SetDefault("openrouter.max_retries", server.DefaultMaxRetries)
+	viper.SetDefault("openrouter.referer", server.DefaultReferer)
+	viper.SetDefault("openrouter.title", server.DefaultTitle)
+	viper.SetDefault("openrouter.timeout", server.DefaultUpstreamTimeout)
+	viper.SetDefault("openrouter.stream_timeout", server.DefaultStreamTimeout)
+	viper.SetDefault("openrouter.model_list_ttl", server.DefaultModelListTTL)
+	viper.SetDefault("openrouter.proxy_url", "")
+	viper.SetDefault("compat.case_insensitive_models", true)
+	viper.SetDefault("features.include_reasoning", false)
+	viper.SetDefault("chat.detect_empty_stream", true)
+	viper.SetDefault("prompt.system_prefix", "")
+	viper.SetDefault("free.first_attempt_grace", 0)
+	viper.SetDefault("free.min_context", 0)
+	viper.SetDefault("filter.use_default", true)
+	viper.SetDefault("server.max_concurrent_requests", 0)
+	viper.SetDefault("server.queue.max_depth", 0)
+	viper.SetDefault("server.queue.max_wait", server.DefaultQueueMaxWait)
+	viper.SetDefault("ratelimit.client_rpm", 0)
+	viper.SetDefault("quotas.reset", server.QuotaResetCalendar)
+	viper.SetDefault("logging.capture_path", "")
+	viper.SetDefault("logging.capture_sample_rate", 1.0)
+	viper.SetDefault("admin.timeout", server.DefaultAdminTimeout)
+	viper.SetDefault("failover.strategy", server.StrategyOrdered)
+	viper.SetDefault("failover.pin_model", false)
+	viper.SetDefault("circuit_breaker.threshold", 0)
+	viper.SetDefault("circuit_breaker.window", server.DefaultCircuitBreakerWindow)
+	viper.SetDefault("circuit_breaker.cooldown", server.DefaultCircuitBreakerCooldown)
+	viper.SetDefault("failover.auto_disable_min_attempts", 0)
+	viper.SetDefault("failover.auto_disable_failure_rate", server.DefaultAutoDisableFailureRate)
+	viper.SetDefault("failover.auto_disable_reprobe", server.DefaultAutoDisableReprobe)
 }
 
 func runStart(cmd *cobra.Command, args []string) {
@@ -52,6 +88,10 @@ func runStart(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	if legacy := legacyKeysIn(viper.GetViper()); len(legacy) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️  配置文件使用了已改名的配置项 %s，可运行 'ollama-router config migrate' 升级\n", legacy[0].from)
+	}
+
 	logLevel := viper.GetString("logging.level")
 	if verbose {
 		logLevel = "debug"
@@ -67,32 +107,147 @@ func runStart(cmd *cobra.Command, args []string) {
 		os.Setenv("TOOL_USE_ONLY", "true")
 	}
 
-	configDir, _ := os.UserHomeDir()
-	configDir = filepath.Join(configDir, ".config", "ollama-router")
+	configDir := defaultConfigDir()
 	os.MkdirAll(configDir, 0755)
 
-	filterPath := viper.GetString("filter.model_filter_path")
-	if filterPath == "" {
-		filterPath = filepath.Join(configDir, "models-filter")
+	filterPath := modelFilterPath()
+
+	var defaultStream *bool
+	if viper.IsSet("chat.default_stream") {
+		v := viper.GetBool("chat.default_stream")
+		defaultStream = &v
+	}
+
+	maxRetries := viper.GetInt("openrouter.max_retries")
+
+	var preferFreeVariant *bool
+	if viper.IsSet("free.prefer_free_variant") {
+		v := viper.GetBool("free.prefer_free_variant")
+		preferFreeVariant = &v
+	}
+
+	var modelLimits []server.ModelLimit
+	if err := viper.UnmarshalKey("model_limits", &modelLimits); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: model_limits 配置无效: %v\n", err)
+		os.Exit(1)
+	}
+
+	var modelRules []server.ModelRule
+	if err := viper.UnmarshalKey("model_rules", &modelRules); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: model_rules 配置无效: %v\n", err)
+		os.Exit(1)
+	}
+
+	var quotas []server.QuotaRule
+	if err := viper.UnmarshalKey("quotas.clients", &quotas); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: quotas.clients 配置无效: %v\n", err)
+		os.Exit(1)
+	}
+
+	patterns, err := piiPatterns()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: privacy.patterns 配置无效: %v\n", err)
+		os.Exit(1)
+	}
+
+	durations, err := durationSettings()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 时长配置无效: %v\n", err)
+		os.Exit(1)
 	}
 
 	srv := server.New(server.Config{
-		APIKey:        apiKey,
-		Host:          host,
-		Port:          port,
-		FreeMode:      freeMode,
-		ToolUseOnly:   toolUseOnly,
-		ConfigDir:     configDir,
-		FilterPath:    filterPath,
-		LogLevel:      logLevel,
+		APIKey:                   apiKey,
+		Host:                     host,
+		Port:                     port,
+		TLSCertFile:              viper.GetString("server.tls_cert"),
+		TLSKeyFile:               viper.GetString("server.tls_key"),
+		FreeMode:                 freeMode,
+		ToolUseOnly:              toolUseOnly,
+		ConfigDir:                configDir,
+		FilterPath:               filterPath,
+		LogLevel:                 logLevel,
+		MaxConcurrentPerModel:    viper.GetInt("ratelimit.max_concurrent_per_model"),
+		DefaultStream:            defaultStream,
+		MetricsEnabled:           viper.GetBool("metrics.enabled"),
+		ProxyAuthToken:           viper.GetString("server.auth_token"),
+		ScrubPII:                 viper.GetBool("privacy.scrub_pii"),
+		SystemPrefix:             viper.GetString("prompt.system_prefix"),
+		Aliases:                  viper.GetStringMapString("aliases"),
+		PIIPatterns:              patterns,
+		ModelLimits:              modelLimits,
+		AdminEnabled:             viper.GetBool("admin.enabled"),
+		ToolCallMismatchFailover: viper.GetBool("failover.tool_call_mismatch"),
+		FailoverPriority:         stringList("failover.priority"),
+		MaxMessages:              viper.GetInt("chat.max_messages"),
+		TruncateMessages:         viper.GetBool("chat.truncate_messages"),
+		MaxRetries:               &maxRetries,
+		MaxConcurrentRequests:    viper.GetInt("server.max_concurrent_requests"),
+		TrustedProxies:           stringList("server.trusted_proxies"),
+		QueueMaxDepth:            viper.GetInt("server.queue.max_depth"),
+		QueueMaxWait:             durations["server.queue.max_wait"],
+		PaidFallbacks:            stringList("failover.paid_fallbacks"),
+		DirectPaidModels:         stringList("free.direct_paid_models"),
+		ResponseCacheTTL:         durations["chat.response_cache_ttl"],
+		ProviderPreferences:      providerPreferences(),
+		Referer:                  viper.GetString("openrouter.referer"),
+		Title:                    viper.GetString("openrouter.title"),
+		ModelRules:               modelRules,
+		IncrementalNonStream:     viper.GetBool("chat.incremental_non_stream"),
+		UpstreamProxyURL:         viper.GetString("openrouter.proxy_url"),
+		UpstreamTimeout:          durations["openrouter.timeout"],
+		FirstAttemptGrace:        durations["free.first_attempt_grace"],
+		MinContextLength:         viper.GetInt("free.min_context"),
+		StreamTimeout:            durations["openrouter.stream_timeout"],
+		ModelListTTL:             durations["openrouter.model_list_ttl"],
+		BaseModels:               stringList("generate.base_models"),
+		DedupeStreamChunks:       viper.GetBool("chat.dedupe_stream_chunks"),
+		DetectEmptyStream:        viper.GetBool("chat.detect_empty_stream"),
+		StreamingOnly:            stringList("chat.streaming_only"),
+		CaseInsensitiveModels:    viper.GetBool("compat.case_insensitive_models"),
+		IncludeReasoning:         viper.GetBool("features.include_reasoning"),
+		DefaultFilter:            viper.GetBool("filter.use_default"),
+		EmbeddingModels:          stringList("failover.embedding_models"),
+		ClientRPM:                viper.GetInt("ratelimit.client_rpm"),
+		Quotas:                   quotas,
+		QuotaReset:               viper.GetString("quotas.reset"),
+		CapturePath:              viper.GetString("logging.capture_path"),
+		CaptureSampleRate:        viper.GetFloat64("logging.capture_sample_rate"),
+		AdminTimeout:             durations["admin.timeout"],
+		FailoverStrategy:         viper.GetString("failover.strategy"),
+		PreferFreeVariant:        preferFreeVariant,
+		PinModel:                 viper.GetBool("failover.pin_model"),
+		CircuitBreakerThreshold:  viper.GetInt("circuit_breaker.threshold"),
+		CircuitBreakerWindow:     durations["circuit_breaker.window"],
+		CircuitBreakerCooldown:   durations["circuit_breaker.cooldown"],
+		AutoDisableMinAttempts:   viper.GetInt("failover.auto_disable_min_attempts"),
+		AutoDisableFailureRate:   viper.GetFloat64("failover.auto_disable_failure_rate"),
+		AutoDisableReprobe:       durations["failover.auto_disable_reprobe"],
 	})
 
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		if err := runDryRun(os.Stdout, srv, freeMode, filterPath); err != nil {
+			fmt.Fprintln(os.Stderr, "错误: 配置检查失败:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := checkPortAvailable(host, port); err != nil {
+		fmt.Fprintln(os.Stderr, "错误:", err)
+		os.Exit(1)
+	}
+
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		slog.Info("启动服务器", "addr", host+":"+port, "free_mode", freeMode)
-		fmt.Printf("🚀 服务器已启动: http://%s:%s\n", host, port)
+		scheme := "http"
+		if srv.TLSEnabled() {
+			scheme = "https"
+		}
+		fmt.Printf("🚀 服务器已启动: %s://%s:%s\n", scheme, host, port)
 		fmt.Println("按 Ctrl+C 停止服务器")
 		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
 			slog.Error("服务器启动失败", "error", err)
@@ -113,6 +268,64 @@ func runStart(cmd *cobra.Command, args []string) {
 	slog.Info("服务器已关闭")
 }
 
+// runDryRun 执行启动前的配置检查并输出摘要，不监听端口
+func runDryRun(w io.Writer, srv *server.Server, freeMode bool, filterPath string) error {
+	report, err := srv.Preflight()
+	if err != nil {
+		return err
+	}
+
+	green := color.New(color.FgGreen).SprintFunc()
+	fmt.Fprintf(w, "%s OpenRouter 连接正常，API Key 有效\n", green("✓"))
+	if freeMode {
+		fmt.Fprintf(w, "%s 免费模型: %d 个，通过过滤后可用 %d 个\n", green("✓"), report.FreeModels, report.VisibleModels)
+	} else {
+		fmt.Fprintf(w, "%s 非免费模式，跳过免费模型检查\n", green("✓"))
+	}
+	switch {
+	case report.FilterSource == "default":
+		fmt.Fprintf(w, "%s 模型过滤: 内置默认过滤器（%d 条规则），创建 %s 可覆盖\n", green("✓"), report.FilterPatterns, filterPath)
+	case report.FilterPatterns > 0:
+		fmt.Fprintf(w, "%s 模型过滤: %s（%d 条规则）\n", green("✓"), filterPath, report.FilterPatterns)
+	default:
+		fmt.Fprintf(w, "%s 模型过滤: 未配置规则，显示全部模型\n", green("✓"))
+	}
+	fmt.Fprintln(w, "配置检查通过")
+	return nil
+}
+
+// checkPortAvailable 在启动前试探监听地址，端口被占用时返回带有处理建议的错误，
+// 避免服务器在后台 goroutine 中以原始的 "address already in use" 退出
+func checkPortAvailable(host, port string) error {
+	addr := net.JoinHostPort(host, port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("无法监听 %s: %w\n"+
+			"端口 %s 可能已被其他进程（例如本机运行的 Ollama）占用。\n"+
+			"可通过 'lsof -i :%s'（Windows: 'netstat -ano | findstr :%s'）查看占用进程，\n"+
+			"或使用 --port 参数、'ollama-router config set server.port <端口>' 更换端口",
+			addr, err, port, port, port)
+	}
+	return ln.Close()
+}
+
+// providerPreferences 读取 provider.* 配置；未设置的布尔项保持 nil，沿用 OpenRouter 默认值
+func providerPreferences() server.ProviderPreferences {
+	prefs := server.ProviderPreferences{
+		Order:          stringList("provider.order"),
+		DataCollection: viper.GetString("provider.data_collection"),
+	}
+	if viper.IsSet("provider.allow_fallbacks") {
+		v := viper.GetBool("provider.allow_fallbacks")
+		prefs.AllowFallbacks = &v
+	}
+	if viper.IsSet("provider.require_parameters") {
+		v := viper.GetBool("provider.require_parameters")
+		prefs.RequireParameters = &v
+	}
+	return prefs
+}
+
 func setupLogging(level string) {
 	var slogLevel slog.Level
 	switch level {
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ollama-to-openrouter-proxy/internal/server"
+)
+
+func TestCheckPortAvailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	err = checkPortAvailable("127.0.0.1", port)
+	if err == nil {
+		t.Fatal("checkPortAvailable() succeeded on an occupied port")
+	}
+	for _, want := range []string{"127.0.0.1:" + port, "已被其他进程", "--port", "server.port"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	ln.Close()
+	if err := checkPortAvailable("127.0.0.1", port); err != nil {
+		t.Errorf("checkPortAvailable() after release error = %v", err)
+	}
+
+	ln6, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer ln6.Close()
+	_, port6, _ := net.SplitHostPort(ln6.Addr().String())
+	err = checkPortAvailable("::1", port6)
+	if err == nil || !strings.Contains(err.Error(), "[::1]:"+port6) {
+		t.Errorf("checkPortAvailable(::1) error = %v, want an occupied [::1]:%s", err, port6)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[
+			{"id":"org/keep:free","context_length":32768,"pricing":{"prompt":"0","completion":"0"}},
+			{"id":"org/hidden:free","context_length":4096,"pricing":{"prompt":"0","completion":"0"}},
+			{"id":"org/paid","context_length":8192,"pricing":{"prompt":"0.1","completion":"0.1"}}]}`))
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	filterPath := filepath.Join(dir, "models-filter")
+	if err := os.WriteFile(filterPath, []byte("keep\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.New(server.Config{
+		APIKey:     "test-key",
+		BaseURL:    upstream.URL + "/",
+		FreeMode:   true,
+		ConfigDir:  dir,
+		FilterPath: filterPath,
+	})
+	var out strings.Builder
+	if err := runDryRun(&out, srv, true, filterPath); err != nil {
+		t.Fatalf("runDryRun() error = %v", err)
+	}
+	for _, want := range []string{"免费模型: 2 个", "可用 1 个", "1 条规则", "配置检查通过"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output %q does not contain %q", out.String(), want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, server.FailureDBName)); !os.IsNotExist(err) {
+		t.Error("dry run created the failure database")
+	}
+}
+
+func TestRunDryRunReportsFailingStep(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/auth/key") {
+			w.Write([]byte(`{"data":{}}`))
+			return
+		}
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	srv := server.New(server.Config{APIKey: "test-key", BaseURL: upstream.URL + "/", FreeMode: true, ConfigDir: t.TempDir()})
+	err := runDryRun(io.Discard, srv, true, "")
+	if err == nil || !strings.Contains(err.Error(), "fetch free models") {
+		t.Errorf("runDryRun() error = %v, want a fetch free models failure", err)
+	}
+
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/auth/key") {
+			http.Error(w, `{"error":{"message":"invalid api key"}}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data":[{"id":"org/keep:free","pricing":{"prompt":"0","completion":"0"}}]}`))
+	}))
+	defer rejecting.Close()
+
+	srv = server.New(server.Config{APIKey: "bad-key", BaseURL: rejecting.URL + "/", FreeMode: true, ConfigDir: t.TempDir()})
+	err = runDryRun(io.Discard, srv, true, "")
+	if err == nil || !strings.Contains(err.Error(), "check api key") {
+		t.Errorf("runDryRun() error = %v, want a check api key failure", err)
+	}
+}
@@ -1,14 +1,23 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"ollama-to-openrouter-proxy/internal/server"
 )
 
 var statusCmd = &cobra.Command{
@@ -23,11 +32,70 @@ func init() {
 
 	statusCmd.Flags().StringP("host", "H", "localhost", "服务器主机")
 	statusCmd.Flags().StringP("port", "p", "11434", "服务器端口")
+	statusCmd.Flags().Duration("wait", 0, "服务器未就绪时的最长等待时间（如 10s），0 表示不重试")
+	statusCmd.Flags().Bool("watch", false, "持续轮询健康状态和模型列表并刷新显示，Ctrl+C 退出")
+	statusCmd.Flags().Duration("interval", 5*time.Second, "--watch 模式的轮询间隔")
+}
+
+// 重试退避的初始与最大间隔
+const (
+	retryInitialBackoff = 200 * time.Millisecond
+	retryMaxBackoff     = 2 * time.Second
+)
+
+// statusBaseURL 返回服务器地址；配置了 server.tls_cert 和 server.tls_key 时服务端只接受 HTTPS，使用 https
+func statusBaseURL(host, port string) string {
+	scheme := "http"
+	if viper.GetString("server.tls_cert") != "" && viper.GetString("server.tls_key") != "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port))
+}
+
+// statusGet 请求服务器的 url，token 不为空时携带 Bearer 令牌（服务端开启 server.auth_token 时 /api/* 需要）
+func statusGet(client *http.Client, url, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return client.Do(req)
+}
+
+// withRetry 在 wait 时间内以指数退避重试 fn，wait 为 0 时只尝试一次
+func withRetry(wait time.Duration, fn func() error) error {
+	deadline := time.Now().Add(wait)
+	backoff := retryInitialBackoff
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return err
+		}
+		time.Sleep(min(backoff, remaining))
+		backoff = min(backoff*2, retryMaxBackoff)
+	}
 }
 
 func runStatus(cmd *cobra.Command, args []string) {
 	host, _ := cmd.Flags().GetString("host")
 	port, _ := cmd.Flags().GetString("port")
+	wait, _ := cmd.Flags().GetDuration("wait")
+	if watch, _ := cmd.Flags().GetBool("watch"); watch {
+		interval, _ := cmd.Flags().GetDuration("interval")
+		if interval <= 0 {
+			fmt.Fprintln(os.Stderr, "错误: --interval 必须大于 0")
+			os.Exit(1)
+		}
+		runStatusWatch(statusBaseURL(host, port), viper.GetString("server.auth_token"), interval)
+		return
+	}
 
 	cyan := color.New(color.FgCyan).SprintFunc()
 	yellow := color.New(color.FgYellow).SprintFunc()
@@ -38,10 +106,11 @@ func runStatus(cmd *cobra.Command, args []string) {
 	fmt.Println("==============")
 	fmt.Println()
 
-	baseURL := fmt.Sprintf("http://%s:%s", host, port)
+	baseURL := statusBaseURL(host, port)
+	token := viper.GetString("server.auth_token")
 
 	fmt.Println("检查服务器健康状态...")
-	if err := checkHealth(baseURL); err != nil {
+	if err := withRetry(wait, func() error { return checkHealth(baseURL) }); err != nil {
 		fmt.Printf("%s 服务器未运行: %v\n", red("✗"), err)
 		fmt.Println()
 		fmt.Println("使用以下命令启动服务器:")
@@ -52,7 +121,12 @@ func runStatus(cmd *cobra.Command, args []string) {
 	fmt.Println()
 
 	fmt.Println("获取可用模型列表...")
-	models, err := getModels(baseURL)
+	var models []map[string]interface{}
+	err := withRetry(wait, func() error {
+		var err error
+		models, err = getModels(baseURL, token)
+		return err
+	})
 	if err != nil {
 		fmt.Printf("%s 获取模型列表失败: %v\n", red("✗"), err)
 		return
@@ -70,6 +144,18 @@ func runStatus(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	fmt.Println()
+	fmt.Println("获取失败统计...")
+	stats, err := getStats(baseURL, token)
+	switch {
+	case errors.Is(err, errStatsUnavailable):
+		fmt.Printf("%s 统计不可用: 需在服务端开启 admin.enabled\n", yellow("!"))
+	case err != nil:
+		fmt.Printf("%s 获取失败统计失败: %v\n", red("✗"), err)
+	default:
+		printStats(os.Stdout, stats, time.Now())
+	}
+
 	fmt.Println()
 	fmt.Println("配置信息:")
 	fmt.Printf("  服务器地址: %s\n", yellow(baseURL))
@@ -77,6 +163,171 @@ func runStatus(cmd *cobra.Command, args []string) {
 	fmt.Printf("  工具模型: %s\n", green(viper.GetBool("mode.tool_use_only")))
 }
 
+// statusPoll 是 --watch 模式下一次轮询的结果
+type statusPoll struct {
+	At        time.Time
+	Healthy   bool
+	HealthErr error
+	Models    []string
+	ModelErr  error
+}
+
+// watchCounts 是 --watch 模式累计的检查次数和其中健康的次数
+type watchCounts struct {
+	Checks  int
+	Healthy int
+}
+
+// pollStatus 检查一次 /health 和 /api/tags
+func pollStatus(baseURL, token string, now time.Time) statusPoll {
+	p := statusPoll{At: now}
+	if p.HealthErr = checkHealth(baseURL); p.HealthErr == nil {
+		p.Healthy = true
+	}
+	models, err := getModels(baseURL, token)
+	if err != nil {
+		p.ModelErr = err
+		return p
+	}
+	for _, model := range models {
+		if name, ok := model["name"].(string); ok {
+			p.Models = append(p.Models, name)
+		}
+	}
+	return p
+}
+
+// watchLoop 立即轮询一次，之后每收到一个 tick 轮询一次，直到 ctx 取消，返回累计计数。
+// ticks 和 poll 可注入，便于测试时不依赖真实时钟和网络
+func watchLoop(ctx context.Context, ticks <-chan time.Time, poll func(time.Time) statusPoll, render func(statusPoll, watchCounts)) watchCounts {
+	var counts watchCounts
+	check := func(now time.Time) {
+		p := poll(now)
+		counts.Checks++
+		if p.Healthy {
+			counts.Healthy++
+		}
+		render(p, counts)
+	}
+
+	check(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return counts
+		case now := <-ticks:
+			check(now)
+		}
+	}
+}
+
+// renderWatch 清屏后重绘一次轮询结果和累计的健康检查计数
+func renderWatch(w io.Writer, baseURL string, interval time.Duration) func(statusPoll, watchCounts) {
+	cyan := color.New(color.FgCyan).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+
+	return func(p statusPoll, counts watchCounts) {
+		fmt.Fprint(w, "\033[H\033[2J")
+		fmt.Fprintln(w, cyan("📊 服务状态监视"))
+		fmt.Fprintln(w, "==============")
+		fmt.Fprintf(w, "服务器地址: %s  轮询间隔: %s  更新时间: %s\n\n", baseURL, interval, p.At.Format("15:04:05"))
+
+		if p.Healthy {
+			fmt.Fprintf(w, "%s 服务器运行正常", green("✓"))
+		} else {
+			fmt.Fprintf(w, "%s 服务器异常: %v", red("✗"), p.HealthErr)
+		}
+		fmt.Fprintf(w, "（健康检查 %d/%d 次正常）\n\n", counts.Healthy, counts.Checks)
+
+		if p.ModelErr != nil {
+			fmt.Fprintf(w, "%s 获取模型列表失败: %v\n", red("✗"), p.ModelErr)
+		} else {
+			fmt.Fprintf(w, "可用模型（%d 个）:\n", len(p.Models))
+			for _, name := range p.Models {
+				fmt.Fprintf(w, "  • %s\n", cyan(name))
+			}
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "按 Ctrl+C 退出")
+	}
+}
+
+// runStatusWatch 按 interval 持续轮询，直到收到 Ctrl+C 或 SIGTERM，退出前输出汇总
+func runStatusWatch(baseURL, token string, interval time.Duration) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	counts := watchLoop(ctx, ticker.C,
+		func(now time.Time) statusPoll { return pollStatus(baseURL, token, now) },
+		renderWatch(os.Stdout, baseURL, interval))
+	fmt.Printf("\n共检查 %d 次，其中 %d 次健康\n", counts.Checks, counts.Healthy)
+}
+
+// errStatsUnavailable 表示服务端未注册 /api/admin/stats（未开启 admin.enabled）
+var errStatsUnavailable = errors.New("stats endpoint not available")
+
+// getStats 从 /api/admin/stats 获取失败和限流统计，token 为服务端的 server.auth_token
+func getStats(baseURL, token string) (server.Stats, error) {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+	}
+
+	resp, err := statusGet(client, baseURL+"/api/admin/stats", token)
+	if err != nil {
+		return server.Stats{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return server.Stats{}, errStatsUnavailable
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return server.Stats{}, fmt.Errorf("unauthorized: check server.auth_token")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return server.Stats{}, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var stats server.Stats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return server.Stats{}, err
+	}
+	return stats, nil
+}
+
+// printStats 输出失败和限流统计；全部免费模型都在冷却中时提示免费额度可能已耗尽
+func printStats(w io.Writer, stats server.Stats, now time.Time) {
+	green := color.New(color.FgGreen).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+
+	fmt.Fprintf(w, "  冷却中的模型: %d\n", stats.SkippedModels)
+	fmt.Fprintf(w, "  永久失败模型: %d\n", stats.PermanentFailures)
+	fmt.Fprintf(w, "  临时失败模型: %d\n", stats.TemporaryFailures)
+	if stats.LastRequest != nil {
+		fmt.Fprintf(w, "  最近上游请求: %s（%s 前）\n",
+			stats.LastRequest.Local().Format("2006-01-02 15:04:05"), now.Sub(*stats.LastRequest).Round(time.Second))
+	} else {
+		fmt.Fprintln(w, "  最近上游请求: 无")
+	}
+
+	// 冷却记录和永久失败可能落在同一模型上，也可能属于已不在列表中的模型，
+	// 因此按服务端去重后的 unavailable_models 判断，而不是把两者相加
+	switch {
+	case stats.FreeModels == 0:
+	case stats.UnavailableModels >= stats.FreeModels:
+		fmt.Fprintf(w, "%s 全部 %d 个免费模型均不可用，免费额度可能已耗尽\n", red("✗"), stats.FreeModels)
+	case stats.UnavailableModels > 0:
+		fmt.Fprintf(w, "%s %d/%d 个免费模型被跳过\n", yellow("!"), stats.UnavailableModels, stats.FreeModels)
+	default:
+		fmt.Fprintf(w, "%s 全部 %d 个免费模型可用\n", green("✓"), stats.FreeModels)
+	}
+}
+
 func checkHealth(baseURL string) error {
 	client := &http.Client{
 		Timeout: 5 * time.Second,
@@ -95,12 +346,12 @@ func checkHealth(baseURL string) error {
 	return nil
 }
 
-func getModels(baseURL string) ([]map[string]interface{}, error) {
+func getModels(baseURL, token string) ([]map[string]interface{}, error) {
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
 
-	resp, err := client.Get(baseURL + "/api/tags")
+	resp, err := statusGet(client, baseURL+"/api/tags", token)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"ollama-to-openrouter-proxy/internal/server"
+)
+
+// newDelayedServer 返回一个在 delay 之后才变为健康的服务器
+func newDelayedServer(t *testing.T, delay time.Duration) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	ready := time.Now().Add(delay)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if time.Now().Before(ready) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/health":
+			w.Write([]byte(`{"status":"ok"}`))
+		case "/api/tags":
+			w.Write([]byte(`{"models":[{"name":"model-a"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestWithRetryWaitsForServer(t *testing.T) {
+	srv, calls := newDelayedServer(t, 500*time.Millisecond)
+
+	if err := withRetry(5*time.Second, func() error { return checkHealth(srv.URL) }); err != nil {
+		t.Fatalf("checkHealth with wait: %v", err)
+	}
+	if calls.Load() < 2 {
+		t.Errorf("server called %d times, want retries", calls.Load())
+	}
+
+	var models []map[string]interface{}
+	err := withRetry(5*time.Second, func() error {
+		var err error
+		models, err = getModels(srv.URL, "")
+		return err
+	})
+	if err != nil || len(models) != 1 {
+		t.Fatalf("getModels with wait = %v, %v", models, err)
+	}
+}
+
+func TestWithRetryNoWait(t *testing.T) {
+	srv, calls := newDelayedServer(t, time.Hour)
+
+	start := time.Now()
+	if err := withRetry(0, func() error { return checkHealth(srv.URL) }); err == nil {
+		t.Fatal("checkHealth succeeded against an unready server")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("server called %d times, want 1", calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("withRetry(0) took %v, want immediate failure", elapsed)
+	}
+}
+
+func TestWithRetryGivesUpAfterWait(t *testing.T) {
+	srv, _ := newDelayedServer(t, time.Hour)
+
+	start := time.Now()
+	if err := withRetry(600*time.Millisecond, func() error { return checkHealth(srv.URL) }); err == nil {
+		t.Fatal("checkHealth succeeded against an unready server")
+	}
+	if elapsed := time.Since(start); elapsed < 600*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("withRetry gave up after %v, want ~600ms", elapsed)
+	}
+}
+
+func TestWatchLoopCountsHealthyChecks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ticks := make(chan time.Time)
+	results := []bool{true, false, true, true}
+	var polled int
+	poll := func(now time.Time) statusPoll {
+		p := statusPoll{At: now, Healthy: results[polled], Models: []string{"model-a"}}
+		polled++
+		return p
+	}
+
+	var rendered []watchCounts
+	done := make(chan watchCounts)
+	go func() {
+		done <- watchLoop(ctx, ticks, poll, func(p statusPoll, counts watchCounts) {
+			rendered = append(rendered, counts)
+		})
+	}()
+
+	base := time.Unix(0, 0)
+	for i := 1; i < len(results); i++ {
+		ticks <- base.Add(time.Duration(i) * 5 * time.Second)
+	}
+	cancel()
+	counts := <-done
+
+	if counts != (watchCounts{Checks: 4, Healthy: 3}) {
+		t.Errorf("counts = %+v, want 4 checks, 3 healthy", counts)
+	}
+	want := []watchCounts{{1, 1}, {2, 1}, {3, 2}, {4, 3}}
+	if len(rendered) != len(want) {
+		t.Fatalf("rendered %d times, want %d", len(rendered), len(want))
+	}
+	for i := range want {
+		if rendered[i] != want[i] {
+			t.Errorf("render %d counts = %+v, want %+v", i, rendered[i], want[i])
+		}
+	}
+}
+
+func TestPollStatus(t *testing.T) {
+	srv, _ := newDelayedServer(t, 0)
+	p := pollStatus(srv.URL, "", time.Now())
+	if !p.Healthy || p.ModelErr != nil || len(p.Models) != 1 || p.Models[0] != "model-a" {
+		t.Errorf("pollStatus() = %+v", p)
+	}
+
+	down, _ := newDelayedServer(t, time.Hour)
+	p = pollStatus(down.URL, "", time.Now())
+	if p.Healthy || p.HealthErr == nil || p.ModelErr == nil {
+		t.Errorf("pollStatus() on an unhealthy server = %+v", p)
+	}
+}
+
+func TestRenderWatch(t *testing.T) {
+	var buf strings.Builder
+	render := renderWatch(&buf, "http://localhost:11434", 5*time.Second)
+	render(statusPoll{At: time.Now(), Healthy: true, Models: []string{"model-a"}}, watchCounts{Checks: 3, Healthy: 2})
+
+	out := buf.String()
+	for _, want := range []string{"\033[H\033[2J", "2/3", "model-a"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestStatusShowsSeededFailureStats(t *testing.T) {
+	last := time.Now().Add(-90 * time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/admin/stats" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(server.Stats{
+			FreeModels:        3,
+			SkippedModels:     2,
+			UnavailableModels: 3,
+			PermanentFailures: 1,
+			LastRequest:       &last,
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	stats, err := getStats(srv.URL, "")
+	if err != nil {
+		t.Fatalf("getStats() error = %v", err)
+	}
+	var buf strings.Builder
+	printStats(&buf, stats, last.Add(90*time.Second))
+
+	out := buf.String()
+	for _, want := range []string{"冷却中的模型: 2", "永久失败模型: 1", "临时失败模型: 0", "1m30s 前", "免费额度可能已耗尽"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestGetStatsWithoutAdmin(t *testing.T) {
+	srv, _ := newDelayedServer(t, 0)
+	if _, err := getStats(srv.URL, ""); !errors.Is(err, errStatsUnavailable) {
+		t.Errorf("getStats() error = %v, want errStatsUnavailable", err)
+	}
+}
+
+func TestPrintStatsDoesNotDoubleCountOverlappingFailures(t *testing.T) {
+	// 冷却中的 2 个模型里有 1 个同时是永久失败，实际只有 2 个不可用
+	stats := server.Stats{FreeModels: 3, SkippedModels: 2, PermanentFailures: 1, UnavailableModels: 2}
+	var buf strings.Builder
+	printStats(&buf, stats, time.Now())
+
+	out := buf.String()
+	if strings.Contains(out, "免费额度可能已耗尽") || !strings.Contains(out, "2/3 个免费模型被跳过") {
+		t.Errorf("output = %s, want 2/3 skipped without the exhausted warning", out)
+	}
+}
+
+func TestStatusSendsAuthToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/tags":
+			w.Write([]byte(`{"models":[{"name":"model-a"}]}`))
+		case "/api/admin/stats":
+			json.NewEncoder(w).Encode(server.Stats{FreeModels: 1})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	if _, err := getStats(srv.URL, ""); err == nil || !strings.Contains(err.Error(), "auth_token") {
+		t.Errorf("getStats() without token error = %v, want an auth_token hint", err)
+	}
+	if stats, err := getStats(srv.URL, "secret"); err != nil || stats.FreeModels != 1 {
+		t.Errorf("getStats() = %+v, %v", stats, err)
+	}
+	if models, err := getModels(srv.URL, "secret"); err != nil || len(models) != 1 {
+		t.Errorf("getModels() = %v, %v", models, err)
+	}
+}
+
+func TestStatusBaseURLUsesHTTPSWithTLS(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Set("server.tls_cert", "")
+		viper.Set("server.tls_key", "")
+	})
+
+	if got := statusBaseURL("localhost", "11434"); got != "http://localhost:11434" {
+		t.Errorf("statusBaseURL() = %q, want http", got)
+	}
+	viper.Set("server.tls_cert", "/etc/cert.pem")
+	viper.Set("server.tls_key", "/etc/key.pem")
+	if got := statusBaseURL("::1", "11434"); got != "https://[::1]:11434" {
+		t.Errorf("statusBaseURL() = %q, want https with a bracketed IPv6 host", got)
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"ollama-to-openrouter-proxy/internal/server"
+)
+
+var validateFilterCmd = &cobra.Command{
+	Use:   "validate-filter [path]",
+	Short: "校验模型过滤文件",
+	Long: `加载模型过滤文件并与 OpenRouter 实时模型列表比对，报告每个模式匹配的模型数，
+标记不匹配任何模型的模式，并统计最终会提供的模型总数。`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runValidateFilter,
+}
+
+func init() {
+	rootCmd.AddCommand(validateFilterCmd)
+
+	validateFilterCmd.Flags().Bool("free", false, "仅与免费模型列表比对")
+}
+
+// patternReport 记录单个过滤模式匹配的模型数
+type patternReport struct {
+	Pattern string
+	Matches int
+}
+
+// filterReport 是过滤文件的校验结果
+type filterReport struct {
+	Patterns []patternReport
+	Offered  int
+	Total    int
+}
+
+// deadPatterns 返回不匹配任何模型的模式
+func (r filterReport) deadPatterns() []string {
+	var dead []string
+	for _, p := range r.Patterns {
+		if p.Matches == 0 {
+			dead = append(dead, p.Pattern)
+		}
+	}
+	return dead
+}
+
+// validateFilter 统计过滤器中每个模式对模型显示名的匹配情况
+func validateFilter(filter *server.ModelFilter, modelIDs []string) filterReport {
+	report := filterReport{Total: len(modelIDs)}
+
+	for _, pattern := range filter.Patterns() {
+		pr := patternReport{Pattern: pattern}
+		for _, id := range modelIDs {
+			if filter.MatchPattern(pattern, displayName(id)) {
+				pr.Matches++
+			}
+		}
+		report.Patterns = append(report.Patterns, pr)
+	}
+
+	for _, id := range modelIDs {
+		if filter.Match(displayName(id)) {
+			report.Offered++
+		}
+	}
+	return report
+}
+
+// displayName 返回模型 ID 的最后一段，与服务器对外展示的名称一致
+func displayName(modelID string) string {
+	parts := strings.Split(modelID, "/")
+	return parts[len(parts)-1]
+}
+
+func runValidateFilter(cmd *cobra.Command, args []string) {
+	apiKey := getAPIKey()
+	if apiKey == "" {
+		fmt.Fprintln(os.Stderr, "错误: 未设置 OpenRouter API Key")
+		fmt.Fprintln(os.Stderr, "\n使用 'ollama-router config init' 进行交互式配置")
+		os.Exit(1)
+	}
+
+	path := modelFilterPath()
+	if len(args) > 0 {
+		path = args[0]
+	}
+	freeOnly, _ := cmd.Flags().GetBool("free")
+
+	filter, err := server.LoadModelFilter(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 读取过滤文件失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("⏳ 正在获取模型列表...")
+
+	var modelIDs []string
+	if freeOnly {
+		models, err := fetchFreeModelsWithDetails(apiKey, false, viper.GetInt("free.min_context"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 获取模型失败: %v\n", err)
+			os.Exit(1)
+		}
+		for _, m := range models {
+			modelIDs = append(modelIDs, m.ID)
+		}
+	} else {
+		result, err := fetchORModels(apiKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 获取模型失败: %v\n", err)
+			os.Exit(1)
+		}
+		for _, m := range result.Data {
+			modelIDs = append(modelIDs, m.ID)
+		}
+	}
+
+	report := validateFilter(filter, modelIDs)
+	printFilterReport(path, report)
+
+	if len(report.deadPatterns()) > 0 {
+		os.Exit(1)
+	}
+}
+
+func printFilterReport(path string, report filterReport) {
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	cyan := color.New(color.FgCyan).SprintFunc()
+
+	fmt.Printf("\n📁 过滤文件: %s\n\n", path)
+
+	if len(report.Patterns) == 0 {
+		fmt.Println("⚠️  过滤文件中没有任何模式，将提供全部模型")
+	}
+
+	for _, p := range report.Patterns {
+		mark := green("✓")
+		if p.Matches == 0 {
+			mark = red("✗")
+		}
+		fmt.Printf("  %s %-40s %d 个模型\n", mark, cyan(p.Pattern), p.Matches)
+	}
+
+	fmt.Printf("\n将提供 %d / %d 个模型\n", report.Offered, report.Total)
+
+	if dead := report.deadPatterns(); len(dead) > 0 {
+		fmt.Printf("%s %d 个模式未匹配任何模型: %s\n", red("✗"), len(dead), strings.Join(dead, ", "))
+	}
+}
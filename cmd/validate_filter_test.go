@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"ollama-to-openrouter-proxy/internal/server"
+)
+
+func TestValidateFilterFlagsDeadPattern(t *testing.T) {
+	filter, err := server.ParseModelFilter(strings.NewReader("gemma\ndeepseek\ngemnii-typo\n"))
+	if err != nil {
+		t.Fatalf("ParseModelFilter() error = %v", err)
+	}
+
+	models := []string{
+		"google/gemma-3-27b-it:free",
+		"google/gemma-2-9b-it:free",
+		"deepseek/deepseek-chat:free",
+		"meta-llama/llama-3.3-70b-instruct:free",
+	}
+
+	report := validateFilter(filter, models)
+
+	want := []patternReport{
+		{Pattern: "gemma", Matches: 2},
+		{Pattern: "deepseek", Matches: 1},
+		{Pattern: "gemnii-typo", Matches: 0},
+	}
+	if !reflect.DeepEqual(report.Patterns, want) {
+		t.Errorf("Patterns = %+v, want %+v", report.Patterns, want)
+	}
+	if report.Offered != 3 || report.Total != 4 {
+		t.Errorf("Offered/Total = %d/%d, want 3/4", report.Offered, report.Total)
+	}
+	if dead := report.deadPatterns(); !reflect.DeepEqual(dead, []string{"gemnii-typo"}) {
+		t.Errorf("deadPatterns() = %v, want [gemnii-typo]", dead)
+	}
+}
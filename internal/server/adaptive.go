@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// adaptiveLimiter 是按 AIMD（加性增、乘性减）调整上限的并发限制器：
+// 收到速率限制时上限减半，每次成功增加 1/上限，最多恢复到 max。
+type adaptiveLimiter struct {
+	mu       sync.Mutex
+	limit    float64
+	max      int
+	inFlight int
+	changed  chan struct{}
+}
+
+func newAdaptiveLimiter(max int) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		limit:   float64(max),
+		max:     max,
+		changed: make(chan struct{}),
+	}
+}
+
+// broadcast 唤醒所有等待者，调用方需持有锁
+func (a *adaptiveLimiter) broadcast() {
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+func (a *adaptiveLimiter) acquire(ctx context.Context) error {
+	for {
+		a.mu.Lock()
+		if a.inFlight < int(a.limit) {
+			a.inFlight++
+			a.mu.Unlock()
+			return nil
+		}
+		changed := a.changed
+		a.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (a *adaptiveLimiter) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.inFlight--
+	a.broadcast()
+}
+
+func (a *adaptiveLimiter) increase() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	before := int(a.limit)
+	a.limit += 1 / a.limit
+	if a.limit > float64(a.max) {
+		a.limit = float64(a.max)
+	}
+	if int(a.limit) > before {
+		a.broadcast()
+	}
+}
+
+func (a *adaptiveLimiter) decrease() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.limit /= 2
+	if a.limit < 1 {
+		a.limit = 1
+	}
+	slog.Debug("concurrency limit reduced", "limit", int(a.limit))
+}
+
+func (a *adaptiveLimiter) currentLimit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int(a.limit)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveConcurrencyBacksOffAndRecovers(t *testing.T) {
+	g := NewGlobalRateLimiter(4)
+	const model = "org/model"
+	rateLimited := errors.New("status code: 429, rate limit exceeded")
+
+	if got := g.ConcurrencyLimit(model); got != 4 {
+		t.Fatalf("initial limit = %d, want 4", got)
+	}
+
+	g.RecordResult(model, rateLimited)
+	if got := g.ConcurrencyLimit(model); got != 2 {
+		t.Errorf("limit after one 429 = %d, want 2", got)
+	}
+	g.RecordResult(model, rateLimited)
+	g.RecordResult(model, rateLimited)
+	if got := g.ConcurrencyLimit(model); got != 1 {
+		t.Errorf("limit after repeated 429s = %d, want 1", got)
+	}
+
+	// 上限为 1 时第二个请求必须等待
+	if err := g.Acquire(context.Background(), model); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	if err := g.Acquire(ctx, model); err == nil {
+		t.Error("second Acquire() should block while limit is 1")
+	}
+	cancel()
+	g.Release(model)
+
+	// 非速率限制错误不影响上限
+	g.RecordResult(model, errors.New("status code: 500"))
+	if got := g.ConcurrencyLimit(model); got != 1 {
+		t.Errorf("limit after non-429 error = %d, want 1", got)
+	}
+
+	for i := 0; i < 20; i++ {
+		g.RecordResult(model, nil)
+	}
+	if got := g.ConcurrencyLimit(model); got != 4 {
+		t.Errorf("limit after successes = %d, want 4 (capped at max)", got)
+	}
+}
+
+func TestAdaptiveIncreaseWakesWaiters(t *testing.T) {
+	g := NewGlobalRateLimiter(2)
+	const model = "org/model"
+
+	g.RecordResult(model, errors.New("429 too many requests"))
+	if err := g.Acquire(context.Background(), model); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- g.Acquire(context.Background(), model) }()
+
+	select {
+	case <-acquired:
+		t.Fatal("Acquire() should wait while limit is 1")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	g.RecordResult(model, nil)
+	g.RecordResult(model, nil)
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Acquire() not woken after limit increased")
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAdminResetFailures(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true, AdminEnabled: true, ProxyAuthToken: "secret"}, upstream, "org/a:free", "org/b:free")
+	r := s.buildRouter()
+
+	s.failureStore.MarkFailure("org/a:free")
+	s.failureStore.MarkFailureWithType("org/b:free", "rate_limit")
+	s.permanentFails.MarkPermanentFailure("org/gone:free")
+	s.permanentFails.MarkTemporaryFailure("org/b:free")
+	s.permanentFails.Disable("org/a:free", time.Now().Add(time.Hour))
+
+	if w := doJSON(t, r, http.MethodPost, "/api/admin/failures/reset", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated reset status = %d, want 401", w.Code)
+	}
+
+	w := doJSON(t, r, http.MethodPost, "/api/admin/failures/reset", "", "Authorization", "Bearer secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var got struct{ Failures, Permanent, Temporary, Disabled int }
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid body %s: %v", w.Body.String(), err)
+	}
+	if got.Failures != 2 || got.Permanent != 1 || got.Temporary != 1 || got.Disabled != 1 {
+		t.Errorf("cleared = %+v, want 2 failures, 1 permanent, 1 temporary, 1 disabled", got)
+	}
+
+	if records, err := s.failureStore.ListFailures(); err != nil || len(records) != 0 {
+		t.Errorf("ListFailures() = %v, %v after reset, want empty", records, err)
+	}
+	if s.permanentFails.IsPermanentlyFailed("org/gone:free") {
+		t.Error("permanent failure survived reset")
+	}
+	if s.freeModelSkipReason("org/a:free", 0) != "" {
+		t.Errorf("auto-disabled model still skipped after reset: %q", s.freeModelSkipReason("org/a:free", 0))
+	}
+	reloaded := NewPermanentFailureTracker(s.failureStore)
+	if reloaded.IsPermanentlyFailed("org/gone:free") {
+		t.Error("persisted permanent failure survived reset")
+	}
+	if reloaded.IsDisabled("org/a:free") {
+		t.Error("persisted auto-disable survived reset")
+	}
+}
+
+func TestAdminResetFailuresDisabled(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true}, upstream)
+	if w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/admin/failures/reset", ""); w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 when admin is disabled", w.Code)
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultAdminTimeout 为未配置时管理端点的超时
+const DefaultAdminTimeout = 10 * time.Second
+
+// errAdminTimeout 是管理操作超过 AdminTimeout 时返回的错误
+var errAdminTimeout = errors.New("admin operation timed out")
+
+// adminTimeout 返回管理端点的超时，与聊天请求的上游超时相互独立
+func (s *Server) adminTimeout() time.Duration {
+	if s.config.AdminTimeout > 0 {
+		return s.config.AdminTimeout
+	}
+	return DefaultAdminTimeout
+}
+
+// adminTimeoutMiddleware 为管理端点的请求设置独立的超时上下文，
+// 处理器发起的上游调用随之取消，避免管理操作无限期挂起。
+// 超时后处理器的输出被丢弃，尚未写出响应时统一返回 504
+func (s *Server) adminTimeoutMiddleware(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.adminTimeout())
+	defer cancel()
+	c.Request = c.Request.WithContext(ctx)
+	writer := &adminTimeoutWriter{ResponseWriter: c.Writer, ctx: ctx}
+	c.Writer = writer
+	c.Next()
+
+	c.Writer = writer.ResponseWriter
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+		writeError(c, http.StatusGatewayTimeout, fmt.Errorf("%w after %s", errAdminTimeout, s.adminTimeout()))
+	}
+}
+
+// adminTimeoutWriter 在管理端点超时后丢弃处理器尚未写出的响应，由 adminTimeoutMiddleware 改写为 504
+type adminTimeoutWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+}
+
+// expired 判断是否已超时且响应尚未写出
+func (w *adminTimeoutWriter) expired() bool {
+	return errors.Is(w.ctx.Err(), context.DeadlineExceeded) && !w.ResponseWriter.Written()
+}
+
+func (w *adminTimeoutWriter) WriteHeader(code int) {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *adminTimeoutWriter) WriteHeaderNow() {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *adminTimeoutWriter) Write(b []byte) (int, error) {
+	if w.expired() {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *adminTimeoutWriter) WriteString(s string) (int, error) {
+	if w.expired() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// handleAdminReloadModels 重新从 OpenRouter 获取免费模型列表并写入缓存，
+// 立即替换当前使用的模型列表而无需重启
+func (s *Server) handleAdminReloadModels(c *gin.Context) {
+	if !s.config.FreeMode {
+		writeError(c, http.StatusBadRequest, errors.New("model reload is only available in free mode"))
+		return
+	}
+
+	models, err := fetchFreeModelsContext(c.Request.Context(), s.modelsURL(), s.config.APIKey, s.transport)
+	if err != nil {
+		writeError(c, http.StatusBadGateway, fmt.Errorf("failed to fetch free models: %w", err))
+		return
+	}
+
+	if err := s.failureStore.SaveModels(models); err != nil {
+		slog.Error("Failed to cache free models", "error", err)
+	}
+	toolUseOnly := strings.ToLower(os.Getenv("TOOL_USE_ONLY")) == "true"
+	s.setFreeModels(s.usableFreeModels(models, toolUseOnly))
+	s.setContextLengths(models)
+	s.reorderFreeModelsByLatency()
+	if err := s.provider.RefreshModels(); err != nil {
+		slog.Warn("Failed to refresh provider model list", "error", err)
+	}
+
+	slog.Info("Free models reloaded", "models", len(s.freeModelList()))
+	c.JSON(http.StatusOK, gin.H{"models": len(s.freeModelList())})
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminReloadModels(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/a:free"}, fakeModel{ID: "org/b:free"})
+	s := newTestServer(t, Config{FreeMode: true, AdminEnabled: true}, upstream, "org/a:free")
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/admin/models/reload", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var body struct{ Models int }
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Models != 2 || len(s.freeModelList()) != 2 {
+		t.Errorf("reloaded models = %d (list %v), want 2", body.Models, s.freeModelList())
+	}
+}
+
+func TestAdminReloadModelsTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true, AdminEnabled: true, AdminTimeout: 100 * time.Millisecond}, upstream, "org/a:free")
+	s.config.BaseURL = slow.URL + "/"
+
+	start := time.Now()
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/admin/models/reload", "")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("reload took %v, want it bounded by the admin timeout", elapsed)
+	}
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504; body = %s", w.Code, w.Body.String())
+	}
+	if got := s.freeModelList(); len(got) != 1 || got[0] != "org/a:free" {
+		t.Errorf("free models = %v after timed-out reload, want unchanged", got)
+	}
+}
+
+func TestAdminTimeoutAppliesToEveryHandler(t *testing.T) {
+	s := newTestServer(t, Config{AdminTimeout: 50 * time.Millisecond}, newFakeUpstream(t))
+	r := gin.New()
+	// 超时后才写出的成功或错误响应都改为 504
+	r.GET("/api/admin/slow-ok", s.adminTimeoutMiddleware, func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	r.GET("/api/admin/slow-error", s.adminTimeoutMiddleware, func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		writeError(c, http.StatusInternalServerError, c.Request.Context().Err())
+	})
+	r.GET("/api/admin/fast", s.adminTimeoutMiddleware, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	for _, path := range []string{"/api/admin/slow-ok", "/api/admin/slow-error"} {
+		w := doJSON(t, r, http.MethodGet, path, "")
+		if w.Code != http.StatusGatewayTimeout || !strings.Contains(w.Body.String(), errAdminTimeout.Error()) {
+			t.Errorf("%s: status = %d, body = %s; want 504", path, w.Code, w.Body.String())
+		}
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/admin/fast", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "ok") {
+		t.Errorf("fast handler: status = %d, body = %s; want 200", w.Code, w.Body.String())
+	}
+}
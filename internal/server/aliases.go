@@ -0,0 +1,51 @@
+package server
+
+import (
+	"sort"
+	"strings"
+)
+
+// lookupAlias 返回 name 对应的别名目标。别名忽略大小写匹配，
+// 因为 viper 读取配置时会把 aliases 的键转为小写
+func lookupAlias(aliases map[string]string, name string) (string, bool) {
+	if target, ok := aliases[name]; ok {
+		return target, true
+	}
+	for alias, target := range aliases {
+		if strings.EqualFold(alias, name) {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// resolveAlias 把客户端请求的别名替换为配置的目标模型名，不是别名时原样返回
+func (s *Server) resolveAlias(name string) string {
+	if target, ok := lookupAlias(s.config.Aliases, name); ok {
+		return target
+	}
+	return name
+}
+
+// aliasEntry 是模型列表中的一个别名，index 为其目标模型在列表中的下标
+type aliasEntry struct {
+	name  string
+	index int
+}
+
+// aliasListing 返回目标模型出现在模型列表中的别名，按别名排序。names 为列表中各条记录的显示名，
+// 目标按显示名匹配；目标不在列表中（被过滤或处于冷却）的别名不列出
+func (s *Server) aliasListing(names []string) []aliasEntry {
+	var entries []aliasEntry
+	for alias, target := range s.config.Aliases {
+		parts := strings.Split(target, "/")
+		for i, name := range names {
+			if sameModelName(name, parts[len(parts)-1], s.config.CaseInsensitiveModels) {
+				entries = append(entries, aliasEntry{name: alias, index: i})
+				break
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries
+}
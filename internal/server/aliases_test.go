@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAliasRoutesToMappedModel(t *testing.T) {
+	for _, freeMode := range []bool{true, false} {
+		for _, path := range []string{"/api/chat", "/v1/chat/completions"} {
+			name := path
+			if freeMode {
+				name += " free mode"
+			}
+			t.Run(name, func(t *testing.T) {
+				upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a:free"}, fakeModel{ID: "org/model-b:free"})
+				cfg := Config{FreeMode: freeMode, Aliases: map[string]string{"gpt-4": "org/model-b:free"}}
+				s := newTestServer(t, cfg, upstream, "org/model-a:free", "org/model-b:free")
+
+				w := doJSON(t, s.buildRouter(), http.MethodPost, path,
+					`{"model":"GPT-4","stream":false,"messages":[{"role":"user","content":"hi"}]}`)
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+				}
+				if got := upstream.lastRequest(t)["model"]; got != "org/model-b:free" {
+					t.Errorf("upstream model = %v, want org/model-b:free", got)
+				}
+			})
+		}
+	}
+}
+
+func TestAliasListedInModels(t *testing.T) {
+	for _, freeMode := range []bool{true, false} {
+		upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a:free"}, fakeModel{ID: "org/model-b:free"})
+		cfg := Config{FreeMode: freeMode, Aliases: map[string]string{
+			"gpt-4":   "org/model-b:free",
+			"missing": "org/unknown",
+		}}
+		s := newTestServer(t, cfg, upstream, "org/model-a:free", "org/model-b:free")
+		r := s.buildRouter()
+
+		w := doJSON(t, r, http.MethodGet, "/api/tags", "")
+		var tags struct {
+			Models []struct {
+				Name string `json:"name"`
+			} `json:"models"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &tags); err != nil {
+			t.Fatal(err)
+		}
+		var tagNames []string
+		for _, m := range tags.Models {
+			tagNames = append(tagNames, m.Name)
+		}
+		want := []string{"model-a:free", "model-b:free", "gpt-4"}
+		if fmt.Sprint(tagNames) != fmt.Sprint(want) {
+			t.Errorf("free=%v /api/tags names = %v, want %v", freeMode, tagNames, want)
+		}
+
+		w = doJSON(t, r, http.MethodGet, "/v1/models", "")
+		var list struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, m := range list.Data {
+			ids = append(ids, m.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(want) {
+			t.Errorf("free=%v /v1/models ids = %v, want %v", freeMode, ids, want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// attemptGrace 记录一次请求中首个上游尝试的额外时间是否已被使用
+type attemptGrace struct {
+	used atomic.Bool
+}
+
+type attemptGraceKey struct{}
+
+// withAttemptGrace 为 ctx 关联首次尝试宽限记录；ctx 中已有记录时原样返回，
+// 使首选模型与之后的故障转移共享同一份记录
+func withAttemptGrace(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(attemptGraceKey{}).(*attemptGrace); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, attemptGraceKey{}, &attemptGrace{})
+}
+
+// takeAttemptGrace 在请求的第一次上游尝试时返回 FirstAttemptGrace，之后的尝试返回 0
+func (s *Server) takeAttemptGrace(ctx context.Context) time.Duration {
+	if s.config.FirstAttemptGrace <= 0 {
+		return 0
+	}
+	g, ok := ctx.Value(attemptGraceKey{}).(*attemptGrace)
+	if !ok || g.used.Swap(true) {
+		return 0
+	}
+	return s.config.FirstAttemptGrace
+}
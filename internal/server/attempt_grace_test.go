@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// slowModelUpstream 返回一个上游：slow 中的模型延迟 delay 后正常响应，failing 中的模型立即返回 500
+func slowModelUpstream(t *testing.T, delay time.Duration, slow, failing string) *fakeUpstream {
+	upstream := newFakeUpstream(t)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		model, _ := body["model"].(string)
+		switch model {
+		case failing:
+			writeUpstreamError(w, http.StatusInternalServerError, "upstream exploded")
+		case slow:
+			time.Sleep(delay)
+			writeChatCompletion(w, model, "late but fine")
+		default:
+			writeChatCompletion(w, model, "hello")
+		}
+	}
+	return upstream
+}
+
+func TestFirstAttemptGetsGraceDeadline(t *testing.T) {
+	cfg := Config{FreeMode: true, UpstreamTimeout: 100 * time.Millisecond, FirstAttemptGrace: 500 * time.Millisecond}
+	req := openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+
+	// 首个模型比基础超时慢，但在宽限期内响应
+	upstream := slowModelUpstream(t, 250*time.Millisecond, "org/a:free", "")
+	s := newTestServer(t, cfg, upstream, "org/a:free", "org/b:free")
+	if _, model, err := s.getFreeChat(context.Background(), req); err != nil || model != "org/a:free" {
+		t.Fatalf("getFreeChat() = %q, %v; want org/a:free within the grace period", model, err)
+	}
+
+	// 首个模型失败后，第二个模型只有基础超时
+	upstream = slowModelUpstream(t, 250*time.Millisecond, "org/b:free", "org/a:free")
+	s = newTestServer(t, cfg, upstream, "org/a:free", "org/b:free")
+	_, _, err := s.getFreeChat(context.Background(), req)
+	if err == nil || !isTimeoutError(err) {
+		t.Fatalf("getFreeChat() error = %v, want the second attempt to time out", err)
+	}
+	if got := upstream.requestedModels(); len(got) != 2 || got[0] != "org/a:free" || got[1] != "org/b:free" {
+		t.Errorf("requested models = %v, want [org/a:free org/b:free]", got)
+	}
+}
+
+func TestFirstAttemptWithoutGraceFailsOver(t *testing.T) {
+	upstream := slowModelUpstream(t, 250*time.Millisecond, "org/a:free", "")
+	s := newTestServer(t, Config{FreeMode: true, UpstreamTimeout: 100 * time.Millisecond}, upstream, "org/a:free", "org/b:free")
+
+	req := openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	if _, model, err := s.getFreeChat(context.Background(), req); err != nil || model != "org/b:free" {
+		t.Fatalf("getFreeChat() = %q, %v; want failover to org/b:free", model, err)
+	}
+}
+
+func TestPreferredModelConsumesGrace(t *testing.T) {
+	s := &Server{config: Config{FirstAttemptGrace: time.Second}}
+	ctx := withAttemptGrace(context.Background())
+	if got := s.takeAttemptGrace(ctx); got != time.Second {
+		t.Errorf("first takeAttemptGrace() = %v, want 1s", got)
+	}
+	// 故障转移沿用同一份记录，宽限不会再次发放
+	ctx = withAttemptGrace(ctx)
+	if got := s.takeAttemptGrace(ctx); got != 0 {
+		t.Errorf("second takeAttemptGrace() = %v, want 0", got)
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import "net/http"
+
+// OpenRouter 应用归属请求头的默认值，用于在 OpenRouter 中标识本代理
+const (
+	DefaultReferer = "https://github.com/morning-start/ollama-openrouter-proxy"
+	DefaultTitle   = "Ollama OpenRouter Proxy"
+)
+
+// attributionTransport 为发往 OpenRouter 的请求加上 HTTP-Referer 和 X-Title 头
+type attributionTransport struct {
+	base    http.RoundTripper
+	referer string
+	title   string
+}
+
+func (t *attributionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if t.referer != "" {
+		req.Header.Set("HTTP-Referer", t.referer)
+	}
+	if t.title != "" {
+		req.Header.Set("X-Title", t.title)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// recordingTransport 记录经过的请求头后交给默认 Transport
+type recordingTransport struct {
+	mu      sync.Mutex
+	headers []http.Header
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	r.headers = append(r.headers, req.Header.Clone())
+	r.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestAttributionHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []ProviderOption
+		wantReferer string
+		wantTitle   string
+	}{
+		{"defaults", nil, DefaultReferer, DefaultTitle},
+		{"configured", []ProviderOption{WithAttribution("https://example.com", "My App")}, "https://example.com", "My App"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			upstream.Config.Handler.(*http.ServeMux).HandleFunc("/embeddings", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1]}]}`))
+			})
+			transport := &recordingTransport{}
+			opts := append([]ProviderOption{WithBaseURL(upstream.URL + "/"), WithTransport(transport)}, tt.opts...)
+			provider := NewOpenrouterProvider("key", opts...)
+
+			if _, err := provider.Chat([]openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}, "org/model-a"); err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if _, err := provider.GetEmbeddings("hi", "org/embed"); err != nil {
+				t.Fatalf("GetEmbeddings() error = %v", err)
+			}
+
+			if len(transport.headers) != 2 {
+				t.Fatalf("recorded %d requests, want 2", len(transport.headers))
+			}
+			for _, h := range transport.headers {
+				if got := h.Get("HTTP-Referer"); got != tt.wantReferer {
+					t.Errorf("HTTP-Referer = %q, want %q", got, tt.wantReferer)
+				}
+				if got := h.Get("X-Title"); got != tt.wantTitle {
+					t.Errorf("X-Title = %q, want %q", got, tt.wantTitle)
+				}
+			}
+		})
+	}
+}
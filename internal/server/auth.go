@@ -0,0 +1,43 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidProxyToken = errors.New("Invalid or missing proxy auth token")
+
+// requiresAuth 判断路径是否需要代理鉴权；根路径、/health 等探活端点保持开放
+func requiresAuth(path string) bool {
+	return strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/v1/")
+}
+
+// bearerToken 从 Authorization 头中提取 Bearer 令牌
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
+
+// authMiddleware 在配置了 ProxyAuthToken 时校验 /api/* 和 /v1/* 请求的 Bearer 令牌
+func (s *Server) authMiddleware(c *gin.Context) {
+	if !requiresAuth(c.Request.URL.Path) {
+		c.Next()
+		return
+	}
+
+	token := bearerToken(c)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.ProxyAuthToken)) != 1 {
+		writeError(c, http.StatusUnauthorized, errInvalidProxyToken)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
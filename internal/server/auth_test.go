@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProxyAuth(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{ProxyAuthToken: "secret"}, upstream)
+	r := s.buildRouter()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		auth   string
+		want   int
+	}{
+		{"root stays open", http.MethodGet, "/", "", http.StatusOK},
+		{"health stays open", http.MethodGet, "/health", "", http.StatusOK},
+		{"ollama api without token", http.MethodGet, "/api/tags", "", http.StatusUnauthorized},
+		{"openai api with wrong token", http.MethodGet, "/v1/models", "Bearer nope", http.StatusUnauthorized},
+		{"ollama api with token", http.MethodGet, "/api/tags", "Bearer secret", http.StatusOK},
+		{"openai api with token", http.MethodGet, "/v1/models", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headers []string
+			if tt.auth != "" {
+				headers = []string{"Authorization", tt.auth}
+			}
+			w := doJSON(t, r, tt.method, tt.path, "", headers...)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.want != http.StatusUnauthorized {
+				return
+			}
+
+			if strings.HasPrefix(tt.path, "/api/") {
+				var body struct {
+					Error string `json:"error"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error == "" {
+					t.Errorf("401 body = %s, want Ollama-shaped error", w.Body.String())
+				}
+				return
+			}
+
+			var body struct {
+				Error struct {
+					Message string `json:"message"`
+					Type    string `json:"type"`
+					Code    string `json:"code"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Message == "" || body.Error.Code != "invalid_api_key" {
+				t.Errorf("401 body = %s, want OpenAI-shaped error", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestProxyAuthDisabledByDefault(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+
+	if w := doJSON(t, s.buildRouter(), http.MethodGet, "/api/tags", ""); w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 without configured token", w.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	// DefaultAutoDisableFailureRate 为未配置时触发自动停用的失败率
+	DefaultAutoDisableFailureRate = 0.9
+	// DefaultAutoDisableReprobe 为未配置时自动停用的模型重新探测前的等待时间
+	DefaultAutoDisableReprobe = 7 * 24 * time.Hour
+)
+
+// recordModelOutcome 记录免费模型的一次尝试结果；开启自动停用时，累计尝试次数达到
+// AutoDisableMinAttempts 且失败率不低于阈值的模型由 PermanentFailureTracker 持久化停用，直到重新探测时间到达，
+// 或与永久失败标记一起通过 reset-failures、/api/admin/failures/reset 手动恢复。
+// 速率限制不计入，它反映的是配额而不是模型本身的问题
+func (s *Server) recordModelOutcome(model string, failed bool) {
+	minAttempts := s.config.AutoDisableMinAttempts
+	if minAttempts <= 0 || s.failureStore == nil {
+		return
+	}
+
+	attempts, failures, err := s.failureStore.RecordOutcome(model, failed)
+	if err != nil {
+		slog.Warn("failed to record model outcome", "model", model, "error", err)
+		return
+	}
+
+	threshold := s.config.AutoDisableFailureRate
+	if threshold <= 0 {
+		threshold = DefaultAutoDisableFailureRate
+	}
+	rate := float64(failures) / float64(attempts)
+	if attempts < minAttempts || rate < threshold {
+		return
+	}
+
+	reprobe := s.config.AutoDisableReprobe
+	if reprobe <= 0 {
+		reprobe = DefaultAutoDisableReprobe
+	}
+	until := time.Now().Add(reprobe)
+	s.permanentFails.Disable(model, until)
+	slog.Warn("Model auto-disabled after chronic failures",
+		"model", model, "attempts", attempts, "failures", failures,
+		"failure_rate", rate, "until", until.Format(time.RFC3339))
+}
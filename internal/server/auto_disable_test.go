@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestChronicallyFailingModelIsAutoDisabled(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		writeUpstreamError(w, http.StatusInternalServerError, "upstream exploded")
+	}
+	cfg := Config{FreeMode: true, AutoDisableMinAttempts: 3, AutoDisableFailureRate: 0.6, AutoDisableReprobe: time.Hour}
+	s := newTestServer(t, cfg, upstream, "org/flaky:free")
+
+	req := openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	for i := 0; i < 3; i++ {
+		if reason := s.freeModelSkipReason("org/flaky:free", 0); reason == skipAutoDisabled {
+			t.Fatalf("round %d: model disabled before reaching min attempts", i)
+		}
+		if _, _, err := s.getFreeChat(context.Background(), req); err == nil {
+			t.Fatalf("round %d: getFreeChat() succeeded against a failing model", i)
+		}
+		// 模拟普通失败的冷却期已过，让下一轮再次尝试该模型
+		if _, err := s.failureStore.db.Exec(`DELETE FROM failures`); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if reason := s.freeModelSkipReason("org/flaky:free", 0); reason != skipAutoDisabled {
+		t.Fatalf("skip reason = %q, want %q", reason, skipAutoDisabled)
+	}
+	// 停用状态持久化在 failures.db 中，重新打开后仍然有效
+	store, err := NewFailureStore(filepath.Join(s.config.ConfigDir, "failures.db"))
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	defer store.Close()
+	if !NewPermanentFailureTracker(store).ShouldSkip("org/flaky:free") {
+		t.Fatal("reloaded tracker does not skip the auto-disabled model")
+	}
+
+	if _, err := store.DeleteFailure("flaky:free"); err != nil {
+		t.Fatalf("DeleteFailure() error = %v", err)
+	}
+	if NewPermanentFailureTracker(store).IsDisabled("org/flaky:free") {
+		t.Error("model still disabled after manual reset")
+	}
+}
+
+func TestAutoDisableRespectsThresholds(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true, AutoDisableMinAttempts: 4, AutoDisableFailureRate: 0.75}, upstream, "org/a:free")
+
+	for _, failed := range []bool{true, false, true, true} {
+		s.recordModelOutcome("org/a:free", failed)
+	}
+	if !s.permanentFails.IsDisabled("org/a:free") {
+		t.Fatal("model at 75% failure rate over 4 attempts was not disabled")
+	}
+
+	s.permanentFails.Disable("org/a:free", time.Now().Add(-time.Second))
+	if s.permanentFails.IsDisabled("org/a:free") {
+		t.Error("model still disabled after reprobe time passed")
+	}
+	for _, failed := range []bool{true, false, false, true} {
+		s.recordModelOutcome("org/a:free", failed)
+	}
+	if s.permanentFails.IsDisabled("org/a:free") {
+		t.Error("model at 50% failure rate was disabled")
+	}
+
+	off := newTestServer(t, Config{FreeMode: true}, upstream, "org/b:free")
+	for i := 0; i < 10; i++ {
+		off.recordModelOutcome("org/b:free", true)
+	}
+	if off.permanentFails.IsDisabled("org/b:free") {
+		t.Error("auto-disable should be off when AutoDisableMinAttempts is 0")
+	}
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+)
+
+// matchModelPattern 判断 path.Match 风格的通配符是否匹配模型的完整 ID 或显示名
+func matchModelPattern(pattern, model string) bool {
+	parts := strings.Split(model, "/")
+	displayName := parts[len(parts)-1]
+	if ok, _ := path.Match(pattern, model); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, displayName)
+	return ok
+}
+
+// baseModelFor 判断 /api/generate 请求的模型是否配置为基础（非指令）模型，是则返回完整模型 ID。
+// 免费模式的故障转移基于聊天接口，此时始终返回 false
+func (s *Server) baseModelFor(model string) (string, bool) {
+	if s.config.FreeMode || len(s.config.BaseModels) == 0 {
+		return "", false
+	}
+	fullModelName, err := s.provider.GetFullModelName(model)
+	if err != nil {
+		return "", false
+	}
+	for _, pattern := range s.config.BaseModels {
+		if matchModelPattern(pattern, fullModelName) {
+			return fullModelName, true
+		}
+	}
+	return "", false
+}
+
+// completionPrompt 构造发往 completions 接口的原始提示词，system 作为前缀
+func completionPrompt(req GenerateRequest) string {
+	if req.System == "" {
+		return req.Prompt
+	}
+	return req.System + "\n\n" + req.Prompt
+}
+
+// handleBaseGenerate 通过 completions 接口处理基础模型的 /api/generate，
+// 响应格式与聊天路径相同，但不返回 context
+func (s *Server) handleBaseGenerate(c *gin.Context, req GenerateRequest, options generateOptions, fullModelName string, startTime time.Time) {
+	request := openai.CompletionRequest{
+		Model:     fullModelName,
+		Prompt:    completionPrompt(req),
+		Suffix:    req.Suffix,
+		Stop:      options.Stop,
+		MaxTokens: options.MaxTokens,
+	}
+
+	if !s.streamRequested(req.Stream, true) {
+		response, err := s.provider.CreateCompletion(request)
+		if err != nil {
+			writeError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
+			return
+		}
+		if len(response.Choices) == 0 {
+			writeError(c, http.StatusInternalServerError, errors.New("No response"))
+			return
+		}
+
+		setGenerationID(c, response.ID)
+		endTime := time.Now()
+		durations := responseDurations(startTime, endTime)
+		c.JSON(http.StatusOK, GenerateResponse{
+			ID:                 requestID(c),
+			Model:              fullModelName,
+			CreatedAt:          endTime.Format(time.RFC3339),
+			Response:           response.Choices[0].Text,
+			Done:               true,
+			DoneReason:         ollamaDoneReason(response.Choices[0].FinishReason),
+			TotalDuration:      durations.Total,
+			PromptEvalCount:    response.Usage.PromptTokens,
+			PromptEvalDuration: durations.PromptEval,
+			EvalCount:          response.Usage.CompletionTokens,
+			EvalDuration:       durations.Eval,
+		})
+		return
+	}
+
+	stream, err := s.provider.CreateCompletionStream(request)
+	if err != nil {
+		writeError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+	defer stream.Close()
+
+	c.Writer.Header().Set("Content-Type", "application/x-ndjson")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		writeError(c, http.StatusInternalServerError, errors.New("Streaming not supported"))
+		return
+	}
+
+	var firstTokenAt time.Time
+	evalCount := 0
+	doneReason := "stop"
+	for {
+		response, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		setGenerationID(c, response.ID)
+		if len(response.Choices) == 0 {
+			continue
+		}
+		if reason := response.Choices[0].FinishReason; reason != "" {
+			doneReason = ollamaDoneReason(reason)
+		}
+		if response.Choices[0].Text != "" && firstTokenAt.IsZero() {
+			firstTokenAt = time.Now()
+		}
+		evalCount++
+
+		jsonData, _ := json.Marshal(GenerateResponse{
+			Model:     fullModelName,
+			CreatedAt: time.Now().Format(time.RFC3339),
+			Response:  response.Choices[0].Text,
+		})
+		fmt.Fprintf(c.Writer, "%s\n", jsonData)
+		flusher.Flush()
+	}
+
+	endTime := time.Now()
+	durations := streamDurations(startTime, firstTokenAt, endTime)
+	jsonData, _ := json.Marshal(GenerateResponse{
+		ID:                 requestID(c),
+		Model:              fullModelName,
+		CreatedAt:          endTime.Format(time.RFC3339),
+		Done:               true,
+		DoneReason:         doneReason,
+		TotalDuration:      durations.Total,
+		PromptEvalDuration: durations.PromptEval,
+		EvalCount:          evalCount,
+		EvalDuration:       durations.Eval,
+	})
+	fmt.Fprintf(c.Writer, "%s\n", jsonData)
+	flusher.Flush()
+}
+
+// ollamaDoneReason 将上游的 finish_reason 转换为 Ollama 的 done_reason（stop、length、tool_calls），
+// 旧式的 function_call 归为 tool_calls，其余均视为 stop
+func ollamaDoneReason(reason string) string {
+	switch openai.FinishReason(reason) {
+	case openai.FinishReasonLength:
+		return "length"
+	case openai.FinishReasonToolCalls, openai.FinishReasonFunctionCall:
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// CreateCompletion 通过 completions 接口发送原始文本补全请求，用于基础（非指令）模型
+func (o *OpenrouterProvider) CreateCompletion(req openai.CompletionRequest) (openai.CompletionResponse, error) {
+	req.Stream = false
+	req.Prompt = o.scrubPrompt(req.Prompt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.chatTimeout)
+	defer cancel()
+	resp, err := o.client.CreateCompletion(ctx, req)
+	if err != nil {
+		return openai.CompletionResponse{}, wrapUpstreamError("completion failed", err)
+	}
+	return resp, nil
+}
+
+// CompletionStream 是 completions 接口流式响应的抽象
+type CompletionStream interface {
+	Recv() (openai.CompletionResponse, error)
+	Close() error
+}
+
+// CreateCompletionStream 发送流式原始文本补全请求，超时规则与 CreateChatStream 相同
+func (o *OpenrouterProvider) CreateCompletionStream(req openai.CompletionRequest) (CompletionStream, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if o.streamTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), o.streamTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	req.Stream = true
+	req.Prompt = o.scrubPrompt(req.Prompt)
+	stream, err := o.client.CreateCompletionStream(ctx, req)
+	if err != nil {
+		cancel()
+		return nil, wrapUpstreamError("completion stream creation failed", err)
+	}
+	return &closingCompletionStream{CompletionStream: stream, cleanup: cancel}, nil
+}
+
+// closingCompletionStream 在关闭底层流后取消请求上下文
+type closingCompletionStream struct {
+	CompletionStream
+	once    sync.Once
+	cleanup func()
+}
+
+func (s *closingCompletionStream) Close() error {
+	err := s.CompletionStream.Close()
+	s.once.Do(s.cleanup)
+	return err
+}
+
+// scrubPrompt 在配置了脱敏规则时对字符串提示词脱敏
+func (o *OpenrouterProvider) scrubPrompt(prompt any) any {
+	text, ok := prompt.(string)
+	if !ok || o.scrubber == nil {
+		return prompt
+	}
+	scrubbed, _ := o.scrubber.scrubText(text)
+	return scrubbed
+}
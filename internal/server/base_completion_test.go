@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// handleCompletions 让假上游响应 /completions，并返回记录请求体的函数
+func handleCompletions(upstream *fakeUpstream) func() []map[string]interface{} {
+	var mu sync.Mutex
+	var requests []map[string]interface{}
+	upstream.Config.Handler.(*http.ServeMux).HandleFunc("/completions", func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		json.Unmarshal(raw, &body)
+		mu.Lock()
+		requests = append(requests, body)
+		mu.Unlock()
+
+		model, _ := body["model"].(string)
+		if stream, _ := body["stream"].(bool); stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, text := range []string{"once upon", " a time"} {
+				fmt.Fprintf(w, `data: {"id":"gen-base","object":"text_completion","model":%q,"choices":[{"index":0,"text":%q}]}`+"\n\n", model, text)
+			}
+			fmt.Fprintf(w, `data: {"id":"gen-base","object":"text_completion","model":%q,"choices":[{"index":0,"text":"","finish_reason":"length"}]}`+"\n\n", model)
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"gen-base","object":"text_completion","model":%q,"choices":[{"index":0,"text":"once upon a time","finish_reason":"stop"}],"usage":{"prompt_tokens":4,"completion_tokens":4,"total_tokens":8}}`, model)
+	})
+	return func() []map[string]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]map[string]interface{}(nil), requests...)
+	}
+}
+
+func TestGenerateUsesCompletionsForBaseModels(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/llama-base"}, fakeModel{ID: "org/llama-instruct"})
+			completions := handleCompletions(upstream)
+			s := newTestServer(t, Config{BaseModels: []string{"*-base"}}, upstream)
+			r := s.buildRouter()
+
+			body := fmt.Sprintf(`{"model":"llama-base","stream":%v,"system":"A story.","prompt":"Once","suffix":"The end."}`, stream)
+			w := doJSON(t, r, http.MethodPost, "/api/generate", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), "once upon") {
+				t.Errorf("body = %s, want the completion text", w.Body.String())
+			}
+
+			got := completions()
+			if len(got) != 1 {
+				t.Fatalf("completions requests = %d, want 1", len(got))
+			}
+			if got[0]["prompt"] != "A story.\n\nOnce" || got[0]["suffix"] != "The end." || got[0]["model"] != "org/llama-base" {
+				t.Errorf("completion request = %v", got[0])
+			}
+			if models := upstream.requestedModels(); len(models) != 0 {
+				t.Errorf("chat requests = %v, want none for a base model", models)
+			}
+
+			if w := doJSON(t, r, http.MethodPost, "/api/generate", `{"model":"llama-instruct","stream":false,"prompt":"hi"}`); w.Code != http.StatusOK {
+				t.Fatalf("instruct status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if models := upstream.requestedModels(); len(models) != 1 || models[0] != "org/llama-instruct" {
+				t.Errorf("chat requests = %v, want the instruct model wrapped as chat", models)
+			}
+		})
+	}
+}
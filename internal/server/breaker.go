@@ -0,0 +1,182 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errCircuitOpen 是熔断器打开期间快速拒绝请求时返回的错误
+var errCircuitOpen = errors.New("upstream circuit breaker is open, try again later")
+
+// 熔断器的默认统计窗口和打开时长
+const (
+	DefaultCircuitBreakerWindow   = time.Minute
+	DefaultCircuitBreakerCooldown = 30 * time.Second
+)
+
+// 熔断器状态
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// circuitBreaker 统计发往 OpenRouter 的连续失败（不区分模型）。窗口内连续失败达到 threshold 次后打开，
+// 冷却期内快速拒绝新请求；冷却期结束后半开，只放行一个探测请求，
+// 探测成功则关闭，失败则重新打开
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	now       func() time.Time
+
+	state        string
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	// probeStarted 为半开状态下放行探测请求的时间，零值表示尚未放行
+	probeStarted time.Time
+}
+
+// newCircuitBreaker 创建熔断器，threshold 不大于 0 时返回 nil 表示不熔断；
+// window 和 cooldown 不大于 0 时使用默认值
+func newCircuitBreaker(threshold int, window, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	if window <= 0 {
+		window = DefaultCircuitBreakerWindow
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultCircuitBreakerCooldown
+	}
+	return &circuitBreaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     circuitClosed,
+	}
+}
+
+// allow 判断是否放行新请求，拒绝时返回距离可以重试的时间。
+// 半开状态只放行一个探测请求；探测请求在一个冷却期内没有产生结果（如未访问上游）时再放行下一个
+func (b *circuitBreaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	switch b.state {
+	case circuitOpen:
+		if wait := b.openedAt.Add(b.cooldown).Sub(now); wait > 0 {
+			return false, wait
+		}
+		b.state = circuitHalfOpen
+		b.probeStarted = now
+		slog.Info("circuit breaker half-open, probing upstream")
+		return true, 0
+	case circuitHalfOpen:
+		if wait := b.probeStarted.Add(b.cooldown).Sub(now); wait > 0 {
+			return false, wait
+		}
+		b.probeStarted = now
+		return true, 0
+	}
+	return true, 0
+}
+
+// isOpen 判断熔断器是否处于打开状态，故障转移据此提前停止尝试剩余模型
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == circuitOpen
+}
+
+// recordSuccess 记录一次上游成功，关闭熔断器并清零失败计数
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != circuitClosed {
+		slog.Info("circuit breaker closed, upstream recovered")
+	}
+	b.state = circuitClosed
+	b.failures = 0
+}
+
+// recordFailure 记录一次上游失败。半开时直接重新打开；关闭时超出窗口的旧失败不再计入
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	switch b.state {
+	case circuitHalfOpen:
+		b.open(now)
+		return
+	case circuitOpen:
+		return
+	}
+
+	if b.failures == 0 || now.Sub(b.firstFailure) > b.window {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.open(now)
+	}
+}
+
+func (b *circuitBreaker) open(now time.Time) {
+	b.state = circuitOpen
+	b.openedAt = now
+	b.failures = 0
+	slog.Warn("circuit breaker opened after consecutive upstream failures", "cooldown", b.cooldown)
+}
+
+// breakerTransport 把每次发往 OpenRouter 的 HTTP 请求结果计入熔断器：网络错误和 5xx 计为失败，
+// 其他响应（包括 4xx 和 429，说明上游仍在正常处理请求）计为成功。客户端取消的请求不计入
+type breakerTransport struct {
+	base    http.RoundTripper
+	breaker *circuitBreaker
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil:
+		if req.Context().Err() == nil || isTimeoutError(err) {
+			t.breaker.recordFailure()
+		}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		t.breaker.recordFailure()
+	default:
+		t.breaker.recordSuccess()
+	}
+	return resp, err
+}
+
+// circuitMiddleware 在熔断器打开时以 503 快速拒绝聊天、生成和嵌入请求，并通过 Retry-After 告知冷却剩余秒数
+func (s *Server) circuitMiddleware(c *gin.Context) {
+	if s.breaker == nil {
+		c.Next()
+		return
+	}
+
+	if ok, wait := s.breaker.allow(); !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(c, http.StatusServiceUnavailable, errCircuitOpen)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestBreaker 创建使用可控时钟的熔断器
+func newTestBreaker(threshold int) (*circuitBreaker, *time.Time) {
+	b := newCircuitBreaker(threshold, time.Minute, 30*time.Second)
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b, now := newTestBreaker(3)
+
+	b.recordFailure()
+	b.recordFailure()
+	b.recordSuccess()
+	b.recordFailure()
+	b.recordFailure()
+	if b.isOpen() {
+		t.Fatal("breaker opened although failures were not consecutive")
+	}
+
+	b.recordFailure()
+	if !b.isOpen() {
+		t.Fatal("breaker not open after 3 consecutive failures")
+	}
+	ok, wait := b.allow()
+	if ok || wait != 30*time.Second {
+		t.Fatalf("allow() = %v, %v while open; want false, 30s", ok, wait)
+	}
+
+	*now = now.Add(10 * time.Second)
+	if _, wait := b.allow(); wait != 20*time.Second {
+		t.Errorf("remaining cooldown = %v, want 20s", wait)
+	}
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	b, now := newTestBreaker(2)
+	b.recordFailure()
+	*now = now.Add(2 * time.Minute)
+	b.recordFailure()
+	if b.isOpen() {
+		t.Fatal("failures outside the window should not open the breaker")
+	}
+	b.recordFailure()
+	if !b.isOpen() {
+		t.Fatal("two failures within the window should open the breaker")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	t.Run("success closes", func(t *testing.T) {
+		b, now := newTestBreaker(1)
+		b.recordFailure()
+		*now = now.Add(30 * time.Second)
+
+		if ok, _ := b.allow(); !ok {
+			t.Fatal("probe not allowed after cooldown")
+		}
+		if ok, _ := b.allow(); ok {
+			t.Fatal("second request allowed while the probe is in flight")
+		}
+		b.recordSuccess()
+		if ok, _ := b.allow(); !ok || b.state != circuitClosed {
+			t.Fatalf("breaker state = %s after successful probe, want closed", b.state)
+		}
+	})
+
+	t.Run("failure re-opens", func(t *testing.T) {
+		b, now := newTestBreaker(1)
+		b.recordFailure()
+		*now = now.Add(30 * time.Second)
+
+		if ok, _ := b.allow(); !ok {
+			t.Fatal("probe not allowed after cooldown")
+		}
+		b.recordFailure()
+		if !b.isOpen() {
+			t.Fatal("breaker not re-opened after failed probe")
+		}
+		if ok, wait := b.allow(); ok || wait != 30*time.Second {
+			t.Fatalf("allow() = %v, %v after failed probe; want a fresh 30s cooldown", ok, wait)
+		}
+	})
+}
+
+func TestCircuitBreakerFastFailsRequests(t *testing.T) {
+	var healthy atomic.Bool
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		if !healthy.Load() {
+			writeUpstreamError(w, http.StatusBadGateway, "upstream down")
+			return
+		}
+		writeChatCompletion(w, "org/model-a", "back")
+	}
+	s := newTestServer(t, Config{CircuitBreakerThreshold: 2, CircuitBreakerCooldown: 30 * time.Second}, upstream)
+	r := s.buildRouter()
+	now := time.Now()
+	s.breaker.now = func() time.Time { return now }
+
+	body := `{"model":"org/model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	for i := 0; i < 2; i++ {
+		if w := doJSON(t, r, http.MethodPost, "/api/chat", body); w.Code == http.StatusOK {
+			t.Fatalf("request %d succeeded against a failing upstream", i)
+		}
+	}
+	calls := len(upstream.requestedModels())
+
+	w := doJSON(t, r, http.MethodPost, "/v1/chat/completions", body)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "30" {
+		t.Fatalf("open breaker: status = %d, Retry-After = %q; want 503, 30", w.Code, w.Header().Get("Retry-After"))
+	}
+	if got := len(upstream.requestedModels()); got != calls {
+		t.Errorf("upstream called %d more times while the breaker was open", got-calls)
+	}
+
+	healthy.Store(true)
+	now = now.Add(30 * time.Second)
+	if w := doJSON(t, r, http.MethodPost, "/api/chat", body); w.Code != http.StatusOK {
+		t.Fatalf("probe request: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(t, r, http.MethodPost, "/api/chat", body); w.Code != http.StatusOK {
+		t.Errorf("request after recovery: status = %d", w.Code)
+	}
+}
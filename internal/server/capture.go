@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CaptureRecord 是捕获日志中的一行，记录一次 /api/* 或 /v1/* 请求的计费相关信息
+type CaptureRecord struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMS int64     `json:"duration_ms"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int       `json:"bytes_out"`
+	// Response 为流式聊天/生成响应拼接后的文本，超过上限时截断并设置 Truncated
+	Response  string `json:"response,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	// ClientDisconnected 表示客户端中途断开，Response 由后台继续读取上游流得到
+	ClientDisconnected bool `json:"client_disconnected,omitempty"`
+}
+
+// captureLog 以 JSON Lines 格式追加写入请求记录，按 rate 对请求采样
+type captureLog struct {
+	mu   sync.Mutex
+	w    io.Writer
+	rate float64
+	file *os.File
+}
+
+// openCaptureLog 以追加方式打开 path 作为捕获日志
+func openCaptureLog(path string, rate float64) (*captureLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l := newCaptureLog(f, rate)
+	l.file = f
+	return l, nil
+}
+
+// newCaptureLog 创建写入 w 的捕获日志，rate 超出 0–1 时截断到该范围
+func newCaptureLog(w io.Writer, rate float64) *captureLog {
+	return &captureLog{w: w, rate: math.Max(0, math.Min(1, rate))}
+}
+
+// sampled 判断请求是否被采样。按请求 ID 的哈希决定，同一个请求 ID 的结果总是相同，
+// 客户端重放同一 X-Request-Id 时不会出现有时记录、有时不记录的情况
+func (l *captureLog) sampled(requestID string) bool {
+	switch {
+	case l.rate >= 1:
+		return true
+	case l.rate <= 0:
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(requestID))
+	return float64(h.Sum32())/float64(math.MaxUint32+1) < l.rate
+}
+
+func (l *captureLog) write(rec CaptureRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		slog.Warn("failed to write capture log", "error", err)
+	}
+}
+
+func (l *captureLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// captureMiddleware 在请求结束后把被采样的 /api/* 和 /v1/* 请求写入捕获日志
+func (s *Server) captureMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	if !requiresAuth(c.Request.URL.Path) {
+		return
+	}
+	id := requestID(c)
+	if !s.capture.sampled(id) || c.GetBool(captureDetachedKey) {
+		return
+	}
+	s.capture.write(CaptureRecord{
+		Time:       start.UTC(),
+		RequestID:  id,
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		Status:     c.Writer.Status(),
+		DurationMS: time.Since(start).Milliseconds(),
+		BytesIn:    c.Request.ContentLength,
+		BytesOut:   c.Writer.Size(),
+		Response:   c.GetString(captureResponseKey),
+	})
+}
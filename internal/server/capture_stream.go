@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 捕获流式响应内容的上限。客户端断开后后台继续读取上游时同样受此限制，
+// 避免客户端离开后无限消耗 token
+const (
+	captureMaxResponseBytes = 256 << 10
+	captureDrainMaxDuration = 2 * time.Minute
+)
+
+// gin.Context 中传递给 captureMiddleware 的键
+const (
+	// captureResponseKey 保存流式响应拼接后的文本
+	captureResponseKey = "capture_response"
+	// captureDetachedKey 表示捕获记录改由后台读取完上游流后写入，中间件不再写入
+	captureDetachedKey = "capture_detached"
+)
+
+// streamCapture 累积一次被采样的流式请求的响应文本。客户端中途断开时，
+// 把上游流移交给后台 goroutine 读取到结束（受上限约束），再写入完整的捕获记录
+type streamCapture struct {
+	s     *Server
+	c     *gin.Context
+	start time.Time
+
+	text      strings.Builder
+	truncated bool
+	detached  atomic.Bool
+}
+
+// newStreamCapture 在捕获日志开启且请求被采样时返回 streamCapture，否则返回 nil；
+// nil 上的方法均为空操作
+func (s *Server) newStreamCapture(c *gin.Context) *streamCapture {
+	if s.capture == nil || !s.capture.sampled(requestID(c)) {
+		return nil
+	}
+	return &streamCapture{s: s, c: c, start: time.Now()}
+}
+
+// wrap 返回移交后 Close 为空操作的流，使处理函数中的 defer stream.Close() 不会关闭后台仍在读取的流
+func (sc *streamCapture) wrap(stream ChatStream) ChatStream {
+	if sc == nil {
+		return stream
+	}
+	return &detachableStream{ChatStream: stream, detached: &sc.detached}
+}
+
+// add 记录一个分块的文本内容，超过 captureMaxResponseBytes 的部分丢弃并标记为截断
+func (sc *streamCapture) add(chunk ChatChunk) {
+	if sc == nil || len(chunk.Choices) == 0 {
+		return
+	}
+	content := chunk.Choices[0].Delta.Content
+	if remaining := captureMaxResponseBytes - sc.text.Len(); len(content) > remaining {
+		content = content[:max(remaining, 0)]
+		sc.truncated = true
+	}
+	sc.text.WriteString(content)
+}
+
+// finish 在流正常结束时把响应文本交给 captureMiddleware
+func (sc *streamCapture) finish() {
+	if sc == nil {
+		return
+	}
+	sc.c.Set(captureResponseKey, sc.text.String())
+}
+
+// detachOnDisconnect 在客户端已断开时把上游流移交给后台读取并返回 true，调用方应立即返回
+func (sc *streamCapture) detachOnDisconnect(stream ChatStream) bool {
+	if sc == nil || sc.c.Request.Context().Err() == nil {
+		return false
+	}
+
+	// gin.Context 在处理函数返回后会被复用，先复制后台写入记录需要的字段
+	rec := CaptureRecord{
+		Time:               sc.start.UTC(),
+		RequestID:          requestID(sc.c),
+		Method:             sc.c.Request.Method,
+		Path:               sc.c.Request.URL.Path,
+		Status:             sc.c.Writer.Status(),
+		BytesIn:            sc.c.Request.ContentLength,
+		BytesOut:           sc.c.Writer.Size(),
+		ClientDisconnected: true,
+	}
+	sc.c.Set(captureDetachedKey, true)
+	sc.detached.Store(true)
+
+	inner := stream
+	if d, ok := stream.(*detachableStream); ok {
+		inner = d.ChatStream
+	}
+	// 后台读取仍在消耗上游，继续占用请求的并发槽位，读取结束后再释放
+	release, _ := sc.c.Value(inflightReleaseKey).(func())
+	sc.s.captureDrains.Add(1)
+	go func() {
+		defer sc.s.captureDrains.Done()
+		if release != nil {
+			defer release()
+		}
+		sc.drain(inner, rec)
+	}()
+	return true
+}
+
+// waitCaptureDrains 等待后台捕获读取全部结束，ctx 先到期时返回 false
+func (s *Server) waitCaptureDrains(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		s.captureDrains.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// drain 读取上游流直到结束、出错、内容达到上限或超过 captureDrainMaxDuration，然后写入捕获记录
+func (sc *streamCapture) drain(stream ChatStream, rec CaptureRecord) {
+	timer := time.AfterFunc(captureDrainMaxDuration, func() { stream.Close() })
+	defer timer.Stop()
+	defer stream.Close()
+
+	for !sc.truncated {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			slog.Warn("capture drain stopped", "request_id", rec.RequestID, "error", err)
+			sc.truncated = true
+			break
+		}
+		sc.add(chunk)
+	}
+
+	rec.DurationMS = time.Since(sc.start).Milliseconds()
+	rec.Response = sc.text.String()
+	rec.Truncated = sc.truncated
+	sc.s.capture.write(rec)
+}
+
+// detachableStream 在移交给后台后忽略 Close，由后台读取结束时关闭底层流
+type detachableStream struct {
+	ChatStream
+	detached *atomic.Bool
+}
+
+func (d *detachableStream) Close() error {
+	if d.detached.Load() {
+		return nil
+	}
+	return d.ChatStream.Close()
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// lockedBuffer 是可并发读写的 bytes.Buffer，后台捕获任务和测试会同时访问
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// disconnectingRecorder 在第一次写入响应后取消请求上下文，模拟客户端中途断开
+type disconnectingRecorder struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (d *disconnectingRecorder) Write(p []byte) (int, error) {
+	n, err := d.ResponseRecorder.Write(p)
+	d.cancel()
+	return n, err
+}
+
+// capturedRecords 解析捕获日志中的全部记录
+func capturedRecords(t *testing.T, log string) []CaptureRecord {
+	t.Helper()
+	var records []CaptureRecord
+	scanner := bufio.NewScanner(strings.NewReader(log))
+	scanner.Buffer(nil, 2*captureMaxResponseBytes)
+	for scanner.Scan() {
+		var rec CaptureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid capture line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestCaptureCompletesStreamAfterClientDisconnect(t *testing.T) {
+	for _, path := range []string{"/api/chat", "/api/generate", "/v1/chat/completions"} {
+		t.Run(path, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+				writeChatStream(w, "org/model-a", "one", " two", " three", " four")
+			}
+			s := newTestServer(t, Config{}, upstream)
+			var log lockedBuffer
+			s.capture = newCaptureLog(&log, 1)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			body := `{"model":"model-a","stream":true,"prompt":"hi","messages":[{"role":"user","content":"hi"}]}`
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)).WithContext(ctx)
+			req.Header.Set("Content-Type", "application/json")
+			w := &disconnectingRecorder{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+			s.buildRouter().ServeHTTP(w, req)
+
+			if strings.Contains(w.Body.String(), "four") {
+				t.Fatal("handler kept streaming to a disconnected client")
+			}
+
+			s.captureDrains.Wait()
+			records := capturedRecords(t, log.String())
+			if len(records) != 1 {
+				t.Fatalf("capture records = %d, want 1: %s", len(records), log.String())
+			}
+			rec := records[0]
+			if rec.Response != "one two three four" {
+				t.Errorf("captured response = %q, want the full generation", rec.Response)
+			}
+			if !rec.ClientDisconnected || rec.Truncated {
+				t.Errorf("record flags = disconnected %v, truncated %v", rec.ClientDisconnected, rec.Truncated)
+			}
+		})
+	}
+}
+
+func TestCaptureRecordsStreamedResponse(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+	var log lockedBuffer
+	s.capture = newCaptureLog(&log, 1)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+		`{"model":"model-a","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	records := capturedRecords(t, log.String())
+	if len(records) != 1 || records[0].Response != "hello world" || records[0].ClientDisconnected {
+		t.Errorf("records = %+v, want one record with the streamed text", records)
+	}
+}
+
+func TestCaptureDrainIsBounded(t *testing.T) {
+	s := &Server{}
+	var log lockedBuffer
+	s.capture = newCaptureLog(&log, 1)
+
+	chunk := strings.Repeat("x", 64<<10)
+	stream := &endlessStream{content: chunk}
+	sc := &streamCapture{s: s, start: time.Now()}
+	sc.drain(stream, CaptureRecord{RequestID: "req"})
+
+	records := capturedRecords(t, log.String())
+	if len(records) != 1 {
+		t.Fatalf("capture records = %d, want 1", len(records))
+	}
+	if !records[0].Truncated || len(records[0].Response) != captureMaxResponseBytes {
+		t.Errorf("response length = %d, truncated = %v, want capped at %d",
+			len(records[0].Response), records[0].Truncated, captureMaxResponseBytes)
+	}
+	if !stream.closed {
+		t.Error("drained stream was not closed")
+	}
+}
+
+// endlessStream 是永不结束的上游流，每个分块返回相同的内容
+type endlessStream struct {
+	content string
+	closed  bool
+}
+
+func (e *endlessStream) Recv() (ChatChunk, error) {
+	return ChatChunk{ChatCompletionStreamResponse: openai.ChatCompletionStreamResponse{
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Delta: openai.ChatCompletionStreamChoiceDelta{Content: e.content},
+		}},
+	}}, nil
+}
+
+func (e *endlessStream) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestCaptureDrainHoldsInflightSlot(t *testing.T) {
+	unblock := make(chan struct{})
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		first, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			Model:   "org/model-a",
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: "one"}}},
+		})
+		// 发送两个分块后阻塞：处理器写出第一个分块时客户端断开，读到第二个分块时移交给后台
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: %s\n\ndata: %s\n\n", first, first)
+		w.(http.Flusher).Flush()
+		<-unblock
+		writeChatStream(w, "org/model-a", " two")
+	}
+	var once sync.Once
+	release := func() { once.Do(func() { close(unblock) }) }
+	t.Cleanup(release)
+
+	s := newTestServer(t, Config{MaxConcurrentRequests: 1}, upstream)
+	var log lockedBuffer
+	s.capture = newCaptureLog(&log, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/api/chat",
+		strings.NewReader(`{"model":"model-a","stream":true,"messages":[{"role":"user","content":"hi"}]}`)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	s.buildRouter().ServeHTTP(&disconnectingRecorder{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}, req)
+
+	// 处理器已返回，但后台仍在读取上游，槽位不能提前释放
+	if n := len(s.inflight); n != 1 {
+		t.Fatalf("inflight slots in use during drain = %d, want 1", n)
+	}
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer shortCancel()
+	if s.waitCaptureDrains(shortCtx) {
+		t.Fatal("waitCaptureDrains() returned true while a drain was still running")
+	}
+
+	release()
+	if !s.waitCaptureDrains(context.Background()) {
+		t.Fatal("waitCaptureDrains() returned false after the drain finished")
+	}
+	if n := len(s.inflight); n != 0 {
+		t.Errorf("inflight slots in use after drain = %d, want 0", n)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCaptureSampleRate(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+	var buf bytes.Buffer
+	s.capture = newCaptureLog(&buf, 0.1)
+	r := s.buildRouter()
+
+	const total = 2000
+	for i := 0; i < total; i++ {
+		doJSON(t, r, http.MethodGet, "/api/tags", "", requestIDHeader, fmt.Sprintf("req-%d", i))
+	}
+	doJSON(t, r, http.MethodGet, "/health", "")
+
+	captured := 0
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var rec CaptureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid capture line %q: %v", scanner.Text(), err)
+		}
+		if rec.Path != "/api/tags" || rec.Status != http.StatusOK || rec.RequestID == "" {
+			t.Errorf("unexpected record %+v", rec)
+		}
+		captured++
+	}
+	if captured < total*7/100 || captured > total*13/100 {
+		t.Errorf("captured %d of %d requests, want about 10%%", captured, total)
+	}
+}
+
+func TestCaptureSamplingIsDeterministic(t *testing.T) {
+	l := newCaptureLog(&bytes.Buffer{}, 0.5)
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("req-%d", i)
+		if l.sampled(id) != l.sampled(id) {
+			t.Fatalf("sampled(%q) is not stable", id)
+		}
+	}
+	if !newCaptureLog(nil, 1).sampled("x") || newCaptureLog(nil, 0).sampled("x") {
+		t.Error("rates 1 and 0 should capture all and none")
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetFullModelNameCaseInsensitive(t *testing.T) {
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "org/model-a"},
+		fakeModel{ID: "Org/Model-B"},
+		fakeModel{ID: "org/model-b"},
+	)
+
+	provider := NewOpenrouterProvider("key", WithBaseURL(upstream.URL+"/"), WithCaseInsensitiveModels(true))
+	tests := []struct {
+		alias string
+		want  string
+	}{
+		{"ORG/Model-A", "org/model-a"},
+		{"MODEL-A", "org/model-a"},
+		// 大小写完全一致的完整 ID 优先
+		{"Org/Model-B", "Org/Model-B"},
+		{"org/model-b", "org/model-b"},
+	}
+	for _, tt := range tests {
+		got, err := provider.GetFullModelName(tt.alias)
+		if err != nil {
+			t.Fatalf("GetFullModelName(%q) error = %v", tt.alias, err)
+		}
+		if got != tt.want {
+			t.Errorf("GetFullModelName(%q) = %q, want %q", tt.alias, got, tt.want)
+		}
+	}
+
+	strict := NewOpenrouterProvider("key", WithBaseURL(upstream.URL+"/"))
+	if got, _ := strict.GetFullModelName("ORG/Model-A"); got != "ORG/Model-A" {
+		t.Errorf("case-sensitive GetFullModelName = %q, want the alias passed through", got)
+	}
+}
+
+func TestFreeModeChatResolvesDifferentlyCasedModel(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a:free"}, fakeModel{ID: "org/model-b:free"})
+	s := newTestServer(t, Config{FreeMode: true, CaseInsensitiveModels: true}, upstream,
+		"org/model-a:free", "org/model-b:free")
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+		`{"model":"Model-B:FREE","stream":false,"messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := upstream.requestedModels(); len(got) != 1 || got[0] != "org/model-b:free" {
+		t.Errorf("requested models = %v, want [org/model-b:free]", got)
+	}
+}
+
+func TestModelFilterIgnoreCase(t *testing.T) {
+	filter, err := ParseModelFilter(strings.NewReader("Gemma\nre:^LLAMA-\nmistral-*\n!FREE"))
+	if err != nil {
+		t.Fatalf("ParseModelFilter() error = %v", err)
+	}
+
+	if filter.Match("gemma-3-27b-it") {
+		t.Error("case-sensitive filter matched a differently-cased name")
+	}
+
+	filter.SetIgnoreCase(true)
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"gemma-3-27b-it", true},
+		{"llama-3.3-70b", true},
+		{"Mistral-7B", true},
+		{"gemma-3-27b-it:free", false},
+		{"qwen", false},
+	}
+	for _, tt := range tests {
+		if got := filter.Match(tt.name); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errClientRateLimited 是单个客户端超过每分钟请求数上限时返回的错误
+var errClientRateLimited = errors.New("client rate limit exceeded, try again later")
+
+// maxClientBuckets 为令牌桶数量的上限，超过时先清理已回满的桶，仍然超过时淘汰最久未使用的桶，
+// 避免大量不同 IP 占用内存
+const maxClientBuckets = 10000
+
+// clientBucket 是单个客户端的令牌桶
+type clientBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// clientLimiter 按客户端维护令牌桶：容量为每分钟请求数，按 rpm/60 每秒的速度补充。
+// 与限制上游请求的 GlobalRateLimiter 相互独立
+type clientLimiter struct {
+	mu      sync.Mutex
+	rpm     float64
+	buckets map[string]*clientBucket
+	now     func() time.Time
+}
+
+// newClientLimiter 创建每个客户端每分钟最多 rpm 个请求的限流器，rpm 不大于 0 时返回 nil 表示不限制
+func newClientLimiter(rpm int) *clientLimiter {
+	if rpm <= 0 {
+		return nil
+	}
+	return &clientLimiter{
+		rpm:     float64(rpm),
+		buckets: make(map[string]*clientBucket),
+		now:     time.Now,
+	}
+}
+
+// allow 为客户端消耗一个令牌；令牌不足时返回 false 以及下一个令牌可用前需要等待的时间
+func (l *clientLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxClientBuckets {
+			l.prune(now)
+		}
+		for len(l.buckets) >= maxClientBuckets {
+			l.evictOldest()
+		}
+		b = &clientBucket{tokens: l.rpm, last: now}
+		l.buckets[key] = b
+	}
+
+	perSecond := l.rpm / 60
+	b.tokens = math.Min(l.rpm, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune 删除到 now 时已经回满的令牌桶
+func (l *clientLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rpm/60 >= l.rpm {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// evictOldest 删除最久未使用的令牌桶
+func (l *clientLimiter) evictOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for key, b := range l.buckets {
+		if oldestKey == "" || b.last.Before(oldest) {
+			oldestKey, oldest = key, b.last
+		}
+	}
+	delete(l.buckets, oldestKey)
+}
+
+// clientKey 标识发起请求的客户端：按来源 IP 区分，携带经 ProxyAuthToken 校验的 Bearer 令牌时再加上令牌的哈希。
+// 所有客户端共用同一个 ProxyAuthToken，只按令牌区分会让它们共享同一份限额；
+// 未配置 ProxyAuthToken 时令牌可以随意伪造，不参与区分。
+// 来源 IP 只在请求来自 TrustedProxies 时才取自 X-Forwarded-For
+func (s *Server) clientKey(c *gin.Context) string {
+	ip := "ip:" + c.ClientIP()
+	if token := s.validatedToken(c); token != "" {
+		sum := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(sum[:8]) + "|" + ip
+	}
+	return ip
+}
+
+// validatedToken 返回请求中与 ProxyAuthToken 一致的 Bearer 令牌，未配置 ProxyAuthToken 或令牌不一致时返回空字符串
+func (s *Server) validatedToken(c *gin.Context) string {
+	token := bearerToken(c)
+	if s.config.ProxyAuthToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.ProxyAuthToken)) != 1 {
+		return ""
+	}
+	return token
+}
+
+// clientRateLimitMiddleware 在配置了 ClientRPM 时按客户端限制 /api/* 和 /v1/* 请求，
+// 超出时返回 429 并通过 Retry-After 告知需要等待的秒数
+func (s *Server) clientRateLimitMiddleware(c *gin.Context) {
+	if !requiresAuth(c.Request.URL.Path) {
+		c.Next()
+		return
+	}
+
+	ok, wait := s.clientLimiter.allow(s.clientKey(c))
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(c, http.StatusTooManyRequests, errClientRateLimited)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientRateLimitIsPerClient(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{ClientRPM: 2, TrustedProxies: []string{"192.0.2.0/24"}}, upstream)
+	r := s.buildRouter()
+
+	body := `{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	for i := 0; i < 2; i++ {
+		if w := doJSON(t, r, http.MethodPost, "/api/chat", body, "X-Forwarded-For", "203.0.113.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, body = %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	w := doJSON(t, r, http.MethodPost, "/v1/chat/completions", body, "X-Forwarded-For", "203.0.113.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("exhausted client status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+
+	// 来自可信代理的请求按 X-Forwarded-For 区分客户端
+	if w := doJSON(t, r, http.MethodPost, "/api/chat", body, "X-Forwarded-For", "203.0.113.2"); w.Code != http.StatusOK {
+		t.Fatalf("second client status = %d, want 200", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodGet, "/health", ""); w.Code != http.StatusOK {
+		t.Errorf("/health status = %d, want 200 regardless of client limit", w.Code)
+	}
+}
+
+func TestClientRateLimitIgnoresSpoofableKeys(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{ClientRPM: 1}, upstream)
+	r := s.buildRouter()
+
+	if w := doJSON(t, r, http.MethodGet, "/api/tags", "", "Authorization", "Bearer token-1"); w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d", w.Code)
+	}
+	// 未配置鉴权令牌时换用新的 Bearer 令牌、未配置可信代理时伪造 X-Forwarded-For 都不会得到新的配额
+	spoofs := [][]string{
+		{"Authorization", "Bearer token-2"},
+		{"X-Forwarded-For", "203.0.113.9"},
+	}
+	for _, headers := range spoofs {
+		if w := doJSON(t, r, http.MethodGet, "/api/tags", "", headers...); w.Code != http.StatusTooManyRequests {
+			t.Errorf("request with %v status = %d, want 429", headers, w.Code)
+		}
+	}
+}
+
+func TestClientRateLimitKeysByValidatedToken(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{ClientRPM: 1, ProxyAuthToken: "secret"}, upstream)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/tags", nil)
+	ipKey := s.clientKey(c)
+	c.Request.Header.Set("Authorization", "Bearer secret")
+	if key := s.clientKey(c); key == ipKey || !strings.HasPrefix(key, "token:") {
+		t.Errorf("clientKey() with the proxy token = %q, want a token key", key)
+	}
+	c.Request.Header.Set("Authorization", "Bearer wrong")
+	if key := s.clientKey(c); key != ipKey {
+		t.Errorf("clientKey() with an invalid token = %q, want %q", key, ipKey)
+	}
+}
+
+func TestClientRateLimitSeparatesClientsSharingToken(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{ClientRPM: 1, ProxyAuthToken: "secret", TrustedProxies: []string{"192.0.2.0/24"}}, upstream)
+	r := s.buildRouter()
+
+	auth := []string{"Authorization", "Bearer secret"}
+	first := append([]string{"X-Forwarded-For", "203.0.113.1"}, auth...)
+	second := append([]string{"X-Forwarded-For", "203.0.113.2"}, auth...)
+	if w := doJSON(t, r, http.MethodGet, "/api/tags", "", first...); w.Code != http.StatusOK {
+		t.Fatalf("first client status = %d", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/tags", "", first...); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("first client second request status = %d, want 429", w.Code)
+	}
+	// 同一个令牌的另一个客户端有自己的令牌桶
+	if w := doJSON(t, r, http.MethodGet, "/api/tags", "", second...); w.Code != http.StatusOK {
+		t.Errorf("second client with the same token status = %d, want 200", w.Code)
+	}
+}
+
+func TestClientLimiterCapsBuckets(t *testing.T) {
+	l := newClientLimiter(60)
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+
+	// 每个桶都刚消耗过令牌，prune 无法清理
+	for i := 0; i <= maxClientBuckets; i++ {
+		now = now.Add(time.Microsecond)
+		l.allow(fmt.Sprintf("client-%d", i))
+	}
+	if len(l.buckets) != maxClientBuckets {
+		t.Errorf("buckets = %d, want capped at %d", len(l.buckets), maxClientBuckets)
+	}
+	if _, ok := l.buckets["client-0"]; ok {
+		t.Error("oldest bucket was not evicted")
+	}
+}
+
+func TestClientRateLimitFallsBackToIP(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{ClientRPM: 1}, upstream)
+	r := s.buildRouter()
+
+	if w := doJSON(t, r, http.MethodGet, "/api/tags", ""); w.Code != http.StatusOK {
+		t.Fatalf("first anonymous request status = %d", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/tags", ""); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second anonymous request status = %d, want 429", w.Code)
+	}
+}
+
+func TestClientLimiterRefills(t *testing.T) {
+	l := newClientLimiter(60)
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 60; i++ {
+		if ok, _ := l.allow("k"); !ok {
+			t.Fatalf("request %d rejected within burst", i)
+		}
+	}
+	ok, wait := l.allow("k")
+	if ok || wait != time.Second {
+		t.Fatalf("allow = %v, %v; want false, 1s", ok, wait)
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.allow("k"); !ok {
+		t.Fatal("token not refilled after one second")
+	}
+	if newClientLimiter(0) != nil {
+		t.Error("newClientLimiter(0) should disable limiting")
+	}
+}
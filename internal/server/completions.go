@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// handleOpenAICompletions 处理 OpenAI 兼容的 /v1/completions 原始文本补全请求，直接转发到上游
+// completions 接口，不参与免费模型故障转移。免费模式下只接受免费模型和 DirectPaidModels 中的付费模型。
+// echo 为 true 时由代理把原始提示词拼接在补全文本前，不依赖上游是否支持该参数
+func (s *Server) handleOpenAICompletions(c *gin.Context) {
+	defer s.trackOutcome(c)()
+
+	var request openai.CompletionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		writeError(c, http.StatusBadRequest, errors.New("Invalid JSON"))
+		return
+	}
+	if request.Model == "" {
+		writeError(c, http.StatusBadRequest, errors.New("Model name is required"))
+		return
+	}
+	prompt, ok := request.Prompt.(string)
+	if !ok {
+		writeError(c, http.StatusBadRequest, errors.New("prompt must be a string"))
+		return
+	}
+
+	fullModelName, err := s.completionModel(c.Request.Context(), request.Model)
+	if err != nil {
+		writeError(c, resolveErrorStatus(err), err)
+		return
+	}
+
+	echo := request.Echo
+	request.Model = fullModelName
+	request.Echo = false
+
+	if !request.Stream {
+		response, err := s.provider.CreateCompletion(request)
+		if err != nil {
+			writeError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
+			return
+		}
+		setGenerationID(c, response.ID)
+		if echo {
+			for i := range response.Choices {
+				response.Choices[i].Text = prompt + response.Choices[i].Text
+			}
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	stream, err := s.provider.CreateCompletionStream(request)
+	if err != nil {
+		writeError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+	defer stream.Close()
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+
+	w := c.Writer
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return
+	}
+
+	// echo 时提示词只拼接到第一个带 choices 的分块
+	echoed := !echo
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintf(w, "data: [DONE]\n\n")
+			flusher.Flush()
+			break
+		}
+		if err != nil {
+			// 响应头已发出，以 SSE 错误事件告知客户端，并照常结束流
+			errorJSON, _ := json.Marshal(errorBody(c, upstreamErrorStatus(err, http.StatusBadGateway), err))
+			fmt.Fprintf(w, "data: %s\n\n", errorJSON)
+			fmt.Fprintf(w, "data: [DONE]\n\n")
+			flusher.Flush()
+			break
+		}
+		setGenerationID(c, response.ID)
+
+		if !echoed && len(response.Choices) > 0 {
+			response.Choices[0].Text = prompt + response.Choices[0].Text
+			echoed = true
+		}
+
+		jsonData, _ := json.Marshal(response)
+		fmt.Fprintf(w, "data: %s\n\n", jsonData)
+		flusher.Flush()
+	}
+}
+
+// errModelNotAllowed 表示免费模式下请求了既不是免费模型、也不在 DirectPaidModels 中的模型
+var errModelNotAllowed = errors.New("model is not available in free mode")
+
+// resolveErrorStatus 返回解析模型名失败时的状态码：名称有歧义为 400，免费模式下不允许的模型为 403，
+// 获取模型列表失败时按上游状态映射
+func resolveErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errAmbiguousModel):
+		return http.StatusBadRequest
+	case errors.Is(err, errModelNotAllowed):
+		return http.StatusForbidden
+	}
+	return upstreamErrorStatus(err, http.StatusBadGateway)
+}
+
+// completionModel 解析 /v1/completions 请求的模型。免费模式下与聊天路径的策略一致：
+// DirectPaidModels 中的付费模型直接使用，其余模型必须是当前可用的免费模型，否则返回 errModelNotAllowed
+func (s *Server) completionModel(ctx context.Context, model string) (string, error) {
+	if !s.config.FreeMode {
+		return s.resolveModel(ctx, model)
+	}
+	if paid, ok := s.directPaidModel(model); ok {
+		return paid, nil
+	}
+	fullModelName := s.resolveDisplayNameToFullModel(model)
+	if !s.contains(s.freeModelList(), fullModelName) {
+		return "", fmt.Errorf("%w: %s", errModelNotAllowed, model)
+	}
+	return fullModelName, nil
+}
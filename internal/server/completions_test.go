@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOpenAICompletionsEcho(t *testing.T) {
+	for _, echo := range []bool{false, true} {
+		t.Run(fmt.Sprintf("echo=%v", echo), func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/llama-base"})
+			completions := handleCompletions(upstream)
+			s := newTestServer(t, Config{}, upstream)
+
+			body := fmt.Sprintf(`{"model":"llama-base","prompt":"Tell me: ","echo":%v}`, echo)
+			w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/completions", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			var resp struct {
+				Choices []struct {
+					Text string `json:"text"`
+				} `json:"choices"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Choices) != 1 {
+				t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+			}
+			want := "once upon a time"
+			if echo {
+				want = "Tell me: " + want
+			}
+			if got := resp.Choices[0].Text; got != want {
+				t.Errorf("text = %q, want %q", got, want)
+			}
+
+			got := completions()
+			if len(got) != 1 || got[0]["model"] != "org/llama-base" {
+				t.Fatalf("completion requests = %v", got)
+			}
+			if e, _ := got[0]["echo"].(bool); e {
+				t.Error("echo was forwarded upstream")
+			}
+		})
+	}
+}
+
+func TestOpenAICompletionsStreamEcho(t *testing.T) {
+	for _, echo := range []bool{false, true} {
+		t.Run(fmt.Sprintf("echo=%v", echo), func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/llama-base"})
+			handleCompletions(upstream)
+			s := newTestServer(t, Config{}, upstream)
+
+			body := fmt.Sprintf(`{"model":"llama-base","prompt":"Tell me: ","stream":true,"echo":%v}`, echo)
+			w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/completions", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			var texts []string
+			for _, line := range strings.Split(w.Body.String(), "\n") {
+				data, ok := strings.CutPrefix(line, "data: ")
+				if !ok || data == "[DONE]" {
+					continue
+				}
+				var chunk struct {
+					Choices []struct {
+						Text string `json:"text"`
+					} `json:"choices"`
+				}
+				if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+					t.Fatalf("invalid chunk %q: %v", data, err)
+				}
+				texts = append(texts, chunk.Choices[0].Text)
+			}
+			if len(texts) == 0 {
+				t.Fatalf("no chunks in %s", w.Body.String())
+			}
+
+			want := "once upon"
+			if echo {
+				want = "Tell me: once upon"
+			}
+			if texts[0] != want {
+				t.Errorf("first chunk = %q, want %q", texts[0], want)
+			}
+			if got := strings.Join(texts, ""); strings.Count(got, "Tell me: ") > 1 {
+				t.Errorf("prompt echoed more than once: %q", got)
+			}
+		})
+	}
+}
+
+func TestOpenAICompletionsRejectsNonStringPrompt(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/llama-base"})
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/completions", `{"model":"llama-base","prompt":["a","b"]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestOpenAICompletionsFreeModePolicy(t *testing.T) {
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "org/base:free"},
+		fakeModel{ID: "org/paid", Prompt: "0.1", Completion: "0.1"},
+		fakeModel{ID: "org/allowed", Prompt: "0.1", Completion: "0.1"},
+	)
+	completions := handleCompletions(upstream)
+	s := newTestServer(t, Config{FreeMode: true, DirectPaidModels: []string{"org/allowed"}}, upstream, "org/base:free")
+
+	cases := []struct {
+		model string
+		code  int
+	}{
+		{"base:free", http.StatusOK},
+		{"org/allowed", http.StatusOK},
+		{"org/paid", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/completions", fmt.Sprintf(`{"model":%q,"prompt":"hi"}`, tc.model))
+		if w.Code != tc.code {
+			t.Errorf("model %s: status = %d, want %d (body %s)", tc.model, w.Code, tc.code, w.Body.String())
+		}
+	}
+	var models []string
+	for _, req := range completions() {
+		models = append(models, fmt.Sprint(req["model"]))
+	}
+	if want := "[org/base:free org/allowed]"; fmt.Sprint(models) != want {
+		t.Errorf("upstream models = %v, want %s", models, want)
+	}
+}
+
+func TestOpenAICompletionsAmbiguousModel(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "a/base"}, fakeModel{ID: "b/base"})
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/completions", `{"model":"base","prompt":"hi"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "ambiguous") {
+		t.Errorf("status = %d, body = %s; want 400 ambiguous", w.Code, w.Body.String())
+	}
+}
+
+func TestOpenAICompletionsStreamErrorEvent(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/llama-base"})
+	upstream.Config.Handler.(*http.ServeMux).HandleFunc("/completions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"gen-base","object":"text_completion","choices":[{"index":0,"text":"once"}]}`+"\n\n")
+		fmt.Fprint(w, "data: {broken\n\n")
+	})
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/completions", `{"model":"llama-base","prompt":"hi","stream":true}`)
+	body := w.Body.String()
+	if !strings.Contains(body, `"error"`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("stream body = %q, want an error event followed by [DONE]", body)
+	}
+}
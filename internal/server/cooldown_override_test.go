@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAdminCooldownOverride(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true, AdminEnabled: true, ProxyAuthToken: "secret"}, upstream, "org/a:free", "org/b:free")
+	r := s.buildRouter()
+	auth := []string{"Authorization", "Bearer secret"}
+
+	// 两个模型都在 10 分钟前失败过一次，超过了默认 5 分钟的冷却
+	for _, m := range []string{"org/a:free", "org/b:free"} {
+		s.failureStore.MarkFailure(m)
+	}
+	s.failureStore.db.Exec(`UPDATE failures SET failed_at=?`, time.Now().Add(-10*time.Minute).Unix())
+
+	if w := doJSON(t, r, http.MethodPost, "/api/admin/cooldown", `{"model":"org/a:free","minutes":30}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated status = %d, want 401", w.Code)
+	}
+	w := doJSON(t, r, http.MethodPost, "/api/admin/cooldown", `{"model":"org/a:free","minutes":30}`, auth...)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	if skip, err := s.failureStore.ShouldSkip("org/a:free"); err != nil || !skip {
+		t.Errorf("ShouldSkip(org/a:free) = %v, %v, want true with a 30m override", skip, err)
+	}
+	if skip, _ := s.failureStore.ShouldSkip("org/b:free"); skip {
+		t.Error("override leaked to org/b:free")
+	}
+	records, err := s.failureStore.ListFailures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records {
+		if rec.Model == "org/a:free" && (rec.Remaining < 19*time.Minute || rec.Remaining > 20*time.Minute) {
+			t.Errorf("remaining cooldown = %v, want about 20m", rec.Remaining)
+		}
+	}
+
+	if w := doJSON(t, r, http.MethodPost, "/api/admin/cooldown", `{"model":"org/a:free","minutes":0}`, auth...); w.Code != http.StatusOK {
+		t.Fatalf("remove status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if skip, _ := s.failureStore.ShouldSkip("org/a:free"); skip {
+		t.Error("model still skipped after the override was removed")
+	}
+	if _, ok, _ := s.failureStore.CooldownOverride("org/a:free"); ok {
+		t.Error("override row survived minutes=0")
+	}
+}
+
+func TestAdminCooldownValidation(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true, AdminEnabled: true}, upstream, "org/a:free")
+	r := s.buildRouter()
+
+	for _, body := range []string{`{"minutes":5}`, `{"model":"org/a:free"}`, `{"model":"org/a:free","minutes":-1}`} {
+		if w := doJSON(t, r, http.MethodPost, "/api/admin/cooldown", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestCooldownOverridePersists(t *testing.T) {
+	path := t.TempDir() + "/failures.db"
+	store, err := NewFailureStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetCooldownOverride("org/a:free", 45); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = NewFailureStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if got, ok, err := store.CooldownOverride("org/a:free"); err != nil || !ok || got != 45*time.Minute {
+		t.Errorf("CooldownOverride() = %v, %v, %v, want 45m after reopening", got, ok, err)
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+)
+
+// dedupeStream 丢弃与上一个分块 choices 完全相同的连续分块，用于应对个别上游重复发送分块的故障。
+// 模型确实连续输出相同片段（如 "ha" "ha"）时也会被合并，因此需通过配置显式开启
+type dedupeStream struct {
+	ChatStream
+	model   string
+	last    []byte
+	dropped int
+}
+
+// dedupeChunks 在开启 DedupeStreamChunks 时为流加上去重
+func (s *Server) dedupeChunks(stream ChatStream, model string) ChatStream {
+	if !s.config.DedupeStreamChunks {
+		return stream
+	}
+	return &dedupeStream{ChatStream: stream, model: model}
+}
+
+func (d *dedupeStream) Recv() (ChatChunk, error) {
+	for {
+		chunk, err := d.ChatStream.Recv()
+		if err != nil {
+			return chunk, err
+		}
+		key, _ := json.Marshal(chunk.Choices)
+		if d.last != nil && string(key) == string(d.last) && chunkHasDelta(chunk) {
+			d.dropped++
+			continue
+		}
+		d.last = key
+		return chunk, nil
+	}
+}
+
+func (d *dedupeStream) Close() error {
+	if d.dropped > 0 {
+		slog.Warn("dropped duplicate stream chunks", "model", d.model, "count", d.dropped)
+	}
+	return d.ChatStream.Close()
+}
+
+// chunkHasDelta 判断分块是否携带文本或工具调用增量，只有这类分块重复时才会影响输出
+func chunkHasDelta(chunk ChatChunk) bool {
+	return chunkHasContent(chunk) || chunkHasToolCall(chunk)
+}
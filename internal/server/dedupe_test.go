@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDedupeStreamChunks(t *testing.T) {
+	tests := []struct {
+		path    string
+		enabled bool
+		want    string
+	}{
+		{"/v1/chat/completions", true, "Hello world!"},
+		{"/v1/chat/completions", false, "Hello world world!"},
+		{"/api/chat", true, "Hello world!"},
+		{"/api/generate", true, "Hello world!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s enabled=%v", tt.path, tt.enabled), func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+				writeChatStream(w, "org/model-a", "Hello", " world", " world", "!")
+			}
+			s := newTestServer(t, Config{DedupeStreamChunks: tt.enabled}, upstream)
+
+			body := `{"model":"model-a","stream":true,"prompt":"hi","messages":[{"role":"user","content":"hi"}]}`
+			w := doJSON(t, s.buildRouter(), http.MethodPost, tt.path, body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if got := streamedText(t, w.Body.String()); got != tt.want {
+				t.Errorf("streamed text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// streamedText 拼接 SSE 或 NDJSON 流中各分块的文本增量
+func streamedText(t *testing.T, body string) string {
+	t.Helper()
+
+	var text strings.Builder
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "data: ")
+		if line == "" || line == "[DONE]" {
+			continue
+		}
+		var frame struct {
+			Response string `json:"response"`
+			Message  struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(line), &frame); err != nil {
+			t.Fatalf("decode frame %q: %v", line, err)
+		}
+		text.WriteString(frame.Response + frame.Message.Content)
+		for _, c := range frame.Choices {
+			text.WriteString(c.Delta.Content)
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOllamaDoneReason(t *testing.T) {
+	cases := map[string]string{
+		"":               "stop",
+		"stop":           "stop",
+		"length":         "length",
+		"tool_calls":     "tool_calls",
+		"function_call":  "tool_calls",
+		"content_filter": "stop",
+	}
+	for reason, want := range cases {
+		if got := ollamaDoneReason(reason); got != want {
+			t.Errorf("ollamaDoneReason(%q) = %q, want %q", reason, got, want)
+		}
+	}
+}
+
+func TestNonStreamingGenerateDoneReason(t *testing.T) {
+	for _, reason := range []string{"stop", "length", "tool_calls"} {
+		t.Run(reason, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"id":"gen-test","model":"org/model-a","choices":[{"index":0,"message":{"role":"assistant","content":"partial"},"finish_reason":%q}]}`, reason)
+			}
+			s := newTestServer(t, Config{}, upstream)
+
+			w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/generate",
+				`{"model":"model-a","prompt":"hi","stream":false}`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			var resp GenerateResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.DoneReason != reason {
+				t.Errorf("done_reason = %q, want %q", resp.DoneReason, reason)
+			}
+		})
+	}
+}
+
+func TestNonStreamingGenerateEmptyChoices(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"gen-test","model":"org/model-a","choices":[]}`)
+	}
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/generate",
+		`{"model":"model-a","prompt":"hi","stream":false}`)
+	// gin.Recovery 也会把 panic 转成 500，因此同时检查错误信息
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "No response") {
+		t.Errorf("status = %d, body = %s; want 500 No response for an empty choices array", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import "time"
+
+// generationDurations 是 Ollama 响应中的耗时字段（纳秒），prompt_eval_duration 与 eval_duration 之和为 total_duration
+type generationDurations struct {
+	Total      int64
+	PromptEval int64
+	Eval       int64
+}
+
+// streamDurations 返回流式生成的耗时：以首个内容分块到达的时间为界，之前计为提示词处理，之后计为生成。
+// 没有内容分块（firstToken 为零值）时全部计为提示词处理
+func streamDurations(start, firstToken, end time.Time) generationDurations {
+	if firstToken.IsZero() || firstToken.After(end) {
+		firstToken = end
+	}
+	if firstToken.Before(start) {
+		firstToken = start
+	}
+	return generationDurations{
+		Total:      end.Sub(start).Nanoseconds(),
+		PromptEval: firstToken.Sub(start).Nanoseconds(),
+		Eval:       end.Sub(firstToken).Nanoseconds(),
+	}
+}
+
+// responseDurations 返回非流式生成的耗时。非流式响应一次性到达，无法观测首个 token 的时间，
+// 也无法区分提示词处理和生成，因此 prompt_eval_duration 为 0，整个上游耗时计为生成
+func responseDurations(start, end time.Time) generationDurations {
+	total := end.Sub(start).Nanoseconds()
+	return generationDurations{Total: total, Eval: total}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestStreamDurationsSplitAtFirstToken(t *testing.T) {
+	start := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	end := start.Add(3 * time.Second)
+
+	got := streamDurations(start, start.Add(time.Second), end)
+	want := generationDurations{Total: int64(3 * time.Second), PromptEval: int64(time.Second), Eval: int64(2 * time.Second)}
+	if got != want {
+		t.Errorf("streamDurations() = %+v, want %+v", got, want)
+	}
+	// 没有内容分块时全部计为提示词处理
+	if got := streamDurations(start, time.Time{}, end); got.PromptEval != got.Total || got.Eval != 0 {
+		t.Errorf("streamDurations() without tokens = %+v", got)
+	}
+
+	// 非流式响应不按 token 比例拆分，整个上游耗时计为生成
+	got = responseDurations(start, end)
+	want = generationDurations{Total: int64(3 * time.Second), Eval: int64(3 * time.Second)}
+	if got != want {
+		t.Errorf("responseDurations() = %+v, want %+v", got, want)
+	}
+}
+
+func TestOllamaResponsesReportMeasuredDurations(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		time.Sleep(delay)
+		if body["stream"] != true {
+			time.Sleep(delay)
+			writeChatCompletion(w, "org/model-a", "hello")
+			return
+		}
+		// 首个分块之前和之后各等待 delay
+		w.Header().Set("Content-Type", "text/event-stream")
+		first, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			ID:      "gen-test",
+			Model:   "org/model-a",
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: "hel"}}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", first)
+		w.(http.Flusher).Flush()
+		time.Sleep(delay)
+		writeChatStream(w, "org/model-a", "lo")
+	}
+	s := newTestServer(t, Config{}, upstream)
+
+	for _, path := range []string{"/api/chat", "/api/generate"} {
+		for _, stream := range []bool{false, true} {
+			body := fmt.Sprintf(`{"model":"model-a","stream":%v,"prompt":"hi","messages":[{"role":"user","content":"hi"}]}`, stream)
+			w := doJSON(t, s.buildRouter(), http.MethodPost, path, body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s stream=%v: status = %d, body = %s", path, stream, w.Code, w.Body.String())
+			}
+			frames := streamFrames(t, w.Body.String())
+			final := frames[len(frames)-1]
+			total, _ := final["total_duration"].(float64)
+			promptEval, _ := final["prompt_eval_duration"].(float64)
+			eval, _ := final["eval_duration"].(float64)
+
+			if eval <= 0 || promptEval+eval != total {
+				t.Errorf("%s stream=%v: durations total=%v prompt_eval=%v eval=%v, want parts summing to total",
+					path, stream, total, promptEval, eval)
+			}
+			if !stream && promptEval != 0 {
+				t.Errorf("%s non-stream: prompt_eval_duration = %v, want 0", path, promptEval)
+			}
+			if total < float64(2*delay) {
+				t.Errorf("%s stream=%v: total_duration = %v, want at least %v", path, stream, total, 2*delay)
+			}
+			if stream && (promptEval < float64(delay) || eval < float64(delay)) {
+				t.Errorf("%s stream: prompt_eval=%v eval=%v, want each at least %v", path, promptEval, eval, delay)
+			}
+		}
+	}
+}
+
+func TestCachedChatOmitsDurations(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{ResponseCacheTTL: time.Minute}, upstream)
+	r := s.buildRouter()
+
+	body := `{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	for i, wantDurations := range []bool{true, false} {
+		w := doJSON(t, r, http.MethodPost, "/api/chat", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, body = %s", i, w.Code, w.Body.String())
+		}
+		frames := streamFrames(t, w.Body.String())
+		final := frames[len(frames)-1]
+		for _, field := range []string{"total_duration", "load_duration", "prompt_eval_duration", "eval_duration"} {
+			if _, ok := final[field]; ok != wantDurations {
+				t.Errorf("request %d: %s present = %v, want %v", i, field, ok, wantDurations)
+			}
+		}
+	}
+	if got := len(upstream.requestedModels()); got != 1 {
+		t.Errorf("upstream requests = %d, want 1", got)
+	}
+}
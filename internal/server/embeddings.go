@@ -0,0 +1,59 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// errNoEmbeddingModels 表示请求的模型不支持嵌入，且没有可用的备选嵌入模型
+var errNoEmbeddingModels = errors.New("no embedding models available")
+
+// isEmbeddingUnsupportedError 判断上游错误是否表示模型不支持嵌入（模型不存在、没有嵌入端点等）
+func isEmbeddingUnsupportedError(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch upstreamStatus(err) {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	}
+	if isPermanentError(err) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "embedding") &&
+		(strings.Contains(msg, "not support") || strings.Contains(msg, "unsupported"))
+}
+
+// embeddings 获取文本的嵌入向量，返回实际使用的模型。免费模式下请求的模型不支持嵌入时，
+// 依次尝试 EmbeddingModels 中的模型，全部失败时返回 errNoEmbeddingModels
+func (s *Server) embeddings(input, model string) ([]float32, string, error) {
+	embedding, err := s.provider.GetEmbeddings(input, model)
+	if err == nil || !s.config.FreeMode || !isEmbeddingUnsupportedError(err) {
+		return embedding, model, err
+	}
+	slog.Warn("model does not support embeddings, trying fallbacks", "model", model, "error", err)
+
+	for _, candidate := range s.config.EmbeddingModels {
+		if candidate == model {
+			continue
+		}
+		embedding, err := s.provider.GetEmbeddings(input, candidate)
+		if err == nil {
+			slog.Info("embeddings served by fallback model", "requested", model, "model", candidate)
+			return embedding, candidate, nil
+		}
+		slog.Warn("embedding fallback failed", "model", candidate, "error", err)
+	}
+	return nil, "", errNoEmbeddingModels
+}
+
+// embeddingErrorStatus 返回嵌入请求失败时的状态码，没有可用嵌入模型时为 503
+func embeddingErrorStatus(err error) int {
+	if errors.Is(err, errNoEmbeddingModels) {
+		return http.StatusServiceUnavailable
+	}
+	return upstreamErrorStatus(err, http.StatusInternalServerError)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// handleEmbeddings 让假上游响应 /embeddings：supported 中的模型返回向量，其余返回 404，
+// 返回的函数给出按顺序请求过的模型
+func handleEmbeddings(upstream *fakeUpstream, supported ...string) func() []string {
+	var mu sync.Mutex
+	var models []string
+	upstream.Config.Handler.(*http.ServeMux).HandleFunc("/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.Unmarshal(raw, &body)
+		mu.Lock()
+		models = append(models, body.Model)
+		mu.Unlock()
+
+		for _, m := range supported {
+			if m == body.Model {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.5,0.25]}]}`))
+				return
+			}
+		}
+		writeUpstreamError(w, http.StatusNotFound, "No endpoints found that support embeddings")
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), models...)
+	}
+}
+
+func TestEmbeddingsFallback(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	requested := handleEmbeddings(upstream, "org/embed-b")
+	cfg := Config{FreeMode: true, EmbeddingModels: []string{"org/embed-a", "org/embed-b"}}
+	s := newTestServer(t, cfg, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/embeddings", `{"model":"org/chat:free","input":"hello"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp OpenAIEmbeddingsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Model != "org/embed-b" || len(resp.Data) != 1 || len(resp.Data[0].Embedding) != 2 {
+		t.Errorf("response = %+v, want the embedding from org/embed-b", resp)
+	}
+	if got := requested(); len(got) != 3 || got[0] != "org/chat:free" || got[1] != "org/embed-a" || got[2] != "org/embed-b" {
+		t.Errorf("requested models = %v", got)
+	}
+}
+
+func TestEmbeddingsNoFallbackAvailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		freeMode bool
+		path     string
+		body     string
+		want     int
+	}{
+		{"free mode openai", true, "/v1/embeddings", `{"model":"org/chat:free","input":"hello"}`, http.StatusServiceUnavailable},
+		{"free mode ollama", true, "/api/embeddings", `{"model":"org/chat:free","prompt":"hello"}`, http.StatusServiceUnavailable},
+		{"normal mode keeps upstream status", false, "/v1/embeddings", `{"model":"org/chat","input":"hello"}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t)
+			handleEmbeddings(upstream)
+			s := newTestServer(t, Config{FreeMode: tt.freeMode, EmbeddingModels: []string{"org/embed-a"}}, upstream)
+
+			w := doJSON(t, s.buildRouter(), http.MethodPost, tt.path, tt.body)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body = %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// errEmptyStream 表示上游流只返回了结束原因，没有任何内容或工具调用（多为内容过滤）
+var errEmptyStream = errors.New("model returned an empty stream")
+
+// finishReasonEmpty 是空流在不能故障转移时报告给客户端的结束原因
+const finishReasonEmpty = openai.FinishReasonContentFilter
+
+// emptyStreamMaxLookahead 是判断空流时最多预读的分块数。上游持续发送没有输出的分块（如只有角色或
+// 空 delta）时，达到上限即停止预读并开始向客户端转发，避免无限缓冲并迟迟不发送响应头
+const emptyStreamMaxLookahead = 64
+
+// chunkHasOutput 判断分块是否携带了客户端可见的输出：文本、工具调用、拒绝或推理内容
+func chunkHasOutput(chunk ChatChunk) bool {
+	if chunkHasContent(chunk) || chunkHasToolCall(chunk) {
+		return true
+	}
+	for i, choice := range chunk.Choices {
+		if choice.Delta.Refusal != "" || reasoningAt(chunk.Reasoning, i) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// guardEmptyStream 在开启 DetectEmptyStream 时预读流的开头，直到出现任何输出或预读了
+// emptyStreamMaxLookahead 个分块。流在此之前就结束时关闭流并返回 errEmptyStream，调用方可以故障转移到下一个模型；
+// 预读的分块会在之后原样返回
+func (s *Server) guardEmptyStream(req openai.ChatCompletionRequest, stream ChatStream) (ChatStream, error) {
+	if !s.config.DetectEmptyStream {
+		return stream, nil
+	}
+
+	var buffered []ChatChunk
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			slog.Warn("model returned an empty stream", "model", req.Model)
+			stream.Close()
+			return nil, errEmptyStream
+		}
+		if err != nil {
+			return &replayStream{ChatStream: stream, buffered: buffered, err: err}, nil
+		}
+		buffered = append(buffered, chunk)
+		if chunkHasOutput(chunk) || len(buffered) >= emptyStreamMaxLookahead {
+			return &replayStream{ChatStream: stream, buffered: buffered}, nil
+		}
+	}
+}
+
+// emptyStreamReason 在开启 DetectEmptyStream 且整个流没有输出时返回 finishReasonEmpty，否则返回 reason
+func (s *Server) emptyStreamReason(reason string, hadOutput bool) string {
+	if s.config.DetectEmptyStream && !hadOutput {
+		return string(finishReasonEmpty)
+	}
+	return reason
+}
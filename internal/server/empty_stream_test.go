@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEmptyStreamFailsOverInFreeMode(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		model, _ := body["model"].(string)
+		if model == "org/a:free" {
+			writeChatStream(w, model)
+			return
+		}
+		writeChatStream(w, model, "hello", " world")
+	}
+	s := newTestServer(t, Config{FreeMode: true, DetectEmptyStream: true}, upstream, "org/a:free", "org/b:free")
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+		`{"model":"unknown","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "hello") {
+		t.Errorf("body = %s, want content from the second model", w.Body.String())
+	}
+	if got, want := upstream.requestedModels(), []string{"org/a:free", "org/b:free"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requested models = %v, want %v", got, want)
+	}
+}
+
+func TestEmptyStreamReportsContentFilter(t *testing.T) {
+	cases := []struct {
+		path, body, field string
+	}{
+		{"/api/chat", `{"model":"model-a","stream":true,"messages":[{"role":"user","content":"hi"}]}`, "finish_reason"},
+		{"/api/generate", `{"model":"model-a","prompt":"hi","stream":true}`, "done_reason"},
+		{"/v1/chat/completions", `{"model":"model-a","stream":true,"messages":[{"role":"user","content":"hi"}]}`, "finish_reason"},
+	}
+	for _, detect := range []bool{true, false} {
+		for _, tc := range cases {
+			t.Run(fmt.Sprintf("%s detect=%v", tc.path, detect), func(t *testing.T) {
+				upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+				upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+					writeChatStream(w, "org/model-a")
+				}
+				s := newTestServer(t, Config{DetectEmptyStream: detect}, upstream)
+
+				w := doJSON(t, s.buildRouter(), http.MethodPost, tc.path, tc.body)
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+				}
+
+				want := "stop"
+				if detect {
+					want = "content_filter"
+				}
+				var reasons []string
+				for _, frame := range streamFrames(t, w.Body.String()) {
+					if reason, _ := frame[tc.field].(string); reason != "" {
+						reasons = append(reasons, reason)
+					}
+					if choices, _ := frame["choices"].([]interface{}); len(choices) > 0 {
+						choice, _ := choices[0].(map[string]interface{})
+						if reason, _ := choice[tc.field].(string); reason != "" {
+							reasons = append(reasons, reason)
+						}
+					}
+				}
+				if len(reasons) != 1 || reasons[0] != want {
+					t.Errorf("%s = %v, want [%s]\nbody: %s", tc.field, reasons, want, w.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestEmptyStreamLookaheadIsCapped(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{DetectEmptyStream: true}, upstream)
+
+	// 持续发送没有输出的分块时，预读达到上限即交给调用方转发，不会一直阻塞
+	stream, err := s.guardEmptyStream(openai.ChatCompletionRequest{Model: "org/model-a"}, &endlessStream{})
+	if err != nil {
+		t.Fatalf("guardEmptyStream() error = %v", err)
+	}
+	replay, ok := stream.(*replayStream)
+	if !ok {
+		t.Fatalf("guardEmptyStream() returned %T, want *replayStream", stream)
+	}
+	if len(replay.buffered) != emptyStreamMaxLookahead {
+		t.Errorf("buffered %d chunks, want %d", len(replay.buffered), emptyStreamMaxLookahead)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errorKind 根据响应状态码和上游错误推断 OpenAI 风格的 type 和 code。
+// 上游返回的 429/404/402 优先于本地状态码，便于客户端识别限流、模型不存在和余额不足
+func errorKind(status int, err error) (string, string) {
+	switch upstreamStatus(err) {
+	case http.StatusTooManyRequests:
+		return "rate_limit_error", "rate_limit_exceeded"
+	case http.StatusNotFound:
+		return "invalid_request_error", "model_not_found"
+	case http.StatusPaymentRequired:
+		return "insufficient_quota", "insufficient_credits"
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error", "rate_limit_exceeded"
+	case status == http.StatusNotFound:
+		return "invalid_request_error", "model_not_found"
+	case status == http.StatusPaymentRequired:
+		return "insufficient_quota", "insufficient_credits"
+	case status == http.StatusUnauthorized:
+		return "invalid_request_error", "invalid_api_key"
+	case status == http.StatusGatewayTimeout:
+		return "server_error", "timeout"
+	case status >= http.StatusInternalServerError:
+		return "server_error", ""
+	default:
+		return "invalid_request_error", ""
+	}
+}
+
+// upstreamStatus 返回错误链中 UpstreamError 携带的上游 HTTP 状态码，没有时返回 0
+func upstreamStatus(err error) int {
+	var upErr *UpstreamError
+	if errors.As(err, &upErr) {
+		return upErr.StatusCode
+	}
+	return 0
+}
+
+// isOpenAIRoute 判断请求是否属于 /v1/* 路由族
+func isOpenAIRoute(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, "/v1/")
+}
+
+// errorBody 按路由族构造错误响应体：/v1/* 为 {"error":{"message","type","code"}}，
+// /api/* 保持 Ollama 的 {"error": "..."}
+func errorBody(c *gin.Context, status int, err error) gin.H {
+	if !isOpenAIRoute(c) {
+		return gin.H{"error": err.Error()}
+	}
+
+	errType, code := errorKind(status, err)
+	detail := gin.H{"message": err.Error(), "type": errType, "code": nil}
+	if code != "" {
+		detail["code"] = code
+	}
+	return gin.H{"error": detail}
+}
+
+// writeError 以当前路由族对应的格式写出错误响应
+func writeError(c *gin.Context, status int, err error) {
+	c.JSON(status, errorBody(c, status, err))
+}
+
+// writeFailoverError 写出免费模式失败的错误响应，debug 日志级别下附带每个模型的失败明细
+func (s *Server) writeFailoverError(c *gin.Context, status int, err error) {
+	body := errorBody(c, status, err)
+
+	var fe *FailoverError
+	if s.config.LogLevel == "debug" && errors.As(err, &fe) {
+		body["attempts"] = fe.Attempts
+	}
+	c.JSON(status, body)
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestErrorShapePerRouteFamily(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"}, fakeModel{ID: "org/limited"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		if body["model"] == "org/limited" {
+			writeUpstreamError(w, http.StatusTooManyRequests, "rate limited")
+			return
+		}
+		writeUpstreamError(w, http.StatusNotFound, "model not found")
+	}
+	s := newTestServer(t, Config{ProxyAuthToken: "secret"}, upstream)
+	r := s.buildRouter()
+
+	const missing = `{"model":"missing","messages":[{"role":"user","content":"hi"}],"stream":false}`
+	const limited = `{"model":"limited","messages":[{"role":"user","content":"hi"}],"stream":false}`
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		auth       string
+		wantStatus int
+		wantType   string
+		wantCode   string
+	}{
+		{"openai upstream 404", "/v1/chat/completions", missing, "secret", 0, "invalid_request_error", "model_not_found"},
+		{"openai bad json", "/v1/chat/completions", "{", "secret", http.StatusBadRequest, "invalid_request_error", ""},
+		{"openai upstream 429", "/v1/chat/completions", limited, "secret", 0, "rate_limit_error", "rate_limit_exceeded"},
+		{"openai unauthorized", "/v1/chat/completions", missing, "", http.StatusUnauthorized, "invalid_request_error", "invalid_api_key"},
+		{"ollama upstream 404", "/api/chat", missing, "secret", 0, "", ""},
+		{"ollama bad json", "/api/chat", "{", "secret", http.StatusBadRequest, "", ""},
+		{"ollama missing model", "/api/generate", `{"prompt":"hi"}`, "secret", http.StatusBadRequest, "", ""},
+		{"ollama unauthorized", "/api/chat", missing, "", http.StatusUnauthorized, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headers []string
+			if tt.auth != "" {
+				headers = []string{"Authorization", "Bearer " + tt.auth}
+			}
+			w := doJSON(t, r, http.MethodPost, tt.path, tt.body, headers...)
+			if tt.wantStatus != 0 && w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code < http.StatusBadRequest {
+				t.Fatalf("status = %d, want an error, body = %s", w.Code, w.Body.String())
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body: %v, body = %s", err, w.Body.String())
+			}
+
+			if tt.wantType == "" {
+				if msg, ok := body["error"].(string); !ok || msg == "" {
+					t.Errorf("body = %s, want flat {\"error\": \"...\"}", w.Body.String())
+				}
+				return
+			}
+
+			detail, ok := body["error"].(map[string]interface{})
+			if !ok || detail["message"] == "" {
+				t.Fatalf("body = %s, want {\"error\": {\"message\", ...}}", w.Body.String())
+			}
+			if detail["type"] != tt.wantType {
+				t.Errorf("type = %v, want %s", detail["type"], tt.wantType)
+			}
+			if _, ok := detail["code"]; !ok {
+				t.Errorf("body = %s, want a code field", w.Body.String())
+			}
+			if tt.wantCode != "" && detail["code"] != tt.wantCode {
+				t.Errorf("code = %v, want %s", detail["code"], tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestFailoverErrorKeepsAttemptsInDebug(t *testing.T) {
+	for _, path := range []string{"/api/chat", "/v1/chat/completions"} {
+		upstream := newFakeUpstream(t, fakeModel{ID: "org/free-a:free"})
+		upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+			writeUpstreamError(w, http.StatusBadGateway, "down")
+		}
+		s := newTestServer(t, Config{FreeMode: true, LogLevel: "debug"}, upstream, "org/free-a:free")
+		r := s.buildRouter()
+
+		body := `{"model":"free-a","messages":[{"role":"user","content":"hi"}],"stream":false}`
+		w := doJSON(t, r, http.MethodPost, path, body)
+		if w.Code < http.StatusInternalServerError {
+			t.Fatalf("%s: status = %d, body = %s", path, w.Code, w.Body.String())
+		}
+
+		var resp map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: decode body: %v", path, err)
+		}
+		if _, ok := resp["attempts"]; !ok {
+			t.Errorf("%s: body = %s, want attempts", path, w.Body.String())
+		}
+	}
+}
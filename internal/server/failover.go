@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	errorClassPermanent = "permanent"
+	errorClassRateLimit = "rate_limit"
+	errorClassGeneral   = "general"
+)
+
+// ModelFailure 记录故障转移过程中一个模型的失败情况
+type ModelFailure struct {
+	Model string `json:"model"`
+	Class string `json:"class"`
+	Error string `json:"error"`
+}
+
+// FailoverError 表示所有候选模型均失败，Attempts 按尝试顺序记录每个模型的失败原因
+type FailoverError struct {
+	Attempts []ModelFailure
+	Last     error
+}
+
+func (e *FailoverError) Error() string {
+	parts := make([]string, len(e.Attempts))
+	for i, a := range e.Attempts {
+		parts[i] = fmt.Sprintf("%s (%s)", a.Model, a.Class)
+	}
+	return fmt.Sprintf("all models failed [%s]: %v", strings.Join(parts, ", "), e.Last)
+}
+
+func (e *FailoverError) Unwrap() error { return e.Last }
+
+// classifyError 将上游错误归类为永久失败、速率限制或一般失败
+func classifyError(err error) string {
+	switch {
+	case isPermanentError(err):
+		return errorClassPermanent
+	case isRateLimitError(err):
+		return errorClassRateLimit
+	default:
+		return errorClassGeneral
+	}
+}
+
+// isTimeoutError 判断错误是否由上游请求超时引起
+func isTimeoutError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// upstreamErrorStatus 在熔断器打开或固定的模型暂不可用时返回 503，提示词超过所有模型的上下文时返回 413，
+// 上游超时时返回 504，上游响应体无法解析时返回 502，上游返回了错误状态码时原样返回
+// （鉴权失败除外，那是代理自身的 API Key 问题，返回 502），否则返回 fallback。免费模式下按最后一次尝试的错误判断
+func upstreamErrorStatus(err error, fallback int) int {
+	if errors.Is(err, errCircuitOpen) || errors.Is(err, errPinnedModelUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, errPromptTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	if isTimeoutError(err) {
+		return http.StatusGatewayTimeout
+	}
+	if isDecodeError(err) {
+		return http.StatusBadGateway
+	}
+	switch status := upstreamStatus(err); {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return http.StatusBadGateway
+	case status >= http.StatusBadRequest:
+		return status
+	}
+	return fallback
+}
+
+// tryFreeModels 按顺序对可用的免费模型（之后是付费备选）调用 attempt，直到某个模型成功并返回其名称。
+// promptTokens 为估算的提示词 token 数，超过模型 max_prompt_tokens 或上下文长度的模型会被跳过，
+// 放不下的模型排在最后，其余模型保持原有顺序；没有任何模型放得下时返回 errPromptTooLarge。
+// 调用 attempt 前已占用该模型的并发槽位，attempt 负责释放（或移交给返回的流）。
+// 候选模型和过滤器取自 ctx 中的请求快照，期间的过滤器重载不影响本次故障转移。
+func (s *Server) tryFreeModels(ctx context.Context, promptTokens int, attempt func(model string) error) (string, error) {
+	var failures []ModelFailure
+	var lastError error
+	// tooLarge 记录是否有模型因提示词过大被跳过，fits 记录是否有放得下提示词的模型（包括冷却中的）
+	var tooLarge, fits bool
+
+	snap := s.modelSnapshotFrom(ctx)
+	candidates := s.orderForPrompt(snap.candidates, promptTokens)
+	if s.config.FailoverStrategy == StrategyWeighted {
+		var eligible []string
+		for _, m := range snap.free {
+			if s.snapshotSkipReason(snap, m, promptTokens) == "" {
+				eligible = append(eligible, m)
+			}
+		}
+		if len(eligible) > 1 {
+			candidates = s.weightedStart(candidates, eligible)
+		}
+	}
+	for _, m := range candidates {
+		if s.breaker != nil && s.breaker.isOpen() {
+			// 上游整体不可用，剩余模型同样会失败，且不应因此进入冷却
+			lastError = errCircuitOpen
+			break
+		}
+		reason := s.snapshotSkipReason(snap, m, promptTokens)
+		if reason == skipPromptTooLarge {
+			tooLarge = true
+		} else if reason != skipFiltered {
+			fits = true
+		}
+		if reason != "" {
+			continue
+		}
+
+		acquired, err := s.attemptModel(ctx, m, attempt)
+		if !acquired {
+			return "", err
+		}
+		if err != nil {
+			lastError = err
+			failures = append(failures, ModelFailure{Model: m, Class: classifyError(err), Error: err.Error()})
+			continue
+		}
+		return m, nil
+	}
+
+	if lastError != nil {
+		return "", &FailoverError{Attempts: failures, Last: lastError}
+	}
+	if tooLarge && !fits {
+		return "", errPromptTooLarge
+	}
+	noteNoModels(ctx)
+	return "", fmt.Errorf("no free models available")
+}
+
+// attemptModel 对模型 m 执行一次尝试：等待该模型和全局的速率限制、占用并发槽位后调用 attempt，
+// 再记录结果（自适应并发反馈、按错误类别冷却、成功率、延迟和指标）。attempt 负责释放槽位（或移交给返回的流）。
+// 占用槽位失败（ctx 被取消）时不调用 attempt，acquired 为 false，err 为取消原因
+func (s *Server) attemptModel(ctx context.Context, m string, attempt func(model string) error) (acquired bool, err error) {
+	queued := time.Now()
+	limiter := s.globalLimiter.GetLimiter(m)
+	limiter.Wait()
+	s.globalLimiter.WaitGlobal()
+
+	if err := s.globalLimiter.Acquire(ctx, m); err != nil {
+		return false, err
+	}
+	start := time.Now()
+	addTiming(ctx, phaseQueue, start.Sub(queued))
+	err = attempt(m)
+	s.globalLimiter.RecordResult(m, err)
+	if err != nil {
+		addTiming(ctx, phaseAttempts, time.Since(start))
+		modelRequestsTotal.inc(m, "failure")
+		noteFailedAttempt(ctx)
+		limiter.RecordFailure(err)
+
+		class := classifyError(err)
+		switch class {
+		case errorClassPermanent:
+			s.permanentFails.MarkPermanentFailure(m)
+		case errorClassRateLimit:
+			s.failureStore.MarkFailureWithType(m, "rate_limit")
+			time.Sleep(500 * time.Millisecond)
+		default:
+			s.failureStore.MarkFailure(m)
+		}
+		if class != errorClassRateLimit {
+			s.recordModelOutcome(m, true)
+		}
+		s.recordSuccessRate(m, false)
+		return true, err
+	}
+
+	addTiming(ctx, phaseUpstream, time.Since(start))
+	modelRequestsTotal.inc(m, "success")
+	limiter.RecordSuccess()
+	s.failureStore.ClearFailure(m)
+	s.recordModelOutcome(m, false)
+	s.recordSuccessRate(m, true)
+	s.recordLatency(m, time.Since(start))
+	return true, nil
+}
+
+// withPreferredFailure 将首选模型的失败并入故障转移的错误，
+// 避免首选模型失败且没有其他可用模型时丢失真实原因（如超时）
+func withPreferredFailure(model string, preferredErr, err error) error {
+	if preferredErr == nil {
+		return err
+	}
+	failure := ModelFailure{Model: model, Class: classifyError(preferredErr), Error: preferredErr.Error()}
+
+	var fe *FailoverError
+	if errors.As(err, &fe) {
+		fe.Attempts = append([]ModelFailure{failure}, fe.Attempts...)
+		return fe
+	}
+	return &FailoverError{Attempts: []ModelFailure{failure}, Last: preferredErr}
+}
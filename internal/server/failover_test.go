@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestGetFreeChatFailureSummary(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		switch body["model"] {
+		case "org/limited:free":
+			writeUpstreamError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		case "org/gone:free":
+			writeUpstreamError(w, http.StatusNotFound, "no endpoints found")
+		default:
+			writeUpstreamError(w, http.StatusInternalServerError, "upstream exploded")
+		}
+	}
+	s := newTestServer(t, Config{FreeMode: true}, upstream, "org/limited:free", "org/gone:free", "org/broken:free")
+
+	req := openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	_, _, err := s.getFreeChat(context.Background(), req)
+
+	var fe *FailoverError
+	if !errors.As(err, &fe) {
+		t.Fatalf("getFreeChat() error = %v, want *FailoverError", err)
+	}
+
+	want := []ModelFailure{
+		{Model: "org/limited:free", Class: errorClassRateLimit},
+		{Model: "org/gone:free", Class: errorClassPermanent},
+		{Model: "org/broken:free", Class: errorClassGeneral},
+	}
+	if len(fe.Attempts) != len(want) {
+		t.Fatalf("attempts = %+v, want %d entries", fe.Attempts, len(want))
+	}
+	for i, w := range want {
+		got := fe.Attempts[i]
+		if got.Model != w.Model || got.Class != w.Class || got.Error == "" {
+			t.Errorf("attempt[%d] = %+v, want model %s class %s", i, got, w.Model, w.Class)
+		}
+	}
+}
+
+func TestPreferredModelAttemptUsesFailoverSafeguards(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		model, _ := body["model"].(string)
+		if model == "org/limited:free" {
+			writeUpstreamError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		writeChatCompletion(w, model, "ok")
+	}
+	s := newTestServer(t, Config{FreeMode: true, MaxConcurrentPerModel: 1}, upstream, "org/limited:free", "org/backup:free")
+
+	req := openai.ChatCompletionRequest{
+		Model:    "limited:free",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	}
+	_, model, err := s.getFreeChatForModel(context.Background(), req)
+	if err != nil || model != "org/backup:free" {
+		t.Fatalf("getFreeChatForModel() = %q, %v; want failover to org/backup:free", model, err)
+	}
+
+	records, err := s.failureStore.ListFailures()
+	if err != nil {
+		t.Fatalf("ListFailures() error = %v", err)
+	}
+	if len(records) != 1 || records[0].Model != "org/limited:free" || records[0].Type != "rate_limit" {
+		t.Errorf("failure records = %+v, want one rate_limit record for org/limited:free", records)
+	}
+
+	// 槽位已释放时，并发上限为 1 的模型仍可立即占用
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.globalLimiter.Acquire(ctx, "org/limited:free"); err != nil {
+		t.Fatalf("Acquire() error = %v, preferred model slot was not released", err)
+	}
+	s.globalLimiter.Release("org/limited:free")
+}
@@ -0,0 +1,38 @@
+package server
+
+import "strings"
+
+// providerFamilies 将 OpenRouter 模型 ID 的提供商前缀映射为模型系列，未列出的前缀直接作为系列名
+var providerFamilies = map[string]string{
+	"meta-llama": "llama",
+	"mistralai":  "mistral",
+	"anthropic":  "claude",
+	"openai":     "gpt",
+	"microsoft":  "phi",
+	"x-ai":       "grok",
+}
+
+// otherFamily 是没有提供商前缀的模型所属的系列
+const otherFamily = "other"
+
+// familyForModel 根据完整模型 ID 的提供商前缀推导模型系列
+func familyForModel(fullID string) string {
+	prefix, _, ok := strings.Cut(fullID, "/")
+	if !ok || prefix == "" {
+		return otherFamily
+	}
+	if family, ok := providerFamilies[prefix]; ok {
+		return family
+	}
+	return prefix
+}
+
+// groupByFamily 将模型名按系列分组，names 与 fullIDs 一一对应，组内保持列表顺序
+func groupByFamily(names, fullIDs []string) map[string][]string {
+	groups := make(map[string][]string)
+	for i, name := range names {
+		family := familyForModel(fullIDs[i])
+		groups[family] = append(groups[family], name)
+	}
+	return groups
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestFamilyForModel(t *testing.T) {
+	tests := map[string]string{
+		"meta-llama/llama-3.3-70b-instruct:free": "llama",
+		"mistralai/mistral-7b-instruct:free":     "mistral",
+		"google/gemma-3-27b-it:free":             "google",
+		"openrouter/auto":                        "openrouter",
+		"bare-model":                             otherFamily,
+	}
+	for id, want := range tests {
+		if got := familyForModel(id); got != want {
+			t.Errorf("familyForModel(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestListModelsGroupByFamily(t *testing.T) {
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "meta-llama/llama-3.3-70b:free"},
+		fakeModel{ID: "google/gemma-3-27b:free"},
+		fakeModel{ID: "meta-llama/llama-4-scout:free"},
+		fakeModel{ID: "mistralai/mistral-small:free"},
+	)
+
+	tests := []struct {
+		name     string
+		freeMode bool
+	}{
+		{"free mode", true},
+		{"all models", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, Config{FreeMode: tt.freeMode}, upstream,
+				"meta-llama/llama-3.3-70b:free", "google/gemma-3-27b:free",
+				"meta-llama/llama-4-scout:free", "mistralai/mistral-small:free")
+			r := s.buildRouter()
+
+			w := doJSON(t, r, http.MethodGet, "/api/tags?group_by=family", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Models   []map[string]interface{} `json:"models"`
+				Families map[string][]string      `json:"families"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if len(resp.Models) != 4 {
+				t.Errorf("flat list has %d models, want 4", len(resp.Models))
+			}
+			want := map[string][]string{
+				"llama":   {"llama-3.3-70b:free", "llama-4-scout:free"},
+				"google":  {"gemma-3-27b:free"},
+				"mistral": {"mistral-small:free"},
+			}
+			if !reflect.DeepEqual(resp.Families, want) {
+				t.Errorf("families = %v, want %v", resp.Families, want)
+			}
+
+			w = doJSON(t, r, http.MethodGet, "/api/tags", "")
+			var plain map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &plain)
+			if _, ok := plain["families"]; ok {
+				t.Error("families present without group_by=family")
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// regexPrefix 开头的过滤行按正则表达式匹配
+	regexPrefix = "re:"
+	// exclusionPrefix 开头的过滤行为排除项，其余部分按普通模式解析
+	exclusionPrefix = "!"
+	// commentPrefix 开头的过滤行为注释
+	commentPrefix = "#"
+)
+
+// defaultModelFilter 是内置的默认过滤器，过滤文件不存在时使用
+//
+//go:embed default-models-filter
+var defaultModelFilter string
+
+// ModelFilter 是从过滤文件加载的模型名称模式集合，每行一个模式：
+//   - 以 re: 开头的行按正则表达式匹配（不自动锚定）
+//   - 包含 * 或 ? 的行按通配符匹配整个模型显示名
+//   - 其余行按部分匹配
+//
+// 以 ! 开头的行为排除项（如 !free、!re:^gpt-）。排除项优先：模型只要匹配任一排除项即被过滤掉；
+// 否则在没有正向模式时放行，有正向模式时需至少匹配其中一个。
+type ModelFilter struct {
+	patterns []string
+	// compiled 保存正则和通配符模式编译后的表达式，纯文本模式不在其中
+	compiled map[string]*regexp.Regexp
+	// ignoreCase 为 true 时匹配忽略大小写
+	ignoreCase bool
+}
+
+// compilePattern 编译正则或通配符模式，纯文本模式返回 nil；ignoreCase 时编译为忽略大小写的表达式
+func compilePattern(pattern string, ignoreCase bool) (*regexp.Regexp, error) {
+	flags := ""
+	if ignoreCase {
+		flags = "(?i)"
+	}
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		return regexp.Compile(flags + expr)
+	}
+	if strings.ContainsAny(pattern, "*?") {
+		expr := regexp.QuoteMeta(pattern)
+		expr = strings.ReplaceAll(expr, `\*`, ".*")
+		expr = strings.ReplaceAll(expr, `\?`, ".")
+		return regexp.Compile(flags + "^" + expr + "$")
+	}
+	return nil, nil
+}
+
+// ParseModelFilter 从 r 中逐行读取过滤模式，忽略空行和以 # 开头的注释行；无法编译的正则记录日志后跳过
+func ParseModelFilter(r io.Reader) (*ModelFilter, error) {
+	f := &ModelFilter{compiled: make(map[string]*regexp.Regexp)}
+	seen := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, commentPrefix) {
+			continue
+		}
+		if _, ok := seen[line]; ok {
+			continue
+		}
+		seen[line] = struct{}{}
+
+		body := strings.TrimPrefix(line, exclusionPrefix)
+		if body == "" {
+			continue
+		}
+		re, err := compilePattern(body, false)
+		if err != nil {
+			slog.Warn("Skipping invalid model filter pattern", "pattern", line, "error", err)
+			continue
+		}
+		if re != nil {
+			f.compiled[body] = re
+		}
+		f.patterns = append(f.patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// LoadModelFilter 读取过滤文件，文件不存在时返回的错误满足 os.IsNotExist
+func LoadModelFilter(path string) (*ModelFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseModelFilter(file)
+}
+
+// DefaultModelFilter 返回内置的默认过滤器
+func DefaultModelFilter() *ModelFilter {
+	filter, err := ParseModelFilter(strings.NewReader(defaultModelFilter))
+	if err != nil {
+		// 内置内容在编译时已确定，读取不会失败
+		panic(err)
+	}
+	return filter
+}
+
+// SetIgnoreCase 设置匹配时是否忽略大小写，并按新的设置重新编译模式
+func (f *ModelFilter) SetIgnoreCase(ignore bool) {
+	if f == nil || f.ignoreCase == ignore {
+		return
+	}
+	f.ignoreCase = ignore
+	for body := range f.compiled {
+		if re, err := compilePattern(body, ignore); err == nil {
+			f.compiled[body] = re
+		}
+	}
+}
+
+// Empty 判断过滤器是否没有任何模式（即不过滤）
+func (f *ModelFilter) Empty() bool {
+	return f == nil || len(f.patterns) == 0
+}
+
+// Patterns 返回过滤器中的全部有效模式
+func (f *ModelFilter) Patterns() []string {
+	if f == nil {
+		return nil
+	}
+	return append([]string(nil), f.patterns...)
+}
+
+// isExclusion 判断模式是否为排除项
+func isExclusion(pattern string) bool {
+	return strings.HasPrefix(pattern, exclusionPrefix)
+}
+
+// MatchPattern 判断单个模式是否匹配模型名；排除项按去掉 ! 后的模式判断是否命中
+func (f *ModelFilter) MatchPattern(pattern, modelName string) bool {
+	pattern = strings.TrimPrefix(pattern, exclusionPrefix)
+	re, ok := f.compiled[pattern]
+	if !ok {
+		var err error
+		if re, err = compilePattern(pattern, f.ignoreCase); err != nil {
+			return false
+		}
+	}
+	if re != nil {
+		return re.MatchString(modelName)
+	}
+	if f.ignoreCase {
+		return strings.Contains(strings.ToLower(modelName), strings.ToLower(pattern))
+	}
+	return strings.Contains(modelName, pattern)
+}
+
+// Match 判断模型名是否通过过滤器：命中任一排除项即拒绝；否则没有正向模式时放行，
+// 有正向模式时需至少匹配一个。空过滤器放行所有模型
+func (f *ModelFilter) Match(modelName string) bool {
+	if f.Empty() {
+		return true
+	}
+
+	hasPositive, matchedPositive := false, false
+	for _, pattern := range f.patterns {
+		matched := f.MatchPattern(pattern, modelName)
+		if isExclusion(pattern) {
+			if matched {
+				return false
+			}
+			continue
+		}
+		hasPositive = true
+		matchedPositive = matchedPositive || matched
+	}
+	return !hasPositive || matchedPositive
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// filterWatchInterval 为检查过滤器文件变化的间隔
+const filterWatchInterval = 2 * time.Second
+
+// fileStamp 记录文件的修改时间和大小，用于判断文件是否变化；零值表示文件不存在
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// reloadModelFilterIfChanged 在过滤器文件被修改、创建或删除时重新加载，返回是否发生了重新加载
+func (s *Server) reloadModelFilterIfChanged() bool {
+	stamp := statFile(s.config.FilterPath)
+
+	s.modelFilterMu.RLock()
+	unchanged := stamp == s.filterStamp
+	s.modelFilterMu.RUnlock()
+	if unchanged {
+		return false
+	}
+
+	slog.Info("Model filter file changed, reloading", "path", s.config.FilterPath)
+	s.loadModelFilter()
+	s.refilterFreeModels()
+	return true
+}
+
+// refilterFreeModels 按新的过滤器从缓存的免费模型重新生成免费模型列表，
+// 让此前被排除、现在允许的模型重新可用。没有缓存时保留当前列表
+func (s *Server) refilterFreeModels() {
+	if !s.config.FreeMode || s.failureStore == nil {
+		return
+	}
+	models, _, err := s.failureStore.LoadModels()
+	if err != nil {
+		slog.Error("Failed to load cached free models", "error", err)
+		return
+	}
+	if len(models) == 0 {
+		return
+	}
+	toolUseOnly := strings.ToLower(os.Getenv("TOOL_USE_ONLY")) == "true"
+	s.setFreeModels(s.usableFreeModels(models, toolUseOnly))
+	s.reorderFreeModelsByLatency()
+}
+
+// watchModelFilter 定期检查过滤器文件，直到服务器关闭
+func (s *Server) watchModelFilter(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.reloadModelFilterIfChanged()
+		}
+	}
+}
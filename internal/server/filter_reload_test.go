@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func listedModelNames(t *testing.T, s *Server) []string {
+	t.Helper()
+
+	w := doJSON(t, s.buildRouter(), http.MethodGet, "/api/tags", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("/api/tags status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode /api/tags: %v", err)
+	}
+	names := make([]string, 0, len(resp.Models))
+	for _, m := range resp.Models {
+		names = append(names, m.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestModelFilterHotReload(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true}, upstream, "org/model-a:free", "org/model-b:free")
+
+	if got := listedModelNames(t, s); len(got) != 2 {
+		t.Fatalf("models before filter = %v, want both", got)
+	}
+	if s.reloadModelFilterIfChanged() {
+		t.Error("reload reported a change without the filter file changing")
+	}
+
+	if err := os.WriteFile(s.config.FilterPath, []byte("model-a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !s.reloadModelFilterIfChanged() {
+		t.Fatal("reload did not detect the new filter file")
+	}
+	if got := listedModelNames(t, s); len(got) != 1 || got[0] != "model-a:free" {
+		t.Errorf("models after filter = %v, want [model-a:free]", got)
+	}
+
+	// 修改内容后再次重新加载
+	if err := os.WriteFile(s.config.FilterPath, []byte("model-b-longer\nmodel-b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !s.reloadModelFilterIfChanged() {
+		t.Fatal("reload did not detect the edited filter file")
+	}
+	if got := listedModelNames(t, s); len(got) != 1 || got[0] != "model-b:free" {
+		t.Errorf("models after edit = %v, want [model-b:free]", got)
+	}
+
+	// 删除文件后恢复为不过滤
+	if err := os.Remove(s.config.FilterPath); err != nil {
+		t.Fatal(err)
+	}
+	if !s.reloadModelFilterIfChanged() {
+		t.Fatal("reload did not detect the removed filter file")
+	}
+	if got := listedModelNames(t, s); len(got) != 2 {
+		t.Errorf("models after removing filter = %v, want both", got)
+	}
+}
+
+func TestWatchModelFilterStopsOnShutdown(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true}, upstream, "org/model-a:free", "org/model-b:free")
+
+	stopped := make(chan struct{})
+	go func() {
+		s.watchModelFilter(10 * time.Millisecond)
+		close(stopped)
+	}()
+
+	if err := os.WriteFile(s.config.FilterPath, []byte("model-a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(listedModelNames(t, s)) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("watcher did not pick up the filter change")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.doneOnce.Do(func() { close(s.done) })
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("watcher did not stop after shutdown")
+	}
+}
+
+func TestInitFreeModeDropsDuplicateAndFilteredModels(t *testing.T) {
+	t.Setenv("FAILURE_DB", "")
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "org/model-a:free"},
+		fakeModel{ID: "org/model-b:free"},
+		fakeModel{ID: "org/model-a:free"},
+		fakeModel{ID: "other/model-a:free"},
+	)
+	dir := t.TempDir()
+	s := New(Config{FreeMode: true, BaseURL: upstream.URL + "/", ConfigDir: dir, FilterPath: filepath.Join(dir, "models-filter")})
+	if err := os.WriteFile(s.config.FilterPath, []byte("model-a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.loadModelFilter()
+	if err := s.initFreeMode(); err != nil {
+		t.Fatalf("initFreeMode() error = %v", err)
+	}
+	t.Cleanup(func() { s.failureStore.Close() })
+
+	want := []string{"org/model-a:free", "other/model-a:free"}
+	if got := s.freeModelList(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("free models = %v, want %v", got, want)
+	}
+
+	// 放宽过滤器后，之前被排除的模型从缓存中恢复
+	if err := os.Remove(s.config.FilterPath); err != nil {
+		t.Fatal(err)
+	}
+	s.reloadModelFilterIfChanged()
+	want = []string{"org/model-a:free", "org/model-b:free", "other/model-a:free"}
+	if got := s.freeModelList(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("free models after removing filter = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestModelFilterPatternKinds(t *testing.T) {
+	filter, err := ParseModelFilter(strings.NewReader(strings.Join([]string{
+		`re:^gpt-4o(-mini)?$`,
+		`llama-*-instruct:free`,
+		`gemini`,
+		`re:(unclosed`,
+		``,
+	}, "\n")))
+	if err != nil {
+		t.Fatalf("ParseModelFilter() error = %v", err)
+	}
+
+	if got := filter.Patterns(); len(got) != 3 {
+		t.Errorf("Patterns() = %v, want the invalid regex skipped", got)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"gpt-4o", true},
+		{"gpt-4o-mini", true},
+		{"gpt-4o-2024", false},
+		{"llama-3.3-70b-instruct:free", true},
+		{"llama-3.3-70b-instruct", false},
+		{"meta-llama-3-instruct:free", false},
+		{"gemini-2.0-flash-exp:free", true},
+		{"mistral-7b", false},
+		{"(unclosed", false},
+	}
+	for _, tt := range tests {
+		if got := filter.Match(tt.name); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPatternGlobSingleChar(t *testing.T) {
+	f := &ModelFilter{}
+	if !f.MatchPattern("qwen?", "qwen3") || f.MatchPattern("qwen?", "qwen32") {
+		t.Error("? should match exactly one character")
+	}
+	if !f.MatchPattern("qwen", "qwen-2.5") {
+		t.Error("literal patterns should keep substring behavior")
+	}
+}
+
+func TestModelFilterExclusions(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		model  string
+		want   bool
+	}{
+		{"positive only", "gemma", "gemma-3-27b-it:free", true},
+		{"exclusion removes positive match", "gemma\n!free", "gemma-3-27b-it:free", false},
+		{"exclusion leaves other positive match", "gemma\n!free", "gemma-3-27b-it", true},
+		{"positive still required", "gemma\n!free", "llama-3-8b", false},
+		{"only exclusions pass the rest", "!free", "llama-3-8b", true},
+		{"only exclusions", "!free", "llama-3-8b:free", false},
+		{"regex exclusion", "!re:^gpt-", "gpt-4o", false},
+		{"glob exclusion", "gemma\n!gemma-2-*", "gemma-2-9b-it:free", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseModelFilter(strings.NewReader(tt.filter))
+			if err != nil {
+				t.Fatalf("ParseModelFilter() error = %v", err)
+			}
+			if got := filter.Match(tt.model); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterExclusionInFreeModeListing(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true}, upstream,
+		"google/gemma-3-27b-it:free", "google/gemma-3-27b-it", "meta/llama-3-8b:free")
+
+	if err := os.WriteFile(s.config.FilterPath, []byte("gemma\n!free\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.loadModelFilter()
+
+	if got := listedModelNames(t, s); len(got) != 1 || got[0] != "gemma-3-27b-it" {
+		t.Errorf("listed models = %v, want [gemma-3-27b-it]", got)
+	}
+}
+
+func TestFilterExclusionInToolUseListing(t *testing.T) {
+	t.Setenv("TOOL_USE_ONLY", "true")
+	tools := []string{"tools"}
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "google/gemma-3-27b-it:free", SupportedParameters: tools},
+		fakeModel{ID: "google/gemma-3-27b-it", SupportedParameters: tools},
+		fakeModel{ID: "google/gemma-2-9b-it"},
+	)
+	s := newTestServer(t, Config{}, upstream)
+
+	if err := os.WriteFile(s.config.FilterPath, []byte("gemma\n!free\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.loadModelFilter()
+
+	if got := listedModelNames(t, s); len(got) != 1 || got[0] != "gemma-3-27b-it" {
+		t.Errorf("listed tool models = %v, want [gemma-3-27b-it]", got)
+	}
+}
+
+func TestFilterSubstringMatchInNonFreeListing(t *testing.T) {
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "google/gemini-2.0-flash"},
+		fakeModel{ID: "google/gemini-pro"},
+		fakeModel{ID: "meta/llama-3-8b"},
+	)
+	s := newTestServer(t, Config{}, upstream)
+
+	// 普通模式与免费模式一样按部分匹配，普通文本不要求与显示名完全相同
+	if err := os.WriteFile(s.config.FilterPath, []byte("gemini\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.loadModelFilter()
+	if got := listedModelNames(t, s); len(got) != 2 || got[0] != "gemini-2.0-flash" || got[1] != "gemini-pro" {
+		t.Errorf("/api/tags models = %v, want both gemini models", got)
+	}
+	w := doJSON(t, s.buildRouter(), http.MethodGet, "/v1/models", "")
+	var resp struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode /v1/models: %v", err)
+	}
+	if len(resp.Data) != 2 {
+		t.Errorf("/v1/models = %+v, want both gemini models", resp.Data)
+	}
+
+	// 需要精确匹配时使用锚定的正则
+	if err := os.WriteFile(s.config.FilterPath, []byte("re:^gemini-pro$\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.loadModelFilter()
+	if got := listedModelNames(t, s); len(got) != 1 || got[0] != "gemini-pro" {
+		t.Errorf("/api/tags models = %v, want [gemini-pro]", got)
+	}
+}
+
+func TestDefaultFilterUsedWithoutFilterFile(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	free := []string{"meta/llama-3-8b:free", "meta/llama-guard-4-12b:free", "acme/text-embed-3:free"}
+	s := newTestServer(t, Config{FreeMode: true, DefaultFilter: true}, upstream, free...)
+
+	if got := listedModelNames(t, s); len(got) != 1 || got[0] != "llama-3-8b:free" {
+		t.Errorf("listed models = %v, want the embedded default to drop guard and embedding models", got)
+	}
+
+	// 用户过滤文件覆盖内置默认过滤器
+	if err := os.WriteFile(s.config.FilterPath, []byte("guard\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.loadModelFilter()
+	if got := listedModelNames(t, s); len(got) != 1 || got[0] != "llama-guard-4-12b:free" {
+		t.Errorf("listed models = %v, want the user filter to replace the default", got)
+	}
+
+	// 删除过滤文件后恢复默认过滤器
+	if err := os.Remove(s.config.FilterPath); err != nil {
+		t.Fatal(err)
+	}
+	s.loadModelFilter()
+	if got := listedModelNames(t, s); len(got) != 1 {
+		t.Errorf("listed models = %v, want the default filter back", got)
+	}
+}
+
+func TestDefaultFilterDisabled(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true}, upstream, "meta/llama-3-8b:free", "meta/llama-guard-4-12b:free")
+
+	if got := listedModelNames(t, s); len(got) != 2 {
+		t.Errorf("listed models = %v, want no filtering when the default filter is disabled", got)
+	}
+}
+
+func TestDefaultModelFilterParses(t *testing.T) {
+	filter := DefaultModelFilter()
+	if filter.Empty() {
+		t.Fatal("embedded default filter has no patterns")
+	}
+	for _, p := range filter.Patterns() {
+		if strings.HasPrefix(p, commentPrefix) {
+			t.Errorf("comment line %q parsed as a pattern", p)
+		}
+	}
+}
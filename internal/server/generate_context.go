@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxGenerateContexts 限制保存的 /api/generate 会话数，超出时淘汰最早的会话
+const maxGenerateContexts = 1000
+
+// encodeMessages 将消息列表编码为 gzip 压缩后再 base64 编码的 JSON
+func encodeMessages(messages []openai.ChatCompletionMessage) (string, error) {
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decodeMessages 是 encodeMessages 的逆过程
+func decodeMessages(encoded string) ([]openai.ChatCompletionMessage, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	var messages []openai.ChatCompletionMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// generateContextStore 在内存中保存 /api/generate 的会话历史。OpenRouter 是无状态的，
+// 返回给客户端的 context 只是一个会话 ID，下次请求携带它时取回之前的消息
+type generateContextStore struct {
+	mu      sync.Mutex
+	nextID  int
+	entries map[int]string
+	order   []int
+}
+
+func newGenerateContextStore() *generateContextStore {
+	return &generateContextStore{nextID: 1, entries: make(map[int]string)}
+}
+
+// save 保存消息历史并返回作为 context 的会话 ID
+func (g *generateContextStore) save(messages []openai.ChatCompletionMessage) ([]int, error) {
+	encoded, err := encodeMessages(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id := g.nextID
+	g.nextID++
+	g.entries[id] = encoded
+	g.order = append(g.order, id)
+	for len(g.order) > maxGenerateContexts {
+		delete(g.entries, g.order[0])
+		g.order = g.order[1:]
+	}
+	return []int{id}, nil
+}
+
+// load 取回 context 对应的消息历史，context 未知或已被淘汰时返回 false
+func (g *generateContextStore) load(context []int) ([]openai.ChatCompletionMessage, bool) {
+	if len(context) != 1 {
+		return nil, false
+	}
+
+	g.mu.Lock()
+	encoded, ok := g.entries[context[0]]
+	g.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	messages, err := decodeMessages(encoded)
+	if err != nil {
+		return nil, false
+	}
+	return messages, true
+}
+
+// generateMessages 构造 /api/generate 发往上游的消息：context 有效时接在之前的会话之后，
+// 新的 system 提示替换历史中的 system 消息
+func (s *Server) generateMessages(req GenerateRequest) []openai.ChatCompletionMessage {
+	var history []openai.ChatCompletionMessage
+	if len(req.Context) > 0 {
+		prior, ok := s.generateContexts.load(req.Context)
+		if ok {
+			history = prior
+		} else {
+			slog.Warn("Unknown generate context, starting a new conversation", "context_len", len(req.Context))
+		}
+	}
+
+	var messages []openai.ChatCompletionMessage
+	if req.System != "" {
+		messages = append(messages, openai.ChatCompletionMessage{Role: "system", Content: req.System})
+		for len(history) > 0 && history[0].Role == "system" {
+			history = history[1:]
+		}
+	}
+	messages = append(messages, history...)
+	return append(messages, openai.ChatCompletionMessage{Role: "user", Content: req.Prompt})
+}
+
+// saveGenerateContext 保存本轮请求与回复，返回下次请求可携带的 context，失败时返回 nil
+func (s *Server) saveGenerateContext(messages []openai.ChatCompletionMessage, reply string) []int {
+	history := append(append([]openai.ChatCompletionMessage(nil), messages...),
+		openai.ChatCompletionMessage{Role: "assistant", Content: reply})
+	context, err := s.generateContexts.save(history)
+	if err != nil {
+		slog.Error("Failed to save generate context", "error", err)
+		return nil
+	}
+	return context
+}
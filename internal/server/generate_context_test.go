@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEncodeDecodeMessages(t *testing.T) {
+	in := []openai.ChatCompletionMessage{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "你好, what's 2+2?"},
+		{Role: "assistant", Content: "4"},
+	}
+	encoded, err := encodeMessages(in)
+	if err != nil {
+		t.Fatalf("encodeMessages() error = %v", err)
+	}
+	out, err := decodeMessages(encoded)
+	if err != nil {
+		t.Fatalf("decodeMessages() error = %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip = %v, want %v", out, in)
+	}
+
+	if _, err := decodeMessages("not base64!"); err == nil {
+		t.Error("decodeMessages() accepted garbage")
+	}
+}
+
+func TestGenerateContextStoreEvictsOldest(t *testing.T) {
+	store := newGenerateContextStore()
+	first, err := store.save([]openai.ChatCompletionMessage{{Role: "user", Content: "first"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxGenerateContexts; i++ {
+		store.save([]openai.ChatCompletionMessage{{Role: "user", Content: "filler"}})
+	}
+	if _, ok := store.load(first); ok {
+		t.Error("oldest context was not evicted")
+	}
+	if _, ok := store.load([]int{1, 2, 3}); ok {
+		t.Error("load() accepted a foreign token array")
+	}
+}
+
+func TestGenerateContextTwoTurns(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		name := "non-stream"
+		if stream {
+			name = "stream"
+		}
+		t.Run(name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			s := newTestServer(t, Config{}, upstream)
+			r := s.buildRouter()
+
+			streamField := "false"
+			if stream {
+				streamField = "true"
+			}
+			first := `{"model":"model-a","stream":` + streamField + `,"system":"be brief","prompt":"my name is Ada"}`
+			w := doJSON(t, r, http.MethodPost, "/api/generate", first)
+			if w.Code != http.StatusOK {
+				t.Fatalf("first turn status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+			var final GenerateResponse
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &final); err != nil {
+				t.Fatalf("decode final frame: %v", err)
+			}
+			if len(final.Context) == 0 {
+				t.Fatalf("first turn returned no context: %s", w.Body.String())
+			}
+
+			ctx, _ := json.Marshal(final.Context)
+			second := `{"model":"model-a","stream":` + streamField + `,"prompt":"what is my name?","context":` + string(ctx) + `}`
+			if w := doJSON(t, r, http.MethodPost, "/api/generate", second); w.Code != http.StatusOK {
+				t.Fatalf("second turn status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			raw, _ := json.Marshal(upstream.lastRequest(t)["messages"])
+			var got []openai.ChatCompletionMessage
+			json.Unmarshal(raw, &got)
+			want := []openai.ChatCompletionMessage{
+				{Role: "system", Content: "be brief"},
+				{Role: "user", Content: "my name is Ada"},
+				{Role: "assistant", Content: "hello world"},
+				{Role: "user", Content: "what is my name?"},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("second turn messages = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"fmt"
+	"math"
+)
+
+// generateOptions 是 /api/generate 的 options 中转发给上游的部分
+type generateOptions struct {
+	Stop      []string
+	MaxTokens int
+}
+
+// parseGenerateOptions 解析 options.stop（字符串或字符串数组）和 options.num_predict。
+// num_predict 不大于 0（Ollama 中 -1 表示不限制）时不设置 MaxTokens；其余选项忽略
+func parseGenerateOptions(options map[string]interface{}) (generateOptions, error) {
+	var opts generateOptions
+
+	switch stop := options["stop"].(type) {
+	case nil:
+	case string:
+		if stop != "" {
+			opts.Stop = []string{stop}
+		}
+	case []interface{}:
+		for _, item := range stop {
+			seq, ok := item.(string)
+			if !ok {
+				return generateOptions{}, fmt.Errorf("options.stop must be a string or an array of strings")
+			}
+			opts.Stop = append(opts.Stop, seq)
+		}
+	default:
+		return generateOptions{}, fmt.Errorf("options.stop must be a string or an array of strings")
+	}
+
+	switch n := options["num_predict"].(type) {
+	case nil:
+	case float64:
+		if n != math.Trunc(n) {
+			return generateOptions{}, fmt.Errorf("options.num_predict must be an integer")
+		}
+		if n > 0 {
+			opts.MaxTokens = int(n)
+		}
+	default:
+		return generateOptions{}, fmt.Errorf("options.num_predict must be an integer")
+	}
+
+	return opts, nil
+}
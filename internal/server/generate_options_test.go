@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGenerateOptions(t *testing.T) {
+	cases := []struct {
+		name    string
+		options string
+		want    generateOptions
+		wantErr bool
+	}{
+		{"empty", `{}`, generateOptions{}, false},
+		{"stop string", `{"stop":"\n"}`, generateOptions{Stop: []string{"\n"}}, false},
+		{"stop array", `{"stop":["END","###"]}`, generateOptions{Stop: []string{"END", "###"}}, false},
+		{"num_predict", `{"num_predict":64}`, generateOptions{MaxTokens: 64}, false},
+		{"num_predict unlimited", `{"num_predict":-1}`, generateOptions{}, false},
+		{"stop number", `{"stop":3}`, generateOptions{}, true},
+		{"stop mixed array", `{"stop":["a",1]}`, generateOptions{}, true},
+		{"num_predict fraction", `{"num_predict":1.5}`, generateOptions{}, true},
+		{"num_predict string", `{"num_predict":"10"}`, generateOptions{}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var options map[string]interface{}
+			if err := json.Unmarshal([]byte(tc.options), &options); err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseGenerateOptions(options)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("options = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGenerateAppliesOptions(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+				model, _ := body["model"].(string)
+				if body["stream"] == true {
+					w.Header().Set("Content-Type", "text/event-stream")
+					fmt.Fprintf(w, `data: {"id":"gen-test","model":%q,"choices":[{"index":0,"delta":{"content":"once upon"}}]}`+"\n\n", model)
+					fmt.Fprintf(w, `data: {"id":"gen-test","model":%q,"choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`+"\n\n", model)
+					fmt.Fprint(w, "data: [DONE]\n\n")
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"id":"gen-test","model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":"once upon"},"finish_reason":"length"}]}`, model)
+			}
+			s := newTestServer(t, Config{}, upstream)
+
+			body := fmt.Sprintf(`{"model":"model-a","prompt":"tell a story","stream":%v,"options":{"stop":["END","###"],"num_predict":2}}`, stream)
+			w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/generate", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			sent := upstream.lastRequest(t)
+			if got := fmt.Sprint(sent["stop"]); got != "[END ###]" {
+				t.Errorf("upstream stop = %v, want [END ###]", sent["stop"])
+			}
+			if sent["max_tokens"] != float64(2) {
+				t.Errorf("upstream max_tokens = %v, want 2", sent["max_tokens"])
+			}
+
+			lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+			var final GenerateResponse
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &final); err != nil {
+				t.Fatal(err)
+			}
+			if !final.Done || final.DoneReason != "length" {
+				t.Errorf("final response done=%v done_reason=%q, want done with length", final.Done, final.DoneReason)
+			}
+		})
+	}
+}
+
+func TestGenerateRejectsInvalidOptions(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/generate",
+		`{"model":"model-a","prompt":"hi","stream":false,"options":{"stop":42}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+	if got := upstream.requestedModels(); len(got) != 0 {
+		t.Errorf("upstream requests = %v, want none", got)
+	}
+}
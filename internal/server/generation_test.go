@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGenerationIDHeader(t *testing.T) {
+	tests := []struct {
+		path   string
+		stream bool
+	}{
+		{"/v1/chat/completions", false},
+		{"/v1/chat/completions", true},
+		{"/api/chat", false},
+		{"/api/chat", true},
+		{"/api/generate", false},
+		{"/api/generate", true},
+	}
+
+	for _, tt := range tests {
+		name := tt.path
+		if tt.stream {
+			name += " stream"
+		}
+		t.Run(name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			s := newTestServer(t, Config{}, upstream)
+			r := s.buildRouter()
+
+			stream := "false"
+			if tt.stream {
+				stream = "true"
+			}
+			body := `{"model":"model-a","stream":` + stream + `,"prompt":"hi","messages":[{"role":"user","content":"hi"}]}`
+			w := doJSON(t, r, http.MethodPost, tt.path, body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get(generationIDHeader); got != "gen-test" {
+				t.Errorf("%s = %q, want gen-test", generationIDHeader, got)
+			}
+		})
+	}
+}
+
+func TestGenerationIDHeaderAbsentWithoutUpstreamID(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"chat.completion","model":"org/model-a","choices":[
+			{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}
+	s := newTestServer(t, Config{}, upstream)
+
+	body := `{"model":"model-a","messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(generationIDHeader); got != "" {
+		t.Errorf("%s = %q, want empty", generationIDHeader, got)
+	}
+}
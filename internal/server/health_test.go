@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		upstreamUp bool
+		wantCode   int
+		wantStatus string
+	}{
+		{"shallow ignores upstream", "/health", false, http.StatusOK, "ok"},
+		{"deep healthy", "/health?deep=true", true, http.StatusOK, "ok"},
+		{"deep degraded", "/health?deep=true", false, http.StatusServiceUnavailable, "degraded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			s := newTestServer(t, Config{}, upstream)
+			if !tt.upstreamUp {
+				upstream.Close()
+			}
+
+			w := doJSON(t, s.buildRouter(), http.MethodGet, tt.path, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			var body struct {
+				Status string `json:"status"`
+				Error  string `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Status != tt.wantStatus {
+				t.Errorf("status field = %q, want %q", body.Status, tt.wantStatus)
+			}
+			if tt.wantStatus == "degraded" && body.Error == "" {
+				t.Error("degraded response carries no upstream error")
+			}
+		})
+	}
+}
+
+func TestDeepHealthReportsUpstreamRejection(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeUpstreamError(w, http.StatusUnauthorized, "invalid api key")
+	}))
+	defer upstream.Close()
+
+	s := New(Config{BaseURL: upstream.URL + "/"})
+	provider, err := s.newProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.provider = provider
+
+	w := doJSON(t, s.buildRouter(), http.MethodGet, "/health?deep=1", "")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "invalid api key") {
+		t.Errorf("status = %d, want 503 with the upstream error, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDeepHealthChecksAPIKey(t *testing.T) {
+	// 模型列表是公开接口，无效密钥同样返回 200；只有 /auth/key 会拒绝
+	mux := http.NewServeMux()
+	mux.HandleFunc("/models", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list","data":[{"id":"org/model-a:free","pricing":{"prompt":"0","completion":"0"}}]}`))
+	})
+	mux.HandleFunc("/auth/key", func(w http.ResponseWriter, r *http.Request) {
+		writeUpstreamError(w, http.StatusUnauthorized, "invalid api key")
+	})
+	upstream := httptest.NewServer(mux)
+	defer upstream.Close()
+
+	s := New(Config{BaseURL: upstream.URL + "/", APIKey: "bad"})
+	provider, err := s.newProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.provider = provider
+	w := doJSON(t, s.buildRouter(), http.MethodGet, "/health?deep=true", "")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "invalid api key") {
+		t.Errorf("status = %d, want 503 with the key rejection, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPreflightChecksAPIKey(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/models", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list","data":[{"id":"org/model-a:free","pricing":{"prompt":"0","completion":"0"}}]}`))
+	})
+	mux.HandleFunc("/auth/key", func(w http.ResponseWriter, r *http.Request) {
+		writeUpstreamError(w, http.StatusUnauthorized, "invalid api key")
+	})
+	upstream := httptest.NewServer(mux)
+	defer upstream.Close()
+
+	for _, freeMode := range []bool{false, true} {
+		s := New(Config{BaseURL: upstream.URL + "/", APIKey: "bad", FreeMode: freeMode, ConfigDir: t.TempDir()})
+		if _, err := s.Preflight(); err == nil || !strings.Contains(err.Error(), "invalid api key") {
+			t.Errorf("free mode %v: Preflight() error = %v, want the key rejection", freeMode, err)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+)
+
+// fakeModel 描述假上游返回的一个模型
+type fakeModel struct {
+	ID                  string
+	ContextLength       int
+	SupportedParameters []string
+	Prompt              string
+	Completion          string
+}
+
+// fakeUpstream 模拟 OpenRouter API，记录收到的聊天请求体
+type fakeUpstream struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	models   []fakeModel
+	requests []map[string]interface{}
+	headers  []http.Header
+	// chat 处理 /chat/completions，为空时按请求的 stream 字段返回固定内容
+	chat func(w http.ResponseWriter, body map[string]interface{})
+}
+
+func newFakeUpstream(t testing.TB, models ...fakeModel) *fakeUpstream {
+	t.Helper()
+
+	f := &fakeUpstream{models: models}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/models", f.handleModels)
+	mux.HandleFunc("/chat/completions", f.handleChat)
+	mux.HandleFunc("/auth/key", f.handleAuthKey)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeUpstream) handleModels(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data := make([]map[string]interface{}, 0, len(f.models))
+	for _, m := range f.models {
+		prompt, completion := m.Prompt, m.Completion
+		if prompt == "" {
+			prompt = "0"
+		}
+		if completion == "" {
+			completion = "0"
+		}
+		data = append(data, map[string]interface{}{
+			"id":                   m.ID,
+			"object":               "model",
+			"context_length":       m.ContextLength,
+			"supported_parameters": m.SupportedParameters,
+			"top_provider":         map[string]interface{}{"context_length": m.ContextLength},
+			"pricing":              map[string]string{"prompt": prompt, "completion": completion},
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"object": "list", "data": data})
+}
+
+func (f *fakeUpstream) handleAuthKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"label": "test"}})
+}
+
+func (f *fakeUpstream) handleChat(w http.ResponseWriter, r *http.Request) {
+	raw, _ := io.ReadAll(r.Body)
+	var body map[string]interface{}
+	json.Unmarshal(raw, &body)
+
+	f.mu.Lock()
+	f.requests = append(f.requests, body)
+	f.headers = append(f.headers, r.Header.Clone())
+	chat := f.chat
+	f.mu.Unlock()
+
+	if chat != nil {
+		chat(w, body)
+		return
+	}
+
+	model, _ := body["model"].(string)
+	if stream, _ := body["stream"].(bool); stream {
+		writeChatStream(w, model, "hello", " world")
+		return
+	}
+	writeChatCompletion(w, model, "hello world")
+}
+
+// lastRequest 返回最近一次聊天请求体
+func (f *fakeUpstream) lastRequest(t *testing.T) map[string]interface{} {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) == 0 {
+		t.Fatal("upstream received no chat requests")
+	}
+	return f.requests[len(f.requests)-1]
+}
+
+// requestedModels 返回按顺序收到的聊天请求所用模型
+func (f *fakeUpstream) requestedModels() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	models := make([]string, 0, len(f.requests))
+	for _, body := range f.requests {
+		m, _ := body["model"].(string)
+		models = append(models, m)
+	}
+	return models
+}
+
+func writeChatCompletion(w http.ResponseWriter, model, content string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		ID:     "gen-test",
+		Object: "chat.completion",
+		Model:  model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: "assistant", Content: content},
+			FinishReason: openai.FinishReasonStop,
+		}},
+		Usage: openai.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5},
+	})
+}
+
+func writeChatStream(w http.ResponseWriter, model string, deltas ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, d := range deltas {
+		chunk := openai.ChatCompletionStreamResponse{
+			ID:    "gen-test",
+			Model: model,
+			Choices: []openai.ChatCompletionStreamChoice{{
+				Delta: openai.ChatCompletionStreamChoiceDelta{Content: d},
+			}},
+		}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	final, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+		ID:    "gen-test",
+		Model: model,
+		Choices: []openai.ChatCompletionStreamChoice{{
+			FinishReason: openai.FinishReasonStop,
+		}},
+	})
+	fmt.Fprintf(w, "data: %s\n\n", final)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func writeUpstreamError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"message": message, "code": status},
+	})
+}
+
+// newTestServer 创建指向假上游的 Server；免费模式下 freeModels 直接作为免费模型列表
+func newTestServer(t testing.TB, cfg Config, upstream *fakeUpstream, freeModels ...string) *Server {
+	t.Helper()
+
+	cfg.BaseURL = upstream.URL + "/"
+	if cfg.ConfigDir == "" {
+		cfg.ConfigDir = t.TempDir()
+	}
+	if cfg.FilterPath == "" {
+		cfg.FilterPath = filepath.Join(cfg.ConfigDir, "models-filter")
+	}
+	// 测试默认不重试，避免重试退避拖慢用例并干扰上游请求计数
+	if cfg.MaxRetries == nil {
+		noRetries := 0
+		cfg.MaxRetries = &noRetries
+	}
+
+	s := New(cfg)
+	provider, err := s.newProvider()
+	if err != nil {
+		t.Fatalf("newProvider() error = %v", err)
+	}
+	s.provider = provider
+	if cfg.FreeMode {
+		store, err := NewFailureStore(filepath.Join(cfg.ConfigDir, "failures.db"))
+		if err != nil {
+			t.Fatalf("NewFailureStore() error = %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		s.failureStore = store
+		s.permanentFails = NewPermanentFailureTracker(store)
+		s.setFreeModels(freeModels)
+	}
+	s.loadModelFilter()
+	return s
+}
+
+// doJSON 向路由发送 JSON 请求并返回响应记录
+func doJSON(t *testing.T, r *gin.Engine, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+)
+
+// incrementalNonStreaming 判断非流式请求是否走增量写出。需要组装工具调用或多个 choice 的请求
+// 仍按原方式缓冲完整响应
+func (s *Server) incrementalNonStreaming(request openai.ChatCompletionRequest) bool {
+	return s.config.IncrementalNonStream && request.N <= 1 && !requestHasTools(request)
+}
+
+// handleOpenAIIncremental 以上游流的方式获取回复，并逐块写出非流式的 chat.completion 响应体。
+// 内存占用与单个分块相当，与回复总长度无关；代价是响应头写出后无法再改变状态码，
+// 中途出错时以 finish_reason "error" 结束响应体。推理内容在内容之后写出，需要缓冲。此路径不读写响应缓存
+func (s *Server) handleOpenAIIncremental(c *gin.Context, request openai.ChatCompletionRequest) {
+	// 请求上游在流末尾返回用量，以便响应体与缓冲模式一样带有 usage
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	stream, fullModelName, ok := s.openOpenAIStream(c, request)
+	if !ok {
+		return
+	}
+	stream = s.dedupeChunks(stream, fullModelName)
+	defer stream.Close()
+
+	// 先读到第一个分块再写响应头，这样上游在开头失败时仍能返回正确的错误状态码
+	first, err := stream.Recv()
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(c, upstreamErrorStatus(err, http.StatusBadGateway), err)
+		return
+	}
+	setGenerationID(c, first.ID)
+
+	model, _ := json.Marshal(fullModelName)
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := c.Writer
+	fmt.Fprintf(w, `{"id":"chatcmpl-%d","object":"chat.completion","created":%d,"model":%s,`+
+		`"choices":[{"index":0,"message":{"role":"assistant","content":"`,
+		time.Now().Unix(), time.Now().Unix(), model)
+
+	finishReason := openai.FinishReasonStop
+	var usage *openai.Usage
+	var reasoning strings.Builder
+	chunk := first
+	for err == nil {
+		if len(chunk.Choices) > 0 {
+			writeJSONStringContent(w, chunk.Choices[0].Delta.Content)
+			reasoning.WriteString(reasoningAt(chunk.Reasoning, 0))
+			if chunk.Choices[0].FinishReason != "" {
+				finishReason = chunk.Choices[0].FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		chunk, err = stream.Recv()
+	}
+	if !errors.Is(err, io.EOF) {
+		slog.Error("upstream stream failed mid-response", "model", fullModelName, "error", err)
+		finishReason = "error"
+	}
+
+	io.WriteString(w, `"`)
+	if reasoning.Len() > 0 {
+		r, _ := json.Marshal(reasoning.String())
+		fmt.Fprintf(w, `,"reasoning":%s`, r)
+	}
+	reason, _ := json.Marshal(finishReason)
+	fmt.Fprintf(w, `},"finish_reason":%s}]`, reason)
+	if usage != nil {
+		u, _ := json.Marshal(usage)
+		fmt.Fprintf(w, `,"usage":%s`, u)
+	}
+	io.WriteString(w, "}")
+}
+
+// writeJSONStringContent 写出 s 经 JSON 转义后的内容（不含首尾引号）
+func writeJSONStringContent(w io.Writer, s string) {
+	if s == "" {
+		return
+	}
+	quoted, _ := json.Marshal(s)
+	w.Write(quoted[1 : len(quoted)-1])
+}
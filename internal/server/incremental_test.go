@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// signalWriter 是只统计字节数的 ResponseWriter，首次写出响应体时关闭 started
+type signalWriter struct {
+	header  http.Header
+	status  int
+	mu      sync.Mutex
+	body    strings.Builder
+	keep    bool
+	written int
+	started chan struct{}
+	once    sync.Once
+}
+
+func newSignalWriter(keep bool) *signalWriter {
+	return &signalWriter{header: http.Header{}, keep: keep, started: make(chan struct{})}
+}
+
+func (w *signalWriter) Header() http.Header { return w.header }
+
+func (w *signalWriter) WriteHeader(status int) { w.status = status }
+
+func (w *signalWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.written += len(p)
+	if w.keep {
+		w.body.Write(p)
+	}
+	w.mu.Unlock()
+	w.once.Do(func() { close(w.started) })
+	return len(p), nil
+}
+
+func (w *signalWriter) Flush() {}
+
+// writeGatedStream 先写出 before 个分块，等待 gate 关闭后再写出剩余分块
+func writeGatedStream(w http.ResponseWriter, model, delta string, before, after int, gate <-chan struct{}) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	chunk := func(content string, finish openai.FinishReason) {
+		data, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			ID:    "gen-test",
+			Model: model,
+			Choices: []openai.ChatCompletionStreamChoice{{
+				Delta:        openai.ChatCompletionStreamChoiceDelta{Content: content},
+				FinishReason: finish,
+			}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	for i := 0; i < before; i++ {
+		chunk(delta, "")
+	}
+	w.(http.Flusher).Flush()
+	if gate != nil {
+		<-gate
+	}
+	for i := 0; i < after; i++ {
+		chunk(delta, "")
+	}
+	chunk("", openai.FinishReasonLength)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func TestIncrementalNonStreamWritesBeforeUpstreamFinishes(t *testing.T) {
+	gate := make(chan struct{})
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		if stream, _ := body["stream"].(bool); !stream {
+			t.Error("incremental mode sent a non-streaming upstream request")
+		}
+		writeGatedStream(w, "org/model-a", `say "hi"<`, 10, 10, gate)
+	}
+	s := newTestServer(t, Config{IncrementalNonStream: true}, upstream)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"model-a","messages":[{"role":"user","content":"hi"}]}`))
+	w := newSignalWriter(true)
+	done := make(chan struct{})
+	go func() {
+		s.buildRouter().ServeHTTP(w, req)
+		close(done)
+	}()
+
+	select {
+	case <-w.started:
+	case <-time.After(5 * time.Second):
+		close(gate)
+		t.Fatal("no bytes written before the upstream stream finished")
+	}
+	close(gate)
+	<-done
+
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal([]byte(w.body.String()), &resp); err != nil {
+		t.Fatalf("response is not valid JSON: %v, body = %s", err, w.body.String())
+	}
+	if resp.Object != "chat.completion" || len(resp.Choices) != 1 {
+		t.Fatalf("unexpected response shape: %+v", resp)
+	}
+	if want := strings.Repeat(`say "hi"<`, 20); resp.Choices[0].Message.Content != want {
+		t.Errorf("content = %q, want %q", resp.Choices[0].Message.Content, want)
+	}
+	if resp.Choices[0].FinishReason != openai.FinishReasonLength {
+		t.Errorf("finish_reason = %q, want length", resp.Choices[0].FinishReason)
+	}
+	if got := w.header.Get(generationIDHeader); got != "gen-test" {
+		t.Errorf("%s = %q, want gen-test", generationIDHeader, got)
+	}
+}
+
+func TestIncrementalNonStreamUpstreamErrorStatus(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		writeUpstreamError(w, http.StatusTooManyRequests, "slow down")
+	}
+	s := newTestServer(t, Config{IncrementalNonStream: true}, upstream)
+
+	body := `{"model":"model-a","messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429, body = %s", w.Code, w.Body.String())
+	}
+}
+
+// BenchmarkIncrementalNonStream 报告约 4MB 回复的分配量；增量模式下每次操作的内存
+// 不随回复长度增长到整个响应体
+func BenchmarkIncrementalNonStream(b *testing.B) {
+	for _, incremental := range []bool{false, true} {
+		b.Run(fmt.Sprintf("incremental=%v", incremental), func(b *testing.B) {
+			upstream := newFakeUpstream(b, fakeModel{ID: "org/model-a"})
+			delta := strings.Repeat("x", 1024)
+			upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+				if stream, _ := body["stream"].(bool); stream {
+					writeGatedStream(w, "org/model-a", delta, 4096, 0, nil)
+					return
+				}
+				writeChatCompletion(w, "org/model-a", strings.Repeat(delta, 4096))
+			}
+			s := newTestServer(b, Config{IncrementalNonStream: incremental}, upstream)
+			r := s.buildRouter()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+					strings.NewReader(`{"model":"model-a","messages":[{"role":"user","content":"hi"}]}`))
+				r.ServeHTTP(newSignalWriter(false), req)
+			}
+		})
+	}
+}
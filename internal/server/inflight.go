@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errTooManyInFlight 是超过全局并发上限时返回的错误
+var errTooManyInFlight = errors.New("too many concurrent requests, try again later")
+
+// errQueueFull 和 errQueueTimeout 是排队队列已满、排队超时时返回的错误
+var (
+	errQueueFull    = errors.New("request queue is full, try again later")
+	errQueueTimeout = errors.New("timed out waiting in the request queue, try again later")
+)
+
+// inflightRetryAfter 是超过全局并发上限时建议客户端等待的秒数
+const inflightRetryAfter = "1"
+
+// inflightReleaseKey 是 gin.Context 中释放当前请求并发槽位的 func() 的键。
+// 流被移交给后台捕获读取时，由后台读取结束后调用它释放槽位
+const inflightReleaseKey = "inflight_release"
+
+// DefaultQueueMaxWait 是请求在并发队列中的默认最长等待时间
+const DefaultQueueMaxWait = 30 * time.Second
+
+var requestQueueRejectionsTotal = newCounterVec(
+	"ollama_router_request_queue_rejections_total",
+	"Requests rejected by the request queue, by reason (full, timeout).",
+	"reason",
+)
+
+// newInflightSlots 创建容量为 n 的并发槽位，n 不大于 0 时返回 nil 表示不限制
+func newInflightSlots(n int) chan struct{} {
+	if n <= 0 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// inflightMiddleware 限制同时处理的聊天和生成请求数。超过 MaxConcurrentRequests 时，
+// 配置了 QueueMaxDepth 的请求排队等待槽位，队列已满或等待超过 QueueMaxWait 时以 503 拒绝。
+// 槽位在处理器返回后释放，流式响应中途出错或 panic 时同样会释放；
+// 客户端断开后上游流移交给后台捕获读取时，槽位保留到后台读取结束
+func (s *Server) inflightMiddleware(c *gin.Context) {
+	if s.inflight == nil {
+		c.Next()
+		return
+	}
+
+	select {
+	case s.inflight <- struct{}{}:
+	default:
+		if err := s.waitInQueue(c); err != nil {
+			c.Header("Retry-After", inflightRetryAfter)
+			writeError(c, http.StatusServiceUnavailable, err)
+			c.Abort()
+			return
+		}
+	}
+	release := sync.OnceFunc(func() { <-s.inflight })
+	c.Set(inflightReleaseKey, release)
+	defer func() {
+		if !c.GetBool(captureDetachedKey) {
+			release()
+		}
+	}()
+
+	c.Next()
+}
+
+// waitInQueue 在队列未满时排队等待并发槽位，拿到槽位时返回 nil。
+// 未配置队列时直接返回 errTooManyInFlight
+func (s *Server) waitInQueue(c *gin.Context) error {
+	if s.config.QueueMaxDepth <= 0 {
+		return errTooManyInFlight
+	}
+	if s.inflightQueued.Add(1) > int64(s.config.QueueMaxDepth) {
+		s.inflightQueued.Add(-1)
+		requestQueueRejectionsTotal.inc("full")
+		return errQueueFull
+	}
+	defer s.inflightQueued.Add(-1)
+
+	var timeout <-chan time.Time
+	if s.config.QueueMaxWait > 0 {
+		timer := time.NewTimer(s.config.QueueMaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	start := time.Now()
+	defer func() { addTiming(c.Request.Context(), phaseQueue, time.Since(start)) }()
+	select {
+	case s.inflight <- struct{}{}:
+		return nil
+	case <-timeout:
+		requestQueueRejectionsTotal.inc("timeout")
+		return errQueueTimeout
+	case <-c.Request.Context().Done():
+		return c.Request.Context().Err()
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrentRequestsSheds(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		entered <- struct{}{}
+		<-release
+		writeChatCompletion(w, "org/model-a", "done")
+	}
+	s := newTestServer(t, Config{MaxConcurrentRequests: 1}, upstream)
+	r := s.buildRouter()
+
+	body := `{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+
+	var wg sync.WaitGroup
+	var first *httptest.ResponseRecorder
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		first = doJSON(t, r, http.MethodPost, "/api/chat", body)
+	}()
+
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first request never reached upstream")
+	}
+
+	w := doJSON(t, r, http.MethodPost, "/v1/chat/completions", body)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("saturated status = %d, want 503, body = %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Retry-After"); got == "" {
+		t.Error("saturated response has no Retry-After header")
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/tags", ""); w.Code != http.StatusOK {
+		t.Errorf("/api/tags while saturated: status = %d, want 200", w.Code)
+	}
+
+	close(release)
+	wg.Wait()
+	if first.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, body = %s", first.Code, first.Body.String())
+	}
+
+	go func() { <-entered }()
+	if w := doJSON(t, r, http.MethodPost, "/api/chat", body); w.Code != http.StatusOK {
+		t.Errorf("after release: status = %d, want 200", w.Code)
+	}
+}
+
+func TestInflightSlotReleasedAfterStreamError(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {not json}\n\n"))
+	}
+	s := newTestServer(t, Config{MaxConcurrentRequests: 1}, upstream)
+	r := s.buildRouter()
+
+	body := `{"model":"model-a","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	for i := 0; i < 3; i++ {
+		if w := doJSON(t, r, http.MethodPost, "/api/chat", body); w.Code == http.StatusServiceUnavailable {
+			t.Fatalf("request %d shed after a failed stream, slot was not released", i)
+		}
+	}
+	if n := len(s.inflight); n != 0 {
+		t.Errorf("in-flight slots = %d, want 0", n)
+	}
+}
+
+func TestRequestQueueDrainsAndRejectsOverDepth(t *testing.T) {
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		entered <- struct{}{}
+		<-release
+		writeChatCompletion(w, "org/model-a", "done")
+	}
+	s := newTestServer(t, Config{MaxConcurrentRequests: 1, QueueMaxDepth: 1, QueueMaxWait: 5 * time.Second, MetricsEnabled: true}, upstream)
+	r := s.buildRouter()
+
+	body := `{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 2)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = doJSON(t, r, http.MethodPost, "/api/chat", body)
+		}()
+		if i == 0 {
+			select {
+			case <-entered:
+			case <-time.After(5 * time.Second):
+				t.Fatal("first request never reached upstream")
+			}
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.inflightQueued.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second request never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	metrics := doJSON(t, r, http.MethodGet, "/metrics", "")
+	if !strings.Contains(metrics.Body.String(), "ollama_router_request_queue_depth 1\n") {
+		t.Errorf("metrics missing queue depth 1:\n%s", metrics.Body.String())
+	}
+
+	w := doJSON(t, r, http.MethodPost, "/api/chat", body)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "queue is full") {
+		t.Errorf("over-depth status = %d, body = %s, want 503 queue full", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Retry-After"); got == "" {
+		t.Error("over-depth response has no Retry-After header")
+	}
+
+	close(release)
+	wg.Wait()
+	for i, res := range results {
+		if res.Code != http.StatusOK {
+			t.Errorf("request %d status = %d, body = %s", i, res.Code, res.Body.String())
+		}
+	}
+	if got := s.inflightQueued.Load(); got != 0 {
+		t.Errorf("queue depth after drain = %d, want 0", got)
+	}
+}
+
+func TestRequestQueueTimesOut(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		entered <- struct{}{}
+		<-release
+		writeChatCompletion(w, "org/model-a", "done")
+	}
+	s := newTestServer(t, Config{MaxConcurrentRequests: 1, QueueMaxDepth: 4, QueueMaxWait: 50 * time.Millisecond}, upstream)
+	r := s.buildRouter()
+
+	body := `{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		doJSON(t, r, http.MethodPost, "/api/chat", body)
+	}()
+	<-entered
+
+	w := doJSON(t, r, http.MethodPost, "/api/chat", body)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "timed out") {
+		t.Errorf("queued status = %d, body = %s, want 503 timeout", w.Code, w.Body.String())
+	}
+	close(release)
+	<-done
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultKeepAlive 是请求未携带 keep_alive 时模型在 /api/ps 中保留的时间，与 Ollama 的默认值相同
+const DefaultKeepAlive = 5 * time.Minute
+
+// keepAliveForever 是 keep_alive 为负值（一直保留）时 /api/ps 报告的剩余时间
+const keepAliveForever = 100 * 365 * 24 * time.Hour
+
+// parseKeepAlive 解析 Ollama 的 keep_alive 字段：数字按秒计，字符串为时长（如 "10m"）或秒数，
+// 负值表示一直保留，0 表示立即移除。未提供时返回 DefaultKeepAlive
+func parseKeepAlive(raw json.RawMessage) (time.Duration, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return DefaultKeepAlive, nil
+	}
+
+	var seconds float64
+	if err := json.Unmarshal(raw, &seconds); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return 0, fmt.Errorf("invalid keep_alive %s: must be a duration or a number of seconds", raw)
+	}
+	if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid keep_alive %q: must be a duration or a number of seconds", text)
+	}
+	return d, nil
+}
+
+// runningModels 记录最近请求过的模型及其在 /api/ps 中的过期时间。OpenRouter 上的模型无需加载，
+// 这里只是按 keep_alive 模拟 Ollama 的模型驻留，供依赖 /api/ps 的客户端判断模型状态
+type runningModels struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	now     func() time.Time
+}
+
+func newRunningModels() *runningModels {
+	return &runningModels{expires: make(map[string]time.Time), now: time.Now}
+}
+
+// touch 按 keepAlive 更新模型的过期时间；keepAlive 为 0 时立即移除，为负值时一直保留
+func (r *runningModels) touch(model string, keepAlive time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case keepAlive == 0:
+		delete(r.expires, model)
+	case keepAlive < 0:
+		r.expires[model] = r.now().Add(keepAliveForever)
+	default:
+		r.expires[model] = r.now().Add(keepAlive)
+	}
+}
+
+// list 删除已过期的模型，返回其余模型，按模型名排序
+func (r *runningModels) list() []RunningModel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	models := make([]RunningModel, 0, len(r.expires))
+	for model, expires := range r.expires {
+		if !expires.After(now) {
+			delete(r.expires, model)
+			continue
+		}
+		models = append(models, RunningModel{
+			Name:      model,
+			Model:     model,
+			Details:   ModelDetails{Format: "gguf", Families: []string{}},
+			ExpiresAt: expires,
+		})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Name < models[j].Name })
+	return models
+}
+
+// keepModelAlive 在请求成功后按 keep_alive 更新模型在 /api/ps 中的过期时间
+func (s *Server) keepModelAlive(c *gin.Context, model string, keepAlive time.Duration) {
+	if c.Writer.Status() < http.StatusBadRequest {
+		s.running.touch(model, keepAlive)
+	}
+}
+
+// loadDoneReason 返回带 keep_alive、不带消息或提示词的加载/卸载请求的 done_reason：keep_alive 为 0 时为 unload
+func loadDoneReason(keepAlive time.Duration) string {
+	if keepAlive == 0 {
+		return "unload"
+	}
+	return "load"
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseKeepAlive(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want time.Duration
+	}{
+		{``, DefaultKeepAlive},
+		{`null`, DefaultKeepAlive},
+		{`"10m"`, 10 * time.Minute},
+		{`30`, 30 * time.Second},
+		{`"45"`, 45 * time.Second},
+		{`0`, 0},
+		{`-1`, -time.Second},
+		{`"-1m"`, -time.Minute},
+	}
+	for _, tc := range cases {
+		got, err := parseKeepAlive(json.RawMessage(tc.raw))
+		if err != nil || got != tc.want {
+			t.Errorf("parseKeepAlive(%s) = %v, %v; want %v", tc.raw, got, err, tc.want)
+		}
+	}
+	for _, raw := range []string{`"soon"`, `true`, `{}`} {
+		if _, err := parseKeepAlive(json.RawMessage(raw)); err == nil {
+			t.Errorf("parseKeepAlive(%s) should fail", raw)
+		}
+	}
+}
+
+// runningExpiry 返回 /api/ps 中各模型的过期时间
+func runningExpiry(t *testing.T, s *Server) map[string]time.Time {
+	t.Helper()
+	w := doJSON(t, s.buildRouter(), http.MethodGet, "/api/ps", "")
+	var resp RunningModelsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	expiry := make(map[string]time.Time)
+	for _, m := range resp.Models {
+		expiry[m.Name] = m.ExpiresAt
+	}
+	return expiry
+}
+
+func TestKeepAliveReflectedInRunningModels(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"}, fakeModel{ID: "org/model-b"})
+	s := newTestServer(t, Config{}, upstream)
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	s.running.now = func() time.Time { return now }
+	r := s.buildRouter()
+
+	if got := runningExpiry(t, s); len(got) != 0 {
+		t.Fatalf("/api/ps before any request = %v, want empty", got)
+	}
+
+	requests := []struct{ path, body string }{
+		{"/api/chat", `{"model":"model-a","stream":false,"keep_alive":"10m","messages":[{"role":"user","content":"hi"}]}`},
+		{"/api/generate", `{"model":"model-b","stream":true,"keep_alive":60,"prompt":"hi"}`},
+	}
+	for _, req := range requests {
+		if w := doJSON(t, r, http.MethodPost, req.path, req.body); w.Code != http.StatusOK {
+			t.Fatalf("%s status = %d, body = %s", req.path, w.Code, w.Body.String())
+		}
+	}
+	got := runningExpiry(t, s)
+	want := map[string]time.Time{"model-a": now.Add(10 * time.Minute), "model-b": now.Add(time.Minute)}
+	for model, expiry := range want {
+		if !got[model].Equal(expiry) {
+			t.Errorf("%s expires_at = %v, want %v", model, got[model], expiry)
+		}
+	}
+
+	// 最近一次请求的 keep_alive 生效；keep_alive 为 0 且不带消息时立即卸载
+	w := doJSON(t, r, http.MethodPost, "/api/chat", `{"model":"model-a","keep_alive":0}`)
+	var unload struct {
+		DoneReason string `json:"done_reason"`
+		Done       bool   `json:"done"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &unload); err != nil || w.Code != http.StatusOK || !unload.Done || unload.DoneReason != "unload" {
+		t.Errorf("unload response = %d %s", w.Code, w.Body.String())
+	}
+	got = runningExpiry(t, s)
+	if _, ok := got["model-a"]; ok {
+		t.Errorf("model-a still listed after keep_alive 0: %v", got)
+	}
+
+	// 过期后不再列出
+	now = now.Add(time.Minute)
+	if got := runningExpiry(t, s); len(got) != 0 {
+		t.Errorf("/api/ps after expiry = %v, want empty", got)
+	}
+	if len(upstream.requestedModels()) != 2 {
+		t.Errorf("load/unload requests should not reach upstream: %v", upstream.requestedModels())
+	}
+}
+
+func TestEmptyRequestWithoutKeepAliveRejected(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+	r := s.buildRouter()
+
+	for _, tc := range []struct{ path, body string }{
+		{"/api/chat", `{"model":"model-a","messages":[]}`},
+		{"/api/chat", `{"model":"model-a"}`},
+		{"/api/generate", `{"model":"model-a","prompt":""}`},
+	} {
+		if w := doJSON(t, r, http.MethodPost, tc.path, tc.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s status = %d, want 400", tc.path, tc.body, w.Code)
+		}
+	}
+	if got := runningExpiry(t, s); len(got) != 0 {
+		t.Errorf("/api/ps after rejected requests = %v, want empty", got)
+	}
+
+	if w := doJSON(t, r, http.MethodPost, "/api/generate", `{"model":"model-a","keep_alive":"5m"}`); w.Code != http.StatusOK {
+		t.Errorf("load request status = %d, want 200", w.Code)
+	}
+}
+
+func TestInvalidKeepAliveRejected(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+		`{"model":"model-a","keep_alive":"forever","messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+	if got := runningExpiry(t, s); len(got) != 0 {
+		t.Errorf("/api/ps = %v, want empty after a rejected request", got)
+	}
+}
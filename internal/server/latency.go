@@ -0,0 +1,64 @@
+package server
+
+import (
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// baselineLatency 是没有测量数据的模型的假定延迟，测量值随时间向它衰减
+	baselineLatency = 5 * time.Second
+	// latencyHalfLife 为测量值的半衰期，避免一次偶发的慢响应永久降低模型优先级
+	latencyHalfLife = 30 * time.Minute
+)
+
+// effectiveLatency 返回按时间衰减后的延迟：测量越久远，越接近 baselineLatency
+func effectiveLatency(stat LatencyStat, now time.Time) time.Duration {
+	age := now.Sub(stat.UpdatedAt)
+	if age < 0 {
+		age = 0
+	}
+	weight := math.Pow(0.5, float64(age)/float64(latencyHalfLife))
+	return time.Duration(weight*float64(stat.Average) + (1-weight)*float64(baselineLatency))
+}
+
+// orderByLatency 按有效延迟升序稳定排序模型，延迟相同（包括无数据）时保持原有顺序
+func orderByLatency(models []string, stats map[string]LatencyStat, now time.Time) []string {
+	latency := func(m string) time.Duration {
+		if stat, ok := stats[m]; ok {
+			return effectiveLatency(stat, now)
+		}
+		return baselineLatency
+	}
+
+	ordered := append([]string(nil), models...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return latency(ordered[i]) < latency(ordered[j])
+	})
+	return ordered
+}
+
+// recordLatency 记录成功请求的延迟并据此重排免费模型
+func (s *Server) recordLatency(model string, latency time.Duration) {
+	if err := s.failureStore.RecordLatency(model, latency); err != nil {
+		slog.Error("failed to record latency", "model", model, "error", err)
+		return
+	}
+	s.reorderFreeModelsByLatency()
+}
+
+// reorderFreeModelsByLatency 按持久化的延迟统计重排免费模型列表，
+// failover.priority 中的模型始终排在最前
+func (s *Server) reorderFreeModelsByLatency() {
+	stats, err := s.failureStore.Latencies()
+	if err != nil {
+		slog.Error("failed to load latencies", "error", err)
+		return
+	}
+
+	s.freeModelsMu.Lock()
+	defer s.freeModelsMu.Unlock()
+	s.freeModels = applyPriority(orderByLatency(s.freeModels, stats, time.Now()), s.config.FailoverPriority)
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOrderByLatency(t *testing.T) {
+	now := time.Now()
+	models := []string{"org/big", "org/slow", "org/fast", "org/unknown", "org/stale-slow"}
+	stats := map[string]LatencyStat{
+		"org/big":        {Average: 4 * time.Second, UpdatedAt: now},
+		"org/slow":       {Average: 20 * time.Second, UpdatedAt: now},
+		"org/fast":       {Average: 500 * time.Millisecond, UpdatedAt: now},
+		"org/stale-slow": {Average: 60 * time.Second, UpdatedAt: now.Add(-24 * time.Hour)},
+	}
+
+	got := orderByLatency(models, stats, now)
+	want := []string{"org/fast", "org/big", "org/unknown", "org/stale-slow", "org/slow"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("orderByLatency() = %v, want %v", got, want)
+	}
+}
+
+func TestReorderFreeModelsByRecordedLatency(t *testing.T) {
+	store, err := NewFailureStore(filepath.Join(t.TempDir(), "failures.db"))
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	defer store.Close()
+
+	s := New(Config{})
+	s.failureStore = store
+	s.setFreeModels([]string{"org/a", "org/b", "org/c"})
+
+	s.recordLatency("org/a", 9*time.Second)
+	s.recordLatency("org/c", 1*time.Second)
+	s.recordLatency("org/c", 1*time.Second)
+
+	want := []string{"org/c", "org/b", "org/a"}
+	if got := s.freeModelList(); !reflect.DeepEqual(got, want) {
+		t.Errorf("freeModelList() = %v, want %v", got, want)
+	}
+}
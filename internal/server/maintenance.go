@@ -0,0 +1,55 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errMaintenance 是维护模式下拒绝新请求时返回的错误
+var errMaintenance = errors.New("proxy is in maintenance mode, try again later")
+
+// inMaintenance 返回是否处于维护模式
+func (s *Server) inMaintenance() bool {
+	s.maintenanceMu.RLock()
+	defer s.maintenanceMu.RUnlock()
+	return s.maintenance
+}
+
+// setMaintenance 切换维护模式，已在处理中的请求不受影响
+func (s *Server) setMaintenance(on bool) {
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
+	s.maintenance = on
+}
+
+// maintenanceMiddleware 在维护模式下以 503 拒绝聊天、生成和嵌入请求
+func (s *Server) maintenanceMiddleware(c *gin.Context) {
+	if s.inMaintenance() {
+		writeError(c, http.StatusServiceUnavailable, errMaintenance)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// maintenanceRequest 是 /api/admin/maintenance 的请求体，state 为 "on" 或 "off"
+type maintenanceRequest struct {
+	State string `json:"state" binding:"required,oneof=on off"`
+}
+
+// handleAdminMaintenance 开启或关闭维护模式
+func (s *Server) handleAdminMaintenance(c *gin.Context) {
+	var req maintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, errors.New(`state must be "on" or "off"`))
+		return
+	}
+
+	on := req.State == "on"
+	s.setMaintenance(on)
+	slog.Warn("maintenance mode changed", "enabled", on)
+	c.JSON(http.StatusOK, gin.H{"maintenance": on})
+}
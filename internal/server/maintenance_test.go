@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{AdminEnabled: true, ProxyAuthToken: "secret"}, upstream)
+	r := s.buildRouter()
+	auth := []string{"Authorization", "Bearer secret"}
+
+	chat := `{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	toggle := func(state string) {
+		t.Helper()
+		w := doJSON(t, r, http.MethodPost, "/api/admin/maintenance", `{"state":"`+state+`"}`, auth...)
+		if w.Code != http.StatusOK {
+			t.Fatalf("maintenance %s: status = %d, body = %s", state, w.Code, w.Body.String())
+		}
+	}
+
+	if w := doJSON(t, r, http.MethodPost, "/api/admin/maintenance", `{"state":"on"}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated toggle status = %d, want 401", w.Code)
+	}
+
+	toggle("on")
+	for _, path := range []string{"/api/chat", "/v1/chat/completions", "/api/generate", "/api/embeddings", "/v1/embeddings"} {
+		if w := doJSON(t, r, http.MethodPost, path, chat, auth...); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s during maintenance: status = %d, want 503", path, w.Code)
+		}
+	}
+	for _, path := range []string{"/", "/health"} {
+		if w := doJSON(t, r, http.MethodGet, path, ""); w.Code != http.StatusOK {
+			t.Errorf("%s during maintenance: status = %d, want 200", path, w.Code)
+		}
+	}
+
+	toggle("off")
+	if w := doJSON(t, r, http.MethodPost, "/api/chat", chat, auth...); w.Code != http.StatusOK {
+		t.Errorf("chat after maintenance: status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	if w := doJSON(t, r, http.MethodPost, "/api/admin/maintenance", `{"state":"maybe"}`, auth...); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid state: status = %d, want 400", w.Code)
+	}
+}
+
+func TestStartRejectsAdminWithoutAuthToken(t *testing.T) {
+	s := New(Config{AdminEnabled: true})
+	err := s.Start()
+	if err == nil || !strings.Contains(err.Error(), "server.auth_token") {
+		t.Errorf("Start() error = %v, want auth token required", err)
+	}
+}
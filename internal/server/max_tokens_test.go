@@ -0,0 +1,41 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestMaxCompletionTokensForwarded(t *testing.T) {
+	cases := []struct {
+		name   string
+		fields string
+		want   interface{}
+	}{
+		{"max_completion_tokens", `"max_completion_tokens":50,`, float64(50)},
+		{"max_tokens", `"max_tokens":10,`, float64(10)},
+		{"both prefers max_completion_tokens", `"max_tokens":10,"max_completion_tokens":50,`, float64(50)},
+		{"neither", ``, nil},
+	}
+	for _, tc := range cases {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s stream=%v", tc.name, stream), func(t *testing.T) {
+				upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+				s := newTestServer(t, Config{}, upstream)
+
+				body := fmt.Sprintf(`{"model":"model-a","stream":%v,%s"messages":[{"role":"user","content":"hi"}]}`, stream, tc.fields)
+				if w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body); w.Code != http.StatusOK {
+					t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+				}
+
+				got := upstream.lastRequest(t)
+				if got["max_tokens"] != tc.want {
+					t.Errorf("upstream max_tokens = %v, want %v", got["max_tokens"], tc.want)
+				}
+				if _, ok := got["max_completion_tokens"]; ok {
+					t.Errorf("max_completion_tokens forwarded alongside max_tokens: %v", got)
+				}
+			})
+		}
+	}
+}
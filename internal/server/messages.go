@@ -0,0 +1,41 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// limitMessages 按 chat.max_messages 检查消息数量。超出时若开启了 TruncateMessages，
+// 保留开头的 system 消息和最近的消息，工具调用与其结果一起保留或丢弃；否则返回错误，由调用方以 400 拒绝
+func (s *Server) limitMessages(messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, error) {
+	limit := s.config.MaxMessages
+	if limit <= 0 || len(messages) <= limit {
+		return messages, nil
+	}
+	if !s.config.TruncateMessages {
+		return nil, fmt.Errorf("too many messages: %d exceeds the limit of %d", len(messages), limit)
+	}
+
+	system := 0
+	for system < len(messages) && messages[system].Role == openai.ChatMessageRoleSystem {
+		system++
+	}
+	if system >= limit {
+		system = limit - 1
+	}
+
+	// 截断点落在工具调用中间时，对应的 assistant tool_calls 消息已被丢弃，
+	// 其后的 tool 结果也一并丢弃，否则上游会拒绝没有对应调用的 tool 消息
+	start := len(messages) - (limit - system)
+	for start < len(messages) && messages[start].Role == openai.ChatMessageRoleTool {
+		start++
+	}
+
+	truncated := make([]openai.ChatCompletionMessage, 0, limit)
+	truncated = append(truncated, messages[:system]...)
+	truncated = append(truncated, messages[start:]...)
+	slog.Info("truncated chat history", "messages", len(messages), "kept", len(truncated))
+	return truncated, nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func chatBody(model string, n int) string {
+	msgs := make([]string, n)
+	for i := range msgs {
+		msgs[i] = fmt.Sprintf(`{"role":"user","content":"m%d"}`, i)
+	}
+	return `{"model":"` + model + `","stream":false,"messages":[` + strings.Join(msgs, ",") + `]}`
+}
+
+func TestMaxMessagesRejectsOverLimit(t *testing.T) {
+	for _, path := range []string{"/api/chat", "/v1/chat/completions"} {
+		t.Run(path, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			s := newTestServer(t, Config{MaxMessages: 3}, upstream)
+			r := s.buildRouter()
+
+			if w := doJSON(t, r, http.MethodPost, path, chatBody("model-a", 4)); w.Code != http.StatusBadRequest {
+				t.Errorf("over limit: status = %d, want 400; body = %s", w.Code, w.Body.String())
+			}
+			if got := upstream.requestedModels(); len(got) != 0 {
+				t.Errorf("rejected request reached upstream: %v", got)
+			}
+
+			if w := doJSON(t, r, http.MethodPost, path, chatBody("model-a", 3)); w.Code != http.StatusOK {
+				t.Errorf("at limit: status = %d, body = %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMaxMessagesTruncates(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{MaxMessages: 3, TruncateMessages: true}, upstream)
+
+	body := `{"model":"model-a","stream":false,"messages":[
+		{"role":"system","content":"sys"},
+		{"role":"user","content":"m1"},{"role":"assistant","content":"m2"},
+		{"role":"user","content":"m3"},{"role":"user","content":"m4"}]}`
+	if w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	messages, _ := upstream.lastRequest(t)["messages"].([]interface{})
+	var contents []string
+	for _, m := range messages {
+		contents = append(contents, m.(map[string]interface{})["content"].(string))
+	}
+	if got := strings.Join(contents, ","); got != "sys,m3,m4" {
+		t.Errorf("forwarded messages = %s, want sys,m3,m4", got)
+	}
+}
+
+func TestLimitMessagesUnlimitedByDefault(t *testing.T) {
+	s := New(Config{})
+	messages := make([]openai.ChatCompletionMessage, 500)
+	got, err := s.limitMessages(messages)
+	if err != nil || len(got) != 500 {
+		t.Errorf("limitMessages() = %d messages, %v; want all 500", len(got), err)
+	}
+}
+
+func TestLimitMessagesDropsToolResultsWithTheirCall(t *testing.T) {
+	s := New(Config{MaxMessages: 4, TruncateMessages: true})
+	call := []openai.ToolCall{{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup"}}}
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "sys"},
+		{Role: openai.ChatMessageRoleUser, Content: "m1"},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: call},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: "r1"},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: "r2"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "m5"},
+		{Role: openai.ChatMessageRoleUser, Content: "m6"},
+	}
+
+	got, err := s.limitMessages(messages)
+	if err != nil {
+		t.Fatalf("limitMessages() error = %v", err)
+	}
+	var contents []string
+	for _, m := range got {
+		if m.Role == openai.ChatMessageRoleTool {
+			t.Errorf("kept tool message %q without its assistant tool call", m.Content)
+		}
+		contents = append(contents, m.Content)
+	}
+	if got := strings.Join(contents, ","); got != "sys,m5,m6" {
+		t.Errorf("truncated messages = %s, want sys,m5,m6", got)
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// counterVec 是带标签的单调递增计数器，按 Prometheus 文本格式输出
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]float64),
+	}
+}
+
+// inc 将指定标签值组合的计数加一，标签值顺序与 labels 一致
+func (c *counterVec) inc(labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.Join(labelValues, "\xff")]++
+}
+
+// value 返回指定标签值组合的当前计数
+func (c *counterVec) value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, "\xff")]
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, strings.Split(k, "\xff")), formatValue(c.values[k]))
+	}
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		var v string
+		if i < len(values) {
+			v = values[i]
+		}
+		pairs[i] = fmt.Sprintf("%s=%s", name, strconv.Quote(v))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// 进程级指标，与 Prometheus 默认注册表的用法一致
+var (
+	httpRequestsTotal = newCounterVec("ollama_router_http_requests_total",
+		"HTTP requests by endpoint and status code.", "endpoint", "status")
+	modelRequestsTotal = newCounterVec("ollama_router_model_requests_total",
+		"Upstream requests per model by result.", "model", "result")
+	modelFailuresMarkedTotal = newCounterVec("ollama_router_model_failures_marked_total",
+		"Failures recorded in the failure store by failure type.", "type")
+	chatRequestsTotal = newCounterVec("ollama_router_chat_requests_total",
+		"Chat requests by response mode.", "mode")
+	requestOutcomesTotal = newCounterVec("ollama_router_request_outcomes_total",
+		"Chat and generate requests by endpoint and outcome class.", "endpoint", "outcome")
+)
+
+var allCounters = []*counterVec{
+	httpRequestsTotal,
+	modelRequestsTotal,
+	modelFailuresMarkedTotal,
+	chatRequestsTotal,
+	requestOutcomesTotal,
+	requestQueueRejectionsTotal,
+	quotaRejectionsTotal,
+}
+
+// recordChatMode 记录一次聊天请求是流式还是非流式
+func recordChatMode(stream bool) {
+	if stream {
+		chatRequestsTotal.inc("stream")
+	} else {
+		chatRequestsTotal.inc("non_stream")
+	}
+}
+
+// metricsMiddleware 按路由模板和状态码统计请求数
+func metricsMiddleware(c *gin.Context) {
+	c.Next()
+
+	endpoint := c.FullPath()
+	if endpoint == "" {
+		endpoint = "unmatched"
+	}
+	httpRequestsTotal.inc(endpoint, strconv.Itoa(c.Writer.Status()))
+}
+
+// handleMetrics 以 Prometheus 文本格式输出指标
+func (s *Server) handleMetrics(c *gin.Context) {
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	for _, counter := range allCounters {
+		counter.write(c.Writer)
+	}
+
+	fmt.Fprintf(c.Writer, "# HELP ollama_router_free_models_skipped Free models currently skipped due to cooldown or permanent failure.\n")
+	fmt.Fprintf(c.Writer, "# TYPE ollama_router_free_models_skipped gauge\n")
+	fmt.Fprintf(c.Writer, "ollama_router_free_models_skipped %d\n", s.skippedFreeModels())
+
+	fmt.Fprintf(c.Writer, "# HELP ollama_router_request_queue_depth Requests currently waiting for a concurrency slot.\n")
+	fmt.Fprintf(c.Writer, "# TYPE ollama_router_request_queue_depth gauge\n")
+	fmt.Fprintf(c.Writer, "ollama_router_request_queue_depth %d\n", s.inflightQueued.Load())
+}
+
+// skippedFreeModels 返回当前因冷却或永久失败而被跳过的免费模型数
+func (s *Server) skippedFreeModels() int {
+	if !s.config.FreeMode || s.failureStore == nil {
+		return 0
+	}
+
+	skipped := 0
+	for _, m := range s.freeModelList() {
+		if s.permanentFails.IsPermanentlyFailed(m) || s.permanentFails.IsDisabled(m) {
+			skipped++
+			continue
+		}
+		if skip, err := s.failureStore.ShouldSkip(m); err == nil && skip {
+			skipped++
+		}
+	}
+	return skipped
+}
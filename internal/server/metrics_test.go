@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true, MetricsEnabled: true}, upstream, "org/model-a:free")
+	r := s.buildRouter()
+
+	streamBefore := chatRequestsTotal.value("stream")
+	nonStreamBefore := chatRequestsTotal.value("non_stream")
+	successBefore := modelRequestsTotal.value("org/model-a:free", "success")
+	okBefore := httpRequestsTotal.value("/api/chat", "200")
+
+	body := `{"model":"model-a:free","messages":[{"role":"user","content":"hi"}],"stream":%s}`
+	for _, stream := range []string{"true", "false"} {
+		w := doJSON(t, r, http.MethodPost, "/api/chat", strings.Replace(body, "%s", stream, 1))
+		if w.Code != http.StatusOK {
+			t.Fatalf("/api/chat status = %d, body = %s", w.Code, w.Body.String())
+		}
+	}
+	// 冷却中的模型计入 free_models_skipped
+	s.failureStore.MarkFailure("org/model-a:free")
+
+	w := doJSON(t, r, http.MethodGet, "/metrics", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("/metrics status = %d", w.Code)
+	}
+	text := w.Body.String()
+
+	if got := chatRequestsTotal.value("stream") - streamBefore; got != 1 {
+		t.Errorf("stream chat count moved by %v, want 1", got)
+	}
+	if got := chatRequestsTotal.value("non_stream") - nonStreamBefore; got != 1 {
+		t.Errorf("non-stream chat count moved by %v, want 1", got)
+	}
+	if got := httpRequestsTotal.value("/api/chat", "200") - okBefore; got != 2 {
+		t.Errorf("/api/chat 200 count moved by %v, want 2", got)
+	}
+	if got := modelRequestsTotal.value("org/model-a:free", "success") - successBefore; got != 2 {
+		t.Errorf("preferred model success count moved by %v, want 2", got)
+	}
+
+	for _, want := range []string{
+		`ollama_router_http_requests_total{endpoint="/api/chat",status="200"}`,
+		`ollama_router_chat_requests_total{mode="stream"}`,
+		`ollama_router_model_failures_marked_total{type="general"}`,
+		"ollama_router_free_models_skipped 1",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("/metrics output missing %q", want)
+		}
+	}
+}
+
+func TestMetricsFailoverCounters(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true, MetricsEnabled: true}, upstream, "org/counted:free")
+	r := s.buildRouter()
+
+	before := modelRequestsTotal.value("org/counted:free", "success")
+	w := doJSON(t, r, http.MethodPost, "/api/chat", `{"model":"unknown","messages":[{"role":"user","content":"hi"}],"stream":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("/api/chat status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := modelRequestsTotal.value("org/counted:free", "success") - before; got != 1 {
+		t.Errorf("model success count moved by %v, want 1", got)
+	}
+}
+
+func TestMetricsCountPreferredModelFailures(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		model, _ := body["model"].(string)
+		if model == "org/broken:free" {
+			writeUpstreamError(w, http.StatusInternalServerError, "upstream exploded")
+			return
+		}
+		writeChatCompletion(w, model, "ok")
+	}
+	s := newTestServer(t, Config{FreeMode: true, MetricsEnabled: true}, upstream, "org/broken:free", "org/backup:free")
+
+	failureBefore := modelRequestsTotal.value("org/broken:free", "failure")
+	successBefore := modelRequestsTotal.value("org/backup:free", "success")
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat", `{"model":"broken:free","messages":[{"role":"user","content":"hi"}],"stream":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("/api/chat status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := modelRequestsTotal.value("org/broken:free", "failure") - failureBefore; got != 1 {
+		t.Errorf("preferred model failure count moved by %v, want 1", got)
+	}
+	if got := modelRequestsTotal.value("org/backup:free", "success") - successBefore; got != 1 {
+		t.Errorf("failover model success count moved by %v, want 1", got)
+	}
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{}, upstream)
+
+	if w := doJSON(t, s.buildRouter(), http.MethodGet, "/metrics", ""); w.Code != http.StatusNotFound {
+		t.Errorf("/metrics status = %d, want 404 when disabled", w.Code)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilterMinContext(t *testing.T) {
+	models := []ModelInfo{
+		{ID: "org/big:free", ContextLength: 131072},
+		{ID: "org/exact:free", ContextLength: 8192},
+		{ID: "org/tiny:free", ContextLength: 4096},
+		{ID: "org/unknown:free"},
+	}
+	ids := func(models []ModelInfo) string {
+		var ids []string
+		for _, m := range models {
+			ids = append(ids, m.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+
+	if got := ids(FilterMinContext(models, 0)); got != ids(models) {
+		t.Errorf("FilterMinContext(0) = %v, want all models", got)
+	}
+	want := "[org/big:free org/exact:free org/unknown:free]"
+	if got := ids(FilterMinContext(models, 8192)); got != want {
+		t.Errorf("FilterMinContext(8192) = %v, want %v", got, want)
+	}
+}
+
+func TestInitFreeModeDropsSmallContextModels(t *testing.T) {
+	t.Setenv("FAILURE_DB", "")
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "org/big:free", ContextLength: 131072},
+		fakeModel{ID: "org/tiny:free", ContextLength: 2048},
+		fakeModel{ID: "org/medium:free", ContextLength: 8192},
+	)
+	dir := t.TempDir()
+	s := New(Config{
+		FreeMode:         true,
+		BaseURL:          upstream.URL + "/",
+		ConfigDir:        dir,
+		FilterPath:       filepath.Join(dir, "models-filter"),
+		MinContextLength: 8192,
+	})
+	s.loadModelFilter()
+	if err := s.initFreeMode(); err != nil {
+		t.Fatalf("initFreeMode() error = %v", err)
+	}
+	t.Cleanup(func() { s.failureStore.Close() })
+
+	want := []string{"org/big:free", "org/medium:free"}
+	if got := s.freeModelList(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("free models = %v, want %v", got, want)
+	}
+	// 缓存中仍保留全部免费模型，调低阈值后无需重新获取
+	cached, _, err := s.failureStore.LoadModels()
+	if err != nil || len(cached) != 3 {
+		t.Errorf("cached models = %v, %v; want all 3", cached, err)
+	}
+}
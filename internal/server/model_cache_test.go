@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingModelsServer 返回一个只提供 /models 的上游，并统计被请求的次数
+func countingModelsServer(t *testing.T, ids ...string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object":"list","data":[`)
+		for i, id := range ids {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"id":%q,"object":"model"}`, id)
+		}
+		fmt.Fprint(w, `]}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestProviderModelListCacheTTL(t *testing.T) {
+	srv, calls := countingModelsServer(t, "org/model-a")
+	provider := NewOpenrouterProvider("key", WithBaseURL(srv.URL+"/"), WithModelListTTL(time.Minute))
+	now := time.Now()
+	provider.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if got, err := provider.GetFullModelName("model-a"); err != nil || got != "org/model-a" {
+			t.Fatalf("GetFullModelName() = %q, %v", got, err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("upstream calls within TTL = %d, want 1", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := provider.GetFullModelName("model-a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream calls after expiry = %d, want 2", got)
+	}
+
+	if err := provider.RefreshModels(); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("upstream calls after RefreshModels = %d, want 3", got)
+	}
+}
+
+func TestProviderModelListCacheKeepsStaleOnError(t *testing.T) {
+	srv, calls := countingModelsServer(t, "org/model-a")
+	provider := NewOpenrouterProvider("key", WithBaseURL(srv.URL+"/"), WithModelListTTL(time.Minute))
+	now := time.Now()
+	provider.now = func() time.Time { return now }
+
+	if _, err := provider.GetFullModelName("model-a"); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	now = now.Add(2 * time.Minute)
+
+	if got, err := provider.GetFullModelName("model-a"); err != nil || got != "org/model-a" {
+		t.Errorf("GetFullModelName() = %q, %v, want the stale cached ID", got, err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("upstream calls = %d, want 1", got)
+	}
+}
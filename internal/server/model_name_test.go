@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGetFullModelName(t *testing.T) {
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "meta-llama/llama-3.1-70b"},
+		fakeModel{ID: "other/llama-3.1-70b-instruct"},
+		fakeModel{ID: "acme/llama-3.1-70b-instruct"},
+		fakeModel{ID: "google/gemma-3-27b-it"},
+		fakeModel{ID: "google/gemma-3-27b-it:free"},
+		fakeModel{ID: "mistral/tiny"},
+		fakeModel{ID: "mistral/tiny-v2-tiny"},
+	)
+	provider := NewOpenrouterProvider("key", WithBaseURL(upstream.URL+"/"))
+
+	tests := []struct {
+		alias string
+		want  string
+	}{
+		{"meta-llama/llama-3.1-70b", "meta-llama/llama-3.1-70b"},
+		{"llama-3.1-70b", "meta-llama/llama-3.1-70b"},
+		{"gemma-3-27b-it", "google/gemma-3-27b-it"},
+		{"gemma-3-27b-it:free", "google/gemma-3-27b-it:free"},
+		// 显示名精确匹配优先于后缀匹配
+		{"tiny", "mistral/tiny"},
+		{"v2-tiny", "mistral/tiny-v2-tiny"},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 3; i++ {
+			got, err := provider.GetFullModelName(tt.alias)
+			if err != nil {
+				t.Fatalf("GetFullModelName(%q) error = %v", tt.alias, err)
+			}
+			if got != tt.want {
+				t.Errorf("GetFullModelName(%q) = %q, want %q", tt.alias, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestGetFullModelNameAmbiguous(t *testing.T) {
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "other/llama-3.1-70b-instruct"},
+		fakeModel{ID: "acme/llama-3.1-70b-instruct"},
+		fakeModel{ID: "acme/model-x-chat"},
+		fakeModel{ID: "other/model-y-chat"},
+	)
+	provider := NewOpenrouterProvider("key", WithBaseURL(upstream.URL+"/"))
+
+	for _, alias := range []string{"llama-3.1-70b-instruct", "-chat"} {
+		_, err := provider.GetFullModelName(alias)
+		if !errors.Is(err, errAmbiguousModel) {
+			t.Fatalf("GetFullModelName(%q) error = %v, want errAmbiguousModel", alias, err)
+		}
+	}
+
+	_, err := provider.GetFullModelName("llama-3.1-70b-instruct")
+	if !strings.Contains(err.Error(), "acme/llama-3.1-70b-instruct, other/llama-3.1-70b-instruct") {
+		t.Errorf("error %q does not list sorted candidates", err)
+	}
+}
+
+func TestGetFullModelNameNotFound(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	provider := NewOpenrouterProvider("key", WithBaseURL(upstream.URL+"/"))
+
+	got, err := provider.GetFullModelName("unknown-model")
+	if err != nil {
+		t.Fatalf("GetFullModelName() error = %v", err)
+	}
+	if got != "unknown-model" {
+		t.Errorf("GetFullModelName() = %q, want the alias passed through", got)
+	}
+}
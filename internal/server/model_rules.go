@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+)
+
+// ModelRule 按模型改写发往上游的请求参数，用于绕开个别模型不支持的参数导致的 400。
+// Pattern 为 path.Match 风格的通配符，与完整 ID 或显示名任一匹配即生效
+type ModelRule struct {
+	Pattern    string                 `mapstructure:"pattern"`
+	DropParams []string               `mapstructure:"drop_params"`
+	AddParams  map[string]interface{} `mapstructure:"add_params"`
+}
+
+// matches 判断规则是否适用于指定模型
+func (r ModelRule) matches(model string) bool {
+	return matchModelPattern(r.Pattern, model)
+}
+
+type modelRules []ModelRule
+
+// validateModelRules 检查规则的通配符是否合法，以及 add_params 是否可以序列化
+func validateModelRules(rules []ModelRule) error {
+	for _, r := range rules {
+		if r.Pattern == "" {
+			return fmt.Errorf("model_rules: pattern cannot be empty")
+		}
+		if _, err := path.Match(r.Pattern, ""); err != nil {
+			return fmt.Errorf("model_rules: invalid pattern %q: %w", r.Pattern, err)
+		}
+		if _, err := json.Marshal(r.AddParams); err != nil {
+			return fmt.Errorf("model_rules: invalid add_params for %q: %w", r.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// apply 对请求体依次应用所有匹配的规则：先删除 drop_params，再写入 add_params
+func (rules modelRules) apply(payload map[string]json.RawMessage) {
+	var model string
+	if err := json.Unmarshal(payload["model"], &model); err != nil {
+		return
+	}
+
+	for _, r := range rules {
+		if !r.matches(model) {
+			continue
+		}
+		for _, name := range r.DropParams {
+			if _, ok := payload[name]; ok {
+				slog.Debug("model rule dropped parameter", "model", model, "pattern", r.Pattern, "param", name)
+				delete(payload, name)
+			}
+		}
+		for name, value := range r.AddParams {
+			raw, err := json.Marshal(value)
+			if err != nil {
+				continue
+			}
+			payload[name] = raw
+		}
+	}
+}
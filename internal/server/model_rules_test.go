@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestModelRulesDropParams(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/picky"}, fakeModel{ID: "org/other"})
+	provider := NewOpenrouterProvider("key", WithBaseURL(upstream.URL+"/"), WithModelRules([]ModelRule{
+		{Pattern: "picky*", DropParams: []string{"frequency_penalty"}, AddParams: map[string]interface{}{"top_k": 40}},
+	}))
+
+	for _, model := range []string{"org/picky", "org/other"} {
+		_, err := provider.CreateChat(openai.ChatCompletionRequest{
+			Model:            model,
+			Messages:         []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+			FrequencyPenalty: 0.5,
+		})
+		if err != nil {
+			t.Fatalf("CreateChat(%s) error = %v", model, err)
+		}
+
+		got := upstream.lastRequest(t)
+		_, hasPenalty := got["frequency_penalty"]
+		_, hasTopK := got["top_k"]
+		matched := model == "org/picky"
+		if hasPenalty == matched {
+			t.Errorf("%s: frequency_penalty present = %v, want %v", model, hasPenalty, !matched)
+		}
+		if hasTopK != matched {
+			t.Errorf("%s: top_k present = %v, want %v", model, hasTopK, matched)
+		}
+		if got["model"] != model || got["messages"] == nil {
+			t.Errorf("%s: request body damaged: %v", model, got)
+		}
+	}
+}
+
+func TestModelRulesAppliedToHandlers(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a:free"})
+	rules := []ModelRule{{Pattern: "org/*:free", DropParams: []string{"response_format"}}}
+	s := newTestServer(t, Config{FreeMode: true, ModelRules: rules}, upstream, "org/model-a:free")
+
+	body := `{"model":"model-a:free","stream":false,"format":"json","messages":[{"role":"user","content":"hi"}]}`
+	if w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat", body); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if _, ok := upstream.lastRequest(t)["response_format"]; ok {
+		t.Error("response_format was not dropped for the matching model")
+	}
+}
+
+func TestValidateModelRules(t *testing.T) {
+	for _, rules := range [][]ModelRule{
+		{{Pattern: ""}},
+		{{Pattern: "[unclosed"}},
+	} {
+		s := New(Config{ModelRules: rules})
+		if _, err := s.newProvider(); err == nil {
+			t.Errorf("newProvider() accepted rules %+v", rules)
+		}
+	}
+}
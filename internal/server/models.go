@@ -1,18 +1,33 @@
 package server
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
 type orModels struct {
-	Data []struct {
-		ID                  string   `json:"id"`
-		ContextLength       int      `json:"context_length"`
-		SupportedParameters []string `json:"supported_parameters"`
-		TopProvider         struct {
-			ContextLength int `json:"context_length"`
-		} `json:"top_provider"`
-		Pricing struct {
-			Prompt     string `json:"prompt"`
-			Completion string `json:"completion"`
-		} `json:"pricing"`
-	} `json:"data"`
+	Data []orModel `json:"data"`
+}
+
+// orModel 是 OpenRouter 模型列表中的一条记录
+type orModel struct {
+	ID                  string   `json:"id"`
+	ContextLength       int      `json:"context_length"`
+	SupportedParameters []string `json:"supported_parameters"`
+	TopProvider         struct {
+		ContextLength int `json:"context_length"`
+	} `json:"top_provider"`
+	Pricing struct {
+		Prompt     string `json:"prompt"`
+		Completion string `json:"completion"`
+	} `json:"pricing"`
 }
 
 func supportsToolUse(supportedParams []string) bool {
@@ -23,3 +38,220 @@ func supportsToolUse(supportedParams []string) bool {
 	}
 	return false
 }
+
+// DefaultModelsURL 是 OpenRouter 模型列表接口地址
+const DefaultModelsURL = defaultBaseURL + "models"
+
+// ModelInfo 是缓存的模型元数据
+type ModelInfo struct {
+	ID              string
+	ContextLength   int
+	SupportsTools   bool
+	PromptPrice     string
+	CompletionPrice string
+}
+
+// TokenPrice 返回每 token 的提示词与补全价格之和；价格缺失或无法解析时 ok 为 false
+func (m ModelInfo) TokenPrice() (price float64, ok bool) {
+	prompt, err := strconv.ParseFloat(m.PromptPrice, 64)
+	if err != nil {
+		return 0, false
+	}
+	completion, err := strconv.ParseFloat(m.CompletionPrice, 64)
+	if err != nil {
+		return 0, false
+	}
+	return prompt + completion, true
+}
+
+// toModelInfo 将 OpenRouter 返回的一条模型记录转换为 ModelInfo
+func toModelInfo(m orModel) ModelInfo {
+	ctx := m.TopProvider.ContextLength
+	if ctx == 0 {
+		ctx = m.ContextLength
+	}
+	return ModelInfo{
+		ID:              m.ID,
+		ContextLength:   ctx,
+		SupportsTools:   supportsToolUse(m.SupportedParameters),
+		PromptPrice:     m.Pricing.Prompt,
+		CompletionPrice: m.Pricing.Completion,
+	}
+}
+
+// freeModelInfos 从模型列表中挑出免费模型，重复的 ID 只保留第一个（否则无法写入缓存），按上下文长度从大到小排序
+func freeModelInfos(result orModels) []ModelInfo {
+	var models []ModelInfo
+	seen := make(map[string]bool, len(result.Data))
+	for _, m := range result.Data {
+		if m.Pricing.Prompt != "0" || m.Pricing.Completion != "0" || seen[m.ID] {
+			continue
+		}
+		seen[m.ID] = true
+		models = append(models, toModelInfo(m))
+	}
+	sort.SliceStable(models, func(i, j int) bool { return models[i].ContextLength > models[j].ContextLength })
+	return models
+}
+
+// fetchModelList 经 transport 从 modelsURL 获取完整的模型列表，transport 为 nil 时使用 http.DefaultTransport
+func fetchModelList(modelsURL, apiKey string, transport http.RoundTripper) (orModels, error) {
+	return fetchModelListContext(context.Background(), modelsURL, apiKey, transport)
+}
+
+// fetchModelListContext 与 fetchModelList 相同，但在 ctx 取消或超时时提前返回
+func fetchModelListContext(ctx context.Context, modelsURL, apiKey string, transport http.RoundTripper) (orModels, error) {
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   10 * time.Second,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", modelsURL, nil)
+	if err != nil {
+		return orModels{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return orModels{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return orModels{}, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var result orModels
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return orModels{}, err
+	}
+	return result, nil
+}
+
+// checkAPIKey 请求 OpenRouter 的 /auth/key 接口确认 apiKey 有效。与公开的模型列表不同，
+// 该接口在密钥无效时返回 401，上游拒绝时的错误为带状态码和上游错误信息的 UpstreamError
+func checkAPIKey(ctx context.Context, keyURL, apiKey string, transport http.RoundTripper) error {
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   10 * time.Second,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", keyURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	message := resp.Status
+	if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error.Message != "" {
+		message = body.Error.Message
+	}
+	return &UpstreamError{StatusCode: resp.StatusCode, Err: fmt.Errorf("unexpected status %s: %s", resp.Status, message)}
+}
+
+// FetchFreeModels 经 transport（为 nil 时使用 http.DefaultTransport）从 modelsURL 获取全部免费模型的元数据
+func FetchFreeModels(modelsURL, apiKey string, transport http.RoundTripper) ([]ModelInfo, error) {
+	return fetchFreeModelsContext(context.Background(), modelsURL, apiKey, transport)
+}
+
+// fetchFreeModelsContext 是受 ctx 控制的 FetchFreeModels
+func fetchFreeModelsContext(ctx context.Context, modelsURL, apiKey string, transport http.RoundTripper) ([]ModelInfo, error) {
+	result, err := fetchModelListContext(ctx, modelsURL, apiKey, transport)
+	if err != nil {
+		return nil, err
+	}
+	return freeModelInfos(result), nil
+}
+
+// FetchModels 从 modelsURL 获取全部模型（含付费模型）的元数据，保持接口返回的顺序
+func FetchModels(modelsURL, apiKey string, transport http.RoundTripper) ([]ModelInfo, error) {
+	result, err := fetchModelList(modelsURL, apiKey, transport)
+	if err != nil {
+		return nil, err
+	}
+	models := make([]ModelInfo, 0, len(result.Data))
+	for _, m := range result.Data {
+		models = append(models, toModelInfo(m))
+	}
+	return models, nil
+}
+
+// ModelCacheTTL 返回免费模型缓存的有效期，可通过 CACHE_TTL_HOURS 设置，默认 24 小时
+func ModelCacheTTL() time.Duration {
+	cacheTTL := 24 * time.Hour
+	if ttlStr := os.Getenv("CACHE_TTL_HOURS"); ttlStr != "" {
+		if hours, err := time.ParseDuration(ttlStr + "h"); err == nil {
+			cacheTTL = hours
+		}
+	}
+	return cacheTTL
+}
+
+// CachedFreeModels 返回 store 中缓存的免费模型，缓存为空或超过 ModelCacheTTL 时重新获取并写回；
+// 获取失败时退回到过期的缓存
+func CachedFreeModels(store *FailureStore, modelsURL, apiKey string, transport http.RoundTripper) ([]ModelInfo, error) {
+	cached, fetchedAt, err := store.LoadModels()
+	if err != nil {
+		return nil, err
+	}
+	if len(cached) > 0 && time.Since(fetchedAt) < ModelCacheTTL() {
+		return cached, nil
+	}
+
+	models, err := FetchFreeModels(modelsURL, apiKey, transport)
+	if err != nil {
+		if len(cached) > 0 {
+			slog.Warn("Failed to refresh free models, using stale cache", "error", err, "fetched_at", fetchedAt)
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	if err := store.SaveModels(models); err != nil {
+		slog.Error("Failed to cache free models", "error", err)
+	}
+	return models, nil
+}
+
+// FilterMinContext 去掉上下文长度小于 minContext 的模型；minContext 为 0 时不过滤，
+// 上下文长度未知（为 0）的模型保留
+func FilterMinContext(models []ModelInfo, minContext int) []ModelInfo {
+	if minContext <= 0 {
+		return models
+	}
+	kept := make([]ModelInfo, 0, len(models))
+	for _, m := range models {
+		if m.ContextLength > 0 && m.ContextLength < minContext {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// modelIDs 返回模型 ID 列表，toolUseOnly 时只保留支持工具调用的模型
+func modelIDs(models []ModelInfo, toolUseOnly bool) []string {
+	ids := make([]string, 0, len(models))
+	for _, m := range models {
+		if toolUseOnly && !m.SupportsTools {
+			continue
+		}
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
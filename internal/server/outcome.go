@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求结果分类，用于 SLO 统计
+const (
+	outcomeSuccess         = "success"
+	outcomeFailoverSuccess = "failover-success"
+	outcomeClientError     = "client-error"
+	outcomeUpstreamError   = "upstream-error"
+	outcomeRateLimited     = "rate-limited"
+	outcomeNoModels        = "no-models"
+)
+
+// requestOutcome 记录请求处理过程中影响结果分类的事件，流式请求可能跨 goroutine 写入
+type requestOutcome struct {
+	failedAttempts atomic.Int32
+	noModels       atomic.Bool
+}
+
+type requestOutcomeKey struct{}
+
+// outcomeFrom 返回上下文中的结果记录，未跟踪时返回 nil
+func outcomeFrom(ctx context.Context) *requestOutcome {
+	o, _ := ctx.Value(requestOutcomeKey{}).(*requestOutcome)
+	return o
+}
+
+// noteFailedAttempt 记录一次上游模型尝试失败
+func noteFailedAttempt(ctx context.Context) {
+	if o := outcomeFrom(ctx); o != nil {
+		o.failedAttempts.Add(1)
+	}
+}
+
+// noteNoModels 记录请求因没有可用模型而失败
+func noteNoModels(ctx context.Context) {
+	if o := outcomeFrom(ctx); o != nil {
+		o.noModels.Store(true)
+	}
+}
+
+// classify 根据最终状态码和处理过程中的事件得出结果分类。
+// 客户端限流和配额在处理函数之前的中间件中拒绝，不经过这里，
+// 因此 429 和 402 只可能是上游的限流和额度不足，不计为客户端错误
+func (o *requestOutcome) classify(status int) string {
+	switch {
+	case status < http.StatusBadRequest:
+		if o.failedAttempts.Load() > 0 {
+			return outcomeFailoverSuccess
+		}
+		return outcomeSuccess
+	case o.noModels.Load():
+		return outcomeNoModels
+	case status == http.StatusTooManyRequests:
+		return outcomeRateLimited
+	case status == http.StatusPaymentRequired:
+		return outcomeUpstreamError
+	case status < http.StatusInternalServerError:
+		return outcomeClientError
+	default:
+		return outcomeUpstreamError
+	}
+}
+
+// trackOutcome 开始跟踪请求结果，返回的函数应在处理函数中 defer 调用，
+// 用于记录结果分类日志和指标
+func (s *Server) trackOutcome(c *gin.Context) func() {
+	o := &requestOutcome{}
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestOutcomeKey{}, o))
+
+	return func() {
+		endpoint := c.FullPath()
+		status := c.Writer.Status()
+		outcome := o.classify(status)
+
+		requestOutcomesTotal.inc(endpoint, outcome)
+		slog.Info("request outcome",
+			"request_id", requestID(c),
+			"endpoint", endpoint,
+			"status", status,
+			"outcome", outcome,
+			"failed_attempts", o.failedAttempts.Load())
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// captureLogs 将默认 slog 输出重定向到缓冲区，测试结束后恢复
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+// loggedOutcomes 返回日志中 "request outcome" 记录的 outcome 字段
+func loggedOutcomes(t *testing.T, logs string) []string {
+	t.Helper()
+	var outcomes []string
+	for _, line := range strings.Split(strings.TrimSpace(logs), "\n") {
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			continue
+		}
+		if rec["msg"] == "request outcome" {
+			outcomes = append(outcomes, rec["outcome"].(string))
+		}
+	}
+	return outcomes
+}
+
+func TestOutcomeFailoverSuccessLogged(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		if body["model"] == "org/broken:free" {
+			writeUpstreamError(w, http.StatusInternalServerError, "boom")
+			return
+		}
+		writeChatCompletion(w, body["model"].(string), "hello")
+	}
+	s := newTestServer(t, Config{FreeMode: true}, upstream, "org/broken:free", "org/working:free")
+	logs := captureLogs(t)
+
+	before := requestOutcomesTotal.value("/api/chat", outcomeFailoverSuccess)
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+		`{"model":"broken:free","messages":[{"role":"user","content":"hi"}],"stream":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	if got := loggedOutcomes(t, logs.String()); len(got) != 1 || got[0] != outcomeFailoverSuccess {
+		t.Errorf("logged outcomes = %v, want [%s]", got, outcomeFailoverSuccess)
+	}
+	if got := requestOutcomesTotal.value("/api/chat", outcomeFailoverSuccess) - before; got != 1 {
+		t.Errorf("failover-success count moved by %v, want 1", got)
+	}
+}
+
+func TestOutcomeClassify(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		failed   int32
+		noModels bool
+		want     string
+	}{
+		{"direct success", http.StatusOK, 0, false, outcomeSuccess},
+		{"failover success", http.StatusOK, 2, false, outcomeFailoverSuccess},
+		{"bad request", http.StatusBadRequest, 0, false, outcomeClientError},
+		{"upstream failure", http.StatusBadGateway, 3, false, outcomeUpstreamError},
+		{"upstream rate limit", http.StatusTooManyRequests, 0, false, outcomeRateLimited},
+		{"upstream out of credits", http.StatusPaymentRequired, 0, false, outcomeUpstreamError},
+		{"no models", http.StatusServiceUnavailable, 0, true, outcomeNoModels},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &requestOutcome{}
+			o.failedAttempts.Store(tt.failed)
+			o.noModels.Store(tt.noModels)
+			if got := o.classify(tt.status); got != tt.want {
+				t.Errorf("classify(%d) = %q, want %q", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutcomeUpstreamRateLimitIsNotClientError(t *testing.T) {
+	for _, tt := range []struct {
+		status int
+		want   string
+	}{
+		{http.StatusTooManyRequests, outcomeRateLimited},
+		{http.StatusPaymentRequired, outcomeUpstreamError},
+	} {
+		upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+		upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+			writeUpstreamError(w, tt.status, "upstream refused")
+		}
+		s := newTestServer(t, Config{}, upstream)
+		logs := captureLogs(t)
+
+		w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+			`{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`)
+		if w.Code != tt.status {
+			t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.status, w.Body.String())
+		}
+		if got := loggedOutcomes(t, logs.String()); len(got) != 1 || got[0] != tt.want {
+			t.Errorf("upstream %d outcomes = %v, want [%s]", tt.status, got, tt.want)
+		}
+	}
+}
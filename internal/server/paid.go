@@ -0,0 +1,85 @@
+package server
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// orderPaidFallbacks 按每 token 的提示词加补全价格从低到高排列付费备选模型，
+// 价格相同时保持配置顺序；不在 infos 中或价格未知的模型排在最后并记录警告
+func orderPaidFallbacks(models []string, infos []ModelInfo) []string {
+	prices := make(map[string]float64, len(infos))
+	for _, info := range infos {
+		if price, ok := info.TokenPrice(); ok {
+			prices[info.ID] = price
+		}
+	}
+
+	ordered := append([]string(nil), models...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		pi, iok := prices[ordered[i]]
+		pj, jok := prices[ordered[j]]
+		if iok != jok {
+			return iok
+		}
+		return pi < pj
+	})
+
+	for _, m := range ordered {
+		if _, ok := prices[m]; !ok {
+			slog.Warn("No pricing for paid fallback model, trying it last", "model", m)
+		}
+	}
+	return ordered
+}
+
+// loadPaidFallbacks 获取模型价格并按价格排列 failover.paid_fallbacks，
+// 获取失败时保持配置顺序
+func (s *Server) loadPaidFallbacks() {
+	if len(s.config.PaidFallbacks) == 0 {
+		return
+	}
+
+	infos, err := FetchModels(s.modelsURL(), s.config.APIKey, s.transport)
+	if err != nil {
+		slog.Error("Failed to fetch pricing for paid fallbacks, keeping configured order", "error", err)
+		infos = nil
+	}
+	ordered := orderPaidFallbacks(s.config.PaidFallbacks, infos)
+
+	s.freeModelsMu.Lock()
+	s.paidFallbacks = ordered
+	s.freeModelsMu.Unlock()
+	slog.Info("Paid fallbacks enabled", "models", ordered)
+}
+
+// failoverCandidates 返回故障转移依次考虑的模型：先是免费模型，免费模型用尽后是按价格排列的付费备选
+func (s *Server) failoverCandidates() []string {
+	s.freeModelsMu.RLock()
+	defer s.freeModelsMu.RUnlock()
+
+	candidates := make([]string, 0, len(s.freeModels)+len(s.paidFallbacks))
+	candidates = append(candidates, s.freeModels...)
+	for _, m := range s.paidFallbacks {
+		if !s.contains(s.freeModels, m) {
+			candidates = append(candidates, m)
+		}
+	}
+	return candidates
+}
+
+// directPaidModel 判断免费模式下的请求是否以完整 ID 显式指定了 DirectPaidModels 中的付费模型，
+// 或以别名指向其中的付费模型，是则返回配置中的模型 ID，请求直接发往该模型，不参与免费模型故障转移
+func (s *Server) directPaidModel(model string) (string, bool) {
+	model = s.resolveAlias(model)
+	if !strings.Contains(model, "/") {
+		return "", false
+	}
+	for _, m := range s.config.DirectPaidModels {
+		if sameModelName(m, model, s.config.CaseInsensitiveModels) {
+			return m, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestOrderPaidFallbacks(t *testing.T) {
+	infos := []ModelInfo{
+		{ID: "org/pricey", PromptPrice: "0.00001", CompletionPrice: "0.00003"},
+		{ID: "org/cheap", PromptPrice: "0.0000001", CompletionPrice: "0.0000002"},
+		{ID: "org/mid", PromptPrice: "0.000001", CompletionPrice: "0.000002"},
+		{ID: "org/broken", PromptPrice: "n/a", CompletionPrice: "0"},
+	}
+	got := orderPaidFallbacks([]string{"org/unknown", "org/pricey", "org/broken", "org/mid", "org/cheap"}, infos)
+	want := []string{"org/cheap", "org/mid", "org/pricey", "org/unknown", "org/broken"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("orderPaidFallbacks() = %v, want %v", got, want)
+	}
+}
+
+func TestPaidFallbacksTriedCheapestFirst(t *testing.T) {
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "org/free-a:free"},
+		fakeModel{ID: "org/pricey", Prompt: "0.00001", Completion: "0.00003"},
+		fakeModel{ID: "org/cheap", Prompt: "0.0000001", Completion: "0.0000002"},
+		fakeModel{ID: "org/mid", Prompt: "0.000001", Completion: "0.000002"},
+	)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		if body["model"] == "org/pricey" {
+			writeChatCompletion(w, "org/pricey", "paid answer")
+			return
+		}
+		writeUpstreamError(w, http.StatusBadGateway, "down")
+	}
+	s := newTestServer(t, Config{
+		FreeMode:      true,
+		PaidFallbacks: []string{"org/pricey", "org/mid", "org/cheap"},
+	}, upstream, "org/free-a:free")
+	s.loadPaidFallbacks()
+
+	body := `{"model":"free-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	want := []string{"org/free-a:free", "org/cheap", "org/mid", "org/pricey"}
+	if got := upstream.requestedModels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requested models = %v, want %v", got, want)
+	}
+}
+
+func TestDirectPaidModelBypassesFailover(t *testing.T) {
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "org/free-a:free"},
+		fakeModel{ID: "org/free-b:free"},
+		fakeModel{ID: "org/paid", Prompt: "0.000001", Completion: "0.000002"},
+		fakeModel{ID: "org/other-paid", Prompt: "0.000001", Completion: "0.000002"},
+	)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		model, _ := body["model"].(string)
+		if model == "org/free-a:free" {
+			writeUpstreamError(w, http.StatusBadGateway, "down")
+			return
+		}
+		writeChatCompletion(w, model, "answer")
+	}
+	s := newTestServer(t, Config{FreeMode: true, DirectPaidModels: []string{"org/paid"}},
+		upstream, "org/free-a:free", "org/free-b:free")
+	r := s.buildRouter()
+
+	// 普通请求仍按免费模型故障转移
+	w := doJSON(t, r, http.MethodPost, "/api/chat", `{"model":"free-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("free request status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got, want := upstream.requestedModels(), []string{"org/free-a:free", "org/free-b:free"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("free request models = %v, want %v", got, want)
+	}
+
+	// 显式请求允许列表中的付费模型时直接发往该模型
+	for _, stream := range []string{"false", "true"} {
+		before := len(upstream.requestedModels())
+		w = doJSON(t, r, http.MethodPost, "/api/chat", `{"model":"org/paid","stream":`+stream+`,"messages":[{"role":"user","content":"hi"}]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("paid request (stream=%s) status = %d, body = %s", stream, w.Code, w.Body.String())
+		}
+		if got := upstream.requestedModels()[before:]; !reflect.DeepEqual(got, []string{"org/paid"}) {
+			t.Errorf("paid request (stream=%s) models = %v, want [org/paid]", stream, got)
+		}
+	}
+
+	// 不在允许列表中的付费模型仍走免费故障转移
+	before := len(upstream.requestedModels())
+	doJSON(t, r, http.MethodPost, "/api/chat", `{"model":"org/other-paid","stream":false,"messages":[{"role":"user","content":"hi"}]}`)
+	for _, m := range upstream.requestedModels()[before:] {
+		if m == "org/other-paid" {
+			t.Errorf("request for a paid model outside the allow-list reached %s", m)
+		}
+	}
+}
@@ -6,24 +6,93 @@ import (
 	"time"
 )
 
+// PermanentFailureTTL 为永久失败标记的有效期，过期后模型会重新参与故障转移，
+// 以便发现重新上线的模型
+const PermanentFailureTTL = 7 * 24 * time.Hour
+
 type PermanentFailureTracker struct {
 	mu              sync.RWMutex
 	permanentFailed map[string]time.Time
 	temporaryFailed map[string]time.Time
+	// disabled 为因长期高失败率被自动停用的模型及其停用截止时间
+	disabled map[string]time.Time
+	// store 用于持久化永久失败标记和自动停用，为 nil 时只保存在内存中
+	store *FailureStore
 }
 
-func NewPermanentFailureTracker() *PermanentFailureTracker {
-	return &PermanentFailureTracker{
+// NewPermanentFailureTracker 创建失败跟踪器；store 不为 nil 时从中加载未过期的永久失败标记和自动停用，
+// 并在之后的标记时写回，使已知失效的模型在重启后不必重新探测
+func NewPermanentFailureTracker(store *FailureStore) *PermanentFailureTracker {
+	p := &PermanentFailureTracker{
 		permanentFailed: make(map[string]time.Time),
 		temporaryFailed: make(map[string]time.Time),
+		disabled:        make(map[string]time.Time),
+		store:           store,
+	}
+	if store == nil {
+		return p
+	}
+
+	disabled, err := store.DisabledModels(time.Now())
+	if err != nil {
+		slog.Warn("failed to load auto-disabled models", "error", err)
+	}
+	for model, until := range disabled {
+		p.disabled[model] = until
+	}
+
+	failed, err := store.PermanentFailures(time.Now().Add(-PermanentFailureTTL))
+	if err != nil {
+		slog.Warn("failed to load permanent failures", "error", err)
+		return p
+	}
+	for model, at := range failed {
+		p.permanentFailed[model] = at
+	}
+	if len(failed) > 0 {
+		slog.Info("Loaded permanently unavailable models", "count", len(failed))
 	}
+	return p
 }
 
 func (p *PermanentFailureTracker) MarkPermanentFailure(model string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.permanentFailed[model] = time.Now()
+	now := time.Now()
+	p.permanentFailed[model] = now
 	slog.Warn("Model marked as permanently unavailable", "model", model)
+
+	if p.store != nil {
+		if err := p.store.SavePermanentFailure(model, now); err != nil {
+			slog.Warn("failed to persist permanent failure", "model", model, "error", err)
+		}
+	}
+}
+
+// Disable 自动停用模型直到 until，并清零持久化的累计尝试计数，使重新探测后按新的窗口统计
+func (p *PermanentFailureTracker) Disable(model string, until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.disabled[model] = until
+
+	if p.store != nil {
+		if err := p.store.DisableModel(model, until); err != nil {
+			slog.Warn("failed to persist auto-disable", "model", model, "error", err)
+		}
+	}
+}
+
+// IsDisabled 判断模型是否处于自动停用期
+func (p *PermanentFailureTracker) IsDisabled(model string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.isDisabled(model)
+}
+
+// isDisabled 与 IsDisabled 相同，调用方需持有锁
+func (p *PermanentFailureTracker) isDisabled(model string) bool {
+	until, exists := p.disabled[model]
+	return exists && time.Now().Before(until)
 }
 
 func (p *PermanentFailureTracker) MarkTemporaryFailure(model string) {
@@ -35,15 +104,20 @@ func (p *PermanentFailureTracker) MarkTemporaryFailure(model string) {
 func (p *PermanentFailureTracker) IsPermanentlyFailed(model string) bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	_, exists := p.permanentFailed[model]
-	return exists
+	return p.permanentlyFailed(model)
+}
+
+// permanentlyFailed 判断模型是否有未过期的永久失败标记，调用方需持有锁
+func (p *PermanentFailureTracker) permanentlyFailed(model string) bool {
+	markedAt, exists := p.permanentFailed[model]
+	return exists && time.Since(markedAt) < PermanentFailureTTL
 }
 
 func (p *PermanentFailureTracker) ShouldSkip(model string) bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	if _, exists := p.permanentFailed[model]; exists {
+	if p.permanentlyFailed(model) || p.isDisabled(model) {
 		return true
 	}
 
@@ -62,11 +136,21 @@ func (p *PermanentFailureTracker) ClearTemporaryFailure(model string) {
 	delete(p.temporaryFailed, model)
 }
 
+// GetStats 返回未过期的永久失败（含自动停用）和临时失败的模型数
 func (p *PermanentFailureTracker) GetStats() (permanent int, temporary int) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	permanent = len(p.permanentFailed)
+	for model := range p.permanentFailed {
+		if p.permanentlyFailed(model) {
+			permanent++
+		}
+	}
+	for model := range p.disabled {
+		if p.isDisabled(model) && !p.permanentlyFailed(model) {
+			permanent++
+		}
+	}
 
 	now := time.Now()
 	for _, failTime := range p.temporaryFailed {
@@ -77,3 +161,15 @@ func (p *PermanentFailureTracker) GetStats() (permanent int, temporary int) {
 
 	return permanent, temporary
 }
+
+// Reset 清空内存中的永久失败、临时失败和自动停用标记，返回清除前各自的条目数。
+// 持久化的永久失败和自动停用记录由 FailureStore.ResetAllFailures 清除
+func (p *PermanentFailureTracker) Reset() (permanent, temporary, disabled int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	permanent, temporary, disabled = len(p.permanentFailed), len(p.temporaryFailed), len(p.disabled)
+	p.permanentFailed = make(map[string]time.Time)
+	p.temporaryFailed = make(map[string]time.Time)
+	p.disabled = make(map[string]time.Time)
+	return permanent, temporary, disabled
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPermanentFailuresSurviveRestart(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), FailureDBName)
+	store, err := NewFailureStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	NewPermanentFailureTracker(store).MarkPermanentFailure("org/gone:free")
+	store.Close()
+
+	store, err = NewFailureStore(dbPath)
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	defer store.Close()
+	tracker := NewPermanentFailureTracker(store)
+	if !tracker.IsPermanentlyFailed("org/gone:free") || !tracker.ShouldSkip("org/gone:free") {
+		t.Error("permanent failure was not restored from the store")
+	}
+	if tracker.IsPermanentlyFailed("org/alive:free") {
+		t.Error("unrelated model reported as permanently failed")
+	}
+	if permanent, _ := tracker.GetStats(); permanent != 1 {
+		t.Errorf("GetStats() permanent = %d, want 1", permanent)
+	}
+
+	if _, err := store.DeleteFailure("gone:free"); err != nil {
+		t.Fatalf("DeleteFailure() error = %v", err)
+	}
+	if NewPermanentFailureTracker(store).IsPermanentlyFailed("org/gone:free") {
+		t.Error("DeleteFailure should clear the persisted permanent failure")
+	}
+}
+
+func TestPermanentFailuresExpire(t *testing.T) {
+	store, err := NewFailureStore(filepath.Join(t.TempDir(), FailureDBName))
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SavePermanentFailure("org/old:free", time.Now().Add(-PermanentFailureTTL-time.Hour)); err != nil {
+		t.Fatalf("SavePermanentFailure() error = %v", err)
+	}
+	if NewPermanentFailureTracker(store).IsPermanentlyFailed("org/old:free") {
+		t.Error("expired permanent failure should be re-checked")
+	}
+
+	tracker := NewPermanentFailureTracker(nil)
+	tracker.permanentFailed["org/stale:free"] = time.Now().Add(-PermanentFailureTTL)
+	if tracker.ShouldSkip("org/stale:free") {
+		t.Error("in-memory permanent failure should expire after PermanentFailureTTL")
+	}
+}
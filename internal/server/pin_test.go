@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPinModel(t *testing.T) {
+	tests := []struct {
+		name     string
+		pin      bool
+		stream   bool
+		wantCode int
+		want     []string
+	}{
+		{"unpinned falls back", false, false, http.StatusOK, []string{"org/named:free", "org/other:free"}},
+		{"unpinned stream falls back", false, true, http.StatusOK, []string{"org/named:free", "org/other:free"}},
+		{"pinned returns error", true, false, http.StatusBadGateway, []string{"org/named:free"}},
+		{"pinned stream returns error", true, true, http.StatusBadGateway, []string{"org/named:free"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t)
+			upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+				model := body["model"].(string)
+				if model == "org/named:free" {
+					writeUpstreamError(w, http.StatusBadGateway, "provider returned error")
+					return
+				}
+				if stream, _ := body["stream"].(bool); stream {
+					writeChatStream(w, model, "ok")
+					return
+				}
+				writeChatCompletion(w, model, "ok")
+			}
+			s := newTestServer(t, Config{FreeMode: true, PinModel: tt.pin}, upstream, "org/other:free", "org/named:free")
+
+			stream := "false"
+			if tt.stream {
+				stream = "true"
+			}
+			body := `{"model":"named:free","stream":` + stream + `,"messages":[{"role":"user","content":"hi"}]}`
+			w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d; body = %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if got := upstream.requestedModels(); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("requested models = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPinnedModelInCooldown(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true, PinModel: true}, upstream, "org/other:free", "org/named:free")
+	s.failureStore.MarkFailure("org/named:free")
+
+	body := `{"model":"named:free","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat", body)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503; body = %s", w.Code, w.Body.String())
+	}
+	if got := upstream.requestedModels(); len(got) != 0 {
+		t.Errorf("requested models = %v, want none", got)
+	}
+
+	// 未指定具体免费模型的请求不受影响
+	w = doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat", strings.Replace(body, "named:free", "unknown", 1))
+	if w.Code != http.StatusOK {
+		t.Errorf("unpinned request status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
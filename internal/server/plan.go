@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+)
+
+// 免费模型在故障转移中被跳过的原因
+const (
+	skipPermanentFailure = "permanent_failure"
+	skipFiltered         = "filtered"
+	skipPromptTooLarge   = "prompt_too_large"
+	skipCooldown         = "cooldown"
+	skipAutoDisabled     = "auto_disabled"
+)
+
+// SkippedModel 是故障转移计划中被跳过的模型及原因
+type SkippedModel struct {
+	Model  string `json:"model"`
+	Reason string `json:"reason"`
+}
+
+// freeModelSkipReason 返回免费模型在本次请求中应被跳过的原因，可以尝试时返回空字符串
+func (s *Server) freeModelSkipReason(model string, promptTokens int) string {
+	return s.snapshotSkipReason(&modelSnapshot{filter: s.currentModelFilter()}, model, promptTokens)
+}
+
+// snapshotSkipReason 与 freeModelSkipReason 相同，但按快照中的过滤器判断
+func (s *Server) snapshotSkipReason(snap *modelSnapshot, model string, promptTokens int) string {
+	if s.permanentFails.IsPermanentlyFailed(model) {
+		return skipPermanentFailure
+	}
+
+	parts := strings.Split(model, "/")
+	if !snap.inFilter(parts[len(parts)-1]) {
+		return skipFiltered
+	}
+
+	if !s.fitsPromptLimit(model, promptTokens) {
+		return skipPromptTooLarge
+	}
+
+	if s.permanentFails.IsDisabled(model) {
+		return skipAutoDisabled
+	}
+	skip, err := s.failureStore.ShouldSkip(model)
+	if err != nil || skip {
+		return skipCooldown
+	}
+	return ""
+}
+
+// preferredFreeModel 按快照解析客户端指定的模型，返回可优先尝试的免费模型完整 ID
+func (s *Server) preferredFreeModel(snap *modelSnapshot, requestedModel string, promptTokens int) (string, bool) {
+	fullModelName := snap.resolve(requestedModel)
+	if !s.contains(snap.free, fullModelName) {
+		return fullModelName, false
+	}
+	if !s.fitsPromptLimit(fullModelName, promptTokens) {
+		return fullModelName, false
+	}
+	if s.permanentFails.IsDisabled(fullModelName) {
+		return fullModelName, false
+	}
+	skip, err := s.failureStore.ShouldSkip(fullModelName)
+	return fullModelName, err == nil && !skip
+}
+
+// errPinnedModelUnavailable 是固定模型时指定的模型处于冷却或无法容纳提示词时返回的错误
+var errPinnedModelUnavailable = errors.New("requested model is temporarily unavailable and failover.pin_model is set")
+
+// pinnedModel 判断开启 PinModel 时客户端是否指定了一个具体的免费模型，此时不切换到其他模型
+func (s *Server) pinnedModel(snap *modelSnapshot, fullModelName string) bool {
+	return s.config.PinModel && s.contains(snap.free, fullModelName)
+}
+
+// pinnedUnavailableError 返回固定模型暂不可用时的错误
+func pinnedUnavailableError(model string) error {
+	return &FailoverError{
+		Attempts: []ModelFailure{{Model: model, Class: skipCooldown, Error: errPinnedModelUnavailable.Error()}},
+		Last:     errPinnedModelUnavailable,
+	}
+}
+
+// freeModelPlan 返回免费模式下会按顺序尝试的模型，以及被跳过的模型，不发送任何上游请求
+func (s *Server) freeModelPlan(ctx context.Context, requestedModel string, promptTokens int) ([]string, []SkippedModel) {
+	var candidates []string
+	snap := s.takeModelSnapshot(ctx)
+	preferred, ok := s.preferredFreeModel(snap, requestedModel, promptTokens)
+	if ok {
+		candidates = append(candidates, preferred)
+	}
+
+	var skipped []SkippedModel
+	for _, m := range s.orderForPrompt(snap.candidates, promptTokens) {
+		if ok && m == preferred {
+			continue
+		}
+		if reason := s.snapshotSkipReason(snap, m, promptTokens); reason != "" {
+			skipped = append(skipped, SkippedModel{Model: m, Reason: reason})
+			continue
+		}
+		candidates = append(candidates, m)
+	}
+	return candidates, skipped
+}
+
+// planRequest 是 /api/admin/plan 的请求体
+type planRequest struct {
+	Model    string                         `json:"model"`
+	Messages []openai.ChatCompletionMessage `json:"messages"`
+}
+
+// handleAdminPlan 返回一个聊天请求会依次尝试的模型，用于排查模型选择，不调用上游
+func (s *Server) handleAdminPlan(c *gin.Context) {
+	var req planRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	promptTokens := estimatePromptTokens(req.Messages)
+	if !s.config.FreeMode {
+		fullModelName, err := s.resolveModel(c.Request.Context(), req.Model)
+		if err != nil {
+			writeError(c, http.StatusNotFound, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"free_mode":               false,
+			"estimated_prompt_tokens": promptTokens,
+			"candidates":              []string{fullModelName},
+			"skipped":                 []SkippedModel{},
+		})
+		return
+	}
+
+	candidates, skipped := s.freeModelPlan(c.Request.Context(), req.Model, promptTokens)
+	if candidates == nil {
+		candidates = []string{}
+	}
+	if skipped == nil {
+		skipped = []SkippedModel{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"free_mode":               true,
+		"estimated_prompt_tokens": promptTokens,
+		"candidates":              candidates,
+		"skipped":                 skipped,
+	})
+}
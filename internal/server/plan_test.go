@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAdminPlanMatchesCandidateOrder(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{
+		FreeMode:     true,
+		AdminEnabled: true,
+		ModelLimits:  []ModelLimit{{Model: "capped:free", MaxPromptTokens: 10}},
+	}, upstream,
+		"org/a:free", "org/b:free", "org/cooling:free", "org/hidden:free", "org/broken:free", "org/capped:free")
+
+	if err := os.WriteFile(s.config.FilterPath, []byte("!hidden\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.loadModelFilter()
+	s.failureStore.MarkFailure("org/cooling:free")
+	s.permanentFails.MarkPermanentFailure("org/broken:free")
+
+	prompt := strings.Repeat("x", 200)
+	body := `{"model":"b:free","messages":[{"role":"user","content":"` + prompt + `"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/admin/plan", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var plan struct {
+		Candidates []string       `json:"candidates"`
+		Skipped    []SkippedModel `json:"skipped"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &plan); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+
+	if want := []string{"org/b:free", "org/a:free"}; !reflect.DeepEqual(plan.Candidates, want) {
+		t.Errorf("candidates = %v, want %v", plan.Candidates, want)
+	}
+	wantSkipped := []SkippedModel{
+		{"org/cooling:free", skipCooldown},
+		{"org/hidden:free", skipFiltered},
+		{"org/broken:free", skipPermanentFailure},
+		{"org/capped:free", skipPromptTooLarge},
+	}
+	if !reflect.DeepEqual(plan.Skipped, wantSkipped) {
+		t.Errorf("skipped = %v, want %v", plan.Skipped, wantSkipped)
+	}
+
+	if got := upstream.requestedModels(); len(got) != 0 {
+		t.Errorf("plan sent upstream requests: %v", got)
+	}
+}
+
+func TestAdminPlanRequiresAdminFlag(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true}, upstream, "org/a:free")
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/admin/plan", `{"model":"a:free","messages":[]}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 when admin endpoints are disabled", w.Code)
+	}
+}
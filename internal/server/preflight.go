@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// PreflightReport 是启动前配置检查的结果
+type PreflightReport struct {
+	// FreeModels 为免费模式下解析到的免费模型数（已按 ToolUseOnly 过滤），非免费模式为 0
+	FreeModels int
+	// VisibleModels 为 FreeModels 中通过模型过滤文件的数量
+	VisibleModels int
+	// FilterPatterns 为生效的模型过滤器中的规则数，不过滤时为 0
+	FilterPatterns int
+	// FilterSource 为过滤器来源：file（过滤文件）、default（内置默认过滤器）或 none
+	FilterSource string
+}
+
+// Preflight 在不监听端口的前提下检查配置：构造 provider，请求 /auth/key 确认上游可达且 API 密钥有效，
+// 免费模式下再从 OpenRouter 获取免费模型列表（不读写模型缓存），最后加载模型过滤文件。
+// 返回的错误指明失败的步骤
+func (s *Server) Preflight() (PreflightReport, error) {
+	var report PreflightReport
+
+	provider, err := s.newProvider()
+	if err != nil {
+		return report, fmt.Errorf("construct provider: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	if err := provider.Ping(ctx); err != nil {
+		return report, fmt.Errorf("check api key: %w", err)
+	}
+
+	var freeModels []string
+	if s.config.FreeMode {
+		models, err := FetchFreeModels(s.modelsURL(), s.config.APIKey, s.transport)
+		if err != nil {
+			return report, fmt.Errorf("fetch free models: %w", err)
+		}
+		freeModels = modelIDs(FilterMinContext(models, s.config.MinContextLength), s.config.ToolUseOnly)
+		if len(freeModels) == 0 {
+			return report, fmt.Errorf("fetch free models: no free models available")
+		}
+	}
+
+	filter, source, err := s.readModelFilter()
+	if err != nil {
+		return report, fmt.Errorf("load model filter: %w", err)
+	}
+	report.FilterSource = source
+
+	report.FreeModels = len(freeModels)
+	report.FilterPatterns = len(filter.Patterns())
+	for _, id := range freeModels {
+		parts := strings.Split(id, "/")
+		if filter.Match(parts[len(parts)-1]) {
+			report.VisibleModels++
+		}
+	}
+	return report, nil
+}
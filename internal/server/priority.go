@@ -0,0 +1,56 @@
+package server
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// matchesModel 判断配置中的模型名（完整 ID 或显示名）是否指向 model
+func matchesModel(name, model string) bool {
+	if name == model {
+		return true
+	}
+	parts := strings.Split(model, "/")
+	return name == parts[len(parts)-1]
+}
+
+// applyPriority 将 priority 中列出的模型按配置顺序移到列表最前，其余模型保持原有顺序
+func applyPriority(models, priority []string) []string {
+	if len(priority) == 0 {
+		return models
+	}
+
+	ordered := make([]string, 0, len(models))
+	used := make(map[string]bool, len(models))
+	for _, name := range priority {
+		for _, m := range models {
+			if !used[m] && matchesModel(name, m) {
+				ordered = append(ordered, m)
+				used[m] = true
+			}
+		}
+	}
+	for _, m := range models {
+		if !used[m] {
+			ordered = append(ordered, m)
+		}
+	}
+	return ordered
+}
+
+// warnUnknownPriorityModels 对 failover.priority 中不在免费模型列表里的条目记录警告
+func (s *Server) warnUnknownPriorityModels() {
+	models := s.freeModelList()
+	for _, name := range s.config.FailoverPriority {
+		found := false
+		for _, m := range models {
+			if matchesModel(name, m) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			slog.Warn("Ignoring failover priority entry that is not a free model", "model", name)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestApplyPriority(t *testing.T) {
+	models := []string{"org/a:free", "org/b:free", "org/c:free", "org/d:free"}
+
+	got := applyPriority(models, []string{"c:free", "org/not-free", "org/a:free"})
+	want := []string{"org/c:free", "org/a:free", "org/b:free", "org/d:free"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("applyPriority() = %v, want %v", got, want)
+	}
+
+	if got := applyPriority(models, nil); !reflect.DeepEqual(got, models) {
+		t.Errorf("applyPriority(nil) = %v, want unchanged", got)
+	}
+}
+
+func TestFailoverPriorityReordersGetFreeChat(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		writeUpstreamError(w, http.StatusBadGateway, "upstream unavailable")
+	}
+	// 免费模型按上下文长度排序为 big, mid, small
+	s := newTestServer(t, Config{
+		FreeMode:         true,
+		FailoverPriority: []string{"small:free", "openai/gpt-4o"},
+	}, upstream, "org/big:free", "org/mid:free", "org/small:free")
+	s.warnUnknownPriorityModels()
+	s.reorderFreeModelsByLatency()
+
+	body := `{"model":"auto","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+
+	want := []string{"org/small:free", "org/big:free", "org/mid:free"}
+	if got := upstream.requestedModels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("try order = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// piiRule 是一条脱敏规则：匹配 pattern 的内容替换为 placeholder
+type piiRule struct {
+	pattern     *regexp.Regexp
+	placeholder string
+}
+
+// defaultPIIRules 为未配置自定义规则时使用的内置规则（邮箱、类信用卡号）
+var defaultPIIRules = []piiRule{
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), "[CARD]"},
+}
+
+// PIIScrubber 在请求发往上游前替换消息内容中的敏感信息
+type PIIScrubber struct {
+	rules []piiRule
+}
+
+// NewPIIScrubber 编译自定义正则规则，patterns 为空时使用内置的邮箱和卡号规则
+func NewPIIScrubber(patterns []string) (*PIIScrubber, error) {
+	if len(patterns) == 0 {
+		return &PIIScrubber{rules: defaultPIIRules}, nil
+	}
+
+	rules := make([]piiRule, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid privacy pattern %q: %w", p, err)
+		}
+		rules = append(rules, piiRule{pattern: re, placeholder: "[REDACTED]"})
+	}
+	return &PIIScrubber{rules: rules}, nil
+}
+
+// scrubText 依次应用所有规则，返回替换后的文本和命中次数
+func (p *PIIScrubber) scrubText(text string) (string, int) {
+	hits := 0
+	for _, rule := range p.rules {
+		text = rule.pattern.ReplaceAllStringFunc(text, func(string) string {
+			hits++
+			return rule.placeholder
+		})
+	}
+	return text, hits
+}
+
+// ScrubMessages 返回脱敏后的消息副本，不修改调用方的切片
+func (p *PIIScrubber) ScrubMessages(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	scrubbed := make([]openai.ChatCompletionMessage, len(messages))
+	total := 0
+	for i, msg := range messages {
+		var hits int
+		msg.Content, hits = p.scrubText(msg.Content)
+		total += hits
+
+		if len(msg.MultiContent) > 0 {
+			parts := make([]openai.ChatMessagePart, len(msg.MultiContent))
+			copy(parts, msg.MultiContent)
+			for j := range parts {
+				if parts[j].Type == openai.ChatMessagePartTypeText {
+					parts[j].Text, hits = p.scrubText(parts[j].Text)
+					total += hits
+				}
+			}
+			msg.MultiContent = parts
+		}
+		scrubbed[i] = msg
+	}
+
+	if total > 0 {
+		slog.Warn("已脱敏请求中的敏感信息", "matches", total)
+	}
+	return scrubbed
+}
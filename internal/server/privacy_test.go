@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func upstreamContent(t *testing.T, body map[string]interface{}) string {
+	t.Helper()
+
+	messages, _ := body["messages"].([]interface{})
+	if len(messages) == 0 {
+		t.Fatalf("upstream request has no messages: %v", body)
+	}
+	msg, _ := messages[0].(map[string]interface{})
+	content, _ := msg["content"].(string)
+	return content
+}
+
+func TestScrubPII(t *testing.T) {
+	const prompt = `{"q": "mail alice@example.com about order 42"}`
+
+	tests := []struct {
+		name  string
+		scrub bool
+		want  string
+	}{
+		{"enabled", true, `{"q": "mail [EMAIL] about order 42"}`},
+		{"disabled", false, prompt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			s := newTestServer(t, Config{ScrubPII: tt.scrub}, upstream)
+			r := s.buildRouter()
+
+			content, _ := json.Marshal(prompt)
+			body := `{"model":"model-a","messages":[{"role":"user","content":` + string(content) + `}]}`
+			w := doJSON(t, r, http.MethodPost, "/v1/chat/completions", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			if got := upstreamContent(t, upstream.lastRequest(t)); got != tt.want {
+				t.Errorf("upstream content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPIIScrubberCustomPatterns(t *testing.T) {
+	scrubber, err := NewPIIScrubber([]string{`secret-\d+`})
+	if err != nil {
+		t.Fatalf("NewPIIScrubber() error = %v", err)
+	}
+
+	in := []openai.ChatCompletionMessage{
+		{Role: "user", Content: "token secret-123, mail bob@example.com"},
+		{Role: "user", MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "secret-9"},
+		}},
+	}
+	out := scrubber.ScrubMessages(in)
+
+	if got, want := out[0].Content, "token [REDACTED], mail bob@example.com"; got != want {
+		t.Errorf("Content = %q, want %q", got, want)
+	}
+	if got := out[1].MultiContent[0].Text; got != "[REDACTED]" {
+		t.Errorf("MultiContent text = %q, want [REDACTED]", got)
+	}
+	if in[0].Content != "token secret-123, mail bob@example.com" || in[1].MultiContent[0].Text != "secret-9" {
+		t.Error("ScrubMessages modified the input messages")
+	}
+
+	if _, err := NewPIIScrubber([]string{"("}); err == nil {
+		t.Error("NewPIIScrubber() accepted an invalid pattern")
+	}
+}
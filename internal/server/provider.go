@@ -2,83 +2,460 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sashabaranov/go-openai"
 )
 
+const defaultBaseURL = "https://openrouter.ai/api/v1/"
+
+// 上游请求的默认超时，可通过 WithTimeouts 覆盖
+const (
+	DefaultUpstreamTimeout = 30 * time.Second
+	DefaultStreamTimeout   = 60 * time.Second
+)
+
+// DefaultModelListTTL 是 provider 缓存模型 ID 列表的默认有效期，可通过 WithModelListTTL 覆盖
+const DefaultModelListTTL = 10 * time.Minute
+
+// 非流式请求遇到上游 5xx 或超时时的重试参数
+const (
+	DefaultMaxRetries = 2
+	retryBaseDelay    = 200 * time.Millisecond
+	retryMaxDelay     = 2 * time.Second
+)
+
 type OpenrouterProvider struct {
-	client     *openai.Client
-	modelNames []string
+	client *openai.Client
+
+	// modelNames 缓存上游模型 ID，超过 modelListTTL 后在下次解析模型名时刷新
+	modelsMu        sync.Mutex
+	modelNames      []string
+	modelsFetchedAt time.Time
+	modelListTTL    time.Duration
+	now             func() time.Time
+	// modelMeta 缓存上游模型列表的完整元数据（上下文长度、支持的参数、价格），有效期同样为 modelListTTL
+	modelMeta          []orModel
+	modelMetaFetchedAt time.Time
+
+	scrubber      *PIIScrubber
+	systemPrefix  string
+	chatTimeout   time.Duration
+	streamTimeout time.Duration
+	maxRetries    int
+	streamingOnly []string
+	// reasoning 为 true 时解码上游响应中的推理内容
+	reasoning bool
+	// ignoreCase 为 true 时解析模型名忽略大小写
+	ignoreCase bool
+	// aliases 为模型别名表，解析模型名时先替换为别名目标
+	aliases   map[string]string
+	apiKey    string
+	modelsURL string
+	// keyURL 为校验 API 密钥的 /auth/key 接口地址
+	keyURL string
+	// transport 为获取模型列表使用的底层 Transport
+	transport http.RoundTripper
 }
 
-func NewOpenrouterProvider(apiKey string) *OpenrouterProvider {
-	config := openai.DefaultConfig(apiKey)
-	config.BaseURL = "https://openrouter.ai/api/v1/"
+// providerOptions 保存 OpenrouterProvider 的可选配置
+type providerOptions struct {
+	baseURL    string
+	scrubber   *PIIScrubber
+	prefix     string
+	maxRetries int
+	prefs      ProviderPreferences
+	rules      modelRules
+	referer    string
+	title      string
+	transport  http.RoundTripper
+	breaker    *circuitBreaker
+	streaming  []string
+	modelTTL   time.Duration
+	ignoreCase bool
+	reasoning  bool
+	aliases    map[string]string
+
+	chatTimeout   time.Duration
+	streamTimeout time.Duration
+}
+
+// ProviderOption 配置 OpenrouterProvider
+type ProviderOption func(*providerOptions)
+
+// WithBaseURL 设置 OpenRouter API 的基础地址，为空时使用默认地址
+func WithBaseURL(baseURL string) ProviderOption {
+	return func(o *providerOptions) {
+		if baseURL != "" {
+			o.baseURL = baseURL
+		}
+	}
+}
+
+// WithScrubber 设置发送前对消息内容脱敏的规则，nil 表示不脱敏
+func WithScrubber(scrubber *PIIScrubber) ProviderOption {
+	return func(o *providerOptions) {
+		o.scrubber = scrubber
+	}
+}
+
+// WithMaxRetries 设置非流式请求遇到上游 5xx 或超时时的最大重试次数，0 表示不重试
+func WithMaxRetries(n int) ProviderOption {
+	return func(o *providerOptions) {
+		if n >= 0 {
+			o.maxRetries = n
+		}
+	}
+}
+
+// WithProviderPreferences 设置注入到每个聊天请求中的 OpenRouter provider 路由偏好
+func WithProviderPreferences(prefs ProviderPreferences) ProviderOption {
+	return func(o *providerOptions) {
+		o.prefs = prefs
+	}
+}
+
+// WithTimeouts 设置上游请求超时：chat 为单次非流式请求的超时，0 表示使用 DefaultUpstreamTimeout；
+// stream 为整个流式响应的超时，0 表示不限制
+func WithTimeouts(chat, stream time.Duration) ProviderOption {
+	return func(o *providerOptions) {
+		if chat > 0 {
+			o.chatTimeout = chat
+		}
+		if stream >= 0 {
+			o.streamTimeout = stream
+		}
+	}
+}
 
-	if config.HTTPClient == nil {
-		config.HTTPClient = &http.Client{
-			Timeout: 30 * time.Second,
+// WithModelRules 设置按模型改写上游请求参数的规则
+func WithModelRules(rules []ModelRule) ProviderOption {
+	return func(o *providerOptions) {
+		o.rules = rules
+	}
+}
+
+// WithAttribution 设置 HTTP-Referer 和 X-Title 归属头，为空的项使用默认值
+func WithAttribution(referer, title string) ProviderOption {
+	return func(o *providerOptions) {
+		if referer != "" {
+			o.referer = referer
+		}
+		if title != "" {
+			o.title = title
 		}
 	}
+}
+
+// WithTransport 设置发往 OpenRouter 的底层 HTTP Transport，为 nil 时使用 http.DefaultTransport
+func WithTransport(transport http.RoundTripper) ProviderOption {
+	return func(o *providerOptions) {
+		if transport != nil {
+			o.transport = transport
+		}
+	}
+}
+
+// WithCircuitBreaker 把每次上游 HTTP 请求的结果计入熔断器，nil 表示不统计
+func WithCircuitBreaker(breaker *circuitBreaker) ProviderOption {
+	return func(o *providerOptions) {
+		o.breaker = breaker
+	}
+}
+
+// WithModelListTTL 设置模型 ID 列表缓存的有效期，不大于 0 时使用 DefaultModelListTTL
+func WithModelListTTL(ttl time.Duration) ProviderOption {
+	return func(o *providerOptions) {
+		if ttl > 0 {
+			o.modelTTL = ttl
+		}
+	}
+}
+
+// WithCaseInsensitiveModels 设置解析模型名时是否忽略大小写
+func WithCaseInsensitiveModels(ignore bool) ProviderOption {
+	return func(o *providerOptions) {
+		o.ignoreCase = ignore
+	}
+}
+
+// WithReasoning 设置是否保留上游返回的推理内容（message.reasoning / delta.reasoning）
+func WithReasoning(include bool) ProviderOption {
+	return func(o *providerOptions) {
+		o.reasoning = include
+	}
+}
+
+// WithStreamingOnly 设置只支持流式请求的模型通配符，匹配模型的非流式请求改用流式接口并聚合结果
+func WithStreamingOnly(patterns []string) ProviderOption {
+	return func(o *providerOptions) {
+		o.streaming = patterns
+	}
+}
+
+// WithSystemPrefix 设置注入到每个上游聊天请求开头的系统提示词，为空时不注入。
+// 只作用于聊天接口；completions 接口的原始文本提示词没有角色，不注入
+func WithSystemPrefix(prefix string) ProviderOption {
+	return func(o *providerOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithAliases 设置模型别名表，键为客户端使用的模型名，值为实际请求的 OpenRouter 模型名
+func WithAliases(aliases map[string]string) ProviderOption {
+	return func(o *providerOptions) {
+		o.aliases = aliases
+	}
+}
+
+func NewOpenrouterProvider(apiKey string, opts ...ProviderOption) *OpenrouterProvider {
+	options := providerOptions{
+		baseURL:    defaultBaseURL,
+		maxRetries: DefaultMaxRetries,
+		referer:    DefaultReferer,
+		title:      DefaultTitle,
+		transport:  http.DefaultTransport,
+		modelTTL:   DefaultModelListTTL,
+
+		chatTimeout:   DefaultUpstreamTimeout,
+		streamTimeout: DefaultStreamTimeout,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = options.baseURL
+
+	base := options.transport
+	if options.reasoning {
+		base = &reasoningTransport{base: base}
+	}
+	if options.breaker != nil {
+		base = &breakerTransport{base: base, breaker: options.breaker}
+	}
+	var transport http.RoundTripper = &attributionTransport{
+		base:    base,
+		referer: options.referer,
+		title:   options.title,
+	}
+	if !options.prefs.IsZero() {
+		transport = &chatBodyTransport{base: transport, rewrite: options.prefs.setProviderPreferences}
+	}
+	if len(options.rules) > 0 {
+		transport = &chatBodyTransport{base: transport, rewrite: options.rules.apply}
+	}
+	// 不设置 http.Client.Timeout：它同样限制读取响应体的时间，会截断较长的流式响应。
+	// 每个请求的超时由各自的 context 控制
+	config.HTTPClient = &http.Client{Transport: transport}
 
 	return &OpenrouterProvider{
-		client:     openai.NewClientWithConfig(config),
-		modelNames: []string{},
+		client:        openai.NewClientWithConfig(config),
+		modelListTTL:  options.modelTTL,
+		now:           time.Now,
+		scrubber:      options.scrubber,
+		systemPrefix:  options.prefix,
+		chatTimeout:   options.chatTimeout,
+		streamTimeout: options.streamTimeout,
+		maxRetries:    options.maxRetries,
+		streamingOnly: options.streaming,
+		reasoning:     options.reasoning,
+		ignoreCase:    options.ignoreCase,
+		aliases:       options.aliases,
+		apiKey:        apiKey,
+		modelsURL:     strings.TrimSuffix(options.baseURL, "/") + "/models",
+		keyURL:        strings.TrimSuffix(options.baseURL, "/") + "/auth/key",
+		transport:     options.transport,
 	}
 }
 
-func (o *OpenrouterProvider) Chat(messages []openai.ChatCompletionMessage, modelName string) (openai.ChatCompletionResponse, error) {
-	if modelName == "" {
-		return openai.ChatCompletionResponse{}, fmt.Errorf("model name cannot be empty")
+func (o *OpenrouterProvider) Chat(messages []openai.ChatCompletionMessage, modelName string) (ChatResponse, error) {
+	return o.CreateChat(openai.ChatCompletionRequest{Model: modelName, Messages: messages})
+}
+
+// CreateChat 发送完整的非流式聊天请求
+func (o *OpenrouterProvider) CreateChat(req openai.ChatCompletionRequest) (ChatResponse, error) {
+	return o.CreateChatWithGrace(context.Background(), req, 0)
+}
+
+// CreateChatWithGrace 与 CreateChat 相同，但每次尝试的超时额外延长 grace，
+// 用于让故障转移中的首个模型有更充裕的时间响应。ctx 取消时停止等待重试
+func (o *OpenrouterProvider) CreateChatWithGrace(ctx context.Context, req openai.ChatCompletionRequest, grace time.Duration) (ChatResponse, error) {
+	if req.Model == "" {
+		return ChatResponse{}, fmt.Errorf("model name cannot be empty")
 	}
-	if len(messages) == 0 {
-		return openai.ChatCompletionResponse{}, fmt.Errorf("messages cannot be empty")
+	if len(req.Messages) == 0 {
+		return ChatResponse{}, fmt.Errorf("messages cannot be empty")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if o.isStreamingOnly(req.Model) {
+		return o.createChatViaStream(req, grace)
+	}
 
-	req := openai.ChatCompletionRequest{
-		Model:    modelName,
-		Messages: messages,
-		Stream:   false,
+	req.Stream = false
+	req.StreamOptions = nil
+	req.Messages = o.withSystemPrefix(o.scrubMessages(req.Messages))
+
+	for attempt := 0; ; attempt++ {
+		resp, err := o.createChatOnce(req, o.chatTimeout+grace)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt >= o.maxRetries || !isRetryableError(err) {
+			return ChatResponse{}, wrapUpstreamError("chat completion failed", err)
+		}
+
+		delay := backoffDelay(retryBaseDelay, retryMaxDelay, attempt+1)
+		slog.Warn("upstream chat failed, retrying", "model", req.Model, "attempt", attempt+1, "delay", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ChatResponse{}, wrapUpstreamError("chat completion failed", err)
+		case <-timer.C:
+		}
+	}
+}
+
+// createChatOnce 发送一次非流式请求，每次尝试使用独立的超时
+func (o *OpenrouterProvider) createChatOnce(req openai.ChatCompletionRequest, timeout time.Duration) (ChatResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if !o.reasoning {
+		resp, err := o.client.CreateChatCompletion(ctx, req)
+		return ChatResponse{ChatCompletionResponse: resp}, err
 	}
 
-	resp, err := o.client.CreateChatCompletion(ctx, req)
+	rec := &bodyRecorder{}
+	resp, err := o.client.CreateChatCompletion(withBodyRecorder(ctx, rec), req)
 	if err != nil {
-		return openai.ChatCompletionResponse{}, fmt.Errorf("chat completion failed: %w", err)
+		return ChatResponse{}, err
 	}
+	return ChatResponse{ChatCompletionResponse: resp, Reasoning: decodeReasoning(rec.body)}, nil
+}
 
-	return resp, nil
+// isRetryableError 判断上游错误是否值得原地重试：5xx、超时和响应体被截断属于暂时性故障，
+// 模型不存在等永久错误不重试
+func isRetryableError(err error) bool {
+	if isPermanentError(err) {
+		return false
+	}
+	if isTimeoutError(err) || isDecodeError(err) {
+		return true
+	}
+	return apiStatusCode(err) >= http.StatusInternalServerError
+}
+
+// isDecodeError 判断错误是否由上游返回了截断或无效的 JSON 响应体引起（多为网关问题）
+func isDecodeError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// UpstreamError 携带上游返回的 HTTP 状态码，处理器据此向客户端返回相同的状态
+type UpstreamError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *UpstreamError) Error() string { return e.Err.Error() }
+
+func (e *UpstreamError) Unwrap() error { return e.Err }
+
+// wrapUpstreamError 为错误加上操作说明，上游返回了 HTTP 状态码时包装为 UpstreamError
+func wrapUpstreamError(op string, err error) error {
+	wrapped := fmt.Errorf("%s: %w", op, err)
+	if status := apiStatusCode(err); status != 0 {
+		return &UpstreamError{StatusCode: status, Err: wrapped}
+	}
+	return wrapped
 }
 
-func (o *OpenrouterProvider) ChatStream(messages []openai.ChatCompletionMessage, modelName string) (*openai.ChatCompletionStream, error) {
-	if modelName == "" {
+// apiStatusCode 提取 go-openai 错误中的 HTTP 状态码，没有时返回 0
+func apiStatusCode(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
+
+// scrubMessages 在配置了脱敏规则时返回脱敏后的消息
+func (o *OpenrouterProvider) scrubMessages(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	if o.scrubber == nil {
+		return messages
+	}
+	return o.scrubber.ScrubMessages(messages)
+}
+
+// ChatStream 是上游流式响应的抽象
+type ChatStream interface {
+	Recv() (ChatChunk, error)
+	Close() error
+}
+
+// closingStream 在关闭底层流后执行一次清理函数（取消上下文、释放并发槽位等）
+type closingStream struct {
+	ChatStream
+	once    sync.Once
+	cleanup func()
+}
+
+func (s *closingStream) Close() error {
+	err := s.ChatStream.Close()
+	s.once.Do(s.cleanup)
+	return err
+}
+
+func (o *OpenrouterProvider) ChatStream(messages []openai.ChatCompletionMessage, modelName string) (ChatStream, error) {
+	return o.CreateChatStream(openai.ChatCompletionRequest{Model: modelName, Messages: messages})
+}
+
+// CreateChatStream 发送完整的流式聊天请求
+func (o *OpenrouterProvider) CreateChatStream(req openai.ChatCompletionRequest) (ChatStream, error) {
+	return o.CreateChatStreamWithGrace(req, 0)
+}
+
+// CreateChatStreamWithGrace 与 CreateChatStream 相同，但设置了流式超时时额外延长 grace
+func (o *OpenrouterProvider) CreateChatStreamWithGrace(req openai.ChatCompletionRequest, grace time.Duration) (ChatStream, error) {
+	if req.Model == "" {
 		return nil, fmt.Errorf("model name cannot be empty")
 	}
-	if len(messages) == 0 {
+	if len(req.Messages) == 0 {
 		return nil, fmt.Errorf("messages cannot be empty")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-
-	req := openai.ChatCompletionRequest{
-		Model:    modelName,
-		Messages: messages,
-		Stream:   true,
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if o.streamTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), o.streamTimeout+grace)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
 	}
 
+	req.Stream = true
+	req.Messages = o.withSystemPrefix(o.scrubMessages(req.Messages))
 	stream, err := o.client.CreateChatCompletionStream(ctx, req)
 	if err != nil {
 		cancel()
-		return nil, fmt.Errorf("stream creation failed: %w", err)
+		return nil, wrapUpstreamError("stream creation failed", err)
 	}
 
-	return stream, nil
+	return &closingStream{ChatStream: &upstreamStream{stream: stream, reasoning: o.reasoning}, cleanup: cancel}, nil
 }
 
 type ModelDetails struct {
@@ -97,29 +474,37 @@ type Model struct {
 	Size       int64        `json:"size,omitempty"`
 	Digest     string       `json:"digest,omitempty"`
 	Details    ModelDetails `json:"details,omitempty"`
+	// ID 为 OpenRouter 完整模型 ID，不输出到响应
+	ID string `json:"-"`
 }
 
-func (o *OpenrouterProvider) GetModels() ([]Model, error) {
-	currentTime := time.Now().Format(time.RFC3339)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// Ping 请求一次上游的 /auth/key 接口，用于确认网络、OpenRouter 可用且 API 密钥有效。
+// 模型列表是公开接口，密钥无效时同样返回 200，不能用于这项检查
+func (o *OpenrouterProvider) Ping(ctx context.Context) error {
+	if err := checkAPIKey(ctx, o.keyURL, o.apiKey, o.transport); err != nil {
+		return fmt.Errorf("upstream unreachable: %w", err)
+	}
+	return nil
+}
 
-	modelsResponse, err := o.client.ListModels(ctx)
+// GetModels 从上游获取完整的模型列表，同时刷新模型 ID 缓存
+func (o *OpenrouterProvider) GetModels() ([]Model, error) {
+	ids, err := o.listModelIDs()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list models: %w", err)
+		return nil, err
 	}
+	o.modelsMu.Lock()
+	o.storeModelNames(ids)
+	o.modelsMu.Unlock()
 
-	o.modelNames = []string{}
-
+	currentTime := time.Now().Format(time.RFC3339)
 	var models []Model
-	for _, apiModel := range modelsResponse.Models {
-		parts := strings.Split(apiModel.ID, "/")
+	for _, id := range ids {
+		parts := strings.Split(id, "/")
 		name := parts[len(parts)-1]
 
-		o.modelNames = append(o.modelNames, apiModel.ID)
-
 		model := Model{
+			ID:         id,
 			Name:       name,
 			Model:      name,
 			ModifiedAt: currentTime,
@@ -140,48 +525,236 @@ func (o *OpenrouterProvider) GetModels() ([]Model, error) {
 	return models, nil
 }
 
+// listModelIDs 请求上游模型列表，返回全部模型 ID
+func (o *OpenrouterProvider) listModelIDs() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	modelsResponse, err := o.client.ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	ids := make([]string, 0, len(modelsResponse.Models))
+	for _, apiModel := range modelsResponse.Models {
+		ids = append(ids, apiModel.ID)
+	}
+	return ids, nil
+}
+
+// storeModelNames 更新模型 ID 缓存，调用方需持有 modelsMu
+func (o *OpenrouterProvider) storeModelNames(ids []string) {
+	o.modelNames = ids
+	o.modelsFetchedAt = o.now()
+}
+
+// cachedModelNames 返回缓存的模型 ID，缓存为空或过期时先刷新。
+// 刷新期间持有锁，并发的冷启动请求只会触发一次上游调用；刷新失败但有旧缓存时沿用旧缓存
+func (o *OpenrouterProvider) cachedModelNames() ([]string, error) {
+	o.modelsMu.Lock()
+	defer o.modelsMu.Unlock()
+
+	fetched := !o.modelsFetchedAt.IsZero()
+	if fetched && o.now().Sub(o.modelsFetchedAt) < o.modelListTTL {
+		return o.modelNames, nil
+	}
+	ids, err := o.listModelIDs()
+	if err != nil {
+		if fetched {
+			slog.Warn("model list refresh failed, using cached list", "error", err)
+			return o.modelNames, nil
+		}
+		return nil, err
+	}
+	o.storeModelNames(ids)
+	return ids, nil
+}
+
+// cachedModelMetadata 返回缓存的模型元数据，缓存为空或过期时先刷新；刷新失败但有旧缓存时沿用旧缓存
+func (o *OpenrouterProvider) cachedModelMetadata() ([]orModel, error) {
+	o.modelsMu.Lock()
+	defer o.modelsMu.Unlock()
+
+	fetched := !o.modelMetaFetchedAt.IsZero()
+	if fetched && o.now().Sub(o.modelMetaFetchedAt) < o.modelListTTL {
+		return o.modelMeta, nil
+	}
+	result, err := fetchModelList(o.modelsURL, o.apiKey, o.transport)
+	if err != nil {
+		if fetched {
+			slog.Warn("model metadata refresh failed, using cached metadata", "error", err)
+			return o.modelMeta, nil
+		}
+		return nil, err
+	}
+	o.modelMeta = result.Data
+	o.modelMetaFetchedAt = o.now()
+	return o.modelMeta, nil
+}
+
+// RefreshModels 立即从上游重新获取模型 ID 列表，不论缓存是否过期；模型元数据在下次使用时重新获取
+func (o *OpenrouterProvider) RefreshModels() error {
+	ids, err := o.listModelIDs()
+	if err != nil {
+		return err
+	}
+	o.modelsMu.Lock()
+	o.storeModelNames(ids)
+	o.modelMetaFetchedAt = time.Time{}
+	o.modelsMu.Unlock()
+	return nil
+}
+
+// errModelNotFound 表示模型不在 OpenRouter 的模型列表中
+var errModelNotFound = errors.New("model not found")
+
+// GetModelDetails 按与聊天请求相同的规则（别名、显示名、后缀、忽略大小写）解析模型名，
+// 从缓存的 OpenRouter 模型元数据中返回 /api/show 格式的真实元数据：上下文长度、支持的参数和价格。
+// 找不到时返回 errModelNotFound，名称有歧义时返回 errAmbiguousModel
 func (o *OpenrouterProvider) GetModelDetails(modelName string) (map[string]interface{}, error) {
-	currentTime := time.Now().Format(time.RFC3339)
+	fullName, err := o.GetFullModelName(modelName)
+	if err != nil {
+		return nil, err
+	}
+	models, err := o.cachedModelMetadata()
+	if err != nil {
+		return nil, wrapUpstreamError("failed to list models", err)
+	}
+	m, ok := findModel(models, fullName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errModelNotFound, modelName)
+	}
+
+	info := toModelInfo(m)
+	family := strings.SplitN(m.ID, "/", 2)[0]
+	capabilities := []string{"completion"}
+	if info.SupportsTools {
+		capabilities = append(capabilities, "tools")
+	}
+	supported := m.SupportedParameters
+	if supported == nil {
+		supported = []string{}
+	}
+
 	return map[string]interface{}{
-		"license":    "STUB License",
-		"system":     "STUB SYSTEM",
-		"modifiedAt": currentTime,
+		"license":      "",
+		"modelfile":    "",
+		"parameters":   "",
+		"template":     "",
+		"modified_at":  time.Now().Format(time.RFC3339),
+		"capabilities": capabilities,
 		"details": map[string]interface{}{
-			"format":             "gguf",
-			"parameter_size":     "200B",
-			"quantization_level": "Q4_K_M",
+			"parent_model":       "",
+			"format":             "",
+			"family":             family,
+			"families":           []string{family},
+			"parameter_size":     "",
+			"quantization_level": "",
 		},
 		"model_info": map[string]interface{}{
-			"architecture":    "STUB",
-			"context_length":  200000,
-			"parameter_count": 200_000_000_000,
+			"general.architecture": family,
+			"context_length":       info.ContextLength,
+			"supported_parameters": supported,
+			"pricing": map[string]string{
+				"prompt":     info.PromptPrice,
+				"completion": info.CompletionPrice,
+			},
 		},
 	}, nil
 }
 
-func (o *OpenrouterProvider) GetFullModelName(alias string) (string, error) {
-	if len(o.modelNames) == 0 {
-		_, err := o.GetModels()
-		if err != nil {
-			return "", fmt.Errorf("failed to get models: %w", err)
+// findModel 按完整 ID 查找模型元数据
+func findModel(models []orModel, id string) (orModel, bool) {
+	for _, m := range models {
+		if m.ID == id {
+			return m, true
 		}
 	}
+	return orModel{}, false
+}
 
-	for _, fullName := range o.modelNames {
+// errAmbiguousModel 表示请求的模型名匹配到多个完整 ID
+var errAmbiguousModel = errors.New("ambiguous model name")
+
+// GetFullModelName 把模型名解析为完整 ID，按以下顺序匹配：完整 ID、显示名（ID 最后一段）、
+// ID 后缀。显示名或后缀匹配到多个模型时返回列出候选项的 errAmbiguousModel；
+// 都不匹配时原样返回，由上游判断模型是否存在。开启忽略大小写时，大小写完全一致的完整 ID 优先
+func (o *OpenrouterProvider) GetFullModelName(alias string) (string, error) {
+	if target, ok := lookupAlias(o.aliases, alias); ok {
+		alias = target
+	}
+	modelNames, err := o.cachedModelNames()
+	if err != nil {
+		return "", fmt.Errorf("failed to get models: %w", err)
+	}
+
+	for _, fullName := range modelNames {
 		if fullName == alias {
 			return fullName, nil
 		}
 	}
+	if o.ignoreCase {
+		for _, fullName := range modelNames {
+			if strings.EqualFold(fullName, alias) {
+				return fullName, nil
+			}
+		}
+	}
 
-	for _, fullName := range o.modelNames {
-		if strings.HasSuffix(fullName, alias) {
-			return fullName, nil
+	var byName, bySuffix []string
+	for _, fullName := range modelNames {
+		parts := strings.Split(fullName, "/")
+		if sameModelName(parts[len(parts)-1], alias, o.ignoreCase) {
+			byName = append(byName, fullName)
+		}
+		if hasModelSuffix(fullName, alias, o.ignoreCase) {
+			bySuffix = append(bySuffix, fullName)
+		}
+	}
+	for _, candidates := range [][]string{byName, bySuffix} {
+		switch len(candidates) {
+		case 0:
+			continue
+		case 1:
+			return candidates[0], nil
+		default:
+			sort.Strings(candidates)
+			return "", fmt.Errorf("%w %q, candidates: %s", errAmbiguousModel, alias, strings.Join(candidates, ", "))
 		}
 	}
 
 	return alias, nil
 }
 
+// sameModelName 比较两个模型名，ignoreCase 时忽略大小写
+func sameModelName(a, b string, ignoreCase bool) bool {
+	if ignoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// hasModelSuffix 判断模型 ID 是否以 suffix 结尾，ignoreCase 时忽略大小写
+func hasModelSuffix(id, suffix string, ignoreCase bool) bool {
+	if ignoreCase {
+		return strings.HasSuffix(strings.ToLower(id), strings.ToLower(suffix))
+	}
+	return strings.HasSuffix(id, suffix)
+}
+
+// hasModel 判断 OpenRouter 模型列表中是否有完整 ID 为 id 的模型
+func (o *OpenrouterProvider) hasModel(id string) bool {
+	modelNames, err := o.cachedModelNames()
+	if err != nil {
+		return false
+	}
+	for _, fullName := range modelNames {
+		if sameModelName(fullName, id, o.ignoreCase) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetEmbeddings 获取文本的嵌入向量
 func (o *OpenrouterProvider) GetEmbeddings(input string, model string) ([]float32, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -194,7 +767,7 @@ func (o *OpenrouterProvider) GetEmbeddings(input string, model string) ([]float3
 
 	resp, err := o.client.CreateEmbeddings(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("embeddings creation failed: %w", err)
+		return nil, wrapUpstreamError("embeddings creation failed", err)
 	}
 
 	if len(resp.Data) == 0 {
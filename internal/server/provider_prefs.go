@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ProviderPreferences 对应 OpenRouter 请求体中的 provider 对象，控制上游服务商的路由方式
+type ProviderPreferences struct {
+	// Order 为优先尝试的服务商名称（如 "Together"、"DeepInfra"）
+	Order []string `json:"order,omitempty"`
+	// AllowFallbacks 为 false 时不回退到 Order 以外的服务商，nil 表示沿用 OpenRouter 默认值
+	AllowFallbacks *bool `json:"allow_fallbacks,omitempty"`
+	// RequireParameters 为 true 时只路由到支持请求中全部参数的服务商
+	RequireParameters *bool `json:"require_parameters,omitempty"`
+	// DataCollection 为 "allow" 或 "deny"，deny 时排除会保存用户数据的服务商
+	DataCollection string `json:"data_collection,omitempty"`
+}
+
+// IsZero 判断是否未配置任何偏好
+func (p ProviderPreferences) IsZero() bool {
+	return len(p.Order) == 0 && p.AllowFallbacks == nil && p.RequireParameters == nil && p.DataCollection == ""
+}
+
+// Validate 检查 DataCollection 的取值
+func (p ProviderPreferences) Validate() error {
+	switch p.DataCollection {
+	case "", "allow", "deny":
+		return nil
+	default:
+		return fmt.Errorf("provider.data_collection must be allow or deny, got %q", p.DataCollection)
+	}
+}
+
+// setProviderPreferences 在聊天请求体中写入 provider 对象
+func (p ProviderPreferences) setProviderPreferences(payload map[string]json.RawMessage) {
+	prefs, _ := json.Marshal(p)
+	payload["provider"] = prefs
+}
+
+// chatBodyTransport 在发往 chat/completions 和 completions 的请求体被发送前以 JSON 对象的形式改写它。
+// go-openai 的 ChatCompletionRequest 无法携带 provider 等额外字段，也无法删除已有字段，
+// 因此在 HTTP 层处理；请求体不是 JSON 对象时原样发送
+type chatBodyTransport struct {
+	base    http.RoundTripper
+	rewrite func(payload map[string]json.RawMessage)
+}
+
+func (t *chatBodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/completions") || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err == nil {
+		t.rewrite(payload)
+		if rewritten, err := json.Marshal(payload); err == nil {
+			body = rewritten
+		}
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProviderPreferencesInjected(t *testing.T) {
+	allow := false
+	prefs := ProviderPreferences{
+		Order:          []string{"Together", "DeepInfra"},
+		AllowFallbacks: &allow,
+		DataCollection: "deny",
+	}
+	want := map[string]interface{}{
+		"order":           []interface{}{"Together", "DeepInfra"},
+		"allow_fallbacks": false,
+		"data_collection": "deny",
+	}
+
+	tests := []struct {
+		name     string
+		freeMode bool
+		path     string
+		stream   bool
+	}{
+		{"normal non-stream", false, "/v1/chat/completions", false},
+		{"normal stream", false, "/api/chat", true},
+		{"free mode", true, "/api/chat", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a:free"})
+			s := newTestServer(t, Config{FreeMode: tt.freeMode, ProviderPreferences: prefs}, upstream, "org/model-a:free")
+
+			body := fmt.Sprintf(`{"model":"model-a:free","stream":%v,"messages":[{"role":"user","content":"hi"}]}`, tt.stream)
+			w := doJSON(t, s.buildRouter(), http.MethodPost, tt.path, body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			got := upstream.lastRequest(t)
+			if !reflect.DeepEqual(got["provider"], want) {
+				t.Errorf("provider = %v, want %v", got["provider"], want)
+			}
+			if got["model"] != "org/model-a:free" {
+				t.Errorf("model = %v, request body was rewritten incorrectly", got["model"])
+			}
+		})
+	}
+}
+
+func TestProviderPreferencesOmittedByDefault(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+
+	body := `{"model":"model-a","messages":[{"role":"user","content":"hi"}]}`
+	if w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if _, ok := upstream.lastRequest(t)["provider"]; ok {
+		t.Error("provider block sent without configured preferences")
+	}
+}
+
+func TestProviderPreferencesValidate(t *testing.T) {
+	s := New(Config{ProviderPreferences: ProviderPreferences{DataCollection: "sometimes"}})
+	_, err := s.newProvider()
+	if err == nil || !strings.Contains(err.Error(), "data_collection") {
+		t.Errorf("newProvider() error = %v, want data_collection error", err)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// NewUpstreamTransport 返回发往 OpenRouter 的请求使用的 Transport。proxyURL 为空时使用
+// http.DefaultTransport（遵循 HTTPS_PROXY 等环境变量）；否则所有上游请求经 proxyURL 指定的
+// HTTP、HTTPS 或 SOCKS5 代理发出。proxyURL 无效时返回错误
+func NewUpstreamTransport(proxyURL string) (http.RoundTripper, error) {
+	if proxyURL == "" {
+		return http.DefaultTransport, nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream proxy URL %q: %w", proxyURL, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid upstream proxy URL %q: scheme must be http, https, socks5 or socks5h", proxyURL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream proxy URL %q: missing host", proxyURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(u)
+	return transport, nil
+}
+
+// upstreamClient 返回使用上游 Transport 的 http.Client，供直接请求 OpenRouter 模型列表的处理函数使用
+func (s *Server) upstreamClient() *http.Client {
+	return &http.Client{Transport: s.transport}
+}
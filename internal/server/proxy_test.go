@@ -0,0 +1,102 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// proxyStub 是转发 HTTP 代理请求的本地代理，记录经过它的请求路径
+type proxyStub struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	paths []string
+}
+
+func newProxyStub(t *testing.T) *proxyStub {
+	t.Helper()
+
+	p := &proxyStub{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.paths = append(p.paths, r.URL.Path)
+		p.mu.Unlock()
+
+		// 代理请求的 URL 为绝对地址，原样转发给目标服务器
+		out := r.Clone(r.Context())
+		out.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(out)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *proxyStub) seen(path string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, seen := range p.paths {
+		if seen == path {
+			return true
+		}
+	}
+	return false
+}
+
+func TestUpstreamRequestsGoThroughProxy(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a:free"})
+	proxy := newProxyStub(t)
+	s := newTestServer(t, Config{UpstreamProxyURL: proxy.URL}, upstream)
+	r := s.buildRouter()
+
+	w := doJSON(t, r, http.MethodPost, "/api/chat",
+		`{"model":"model-a:free","stream":false,"messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if !proxy.seen("/chat/completions") {
+		t.Errorf("chat request did not go through the proxy: %v", proxy.paths)
+	}
+
+	proxy.mu.Lock()
+	proxy.paths = nil
+	proxy.mu.Unlock()
+	models, err := FetchFreeModels(s.modelsURL(), s.config.APIKey, s.transport)
+	if err != nil || len(models) != 1 {
+		t.Fatalf("FetchFreeModels() = %v, %v", models, err)
+	}
+	if !proxy.seen("/models") {
+		t.Errorf("model list request did not go through the proxy: %v", proxy.paths)
+	}
+}
+
+func TestInvalidUpstreamProxyRejected(t *testing.T) {
+	for _, proxyURL := range []string{"://bad", "ftp://proxy:21", "http://", "localhost:8080"} {
+		if _, err := NewUpstreamTransport(proxyURL); err == nil {
+			t.Errorf("NewUpstreamTransport(%q) should fail", proxyURL)
+		}
+	}
+	for _, proxyURL := range []string{"", "http://proxy:3128", "socks5://127.0.0.1:1080"} {
+		if _, err := NewUpstreamTransport(proxyURL); err != nil {
+			t.Errorf("NewUpstreamTransport(%q) error = %v", proxyURL, err)
+		}
+	}
+
+	s := New(Config{UpstreamProxyURL: "ftp://proxy:21"})
+	if _, err := s.newProvider(); err == nil || !strings.Contains(err.Error(), "proxy") {
+		t.Errorf("newProvider() error = %v, want invalid proxy error", err)
+	}
+}
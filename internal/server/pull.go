@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pullLayerSize 是拉取进度中报告的层大小，与 /api/tags 中免费模型的 size 一致
+const pullLayerSize = 270898672
+
+// PullProgress 是 /api/pull 流式响应中的一帧，字段与 Ollama 的拉取进度一致
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+}
+
+// pullFrames 返回拉取 model 时依次输出的进度帧。模型托管在 OpenRouter，无需下载，
+// 直接报告已完成的进度，使依赖拉取成功的客户端可以继续
+func pullFrames(model string) []PullProgress {
+	sum := sha256.Sum256([]byte(model))
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	return []PullProgress{
+		{Status: "pulling manifest"},
+		{Status: "pulling " + hex.EncodeToString(sum[:6]), Digest: digest, Total: pullLayerSize, Completed: pullLayerSize},
+		{Status: "verifying sha256 digest"},
+		{Status: "writing manifest"},
+		{Status: "success"},
+	}
+}
+
+// pullableModel 在当前可用的模型中查找 name（显示名或完整 ID），返回完整模型 ID。
+// 免费模式下查找免费模型列表，否则查询 OpenRouter 模型列表；两种情况下都遵循模型过滤器
+func (s *Server) pullableModel(name string) (string, bool, error) {
+	if s.config.FreeMode {
+		for _, m := range s.freeModelList() {
+			parts := strings.Split(m, "/")
+			displayName := parts[len(parts)-1]
+			if (m == name || displayName == name) && s.isModelInFilter(displayName) {
+				return m, true, nil
+			}
+		}
+		return "", false, nil
+	}
+
+	models, err := s.provider.GetModels()
+	if err != nil {
+		return "", false, err
+	}
+	for _, m := range models {
+		if (m.ID == name || m.Name == name) && s.isModelInFilter(m.Name) {
+			return m.ID, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// handlePullModel 处理 /api/pull 请求：模型可用时返回成功的拉取进度（stream 为 false 时只返回最终状态），
+// 模型不存在时返回 404 和错误信息
+func (s *Server) handlePullModel(c *gin.Context) {
+	var req PullModelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	model, ok, err := s.pullableModel(req.Name)
+	if err != nil {
+		writeError(c, http.StatusBadGateway, err)
+		return
+	}
+	if !ok {
+		writeError(c, http.StatusNotFound, fmt.Errorf("pull model manifest: model %q not found", req.Name))
+		return
+	}
+
+	frames := pullFrames(model)
+	if req.Stream != nil && !*req.Stream {
+		c.JSON(http.StatusOK, frames[len(frames)-1])
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	for _, frame := range frames {
+		line, _ := json.Marshal(frame)
+		fmt.Fprintf(c.Writer, "%s\n", line)
+		c.Writer.Flush()
+	}
+}
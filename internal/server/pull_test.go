@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPullModelProgress(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true}, upstream, "org/model-a:free")
+	r := s.buildRouter()
+
+	w := doJSON(t, r, http.MethodPost, "/api/pull", `{"name":"model-a:free"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var statuses []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var frame PullProgress
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			t.Fatalf("invalid frame %q: %v", scanner.Text(), err)
+		}
+		if strings.HasPrefix(frame.Status, "pulling ") && frame.Status != "pulling manifest" {
+			if !strings.HasPrefix(frame.Digest, "sha256:") || frame.Total == 0 || frame.Completed != frame.Total {
+				t.Errorf("layer frame = %+v, want a completed sha256 layer", frame)
+			}
+			frame.Status = "pulling <layer>"
+		}
+		statuses = append(statuses, frame.Status)
+	}
+	want := []string{"pulling manifest", "pulling <layer>", "verifying sha256 digest", "writing manifest", "success"}
+	if strings.Join(statuses, "|") != strings.Join(want, "|") {
+		t.Errorf("statuses = %q, want %q", statuses, want)
+	}
+
+	w = doJSON(t, r, http.MethodPost, "/api/pull", `{"name":"org/model-a:free","stream":false}`)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"status":"success"}` {
+		t.Errorf("non-stream pull = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPullUnknownModel(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	for _, free := range []bool{true, false} {
+		s := newTestServer(t, Config{FreeMode: free}, upstream, "org/model-a:free")
+		w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/pull", `{"name":"missing"}`)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("free=%v: status = %d, want 404", free, w.Code)
+		}
+		var body struct{ Error string }
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || !strings.Contains(body.Error, "missing") {
+			t.Errorf("free=%v: error frame = %s", free, w.Body.String())
+		}
+	}
+
+	s := newTestServer(t, Config{}, upstream)
+	if w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/pull", `{"name":"model-a","stream":false}`); w.Code != http.StatusOK {
+		t.Errorf("paid-mode pull of listed model: status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
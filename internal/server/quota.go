@@ -0,0 +1,277 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 配额窗口的重置方式
+const (
+	// QuotaResetCalendar 在每天本地时间零点重置配额，为默认方式
+	QuotaResetCalendar = "calendar"
+	// QuotaResetRolling 的配额窗口从窗口内第一个请求开始，持续 24 小时
+	QuotaResetRolling = "rolling"
+)
+
+// quotaWindow 是滚动配额窗口的长度
+const quotaWindow = 24 * time.Hour
+
+var quotaRejectionsTotal = newCounterVec(
+	"ollama_router_quota_rejections_total",
+	"Requests rejected by client quotas, by exhausted limit (requests, tokens).",
+	"limit",
+)
+
+// QuotaRule 是客户端的每日用量配额。Client 为通过 ProxyAuthToken 校验的 Bearer 令牌或来源 IP，
+// "*" 匹配没有单独配置的所有客户端（各自独立计数）；MaxRequests、MaxTokens 为 0 表示不限制
+type QuotaRule struct {
+	Client      string `mapstructure:"client"`
+	MaxRequests int    `mapstructure:"max_requests"`
+	MaxTokens   int    `mapstructure:"max_tokens"`
+}
+
+// validateQuotaReset 检查 quotas.reset 的取值
+func validateQuotaReset(reset string) error {
+	switch reset {
+	case "", QuotaResetCalendar, QuotaResetRolling:
+		return nil
+	default:
+		return fmt.Errorf("quotas.reset must be %s or %s, got %q", QuotaResetCalendar, QuotaResetRolling, reset)
+	}
+}
+
+// quotaTracker 按客户端统计每日请求数和 token 数，用量保存在 failures.db 中，重启后仍然有效
+type quotaTracker struct {
+	rules   []QuotaRule
+	rolling bool
+	store   *FailureStore
+	now     func() time.Time
+}
+
+// newQuotaTracker 创建配额跟踪器，没有配置规则时返回 nil 表示不限制。store 在 Start 时设置
+func newQuotaTracker(rules []QuotaRule, reset string) *quotaTracker {
+	if len(rules) == 0 {
+		return nil
+	}
+	return &quotaTracker{rules: rules, rolling: reset == QuotaResetRolling, now: time.Now}
+}
+
+// rule 返回适用于客户端的配额规则：先按经过校验的 Bearer 令牌、再按来源 IP 精确匹配，最后使用 "*"。
+// token 为空表示请求没有携带有效令牌
+func (q *quotaTracker) rule(token, ip string) (QuotaRule, bool) {
+	var fallback *QuotaRule
+	for i, r := range q.rules {
+		switch {
+		case token != "" && r.Client == token, r.Client == ip:
+			return r, true
+		case r.Client == "*" && fallback == nil:
+			fallback = &q.rules[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return QuotaRule{}, false
+}
+
+// window 返回 now 所在配额窗口的开始和重置时间。日历方式以本地零点为界；
+// 滚动方式沿用 usage 中未过期的窗口，否则从 now 开始新窗口
+func (q *quotaTracker) window(usage ClientUsage, now time.Time) (start, reset time.Time) {
+	if q.rolling {
+		if !usage.WindowStart.IsZero() && now.Before(usage.WindowStart.Add(quotaWindow)) {
+			return usage.WindowStart, usage.WindowStart.Add(quotaWindow)
+		}
+		start = now.Truncate(time.Second)
+		return start, start.Add(quotaWindow)
+	}
+	start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
+// keepSince 返回 now 时仍然有效的窗口最早的开始时间，更早开始的窗口已经过期
+func (q *quotaTracker) keepSince(now time.Time) time.Time {
+	if q.rolling {
+		return now.Add(-quotaWindow).Truncate(time.Second).Add(time.Second)
+	}
+	start, _ := q.window(ClientUsage{}, now)
+	return start
+}
+
+// exceeded 返回窗口内已用尽的配额（requests 或 tokens），都未用尽时返回空字符串
+func (r QuotaRule) exceeded(usage ClientUsage) string {
+	switch {
+	case r.MaxRequests > 0 && usage.Requests >= r.MaxRequests:
+		return "requests"
+	case r.MaxTokens > 0 && usage.Tokens >= r.MaxTokens:
+		return "tokens"
+	}
+	return ""
+}
+
+// quotaMiddleware 在配置了 Quotas 时按客户端限制每日的聊天、生成和嵌入请求数及 token 数。
+// 配额规则按令牌或来源 IP 匹配，用量按 clientKey 计数，共用同一令牌的客户端各自拥有一份配额。
+// 请求数在处理前由存储原子地检查并计入，token 数在响应结束后按响应中的用量计入；
+// 已达到配额时返回 429，Retry-After 为距离重置的秒数，X-Quota-Reset 为重置时间。
+// 用量存储出错时放行请求，不因配额统计故障影响服务
+func (s *Server) quotaMiddleware(c *gin.Context) {
+	if s.quotas == nil || s.quotas.store == nil {
+		c.Next()
+		return
+	}
+	rule, ok := s.quotas.rule(s.validatedToken(c), c.ClientIP())
+	if !ok {
+		c.Next()
+		return
+	}
+
+	key := s.clientKey(c)
+	now := s.quotas.now()
+	newStart, _ := s.quotas.window(ClientUsage{}, now)
+	usage, ok, err := s.quotas.store.ReserveClientRequest(key, newStart, s.quotas.keepSince(now), rule.MaxRequests, rule.MaxTokens)
+	if err != nil {
+		slog.Error("failed to record client usage", "client", key, "error", err)
+		c.Next()
+		return
+	}
+	start, reset := s.quotas.window(usage, now)
+	if !ok {
+		quotaRejectionsTotal.inc(rule.exceeded(usage))
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(reset.Sub(now).Seconds()))))
+		c.Header("X-Quota-Reset", reset.UTC().Format(time.RFC3339))
+		writeError(c, http.StatusTooManyRequests, fmt.Errorf("daily quota exceeded, resets at %s", reset.UTC().Format(time.RFC3339)))
+		c.Abort()
+		return
+	}
+
+	writer := &usageWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+
+	tokens := writer.tokens(c.Request.ContentLength)
+	if tokens > 0 {
+		if err := s.quotas.store.AddClientUsage(key, start, 0, tokens); err != nil {
+			slog.Error("failed to record client usage", "client", key, "error", err)
+		}
+	}
+}
+
+// initQuotaStore 为配额统计准备 failures.db：免费模式下与失败记录共用，否则单独打开
+func (s *Server) initQuotaStore() error {
+	if s.quotas == nil {
+		return nil
+	}
+	if s.failureStore != nil {
+		s.quotas.store = s.failureStore
+		return nil
+	}
+	store, err := NewFailureStore(filepath.Join(s.config.ConfigDir, FailureDBName))
+	if err != nil {
+		return fmt.Errorf("failed to init quota store: %w", err)
+	}
+	s.quotas.store = store
+	return nil
+}
+
+// usageWriter 在写出响应的同时提取其中的 token 用量：Ollama 格式的 prompt_eval_count 与
+// eval_count 之和，或 OpenAI 格式的 usage.total_tokens，流式响应取最后一个带用量的帧。
+// 同时累计输出文本的字符数，供响应没有用量时估算
+type usageWriter struct {
+	gin.ResponseWriter
+	pending     []byte
+	reported    int
+	outputChars int
+}
+
+func (w *usageWriter) Write(b []byte) (int, error) {
+	w.scan(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *usageWriter) WriteString(s string) (int, error) {
+	w.scan([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// scan 按行解析写出的数据，不完整的行留到下次写入或 tokens 时处理
+func (w *usageWriter) scan(b []byte) {
+	w.pending = append(w.pending, b...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			return
+		}
+		w.parse(w.pending[:i])
+		w.pending = w.pending[i+1:]
+	}
+}
+
+// usageFrame 是响应帧中与用量有关的字段
+type usageFrame struct {
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+	Usage           *struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+	Message *struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Response string `json:"response"`
+	Choices  []struct {
+		Text    string `json:"text"`
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// parse 解析一行 JSON 或 SSE data 行
+func (w *usageWriter) parse(line []byte) {
+	line = bytes.TrimPrefix(bytes.TrimSpace(line), []byte("data: "))
+	if len(line) == 0 || line[0] != '{' {
+		return
+	}
+	var frame usageFrame
+	if json.Unmarshal(line, &frame) != nil {
+		return
+	}
+	if frame.Usage != nil && frame.Usage.TotalTokens > 0 {
+		w.reported = frame.Usage.TotalTokens
+	} else if n := frame.PromptEvalCount + frame.EvalCount; n > 0 {
+		w.reported = n
+	}
+
+	if frame.Message != nil {
+		w.outputChars += utf8.RuneCountInString(frame.Message.Content)
+	}
+	w.outputChars += utf8.RuneCountInString(frame.Response)
+	for _, choice := range frame.Choices {
+		w.outputChars += utf8.RuneCountInString(choice.Text + choice.Message.Content + choice.Delta.Content)
+	}
+}
+
+// tokens 返回响应中的 token 用量。响应没有用量时（如未请求 include_usage 的 OpenAI 流），
+// 按请求体大小和输出字符数粗略估算
+func (w *usageWriter) tokens(requestBytes int64) int {
+	w.parse(w.pending)
+	w.pending = nil
+	if w.reported > 0 {
+		return w.reported
+	}
+	if w.outputChars == 0 {
+		return 0
+	}
+	return int(max(requestBytes, 0)+int64(w.outputChars)+charsPerToken-1) / charsPerToken
+}
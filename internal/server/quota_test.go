@@ -0,0 +1,198 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newQuotaTestServer 创建配置了配额的测试服务器，配额时钟固定为返回的 *time.Time。
+// 测试请求来自可信代理，客户端 IP 取自 X-Forwarded-For
+func newQuotaTestServer(t *testing.T, cfg Config) (*Server, *time.Time) {
+	t.Helper()
+	cfg.TrustedProxies = []string{"192.0.2.0/24"}
+	s := newTestServer(t, cfg, newFakeUpstream(t, fakeModel{ID: "org/model-a"}))
+	if err := s.initQuotaStore(); err != nil {
+		t.Fatalf("initQuotaStore() error = %v", err)
+	}
+	t.Cleanup(func() { s.quotas.store.Close() })
+
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.Local)
+	s.quotas.now = func() time.Time { return now }
+	return s, &now
+}
+
+// quotaChat 以 clientIP 的身份发送一次聊天请求，返回状态码
+func quotaChat(t *testing.T, s *Server, clientIP string) int {
+	t.Helper()
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+		`{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`,
+		"X-Forwarded-For", clientIP)
+	if w.Code == http.StatusTooManyRequests {
+		if w.Header().Get("Retry-After") == "" || w.Header().Get("X-Quota-Reset") == "" {
+			t.Errorf("429 without reset headers: %v", w.Header())
+		}
+		if !strings.Contains(w.Body.String(), "daily quota exceeded") {
+			t.Errorf("429 body = %s", w.Body.String())
+		}
+	}
+	return w.Code
+}
+
+func TestQuotaBlocksUntilCalendarReset(t *testing.T) {
+	s, now := newQuotaTestServer(t, Config{Quotas: []QuotaRule{
+		{Client: "*", MaxRequests: 2},
+		{Client: "203.0.113.9", MaxRequests: 100},
+	}})
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := quotaChat(t, s, "203.0.113.1"); got != want {
+			t.Fatalf("request %d status = %d, want %d", i+1, got, want)
+		}
+	}
+	// 其他客户端各自计数，单独配置的客户端使用自己的配额
+	if got := quotaChat(t, s, "203.0.113.2"); got != http.StatusOK {
+		t.Errorf("other client status = %d, want 200", got)
+	}
+	if got := quotaChat(t, s, "203.0.113.9"); got != http.StatusOK {
+		t.Errorf("configured client status = %d, want 200", got)
+	}
+
+	*now = now.Add(8 * time.Hour) // 23:00，仍在同一天
+	if got := quotaChat(t, s, "203.0.113.1"); got != http.StatusTooManyRequests {
+		t.Errorf("same day status = %d, want 429", got)
+	}
+	*now = now.Add(time.Hour) // 次日零点
+	if got := quotaChat(t, s, "203.0.113.1"); got != http.StatusOK {
+		t.Errorf("after reset status = %d, want 200", got)
+	}
+}
+
+func TestQuotaTokensRollingWindow(t *testing.T) {
+	// 假上游每次返回 total_tokens = 5
+	s, now := newQuotaTestServer(t, Config{QuotaReset: QuotaResetRolling, Quotas: []QuotaRule{{Client: "*", MaxTokens: 10}}})
+	start := *now
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := quotaChat(t, s, "203.0.113.1"); got != want {
+			t.Fatalf("request %d status = %d, want %d", i+1, got, want)
+		}
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+	c.Request.Header.Set("X-Forwarded-For", "203.0.113.1")
+	usage, err := s.quotas.store.ClientUsage(s.clientKey(c))
+	if err != nil || usage.Tokens != 10 || usage.Requests != 2 {
+		t.Errorf("usage = %+v, %v; want 2 requests and 10 tokens", usage, err)
+	}
+
+	*now = start.Add(quotaWindow - time.Second)
+	if got := quotaChat(t, s, "203.0.113.1"); got != http.StatusTooManyRequests {
+		t.Errorf("inside window status = %d, want 429", got)
+	}
+	*now = start.Add(quotaWindow)
+	if got := quotaChat(t, s, "203.0.113.1"); got != http.StatusOK {
+		t.Errorf("after window status = %d, want 200", got)
+	}
+}
+
+func TestUsageWriterEstimatesWithoutReportedUsage(t *testing.T) {
+	w := &usageWriter{}
+	w.parse([]byte(`data: {"choices":[{"delta":{"content":"abcdefgh"}}]}`))
+	if got := w.tokens(8); got != 4 {
+		t.Errorf("tokens() = %d, want 4", got)
+	}
+
+	w = &usageWriter{}
+	w.parse([]byte(`{"message":{"content":"hello"},"done":true,"prompt_eval_count":7,"eval_count":3}`))
+	if got := w.tokens(100); got != 10 {
+		t.Errorf("tokens() = %d, want the reported 10", got)
+	}
+}
+
+func TestQuotaReservationIsAtomic(t *testing.T) {
+	s, now := newQuotaTestServer(t, Config{Quotas: []QuotaRule{{Client: "*", MaxRequests: 5}}})
+	start, _ := s.quotas.window(ClientUsage{}, *now)
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := s.quotas.store.ReserveClientRequest("ip:203.0.113.1", start, s.quotas.keepSince(*now), 5, 0)
+			if err != nil {
+				t.Errorf("ReserveClientRequest() error = %v", err)
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := allowed.Load(); got != 5 {
+		t.Errorf("allowed = %d, want 5", got)
+	}
+}
+
+func TestQuotaIgnoresUnvalidatedToken(t *testing.T) {
+	s, _ := newQuotaTestServer(t, Config{Quotas: []QuotaRule{
+		{Client: "*", MaxRequests: 1},
+		{Client: "vip", MaxRequests: 100},
+	}})
+
+	// 未配置 ProxyAuthToken 时，伪造的令牌不能匹配为其配置的配额
+	chat := func() int {
+		return doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+			`{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`,
+			"X-Forwarded-For", "203.0.113.1", "Authorization", "Bearer vip").Code
+	}
+	if got := chat(); got != http.StatusOK {
+		t.Fatalf("first request status = %d, want 200", got)
+	}
+	if got := chat(); got != http.StatusTooManyRequests {
+		t.Errorf("forged token status = %d, want 429", got)
+	}
+}
+
+func TestQuotaMatchesValidatedToken(t *testing.T) {
+	s, _ := newQuotaTestServer(t, Config{ProxyAuthToken: "vip", Quotas: []QuotaRule{
+		{Client: "*", MaxRequests: 1},
+		{Client: "vip", MaxRequests: 100},
+	}})
+
+	for i := range 3 {
+		w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+			`{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`,
+			"X-Forwarded-For", "203.0.113.1", "Authorization", "Bearer vip")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i+1, w.Code)
+		}
+	}
+}
+
+func TestQuotaSeparatesClientsSharingToken(t *testing.T) {
+	s, _ := newQuotaTestServer(t, Config{ProxyAuthToken: "vip", Quotas: []QuotaRule{{Client: "vip", MaxRequests: 1}}})
+
+	chat := func(clientIP string) int {
+		return doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+			`{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`,
+			"X-Forwarded-For", clientIP, "Authorization", "Bearer vip").Code
+	}
+	if got := chat("203.0.113.1"); got != http.StatusOK {
+		t.Fatalf("first client status = %d, want 200", got)
+	}
+	if got := chat("203.0.113.1"); got != http.StatusTooManyRequests {
+		t.Fatalf("first client second request status = %d, want 429", got)
+	}
+	// 同一个令牌的另一个客户端有自己的配额
+	if got := chat("203.0.113.2"); got != http.StatusOK {
+		t.Errorf("second client with the same token status = %d, want 200", got)
+	}
+}
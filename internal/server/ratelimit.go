@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"log/slog"
 	"math"
 	"strings"
@@ -77,11 +78,16 @@ func (r *RateLimiter) RecordFailure(err error) {
 }
 
 func (r *RateLimiter) calculateBackoff() time.Duration {
-	multiplier := math.Pow(2, float64(r.failureCount-1))
-	backoff := time.Duration(float64(r.baseDelay) * multiplier)
+	return backoffDelay(r.baseDelay, r.maxDelay, r.failureCount)
+}
+
+// backoffDelay 计算第 attempt 次（从 1 开始）失败后的指数退避时间，上限为 maxDelay，并加入 ±12.5% 的抖动
+func backoffDelay(baseDelay, maxDelay time.Duration, attempt int) time.Duration {
+	multiplier := math.Pow(2, float64(attempt-1))
+	backoff := time.Duration(float64(baseDelay) * multiplier)
 
-	if backoff > r.maxDelay {
-		backoff = r.maxDelay
+	if backoff > maxDelay {
+		backoff = maxDelay
 	}
 
 	jitter := time.Duration(float64(backoff) * 0.25 * (0.5 - float64(time.Now().UnixNano()%100)/100))
@@ -131,17 +137,27 @@ func isPermanentError(err error) bool {
 	return false
 }
 
+const defaultMaxConcurrentPerModel = 2
+
 type GlobalRateLimiter struct {
-	mu         sync.RWMutex
-	limiters   map[string]*RateLimiter
-	globalWait time.Duration
-	lastGlobal time.Time
+	mu            sync.RWMutex
+	limiters      map[string]*RateLimiter
+	semaphores    map[string]*adaptiveLimiter
+	maxConcurrent int
+	globalWait    time.Duration
+	lastGlobal    time.Time
 }
 
-func NewGlobalRateLimiter() *GlobalRateLimiter {
+// NewGlobalRateLimiter 创建全局限流器，maxConcurrent 为每个模型允许的最大并发请求数（<= 0 时使用默认值）
+func NewGlobalRateLimiter(maxConcurrent int) *GlobalRateLimiter {
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultMaxConcurrentPerModel
+	}
 	return &GlobalRateLimiter{
-		limiters:   make(map[string]*RateLimiter),
-		globalWait: 50 * time.Millisecond,
+		limiters:      make(map[string]*RateLimiter),
+		semaphores:    make(map[string]*adaptiveLimiter),
+		maxConcurrent: maxConcurrent,
+		globalWait:    50 * time.Millisecond,
 	}
 }
 
@@ -169,3 +185,79 @@ func (g *GlobalRateLimiter) WaitGlobal() {
 	}
 	g.lastGlobal = time.Now()
 }
+
+// LastGlobal 返回最近一次通过全局限流的时间，尚无请求时返回零值
+func (g *GlobalRateLimiter) LastGlobal() time.Time {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.lastGlobal
+}
+
+func (g *GlobalRateLimiter) concurrency(model string) *adaptiveLimiter {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if limiter, exists := g.semaphores[model]; exists {
+		return limiter
+	}
+
+	limiter := newAdaptiveLimiter(g.maxConcurrent)
+	g.semaphores[model] = limiter
+	return limiter
+}
+
+// Acquire 占用指定模型的一个并发槽位，槽位用尽时阻塞等待，直到 ctx 被取消
+func (g *GlobalRateLimiter) Acquire(ctx context.Context, model string) error {
+	return g.concurrency(model).acquire(ctx)
+}
+
+// Release 释放指定模型的一个并发槽位
+func (g *GlobalRateLimiter) Release(model string) {
+	g.concurrency(model).release()
+}
+
+// RecordResult 根据请求结果调整模型的并发上限：速率限制时减半，成功时缓慢增加
+func (g *GlobalRateLimiter) RecordResult(model string, err error) {
+	limiter := g.concurrency(model)
+	switch {
+	case err == nil:
+		limiter.increase()
+	case isRateLimitError(err):
+		limiter.decrease()
+	}
+}
+
+// ConcurrencyLimit 返回模型当前的并发上限
+func (g *GlobalRateLimiter) ConcurrencyLimit(model string) int {
+	return g.concurrency(model).currentLimit()
+}
+
+// RateLimitState 是单个模型限流状态的快照
+type RateLimitState struct {
+	// BackoffUntil 为退避结束时间，快照时刻未处于退避时为 nil
+	BackoffUntil     *time.Time `json:"backoff_until,omitempty"`
+	FailureCount     int        `json:"failure_count"`
+	ConcurrencyLimit int        `json:"concurrency_limit"`
+}
+
+// Snapshot 返回所有已创建限流器的模型的限流状态
+func (g *GlobalRateLimiter) Snapshot() map[string]RateLimitState {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	now := time.Now()
+	states := make(map[string]RateLimitState, len(g.limiters))
+	for model, limiter := range g.limiters {
+		limiter.mu.RLock()
+		state := RateLimitState{FailureCount: limiter.failureCount}
+		if until := limiter.backoffUntil; now.Before(until) {
+			state.BackoffUntil = &until
+		}
+		limiter.mu.RUnlock()
+		if sem, ok := g.semaphores[model]; ok {
+			state.ConcurrencyLimit = sem.currentLimit()
+		}
+		states[model] = state
+	}
+	return states
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func peakConcurrency(t *testing.T, g *GlobalRateLimiter, workers int) int32 {
+	t.Helper()
+
+	var inFlight, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := g.Acquire(context.Background(), "test/model"); err != nil {
+				t.Errorf("Acquire() error = %v", err)
+				return
+			}
+			defer g.Release("test/model")
+
+			cur := inFlight.Add(1)
+			for {
+				old := peak.Load()
+				if cur <= old || peak.CompareAndSwap(old, cur) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			inFlight.Add(-1)
+		}()
+	}
+	wg.Wait()
+	return peak.Load()
+}
+
+func TestGlobalRateLimiterConcurrencyCap(t *testing.T) {
+	g := NewGlobalRateLimiter(3)
+	if got := peakConcurrency(t, g, 10); got != 3 {
+		t.Errorf("peak concurrency = %d, want 3", got)
+	}
+}
+
+func TestGlobalRateLimiterDefaultConcurrency(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		g := NewGlobalRateLimiter(n)
+		if got := peakConcurrency(t, g, 10); got != defaultMaxConcurrentPerModel {
+			t.Errorf("NewGlobalRateLimiter(%d): peak concurrency = %d, want %d", n, got, defaultMaxConcurrentPerModel)
+		}
+	}
+}
+
+func TestGlobalRateLimiterAcquireCancelled(t *testing.T) {
+	g := NewGlobalRateLimiter(1)
+	if err := g.Acquire(context.Background(), "test/model"); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer g.Release("test/model")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := g.Acquire(ctx, "test/model"); err == nil {
+		t.Fatal("Acquire() on a full semaphore with cancelled context should fail")
+	}
+}
+
+func TestGlobalRateLimiterSnapshot(t *testing.T) {
+	g := NewGlobalRateLimiter(4)
+	g.GetLimiter("org/limited").RecordFailure(errors.New("429 Too Many Requests"))
+	g.RecordResult("org/limited", errors.New("429 Too Many Requests"))
+	g.GetLimiter("org/flaky").RecordFailure(errors.New("500 internal error"))
+
+	snap := g.Snapshot()
+	limited, ok := snap["org/limited"]
+	if !ok {
+		t.Fatalf("snapshot = %+v, want org/limited", snap)
+	}
+	if limited.BackoffUntil == nil || !limited.BackoffUntil.After(time.Now()) {
+		t.Errorf("org/limited backoff_until = %v, want a future time", limited.BackoffUntil)
+	}
+	if limited.FailureCount != 1 || limited.ConcurrencyLimit != 2 {
+		t.Errorf("org/limited = %+v, want 1 failure and concurrency halved to 2", limited)
+	}
+
+	flaky := snap["org/flaky"]
+	if flaky.BackoffUntil != nil || flaky.FailureCount != 1 {
+		t.Errorf("org/flaky = %+v, want a failure without backoff", flaky)
+	}
+}
+
+func TestAdminRateLimitsEndpoint(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{AdminEnabled: true}, upstream)
+	s.globalLimiter.GetLimiter("org/limited").RecordFailure(errors.New("rate limit exceeded"))
+
+	w := doJSON(t, s.buildRouter(), http.MethodGet, "/api/admin/ratelimits", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Models map[string]RateLimitState `json:"models"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if state := body.Models["org/limited"]; state.BackoffUntil == nil || state.FailureCount != 1 {
+		t.Errorf("org/limited = %+v, body = %s", state, w.Body.String())
+	}
+}
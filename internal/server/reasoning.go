@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ChatResponse 是上游的非流式聊天响应。go-openai 的消息结构没有 reasoning 字段，
+// 开启 WithReasoning 时 Reasoning[i] 为 choices[i].message.reasoning，由原始响应体单独解码
+type ChatResponse struct {
+	openai.ChatCompletionResponse
+	Reasoning []string `json:"-"`
+}
+
+// ChatChunk 是上游流式响应的一个分块，开启 WithReasoning 时 Reasoning[i] 为 choices[i].delta.reasoning
+type ChatChunk struct {
+	openai.ChatCompletionStreamResponse
+	Reasoning []string `json:"-"`
+}
+
+// reasoningAt 返回第 i 个 choice 的推理内容，没有时返回空串
+func reasoningAt(reasoning []string, i int) string {
+	if i < 0 || i >= len(reasoning) {
+		return ""
+	}
+	return reasoning[i]
+}
+
+// reasoningPayload 是响应体和流式分块中与推理内容有关的字段
+type reasoningPayload struct {
+	Choices []struct {
+		Message struct {
+			Reasoning string `json:"reasoning"`
+		} `json:"message"`
+		Delta struct {
+			Reasoning string `json:"reasoning"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// decodeReasoning 解码 payload 中各 choice 的 message.reasoning 或 delta.reasoning，
+// 按 choices 的顺序返回；没有推理内容或无法解析时返回 nil
+func decodeReasoning(payload []byte) []string {
+	if !bytes.Contains(payload, []byte(`"reasoning"`)) {
+		return nil
+	}
+	var body reasoningPayload
+	if json.Unmarshal(payload, &body) != nil {
+		return nil
+	}
+	reasoning := make([]string, len(body.Choices))
+	found := false
+	for i, choice := range body.Choices {
+		reasoning[i] = choice.Message.Reasoning + choice.Delta.Reasoning
+		found = found || reasoning[i] != ""
+	}
+	if !found {
+		return nil
+	}
+	return reasoning
+}
+
+// upstreamStream 把 go-openai 的流包装为 ChatStream：按原始数据行解码分块，
+// 开启推理内容时同时解码 delta.reasoning
+type upstreamStream struct {
+	stream    *openai.ChatCompletionStream
+	reasoning bool
+}
+
+func (s *upstreamStream) Recv() (ChatChunk, error) {
+	raw, err := s.stream.RecvRaw()
+	if err != nil {
+		return ChatChunk{}, err
+	}
+	var chunk ChatChunk
+	if err := json.Unmarshal(raw, &chunk.ChatCompletionStreamResponse); err != nil {
+		return ChatChunk{}, err
+	}
+	if s.reasoning {
+		chunk.Reasoning = decodeReasoning(raw)
+	}
+	return chunk, nil
+}
+
+func (s *upstreamStream) Close() error {
+	return s.stream.Close()
+}
+
+// bodyRecorderKey 是请求 context 中 *bodyRecorder 的键
+type bodyRecorderKey struct{}
+
+// bodyRecorder 保存非流式聊天响应的原始响应体，供解码 go-openai 丢弃的 reasoning 字段
+type bodyRecorder struct {
+	body []byte
+}
+
+// withBodyRecorder 返回携带 rec 的 context，经 reasoningTransport 发出的请求会把响应体记录到 rec
+func withBodyRecorder(ctx context.Context, rec *bodyRecorder) context.Context {
+	return context.WithValue(ctx, bodyRecorderKey{}, rec)
+}
+
+// reasoningTransport 在请求 context 带有 bodyRecorder 时，记录成功的非流式 chat/completions 响应体
+type reasoningTransport struct {
+	base http.RoundTripper
+}
+
+func (t *reasoningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	rec, ok := req.Context().Value(bodyRecorderKey{}).(*bodyRecorder)
+	if err != nil || !ok || resp.StatusCode != http.StatusOK || !strings.HasSuffix(req.URL.Path, "/chat/completions") {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	rec.body = body
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// withReasoning 将 v 序列化为 JSON，并在 choices[i].<field> 中写入非空的 reasoning[i]。
+// 所有推理内容均为空时与直接序列化 v 相同
+func withReasoning(v interface{}, field string, reasoning []string) []byte {
+	data, _ := json.Marshal(v)
+	if strings.Join(reasoning, "") == "" {
+		return data
+	}
+
+	var body map[string]json.RawMessage
+	var choices []map[string]json.RawMessage
+	if json.Unmarshal(data, &body) != nil || json.Unmarshal(body["choices"], &choices) != nil {
+		return data
+	}
+	for i, choice := range choices {
+		if i >= len(reasoning) || reasoning[i] == "" {
+			continue
+		}
+		var message map[string]json.RawMessage
+		if json.Unmarshal(choice[field], &message) != nil {
+			continue
+		}
+		message["reasoning"], _ = json.Marshal(reasoning[i])
+		choice[field], _ = json.Marshal(message)
+	}
+	body["choices"], _ = json.Marshal(choices)
+	rewritten, _ := json.Marshal(body)
+	return rewritten
+}
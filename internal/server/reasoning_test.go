@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// writeReasoningResponse 模拟推理模型：非流式时在 message.reasoning、流式时在 delta.reasoning 中返回思考过程
+func writeReasoningResponse(w http.ResponseWriter, body map[string]interface{}) {
+	model, _ := body["model"].(string)
+	if body["stream"] != true {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"gen-test","model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":"42","reasoning":"think hard"},"finish_reason":"stop"}]}`, model)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprintf(w, `data: {"id":"gen-test","model":%q,"choices":[{"index":0,"delta":{"role":"assistant","content":"","reasoning":"think "}}]}`+"\n\n", model)
+	fmt.Fprintf(w, `data: {"id":"gen-test","model":%q,"choices":[{"index":0,"delta":{"content":"","reasoning":"hard"}}]}`+"\n\n", model)
+	fmt.Fprintf(w, `data: {"id":"gen-test","model":%q,"choices":[{"index":0,"delta":{"content":"42"},"finish_reason":"stop"}]}`+"\n\n", model)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// streamFrames 返回流式响应体中的 JSON 帧，SSE 去掉 data: 前缀，NDJSON 按行切分
+func streamFrames(t *testing.T, body string) []map[string]interface{} {
+	t.Helper()
+	var frames []map[string]interface{}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimPrefix(line, "data: ")
+		if line == "" || line == "[DONE]" {
+			continue
+		}
+		var frame map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &frame); err != nil {
+			t.Fatalf("invalid frame %q: %v", line, err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// reasoningOf 取出帧中 path 指定对象的 reasoning 和 refusal 字段
+func reasoningOf(frame map[string]interface{}, path ...string) (reasoning, refusal interface{}) {
+	var obj interface{} = frame
+	for _, key := range path {
+		switch v := obj.(type) {
+		case map[string]interface{}:
+			obj = v[key]
+		case []interface{}:
+			if len(v) == 0 {
+				return nil, nil
+			}
+			obj = v[0]
+		}
+	}
+	m, _ := obj.(map[string]interface{})
+	return m["reasoning"], m["refusal"]
+}
+
+func TestIncludeReasoning(t *testing.T) {
+	cases := []struct {
+		name, path  string
+		stream      bool
+		incremental bool
+		field       []string
+	}{
+		{"ollama", "/api/chat", false, false, []string{"message"}},
+		{"ollama stream", "/api/chat", true, false, []string{"message"}},
+		{"openai", "/v1/chat/completions", false, false, []string{"choices", "0", "message"}},
+		{"openai incremental", "/v1/chat/completions", false, true, []string{"choices", "0", "message"}},
+		{"openai stream", "/v1/chat/completions", true, false, []string{"choices", "0", "delta"}},
+		{"generate", "/api/generate", false, false, nil},
+		{"generate stream", "/api/generate", true, false, nil},
+	}
+
+	for _, include := range []bool{true, false} {
+		for _, tc := range cases {
+			t.Run(fmt.Sprintf("%s include=%v", tc.name, include), func(t *testing.T) {
+				upstream := newFakeUpstream(t, fakeModel{ID: "org/thinker"})
+				upstream.chat = writeReasoningResponse
+				s := newTestServer(t, Config{IncludeReasoning: include, IncrementalNonStream: tc.incremental}, upstream)
+
+				body := fmt.Sprintf(`{"model":"thinker","stream":%v,"messages":[{"role":"user","content":"hi"}]}`, tc.stream)
+				if tc.path == "/api/generate" {
+					body = fmt.Sprintf(`{"model":"thinker","stream":%v,"prompt":"hi"}`, tc.stream)
+				}
+				w := doJSON(t, s.buildRouter(), http.MethodPost, tc.path, body)
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+				}
+
+				var got strings.Builder
+				for _, frame := range streamFrames(t, w.Body.String()) {
+					reasoning, refusal := reasoningOf(frame, tc.field...)
+					if refusal != nil {
+						t.Errorf("reasoning leaked into refusal: %v", frame)
+					}
+					if reasoning == nil {
+						continue
+					}
+					text, ok := reasoning.(string)
+					if !ok || text == "" {
+						t.Errorf("reasoning = %#v, want omitted or a non-empty string", reasoning)
+					}
+					got.WriteString(text)
+				}
+
+				want := ""
+				if include {
+					want = "think hard"
+				}
+				if got.String() != want {
+					t.Errorf("reasoning = %q, want %q\nbody: %s", got.String(), want, w.Body.String())
+				}
+				if !strings.Contains(w.Body.String(), "42") {
+					t.Errorf("content missing from response: %s", w.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestIncludeReasoningStreamingOnlyModel(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/thinker"})
+	upstream.chat = writeReasoningResponse
+	s := newTestServer(t, Config{IncludeReasoning: true, StreamingOnly: []string{"org/thinker"}}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions",
+		`{"model":"thinker","messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if reasoning, _ := reasoningOf(resp, "choices", "0", "message"); reasoning != "think hard" {
+		t.Errorf("aggregated reasoning = %#v, want %q", reasoning, "think hard")
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDHeader 是请求 ID 的请求/响应头，客户端传入时沿用，否则由代理生成
+const requestIDHeader = "X-Request-Id"
+
+// requestIDKey 是请求 ID 在 gin.Context 中的键
+const requestIDKey = "request_id"
+
+// maxRequestIDLength 限制沿用客户端请求 ID 的长度，过长时重新生成
+const maxRequestIDLength = 128
+
+// requestIDMiddleware 为每个请求分配 ID，写入响应头并保存到上下文，便于关联日志和响应
+func requestIDMiddleware(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		id = newRequestID()
+	}
+	c.Set(requestIDKey, id)
+	c.Header(requestIDHeader, id)
+	c.Next()
+}
+
+// newRequestID 生成 16 字节的随机十六进制 ID
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// requestID 返回当前请求的 ID
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
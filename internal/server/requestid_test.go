@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// lastFrameID 返回响应体最后一个 JSON 帧（非流式时即整个响应体）中的 id
+func lastFrameID(t *testing.T, body string) string {
+	t.Helper()
+
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	var frame struct {
+		ID   string `json:"id"`
+		Done bool   `json:"done"`
+	}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &frame); err != nil {
+		t.Fatalf("decode last frame: %v, body = %s", err, body)
+	}
+	if !frame.Done {
+		t.Fatalf("last frame is not done, body = %s", body)
+	}
+	return frame.ID
+}
+
+func TestOllamaResponseIDMatchesRequestID(t *testing.T) {
+	tests := []struct {
+		path   string
+		stream bool
+	}{
+		{"/api/chat", false},
+		{"/api/chat", true},
+		{"/api/generate", false},
+		{"/api/generate", true},
+	}
+
+	for _, tt := range tests {
+		name := tt.path
+		if tt.stream {
+			name += " stream"
+		}
+		t.Run(name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			s := newTestServer(t, Config{}, upstream)
+			r := s.buildRouter()
+
+			stream := "false"
+			if tt.stream {
+				stream = "true"
+			}
+			body := `{"model":"model-a","stream":` + stream + `,"prompt":"hi","messages":[{"role":"user","content":"hi"}]}`
+			w := doJSON(t, r, http.MethodPost, tt.path, body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			header := w.Header().Get(requestIDHeader)
+			if header == "" {
+				t.Fatalf("%s header missing", requestIDHeader)
+			}
+			if got := lastFrameID(t, w.Body.String()); got != header {
+				t.Errorf("id = %q, want %q", got, header)
+			}
+		})
+	}
+}
+
+func TestRequestIDReusesClientHeader(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+
+	body := `{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat", body, requestIDHeader, "client-req-1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(requestIDHeader); got != "client-req-1" {
+		t.Errorf("%s = %q, want client-req-1", requestIDHeader, got)
+	}
+	if got := lastFrameID(t, w.Body.String()); got != "client-req-1" {
+		t.Errorf("id = %q, want client-req-1", got)
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxResponseCacheEntries 限制响应缓存的条目数，写满且没有过期条目时不再写入
+const maxResponseCacheEntries = 1000
+
+// noCacheHeader 是请求跳过响应缓存的自定义请求头
+const noCacheHeader = "X-No-Cache"
+
+// cachedResponse 是一条缓存的非流式聊天响应
+type cachedResponse struct {
+	response ChatResponse
+	model    string
+	expires  time.Time
+}
+
+// responseCache 按请求内容缓存非流式聊天响应，nil 表示未启用
+type responseCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedResponse
+}
+
+// newResponseCache 创建有效期为 ttl 的响应缓存，ttl 不大于 0 时返回 nil
+func newResponseCache(ttl time.Duration) *responseCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &responseCache{ttl: ttl, entries: make(map[string]cachedResponse)}
+}
+
+// responseCacheKey 以转发给上游的字段计算缓存键
+func responseCacheKey(request openai.ChatCompletionRequest) string {
+	data, _ := json.Marshal(upstreamRequest(request))
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (rc *responseCache) get(key string) (ChatResponse, string, bool) {
+	if rc == nil {
+		return ChatResponse{}, "", false
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return ChatResponse{}, "", false
+	}
+	return entry.response, entry.model, true
+}
+
+func (rc *responseCache) put(key string, response ChatResponse, model string) {
+	if rc == nil {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	now := time.Now()
+	if len(rc.entries) >= maxResponseCacheEntries {
+		for k, e := range rc.entries {
+			if now.After(e.expires) {
+				delete(rc.entries, k)
+			}
+		}
+		if len(rc.entries) >= maxResponseCacheEntries {
+			return
+		}
+	}
+	rc.entries[key] = cachedResponse{response: response, model: model, expires: now.Add(rc.ttl)}
+}
+
+// cacheBypassRequested 判断请求是否要求跳过响应缓存（既不读取也不写入）：
+// Cache-Control 含 no-store 或 no-cache，或携带值不为 false/0 的 X-No-Cache 头
+func cacheBypassRequested(c *gin.Context) bool {
+	for _, directive := range strings.Split(c.GetHeader("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-store", "no-cache":
+			return true
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.GetHeader(noCacheHeader))) {
+	case "", "false", "0":
+		return false
+	}
+	return true
+}
+
+// lookupResponse 在启用缓存且请求未要求跳过时查找缓存的响应，返回的 key 为空表示不使用缓存
+func (s *Server) lookupResponse(c *gin.Context, request openai.ChatCompletionRequest) (key string, response ChatResponse, model string, hit bool) {
+	if s.responseCache == nil || cacheBypassRequested(c) {
+		return "", ChatResponse{}, "", false
+	}
+	key = responseCacheKey(request)
+	response, model, hit = s.responseCache.get(key)
+	return key, response, model, hit
+}
+
+// storeResponse 缓存成功的响应，key 为空时不缓存
+func (s *Server) storeResponse(key string, response ChatResponse, model string) {
+	if key == "" || len(response.Choices) == 0 {
+		return
+	}
+	s.responseCache.put(key, response, model)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResponseCacheBypassHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		headers []string
+		want    int // 第二次请求后上游收到的请求数
+	}{
+		{"cached openai", "/v1/chat/completions", nil, 1},
+		{"cached ollama", "/api/chat", nil, 1},
+		{"cache-control no-store", "/v1/chat/completions", []string{"Cache-Control", "no-store"}, 2},
+		{"cache-control no-cache", "/api/chat", []string{"Cache-Control", "max-age=0, No-Cache"}, 2},
+		{"x-no-cache", "/v1/chat/completions", []string{noCacheHeader, "1"}, 2},
+		{"x-no-cache false", "/v1/chat/completions", []string{noCacheHeader, "false"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			s := newTestServer(t, Config{ResponseCacheTTL: time.Minute}, upstream)
+			r := s.buildRouter()
+
+			body := `{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+			for i := 0; i < 2; i++ {
+				w := doJSON(t, r, http.MethodPost, tt.path, body, tt.headers...)
+				if w.Code != http.StatusOK {
+					t.Fatalf("request %d: status = %d, body = %s", i, w.Code, w.Body.String())
+				}
+			}
+			if got := len(upstream.requestedModels()); got != tt.want {
+				t.Errorf("upstream requests = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseCacheBypassSkipsStorage(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{ResponseCacheTTL: time.Minute}, upstream)
+	r := s.buildRouter()
+
+	body := `{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	doJSON(t, r, http.MethodPost, "/v1/chat/completions", body, "Cache-Control", "no-store")
+	doJSON(t, r, http.MethodPost, "/v1/chat/completions", body)
+	if got := len(upstream.requestedModels()); got != 2 {
+		t.Errorf("upstream requests = %d, want 2 (bypassed response must not be stored)", got)
+	}
+}
+
+func TestResponseCacheDisabledByDefault(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+	r := s.buildRouter()
+
+	body := `{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	doJSON(t, r, http.MethodPost, "/v1/chat/completions", body)
+	doJSON(t, r, http.MethodPost, "/v1/chat/completions", body)
+	if got := len(upstream.requestedModels()); got != 2 {
+		t.Errorf("upstream requests = %d, want 2", got)
+	}
+}
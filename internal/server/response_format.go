@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ollamaSchemaName 是 Ollama JSON schema 映射为 OpenAI json_schema 时使用的名称
+const ollamaSchemaName = "response"
+
+// ollamaResponseFormat 将 Ollama 的 format 字段转换为 OpenAI 的 response_format：
+// "json" 映射为 json_object，JSON schema 对象映射为 json_schema，缺省时返回 nil
+func ollamaResponseFormat(format json.RawMessage) (*openai.ChatCompletionResponseFormat, error) {
+	format = bytes.TrimSpace(format)
+	if len(format) == 0 || bytes.Equal(format, []byte("null")) {
+		return nil, nil
+	}
+
+	if format[0] == '{' {
+		return &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   ollamaSchemaName,
+				Schema: format,
+			},
+		}, nil
+	}
+
+	var name string
+	if err := json.Unmarshal(format, &name); err != nil {
+		return nil, fmt.Errorf("invalid format: %w", err)
+	}
+	switch name {
+	case "":
+		return nil, nil
+	case "json":
+		return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", name)
+	}
+}
+
+// openAIChatRequest 是 /v1/chat/completions 的请求体。go-openai 的 json_schema.schema
+// 是 json.Marshaler 接口，无法直接反序列化，因此 response_format 单独解析
+type openAIChatRequest struct {
+	openai.ChatCompletionRequest
+	ResponseFormat *responseFormatPayload `json:"response_format,omitempty"`
+}
+
+// responseFormatPayload 是客户端传入的 response_format，schema 保留原始 JSON
+type responseFormatPayload struct {
+	Type       openai.ChatCompletionResponseFormatType `json:"type"`
+	JSONSchema *struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Schema      json.RawMessage `json:"schema"`
+		Strict      bool            `json:"strict"`
+	} `json:"json_schema"`
+}
+
+// toOpenAI 原样转换为 go-openai 的 response_format，nil 时返回 nil
+func (p *responseFormatPayload) toOpenAI() *openai.ChatCompletionResponseFormat {
+	if p == nil {
+		return nil
+	}
+	format := &openai.ChatCompletionResponseFormat{Type: p.Type}
+	if p.JSONSchema != nil {
+		format.JSONSchema = &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:        p.JSONSchema.Name,
+			Description: p.JSONSchema.Description,
+			Schema:      p.JSONSchema.Schema,
+			Strict:      p.JSONSchema.Strict,
+		}
+	}
+	return format
+}
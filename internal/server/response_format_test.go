@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResponseFormatForwarded(t *testing.T) {
+	const msgs = `"messages":[{"role":"user","content":"hi"}]`
+	const schema = `{"type":"object","properties":{"age":{"type":"integer"}}}`
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		wantType string
+	}{
+		{"ollama chat json", "/api/chat", `{"model":"model-a","stream":false,"format":"json",` + msgs + `}`, "json_object"},
+		{"ollama chat stream json", "/api/chat", `{"model":"model-a","stream":true,"format":"json",` + msgs + `}`, "json_object"},
+		{"ollama chat schema", "/api/chat", `{"model":"model-a","stream":false,"format":` + schema + `,` + msgs + `}`, "json_schema"},
+		{"ollama generate json", "/api/generate", `{"model":"model-a","stream":false,"prompt":"hi","format":"json"}`, "json_object"},
+		{"ollama generate stream schema", "/api/generate", `{"model":"model-a","stream":true,"prompt":"hi","format":` + schema + `}`, "json_schema"},
+		{"ollama without format", "/api/chat", `{"model":"model-a","stream":false,` + msgs + `}`, ""},
+		{"openai json_object", "/v1/chat/completions", `{"model":"model-a","response_format":{"type":"json_object"},` + msgs + `}`, "json_object"},
+		{"openai stream json_object", "/v1/chat/completions", `{"model":"model-a","stream":true,"response_format":{"type":"json_object"},` + msgs + `}`, "json_object"},
+		{"openai without format", "/v1/chat/completions", `{"model":"model-a",` + msgs + `}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			s := newTestServer(t, Config{}, upstream)
+
+			w := doJSON(t, s.buildRouter(), http.MethodPost, tt.path, tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			format, ok := upstream.lastRequest(t)["response_format"].(map[string]interface{})
+			if tt.wantType == "" {
+				if ok {
+					t.Errorf("upstream response_format = %v, want none", format)
+				}
+				return
+			}
+			if !ok || format["type"] != tt.wantType {
+				t.Fatalf("upstream response_format = %v, want type %s", format, tt.wantType)
+			}
+			if tt.wantType == "json_schema" {
+				js, _ := format["json_schema"].(map[string]interface{})
+				sch, _ := js["schema"].(map[string]interface{})
+				if sch["type"] != "object" {
+					t.Errorf("upstream json_schema = %v, want the Ollama schema", js)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAIJSONSchemaPassedThroughUnchanged(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+
+	body := `{"model":"model-a","messages":[{"role":"user","content":"hi"}],
+		"response_format":{"type":"json_schema","json_schema":{"name":"person","strict":true,"schema":{"type":"object"}}}}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	format, _ := upstream.lastRequest(t)["response_format"].(map[string]interface{})
+	js, _ := format["json_schema"].(map[string]interface{})
+	if format["type"] != "json_schema" || js["name"] != "person" || js["strict"] != true {
+		t.Errorf("upstream response_format = %v, want the client's json_schema", format)
+	}
+}
+
+func TestUnsupportedOllamaFormatRejected(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+
+	body := `{"model":"model-a","stream":false,"format":"yaml","messages":[{"role":"user","content":"hi"}]}`
+	if w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat", body); w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newFlakyUpstream 返回前 failures 次以 status 失败、之后正常响应的假上游
+func newFlakyUpstream(t *testing.T, status int, failures int32) (*fakeUpstream, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		if calls.Add(1) <= failures {
+			writeUpstreamError(w, status, "upstream hiccup")
+			return
+		}
+		writeChatCompletion(w, "org/model-a", "recovered")
+	}
+	return upstream, &calls
+}
+
+func TestProviderRetriesTransientErrors(t *testing.T) {
+	upstream, calls := newFlakyUpstream(t, http.StatusBadGateway, 1)
+	provider := NewOpenrouterProvider("key", WithBaseURL(upstream.URL+"/"))
+
+	resp, err := provider.Chat([]openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}, "org/model-a")
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if got := resp.Choices[0].Message.Content; got != "recovered" {
+		t.Errorf("content = %q, want recovered", got)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want 2 (one retry)", got)
+	}
+}
+
+func TestProviderRetryLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		maxRetries int
+		wantCalls  int32
+	}{
+		{"gives up after max retries", http.StatusServiceUnavailable, 2, 3},
+		{"retries disabled", http.StatusServiceUnavailable, 0, 1},
+		{"not found is permanent", http.StatusNotFound, 2, 1},
+		{"rate limit is not retried", http.StatusTooManyRequests, 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, calls := newFlakyUpstream(t, tt.status, 10)
+			provider := NewOpenrouterProvider("key", WithBaseURL(upstream.URL+"/"), WithMaxRetries(tt.maxRetries))
+
+			_, err := provider.Chat([]openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}, "org/model-a")
+			if err == nil {
+				t.Fatal("Chat() succeeded, want error")
+			}
+			if got := upstreamStatus(err); got != tt.status {
+				t.Errorf("upstream status = %d, want %d", got, tt.status)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestServerMaxRetriesConfig(t *testing.T) {
+	upstream, calls := newFlakyUpstream(t, http.StatusBadGateway, 1)
+	retries := 1
+	s := newTestServer(t, Config{MaxRetries: &retries}, upstream)
+
+	body := `{"model":"model-a","messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want 2", got)
+	}
+}
+
+// writeTruncatedCompletion 模拟网关截断的非流式响应体
+func writeTruncatedCompletion(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"id":"gen-test","object":"chat.completion","choices":[{"index":0,"message":{"role":"assis`))
+}
+
+func TestTruncatedJSONIsRetried(t *testing.T) {
+	var calls atomic.Int32
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		if calls.Add(1) == 1 {
+			writeTruncatedCompletion(w)
+			return
+		}
+		writeChatCompletion(w, "org/model-a", "recovered")
+	}
+	retries := 1
+	s := newTestServer(t, Config{MaxRetries: &retries}, upstream)
+
+	body := `{"model":"model-a","messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want 2", got)
+	}
+}
+
+func TestTruncatedJSONWithoutRetriesIsBadGateway(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		writeTruncatedCompletion(w)
+	}
+	s := newTestServer(t, Config{}, upstream)
+
+	body := `{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat", body)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTruncatedJSONFailsOverInFreeMode(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/free-a:free"}, fakeModel{ID: "org/free-b:free"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		if body["model"] == "org/free-a:free" {
+			writeTruncatedCompletion(w)
+			return
+		}
+		writeChatCompletion(w, "org/free-b:free", "from b")
+	}
+	s := newTestServer(t, Config{FreeMode: true}, upstream, "org/free-a:free", "org/free-b:free")
+
+	body := `{"model":"free-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	got := upstream.requestedModels()
+	if len(got) != 2 || got[0] != "org/free-a:free" || got[1] != "org/free-b:free" {
+		t.Errorf("requested models = %v, want [org/free-a:free org/free-b:free]", got)
+	}
+}
+
+func TestServerMaxRetriesConfigDistinguishesZero(t *testing.T) {
+	zero := 0
+	for _, tt := range []struct {
+		name       string
+		maxRetries *int
+		want       int
+	}{
+		{"unset uses default", nil, DefaultMaxRetries},
+		{"zero disables retries", &zero, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(Config{MaxRetries: tt.maxRetries, ConfigDir: t.TempDir()})
+			provider, err := s.newProvider()
+			if err != nil {
+				t.Fatalf("newProvider() error = %v", err)
+			}
+			if provider.maxRetries != tt.want {
+				t.Errorf("maxRetries = %d, want %d", provider.maxRetries, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBackoffStopsOnCancel(t *testing.T) {
+	upstream, calls := newFlakyUpstream(t, http.StatusServiceUnavailable, 10)
+	provider := NewOpenrouterProvider("key", WithBaseURL(upstream.URL+"/"), WithMaxRetries(5))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		calls.Add(1)
+		cancel()
+		writeUpstreamError(w, http.StatusServiceUnavailable, "upstream hiccup")
+	}
+
+	start := time.Now()
+	_, err := provider.CreateChatWithGrace(ctx, openai.ChatCompletionRequest{
+		Model:    "org/model-a",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}},
+	}, 0)
+	if err == nil {
+		t.Fatal("CreateChatWithGrace() succeeded, want error")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("upstream calls = %d, want 1 (no retry after cancel)", got)
+	}
+	if elapsed := time.Since(start); elapsed >= retryBaseDelay {
+		t.Errorf("CreateChatWithGrace() took %v, want it to return without waiting for the backoff", elapsed)
+	}
+}
@@ -1,9 +1,14 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,10 +21,13 @@ func (s *Server) setupRoutes(r *gin.Engine) {
 	r.GET("/", s.handleRoot)
 	r.HEAD("/", s.handleHeadRoot)
 	r.GET("/health", s.handleHealth)
+	if s.config.MetricsEnabled {
+		r.GET("/metrics", s.handleMetrics)
+	}
 
 	// Ollama API 端点
-	r.POST("/api/generate", s.handleGenerate)
-	r.POST("/api/chat", s.handleChat)
+	r.POST("/api/generate", s.maintenanceMiddleware, s.circuitMiddleware, s.quotaMiddleware, s.inflightMiddleware, s.handleGenerate)
+	r.POST("/api/chat", s.maintenanceMiddleware, s.circuitMiddleware, s.quotaMiddleware, s.inflightMiddleware, s.handleChat)
 	r.GET("/api/tags", s.handleListModels)
 	r.POST("/api/show", s.handleShowModel)
 	r.POST("/api/create", s.handleCreateModel)
@@ -27,14 +35,83 @@ func (s *Server) setupRoutes(r *gin.Engine) {
 	r.DELETE("/api/delete", s.handleDeleteModel)
 	r.POST("/api/pull", s.handlePullModel)
 	r.POST("/api/push", s.handlePushModel)
-	r.POST("/api/embeddings", s.handleEmbeddings)
+	r.POST("/api/embeddings", s.maintenanceMiddleware, s.circuitMiddleware, s.quotaMiddleware, s.handleEmbeddings)
 	r.GET("/api/ps", s.handleRunningModels)
 	r.GET("/api/version", s.handleVersion)
 
 	// OpenAI 兼容端点
 	r.GET("/v1/models", s.handleOpenAIModels)
-	r.POST("/v1/chat/completions", s.handleOpenAIChat)
-	r.POST("/v1/embeddings", s.handleOpenAIEmbeddings)
+	r.POST("/v1/chat/completions", s.maintenanceMiddleware, s.circuitMiddleware, s.quotaMiddleware, s.inflightMiddleware, s.handleOpenAIChat)
+	r.POST("/v1/completions", s.maintenanceMiddleware, s.circuitMiddleware, s.quotaMiddleware, s.inflightMiddleware, s.handleOpenAICompletions)
+	r.POST("/v1/embeddings", s.maintenanceMiddleware, s.circuitMiddleware, s.quotaMiddleware, s.handleOpenAIEmbeddings)
+
+	// 管理端点，仅在 AdminEnabled 时注册
+	if s.config.AdminEnabled {
+		admin := r.Group("/api/admin", s.adminTimeoutMiddleware)
+		admin.POST("/plan", s.handleAdminPlan)
+		admin.POST("/maintenance", s.handleAdminMaintenance)
+		admin.GET("/ratelimits", s.handleAdminRateLimits)
+		admin.GET("/stats", s.handleAdminStats)
+		admin.POST("/failures/reset", s.handleAdminResetFailures)
+		admin.POST("/cooldown", s.handleAdminCooldown)
+		admin.POST("/models/reload", s.handleAdminReloadModels)
+	}
+}
+
+// handleAdminRateLimits 返回各模型当前的退避、连续失败次数和自适应并发上限
+func (s *Server) handleAdminRateLimits(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"models": s.globalLimiter.Snapshot()})
+}
+
+// handleAdminResetFailures 清除 failures.db 中的冷却记录和内存中的永久/临时失败及自动停用标记，
+// 返回各自清除的条目数，用于免费额度重置后立即恢复所有模型而无需重启
+func (s *Server) handleAdminResetFailures(c *gin.Context) {
+	var cleared int64
+	if s.failureStore != nil {
+		n, err := s.failureStore.ResetAllFailures()
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, err)
+			return
+		}
+		cleared = n
+	}
+	permanent, temporary, disabled := s.permanentFails.Reset()
+
+	slog.Warn("failure state reset", "failures", cleared, "permanent", permanent, "temporary", temporary, "disabled", disabled)
+	c.JSON(http.StatusOK, gin.H{"failures": cleared, "permanent": permanent, "temporary": temporary, "disabled": disabled})
+}
+
+// cooldownRequest 是 /api/admin/cooldown 的请求体
+type cooldownRequest struct {
+	Model   string `json:"model" binding:"required"`
+	Minutes *int   `json:"minutes" binding:"required,min=0"`
+}
+
+// handleAdminCooldown 在运行时为模型设置冷却时长覆盖（持久化到 failures.db），
+// minutes 为 0 时删除覆盖，恢复默认冷却规则
+func (s *Server) handleAdminCooldown(c *gin.Context) {
+	if s.failureStore == nil {
+		writeError(c, http.StatusBadRequest, errors.New("cooldown overrides are only available in free mode"))
+		return
+	}
+
+	var req cooldownRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, errors.New("model and a non-negative minutes are required"))
+		return
+	}
+	model, err := s.resolveModel(c.Request.Context(), req.Model)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.failureStore.SetCooldownOverride(model, *req.Minutes); err != nil {
+		writeError(c, http.StatusInternalServerError, err)
+		return
+	}
+	slog.Warn("cooldown override changed", "model", model, "minutes", *req.Minutes)
+	c.JSON(http.StatusOK, gin.H{"model": model, "minutes": *req.Minutes})
 }
 
 // handleRoot 处理根路径请求
@@ -47,9 +124,27 @@ func (s *Server) handleHeadRoot(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
-// handleHealth 健康检查
+// healthCheckTimeout 为深度健康检查访问上游的超时
+const healthCheckTimeout = 5 * time.Second
+
+// handleHealth 健康检查。默认只确认进程存活；?deep=true 时额外请求一次上游 /auth/key 校验 API 密钥，
+// 失败时返回 503 和 {"status":"degraded"}，便于编排系统发现代理实际不可用
 func (s *Server) handleHealth(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	if deep, _ := strconv.ParseBool(c.Query("deep")); !deep {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := s.provider.Ping(ctx); err != nil {
+		slog.Warn("deep health check failed", "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "degraded", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "upstream_latency_ms": time.Since(start).Milliseconds()})
 }
 
 // handleVersion 返回版本信息
@@ -62,22 +157,26 @@ func (s *Server) handleVersion(c *gin.Context) {
 // GenerateRequest Ollama Generate API 请求结构
 type GenerateRequest struct {
 	Model   string   `json:"model" binding:"required"`
-	Prompt  string   `json:"prompt" binding:"required"`
+	Prompt  string   `json:"prompt"`
 	Suffix  string   `json:"suffix,omitempty"`
 	System  string   `json:"system,omitempty"`
 	Template string  `json:"template,omitempty"`
 	Context []int    `json:"context,omitempty"`
 	Stream  *bool    `json:"stream,omitempty"`
 	Raw     bool     `json:"raw,omitempty"`
-	Format  string   `json:"format,omitempty"`
+	Format  json.RawMessage `json:"format,omitempty"`
 	Options map[string]interface{} `json:"options,omitempty"`
+	// KeepAlive 为模型在 /api/ps 中的保留时间，数字按秒计，字符串为时长
+	KeepAlive json.RawMessage `json:"keep_alive,omitempty"`
 }
 
 // GenerateResponse Ollama Generate API 响应结构
 type GenerateResponse struct {
+	ID                 string `json:"id,omitempty"`
 	Model              string `json:"model"`
 	CreatedAt          string `json:"created_at"`
 	Response           string `json:"response"`
+	Reasoning          string `json:"reasoning,omitempty"`
 	Done               bool   `json:"done"`
 	DoneReason         string `json:"done_reason,omitempty"`
 	Context            []int  `json:"context,omitempty"`
@@ -91,103 +190,161 @@ type GenerateResponse struct {
 
 // handleGenerate 处理 /api/generate 请求
 func (s *Server) handleGenerate(c *gin.Context) {
+	defer s.trackOutcome(c)()
+
 	var req GenerateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeError(c, http.StatusBadRequest, err)
 		return
 	}
-
-	// 将 generate 请求转换为 chat 请求
-	messages := []openai.ChatCompletionMessage{
-		{Role: "user", Content: req.Prompt},
+	keepAlive, err := parseKeepAlive(req.KeepAlive)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err)
+		return
 	}
-
-	// 如果有 system 提示，添加到消息列表
-	if req.System != "" {
-		messages = append([]openai.ChatCompletionMessage{
-			{Role: "system", Content: req.System},
-		}, messages...)
+	if req.Prompt == "" {
+		// 与 Ollama 一致，不带提示词但带 keep_alive 的请求只加载或卸载（keep_alive 为 0）模型；
+		// 两者都没有时仍按缺少提示词拒绝
+		if len(req.KeepAlive) == 0 {
+			writeError(c, http.StatusBadRequest, errors.New("Prompt is required"))
+			return
+		}
+		s.running.touch(req.Model, keepAlive)
+		c.JSON(http.StatusOK, GenerateResponse{
+			Model:      req.Model,
+			CreatedAt:  time.Now().Format(time.RFC3339),
+			Done:       true,
+			DoneReason: loadDoneReason(keepAlive),
+		})
+		return
 	}
+	defer s.keepModelAlive(c, req.Model, keepAlive)
+
+	// 将 generate 请求转换为 chat 请求，携带 context 时接续之前的会话
+	messages := s.generateMessages(req)
 
-	stream := true
-	if req.Stream != nil {
-		stream = *req.Stream
+	responseFormat, err := ollamaResponseFormat(req.Format)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err)
+		return
+	}
+	options, err := parseGenerateOptions(req.Options)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err)
+		return
+	}
+	request := openai.ChatCompletionRequest{
+		Model:          req.Model,
+		Messages:       messages,
+		ResponseFormat: responseFormat,
+		Stop:           options.Stop,
+		MaxTokens:      options.MaxTokens,
 	}
 
 	startTime := time.Now()
 
-	if !stream {
-		s.handleNonStreamingGenerate(c, req.Model, messages, startTime)
+	if fullModelName, ok := s.baseModelFor(req.Model); ok {
+		s.handleBaseGenerate(c, req, options, fullModelName, startTime)
+		return
+	}
+
+	if !s.streamRequested(req.Stream, true) {
+		s.handleNonStreamingGenerate(c, request, startTime)
 	} else {
-		s.handleStreamingGenerate(c, req.Model, messages, startTime)
+		s.handleStreamingGenerate(c, request, startTime)
 	}
 }
 
 // handleNonStreamingGenerate 处理非流式生成
-func (s *Server) handleNonStreamingGenerate(c *gin.Context, model string, messages []openai.ChatCompletionMessage, startTime time.Time) {
-	var response openai.ChatCompletionResponse
+func (s *Server) handleNonStreamingGenerate(c *gin.Context, request openai.ChatCompletionRequest, startTime time.Time) {
+	var response ChatResponse
 	var fullModelName string
 	var err error
 
 	if s.config.FreeMode {
-		response, fullModelName, err = s.getFreeChatForModel(messages, model)
+		response, fullModelName, err = s.getFreeChatForModel(c.Request.Context(), request)
 		if err != nil {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			s.writeFailoverError(c, upstreamErrorStatus(err, http.StatusServiceUnavailable), err)
 			return
 		}
 	} else {
-		fullModelName, err = s.provider.GetFullModelName(model)
+		fullModelName, err = s.resolveModel(c.Request.Context(), request.Model)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			writeError(c, http.StatusNotFound, err)
 			return
 		}
-		response, err = s.provider.Chat(messages, fullModelName)
+		upstream := request
+		upstream.Model = fullModelName
+		upstreamDone := timePhase(c.Request.Context(), phaseUpstream)
+		response, err = s.provider.CreateChat(upstream)
+		upstreamDone()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
 			return
 		}
 	}
 
-	totalDuration := time.Since(startTime).Nanoseconds()
+	if len(response.Choices) == 0 {
+		writeError(c, http.StatusInternalServerError, errors.New("No response"))
+		return
+	}
+
+	endTime := time.Now()
+	durations := responseDurations(startTime, endTime)
 
 	resp := GenerateResponse{
+		ID:                 requestID(c),
 		Model:              fullModelName,
-		CreatedAt:          time.Now().Format(time.RFC3339),
+		CreatedAt:          endTime.Format(time.RFC3339),
 		Response:           response.Choices[0].Message.Content,
+		Reasoning:          reasoningAt(response.Reasoning, 0),
 		Done:               true,
-		DoneReason:         "stop",
-		TotalDuration:      totalDuration,
+		DoneReason:         ollamaDoneReason(string(response.Choices[0].FinishReason)),
+		TotalDuration:      durations.Total,
 		PromptEvalCount:    response.Usage.PromptTokens,
+		PromptEvalDuration: durations.PromptEval,
 		EvalCount:          response.Usage.CompletionTokens,
+		EvalDuration:       durations.Eval,
+		Context:            s.saveGenerateContext(request.Messages, response.Choices[0].Message.Content),
 	}
 
+	setGenerationID(c, response.ID)
 	c.JSON(http.StatusOK, resp)
 }
 
 // handleStreamingGenerate 处理流式生成
-func (s *Server) handleStreamingGenerate(c *gin.Context, model string, messages []openai.ChatCompletionMessage, startTime time.Time) {
-	var stream *openai.ChatCompletionStream
+func (s *Server) handleStreamingGenerate(c *gin.Context, request openai.ChatCompletionRequest, startTime time.Time) {
+	var stream ChatStream
 	var fullModelName string
 	var err error
 
+	// 请求上游在流末尾附带 usage，用于最终消息的 prompt_eval_count
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
 	if s.config.FreeMode {
-		stream, fullModelName, err = s.getFreeStreamForModel(messages, model)
+		stream, fullModelName, err = s.getFreeStreamForModel(c.Request.Context(), request)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			s.writeFailoverError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
 			return
 		}
 	} else {
-		fullModelName, err = s.provider.GetFullModelName(model)
+		fullModelName, err = s.resolveModel(c.Request.Context(), request.Model)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			writeError(c, http.StatusNotFound, err)
 			return
 		}
-		stream, err = s.provider.ChatStream(messages, fullModelName)
+		upstream := request
+		upstream.Model = fullModelName
+		upstreamDone := timePhase(c.Request.Context(), phaseUpstream)
+		stream, err = s.provider.CreateChatStream(upstream)
+		upstreamDone()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
 			return
 		}
 	}
+	capture := s.newStreamCapture(c)
+	stream = capture.wrap(s.dedupeChunks(stream, fullModelName))
 	defer stream.Close()
 
 	c.Writer.Header().Set("Content-Type", "application/x-ndjson")
@@ -196,28 +353,56 @@ func (s *Server) handleStreamingGenerate(c *gin.Context, model string, messages
 
 	flusher, ok := c.Writer.(http.Flusher)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming not supported"})
+		writeError(c, http.StatusInternalServerError, errors.New("Streaming not supported"))
 		return
 	}
 
 	var fullResponse string
+	var usage *openai.Usage
+	var firstTokenAt time.Time
 	evalCount := 0
+	doneReason := "stop"
+	hadOutput := false
 
 	for {
 		response, err := stream.Recv()
-		if err != nil {
+		if errors.Is(err, io.EOF) {
 			break
 		}
+		if err != nil {
+			errorJSON, _ := json.Marshal(map[string]string{"error": "Stream error: " + err.Error()})
+			fmt.Fprintf(c.Writer, "%s\n", string(errorJSON))
+			flusher.Flush()
+			return
+		}
+		setGenerationID(c, response.ID)
+		capture.add(response)
+		if capture.detachOnDisconnect(stream) {
+			return
+		}
+		if response.Usage != nil {
+			usage = response.Usage
+		}
 
 		if len(response.Choices) > 0 {
+			if reason := response.Choices[0].FinishReason; reason != "" {
+				doneReason = ollamaDoneReason(string(reason))
+			}
+			hadOutput = hadOutput || chunkHasOutput(response)
 			content := response.Choices[0].Delta.Content
+			if content != "" {
+				if evalCount == 0 {
+					firstTokenAt = time.Now()
+				}
+				evalCount++
+			}
 			fullResponse += content
-			evalCount++
 
 			resp := GenerateResponse{
 				Model:     fullModelName,
 				CreatedAt: time.Now().Format(time.RFC3339),
 				Response:  content,
+				Reasoning: reasoningAt(response.Reasoning, 0),
 				Done:      false,
 			}
 
@@ -227,16 +412,29 @@ func (s *Server) handleStreamingGenerate(c *gin.Context, model string, messages
 		}
 	}
 
-	totalDuration := time.Since(startTime).Nanoseconds()
+	capture.finish()
+	doneReason = s.emptyStreamReason(doneReason, hadOutput)
+	endTime := time.Now()
+	durations := streamDurations(startTime, firstTokenAt, endTime)
+	// 提示词 token 数优先取上游 usage，没有时按字符数估算
+	promptEvalCount := estimatePromptTokens(request.Messages)
+	if usage != nil && usage.PromptTokens > 0 {
+		promptEvalCount = usage.PromptTokens
+	}
 
 	finalResp := GenerateResponse{
+		ID:                 requestID(c),
 		Model:              fullModelName,
-		CreatedAt:          time.Now().Format(time.RFC3339),
+		CreatedAt:          endTime.Format(time.RFC3339),
 		Response:           "",
 		Done:               true,
-		DoneReason:         "stop",
-		TotalDuration:      totalDuration,
+		DoneReason:         doneReason,
+		TotalDuration:      durations.Total,
+		PromptEvalCount:    promptEvalCount,
+		PromptEvalDuration: durations.PromptEval,
 		EvalCount:          evalCount,
+		EvalDuration:       durations.Eval,
+		Context:            s.saveGenerateContext(request.Messages, fullResponse),
 	}
 
 	jsonData, _ := json.Marshal(finalResp)
@@ -255,7 +453,7 @@ type CreateModelRequest struct {
 func (s *Server) handleCreateModel(c *gin.Context) {
 	var req CreateModelRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -276,7 +474,7 @@ type CopyModelRequest struct {
 func (s *Server) handleCopyModel(c *gin.Context) {
 	var req CopyModelRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -296,7 +494,7 @@ type DeleteModelRequest struct {
 func (s *Server) handleDeleteModel(c *gin.Context) {
 	var req DeleteModelRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -313,21 +511,6 @@ type PullModelRequest struct {
 	Stream *bool  `json:"stream,omitempty"`
 }
 
-// handlePullModel 处理 /api/pull 请求
-func (s *Server) handlePullModel(c *gin.Context) {
-	var req PullModelRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// OpenRouter 不需要拉取模型，返回提示
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "success",
-		"message": "Model pull is not required with OpenRouter provider",
-	})
-}
-
 // PushModelRequest 推送模型请求
 type PushModelRequest struct {
 	Name   string `json:"name" binding:"required"`
@@ -338,7 +521,7 @@ type PushModelRequest struct {
 func (s *Server) handlePushModel(c *gin.Context) {
 	var req PushModelRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -364,14 +547,14 @@ type EmbeddingsResponse struct {
 func (s *Server) handleEmbeddings(c *gin.Context) {
 	var req EmbeddingsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	// OpenRouter 支持嵌入，调用相应接口
-	embedding, err := s.provider.GetEmbeddings(req.Prompt, req.Model)
+	embedding, _, err := s.embeddings(req.Prompt, req.Model)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, embeddingErrorStatus(err), err)
 		return
 	}
 
@@ -396,11 +579,11 @@ type RunningModel struct {
 	SizeVRAM   int64     `json:"size_vram"`
 }
 
-// handleRunningModels 处理 /api/ps 请求
+// handleRunningModels 处理 /api/ps 请求，列出 keep_alive 尚未到期的模型。
+// OpenRouter 是无状态服务，这里的“运行中”只反映客户端最近请求过的模型
 func (s *Server) handleRunningModels(c *gin.Context) {
-	// 由于 OpenRouter 是无状态服务，返回空列表
 	c.JSON(http.StatusOK, RunningModelsResponse{
-		Models: []RunningModel{},
+		Models: s.running.list(),
 	})
 }
 
@@ -435,13 +618,13 @@ type EmbeddingUsage struct {
 func (s *Server) handleOpenAIEmbeddings(c *gin.Context) {
 	var req OpenAIEmbeddingsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error()}})
+		writeError(c, http.StatusBadRequest, err)
 		return
 	}
 
-	embedding, err := s.provider.GetEmbeddings(req.Input, req.Model)
+	embedding, model, err := s.embeddings(req.Input, req.Model)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		writeError(c, embeddingErrorStatus(err), err)
 		return
 	}
 
@@ -454,7 +637,7 @@ func (s *Server) handleOpenAIEmbeddings(c *gin.Context) {
 				Index:     0,
 			},
 		},
-		Model: req.Model,
+		Model: model,
 		Usage: EmbeddingUsage{
 			PromptTokens: len(req.Input),
 			TotalTokens:  len(req.Input),
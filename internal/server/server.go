@@ -1,101 +1,437 @@
 package server
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/sashabaranov/go-openai"
 )
 
 type Config struct {
-	APIKey      string
-	Host        string
-	Port        string
-	FreeMode    bool
-	ToolUseOnly bool
-	ConfigDir   string
-	FilterPath  string
-	LogLevel    string
+	APIKey                string
+	Host                  string
+	Port                  string
+	FreeMode              bool
+	ToolUseOnly           bool
+	ConfigDir             string
+	FilterPath            string
+	LogLevel              string
+	MaxConcurrentPerModel int
+	// TLSCertFile 和 TLSKeyFile 为 PEM 格式的证书和私钥路径，同时设置时以 HTTPS 监听，只设置其一时启动失败
+	TLSCertFile string
+	TLSKeyFile  string
+	// BaseURL 为 OpenRouter API 基础地址，为空时使用 https://openrouter.ai/api/v1/
+	BaseURL string
+	// DefaultStream 为请求未携带 stream 字段时的默认行为，nil 表示沿用各协议自身的默认值
+	// （Ollama 端点默认流式，OpenAI 端点默认非流式）
+	DefaultStream *bool
+	// MetricsEnabled 控制是否暴露 /metrics 并统计请求指标
+	MetricsEnabled bool
+	// ProxyAuthToken 非空时，/api/* 和 /v1/* 请求必须携带匹配的 Authorization: Bearer 头
+	ProxyAuthToken string
+	// TrustedProxies 为可信反向代理的 IP 或 CIDR，只有来自这些地址的请求才按 X-Forwarded-For
+	// 确定客户端 IP；为空时始终使用连接的来源地址
+	TrustedProxies []string
+	// ScrubPII 开启后，消息内容在发往上游前按 PIIPatterns 脱敏
+	ScrubPII bool
+	// PIIPatterns 为自定义脱敏正则，为空时使用内置的邮箱和卡号规则
+	PIIPatterns []string
+	// ModelLimits 为按模型配置的请求限制（如 max_prompt_tokens）
+	ModelLimits []ModelLimit
+	// AdminEnabled 控制是否注册 /api/admin/* 管理端点，开启时必须配置 ProxyAuthToken
+	AdminEnabled bool
+	// ToolCallMismatchFailover 开启后，免费模式下模型在请求未提供工具时返回工具调用，
+	// 且尚未向客户端写出内容时，视为模型异常并故障转移到下一个模型
+	ToolCallMismatchFailover bool
+	// FailoverPriority 为优先尝试的免费模型（完整 ID 或显示名），按顺序排在故障转移列表最前
+	FailoverPriority []string
+	// MaxMessages 为单个聊天请求允许的最大消息数，0 表示不限制
+	MaxMessages int
+	// TruncateMessages 开启后，超过 MaxMessages 的请求保留 system 消息和最近的消息，而不是返回 400
+	TruncateMessages bool
+	// MaxRetries 为非流式请求遇到上游 5xx 或超时时的原地重试次数，0 表示不重试，nil 表示使用默认的 2 次
+	MaxRetries *int
+	// MaxConcurrentRequests 为同时处理的聊天和生成请求上限，0 表示不限制
+	MaxConcurrentRequests int
+	// QueueMaxDepth 为超过 MaxConcurrentRequests 时允许排队等待的请求数，0 表示不排队直接返回 503
+	QueueMaxDepth int
+	// QueueMaxWait 为请求在队列中等待槽位的最长时间，超过后返回 503；0 表示一直等到客户端断开
+	QueueMaxWait time.Duration
+	// PaidFallbacks 为免费模型全部失败后依次尝试的付费模型完整 ID，按价格从低到高尝试
+	PaidFallbacks []string
+	// DirectPaidModels 为免费模式下允许客户端以完整 ID 直接请求的付费模型，
+	// 这类请求不参与免费模型故障转移，直接发往该模型
+	DirectPaidModels []string
+	// ResponseCacheTTL 为非流式聊天响应的缓存有效期，0 表示不缓存
+	ResponseCacheTTL time.Duration
+	// ProviderPreferences 为注入到每个上游聊天请求中的 OpenRouter provider 路由偏好
+	ProviderPreferences ProviderPreferences
+	// Referer 和 Title 为发往 OpenRouter 的 HTTP-Referer、X-Title 归属头，为空时使用默认值
+	Referer string
+	Title   string
+	// ModelRules 为按模型改写上游请求参数的规则（如删除模型不支持的参数）
+	ModelRules []ModelRule
+	// IncrementalNonStream 开启后，/v1/chat/completions 的非流式请求在内部改用上游流，
+	// 边接收边写出完整的 chat.completion 响应体，避免在内存中缓冲整个回复
+	IncrementalNonStream bool
+	// UpstreamProxyURL 为上游请求使用的 HTTP、HTTPS 或 SOCKS5 代理，为空时遵循 HTTPS_PROXY 等环境变量
+	UpstreamProxyURL string
+	// UpstreamTimeout 为单次非流式上游请求的超时，0 表示使用默认的 30 秒
+	UpstreamTimeout time.Duration
+	// MinContextLength 为免费模式使用的模型的最小上下文长度，更小的模型不参与故障转移，0 表示不限制
+	MinContextLength int
+	// FirstAttemptGrace 为免费模式下每个请求第一次上游尝试额外增加的超时，
+	// 让首选模型在故障转移前有更充裕的时间响应，0 表示不延长
+	FirstAttemptGrace time.Duration
+	// ModelListTTL 为 provider 缓存的模型 ID 列表（用于解析模型名）的有效期，0 表示使用默认的 10 分钟
+	ModelListTTL time.Duration
+	// StreamTimeout 为整个流式上游响应的超时，0 表示不限制
+	StreamTimeout time.Duration
+	// BaseModels 为基础（非指令）模型的通配符，匹配的模型在非免费模式下的 /api/generate
+	// 请求改走 completions 接口，直接发送原始提示词而不包装为聊天消息
+	BaseModels []string
+	// DefaultFilter 开启后，过滤文件不存在时使用内置的默认过滤器
+	DefaultFilter bool
+	// IncludeReasoning 开启后，上游返回的推理内容以 reasoning 字段出现在 Ollama 和 OpenAI 响应的
+	// message（非流式）和 delta（流式）中，以及 /api/generate 响应中
+	IncludeReasoning bool
+	// CaseInsensitiveModels 开启后，模型名解析和过滤器匹配均忽略大小写
+	CaseInsensitiveModels bool
+	// StreamingOnly 为只支持流式请求的模型通配符，匹配模型的非流式请求在内部改用流式上游调用，
+	// 聚合分块后以非流式响应返回
+	StreamingOnly []string
+	// DedupeStreamChunks 开启后，流式响应中与上一个分块完全相同的连续分块会被丢弃
+	DedupeStreamChunks bool
+	// SystemPrefix 为注入到每个聊天请求开头的系统提示词，与客户端的 system 消息合并，为空时不注入。
+	// 经 completions 接口发送的原始文本补全（/v1/completions、基础模型的 /api/generate）不注入
+	SystemPrefix string
+	// Aliases 为模型别名表，键为客户端使用的模型名（忽略大小写），值为实际请求的 OpenRouter 模型名。
+	// 免费模式和普通模式均生效，模型列表中以别名列出
+	Aliases map[string]string
+	// DetectEmptyStream 开启后，免费模式下没有任何输出的流视为失败并故障转移到下一个模型；
+	// 无法故障转移时以 content_filter 作为结束原因报告给客户端
+	DetectEmptyStream bool
+	// EmbeddingModels 为免费模式下请求的模型不支持嵌入时依次尝试的嵌入模型（完整 ID）
+	EmbeddingModels []string
+	// ClientRPM 为每个客户端（按经过校验的 Bearer 令牌或来源 IP 区分）每分钟允许的请求数，0 表示不限制
+	ClientRPM int
+	// AutoDisableMinAttempts 为自动停用模型前至少需要的尝试次数，0 表示不自动停用
+	AutoDisableMinAttempts int
+	// AutoDisableFailureRate 为触发自动停用的失败率（0–1），0 时使用默认的 0.9
+	AutoDisableFailureRate float64
+	// AutoDisableReprobe 为自动停用的模型重新参与故障转移前的等待时间，0 时使用默认的 7 天
+	AutoDisableReprobe time.Duration
+	// CapturePath 为请求捕获日志（JSON Lines）的路径，为空时不记录
+	CapturePath string
+	// CaptureSampleRate 为写入捕获日志的请求比例（0–1），按请求 ID 确定性采样
+	CaptureSampleRate float64
+	// CircuitBreakerThreshold 为打开熔断器所需的连续上游失败次数，0 表示不熔断
+	CircuitBreakerThreshold int
+	// CircuitBreakerWindow 为统计连续失败的时间窗口，0 时使用默认的 1 分钟
+	CircuitBreakerWindow time.Duration
+	// CircuitBreakerCooldown 为熔断器打开后到放行探测请求前的时长，0 时使用默认的 30 秒
+	CircuitBreakerCooldown time.Duration
+	// AdminTimeout 为管理端点（含其触发的上游调用）的超时，0 时使用默认的 10 秒
+	AdminTimeout time.Duration
+	// FailoverStrategy 为免费模型的尝试顺序：ordered（默认）按固定顺序，
+	// weighted 按近期成功率和上下文长度加权随机选出第一个模型
+	FailoverStrategy string
+	// PreferFreeVariant 为 true 时，请求基础模型名而存在对应 :free 变体时使用免费变体，
+	// 可被 X-Prefer-Free-Variant 请求头覆盖；nil 表示免费模式下开启、否则关闭
+	PreferFreeVariant *bool
+	// PinModel 为 true 时，客户端指定的免费模型失败或暂不可用时直接返回错误，不切换到其他模型
+	PinModel bool
+	// Quotas 为按客户端（经过校验的 Bearer 令牌或来源 IP）的每日请求数和 token 数配额，为空时不限制
+	Quotas []QuotaRule
+	// QuotaReset 为配额窗口的重置方式：calendar（默认）在本地零点重置，rolling 为从首个请求起的 24 小时
+	QuotaReset string
 }
 
 type Server struct {
-	config          Config
-	httpServer      *http.Server
-	provider        *OpenrouterProvider
-	failureStore    *FailureStore
-	globalLimiter   *GlobalRateLimiter
-	permanentFails  *PermanentFailureTracker
-	freeModels      []string
-	modelFilter     map[string]struct{}
+	config         Config
+	httpServer     *http.Server
+	provider       *OpenrouterProvider
+	failureStore   *FailureStore
+	globalLimiter  *GlobalRateLimiter
+	permanentFails *PermanentFailureTracker
+	freeModelsMu   sync.RWMutex
+	freeModels     []string
+	// paidFallbacks 是按价格排好序的付费备选模型，与 freeModels 共用 freeModelsMu
+	paidFallbacks []string
+	// contextLengths 为免费模型的上下文长度，与 freeModels 共用 freeModelsMu
+	contextLengths map[string]int
+	// successRates 为各模型近期的成功率，用于 weighted 策略
+	successRates *successRates
+	// randFloat 为 weighted 策略的随机数来源，nil 时使用 math/rand
+	randFloat     func() float64
+	modelFilterMu sync.RWMutex
+	modelFilter   *ModelFilter
+	filterStamp   fileStamp
+	// maintenance 为 true 时拒绝新的聊天、生成和嵌入请求，由管理端点切换
+	maintenanceMu sync.RWMutex
+	maintenance   bool
+	// inflight 是全局并发槽位，MaxConcurrentRequests 为 0 时为 nil
+	inflight chan struct{}
+	// inflightQueued 是正在排队等待并发槽位的请求数
+	inflightQueued atomic.Int64
+	// responseCache 缓存非流式聊天响应，ResponseCacheTTL 为 0 时为 nil
+	responseCache *responseCache
+	// clientLimiter 按客户端限制请求速率，ClientRPM 为 0 时为 nil
+	clientLimiter *clientLimiter
+	// quotas 按客户端统计每日用量，未配置 Quotas 时为 nil
+	quotas *quotaTracker
+	// breaker 在上游连续失败时快速拒绝请求，CircuitBreakerThreshold 为 0 时为 nil
+	breaker *circuitBreaker
+	// capture 记录被采样请求的捕获日志，CapturePath 为空时为 nil
+	capture *captureLog
+	// captureDrains 跟踪客户端断开后仍在后台读取上游流的捕获任务
+	captureDrains sync.WaitGroup
+	// running 按 keep_alive 记录 /api/ps 中的模型
+	running *runningModels
+	// transport 为发往 OpenRouter 的请求使用的 Transport，由 newProvider 按 UpstreamProxyURL 设置
+	transport http.RoundTripper
+	// generateContexts 保存 /api/generate 的会话历史，用于 context 往返
+	generateContexts *generateContextStore
+	// done 在 Shutdown 时关闭，用于停止后台任务
+	done     chan struct{}
+	doneOnce sync.Once
 }
 
 func New(cfg Config) *Server {
 	return &Server{
-		config:         cfg,
-		modelFilter:    make(map[string]struct{}),
-		globalLimiter:  NewGlobalRateLimiter(),
-		permanentFails: NewPermanentFailureTracker(),
+		config:           cfg,
+		modelFilter:      &ModelFilter{},
+		globalLimiter:    NewGlobalRateLimiter(cfg.MaxConcurrentPerModel),
+		permanentFails:   NewPermanentFailureTracker(nil),
+		done:             make(chan struct{}),
+		inflight:         newInflightSlots(cfg.MaxConcurrentRequests),
+		responseCache:    newResponseCache(cfg.ResponseCacheTTL),
+		generateContexts: newGenerateContextStore(),
+		clientLimiter:    newClientLimiter(cfg.ClientRPM),
+		quotas:           newQuotaTracker(cfg.Quotas, cfg.QuotaReset),
+		running:          newRunningModels(),
+		successRates:     newSuccessRates(),
+		breaker:          newCircuitBreaker(cfg.CircuitBreakerThreshold, cfg.CircuitBreakerWindow, cfg.CircuitBreakerCooldown),
 	}
 }
 
 func (s *Server) Start() error {
-	s.provider = NewOpenrouterProvider(s.config.APIKey)
+	if err := validateFailoverStrategy(s.config.FailoverStrategy); err != nil {
+		return err
+	}
+	if err := validateTLSConfig(s.config.TLSCertFile, s.config.TLSKeyFile); err != nil {
+		return err
+	}
+	if err := validateQuotaReset(s.config.QuotaReset); err != nil {
+		return err
+	}
+	if err := validateAdminConfig(s.config.AdminEnabled, s.config.ProxyAuthToken); err != nil {
+		return err
+	}
+	if err := gin.New().SetTrustedProxies(s.config.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid server.trusted_proxies: %w", err)
+	}
+	provider, err := s.newProvider()
+	if err != nil {
+		return err
+	}
+	s.provider = provider
+
+	// 免费模式加载模型列表时按过滤器剔除模型，过滤器需先加载
+	s.loadModelFilter()
 
 	if s.config.FreeMode {
 		if err := s.initFreeMode(); err != nil {
 			return err
 		}
 	}
+	if err := s.initQuotaStore(); err != nil {
+		return err
+	}
 
-	s.loadModelFilter()
+	if s.config.CapturePath != "" {
+		capture, err := openCaptureLog(s.config.CapturePath, s.config.CaptureSampleRate)
+		if err != nil {
+			return fmt.Errorf("failed to open capture log: %w", err)
+		}
+		s.capture = capture
+	}
+
+	go s.watchModelFilter(filterWatchInterval)
+	if s.failureStore != nil {
+		go s.persistSuccessRates(successRateFlushInterval)
+	}
+
+	// 不设置 WriteTimeout：它会在上游耗时较长时截断已开始写出的响应。
+	// 上游耗时由 provider 的请求超时控制，超时返回 504
+	s.httpServer = &http.Server{
+		Addr:        net.JoinHostPort(s.config.Host, s.config.Port),
+		Handler:     s.buildRouter(),
+		ReadTimeout: 30 * time.Second,
+		IdleTimeout: 120 * time.Second,
+	}
+
+	if s.TLSEnabled() {
+		return s.httpServer.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+	}
+	return s.httpServer.ListenAndServe()
+}
+
+// TLSEnabled 判断是否同时配置了证书和私钥，此时服务器以 HTTPS 监听
+func (s *Server) TLSEnabled() bool {
+	return s.config.TLSCertFile != "" && s.config.TLSKeyFile != ""
+}
+
+// validateTLSConfig 要求证书和私钥同时配置或同时为空
+func validateTLSConfig(certFile, keyFile string) error {
+	switch {
+	case certFile != "" && keyFile == "":
+		return fmt.Errorf("server.tls_cert is set but server.tls_key is missing; both are required to enable TLS")
+	case certFile == "" && keyFile != "":
+		return fmt.Errorf("server.tls_key is set but server.tls_cert is missing; both are required to enable TLS")
+	}
+	return nil
+}
+
+// validateAdminConfig 要求开启管理端点时配置鉴权令牌，避免任何能访问端口的人都能修改运行状态
+func validateAdminConfig(adminEnabled bool, authToken string) error {
+	if adminEnabled && authToken == "" {
+		return fmt.Errorf("admin.enabled requires server.auth_token; refusing to expose /api/admin/* without authentication")
+	}
+	return nil
+}
+
+// newProvider 按配置创建 OpenRouter 客户端
+func (s *Server) newProvider() (*OpenrouterProvider, error) {
+	if err := s.config.ProviderPreferences.Validate(); err != nil {
+		return nil, err
+	}
+	if err := validateModelRules(s.config.ModelRules); err != nil {
+		return nil, err
+	}
+	if err := validateStreamingOnly(s.config.StreamingOnly); err != nil {
+		return nil, err
+	}
+	transport, err := NewUpstreamTransport(s.config.UpstreamProxyURL)
+	if err != nil {
+		return nil, err
+	}
+	s.transport = transport
+	opts := []ProviderOption{
+		WithBaseURL(s.config.BaseURL),
+		WithTransport(transport),
+		WithProviderPreferences(s.config.ProviderPreferences),
+		WithAttribution(s.config.Referer, s.config.Title),
+		WithModelRules(s.config.ModelRules),
+		WithTimeouts(s.config.UpstreamTimeout, s.config.StreamTimeout),
+		WithModelListTTL(s.config.ModelListTTL),
+		WithCaseInsensitiveModels(s.config.CaseInsensitiveModels),
+		WithReasoning(s.config.IncludeReasoning),
+		WithSystemPrefix(s.config.SystemPrefix),
+		WithAliases(s.config.Aliases),
+		WithCircuitBreaker(s.breaker),
+		WithStreamingOnly(s.config.StreamingOnly),
+	}
+	if s.config.MaxRetries != nil {
+		opts = append(opts, WithMaxRetries(*s.config.MaxRetries))
+	}
+	if s.config.ScrubPII {
+		scrubber, err := NewPIIScrubber(s.config.PIIPatterns)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithScrubber(scrubber))
+	}
+	return NewOpenrouterProvider(s.config.APIKey, opts...), nil
+}
 
+func (s *Server) buildRouter() *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
+	if err := r.SetTrustedProxies(s.config.TrustedProxies); err != nil {
+		slog.Error("Invalid trusted proxies, ignoring X-Forwarded-For", "error", err)
+		r.SetTrustedProxies(nil)
+	}
 	r.Use(gin.Recovery())
+	r.Use(requestIDMiddleware)
+	r.Use(variantMiddleware)
+	if s.capture != nil {
+		r.Use(s.captureMiddleware)
+	}
+	if s.config.MetricsEnabled {
+		r.Use(metricsMiddleware)
+	}
+	if s.config.LogLevel == "debug" {
+		r.Use(timingMiddleware)
+	}
+	if s.config.ProxyAuthToken != "" {
+		r.Use(s.authMiddleware)
+	}
+	if s.clientLimiter != nil {
+		r.Use(s.clientRateLimitMiddleware)
+	}
 
 	s.setupRoutes(r)
+	return r
+}
 
-	s.httpServer = &http.Server{
-		Addr:         s.config.Host + ":" + s.config.Port,
-		Handler:      r,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  120 * time.Second,
+// modelsURL 返回 OpenRouter 模型列表接口地址
+func (s *Server) modelsURL() string {
+	baseURL := s.config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
 	}
+	return strings.TrimSuffix(baseURL, "/") + "/models"
+}
 
-	return s.httpServer.ListenAndServe()
+// streamRequested 根据请求中的 stream 字段和配置的默认值决定是否流式响应，
+// protocolDefault 为对应协议在字段缺省时的默认值
+func (s *Server) streamRequested(stream *bool, protocolDefault bool) bool {
+	if stream != nil {
+		return *stream
+	}
+	if s.config.DefaultStream != nil {
+		return *s.config.DefaultStream
+	}
+	return protocolDefault
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.doneOnce.Do(func() { close(s.done) })
+	// 数据库和捕获日志在请求处理完之后才关闭，避免正在结束的请求写入已关闭的存储
+	err := s.httpServer.Shutdown(ctx)
+	if s.capture != nil {
+		if !s.waitCaptureDrains(ctx) {
+			slog.Warn("capture drains still running at shutdown deadline, closing capture log")
+		}
+		s.capture.Close()
+	}
+	if s.quotas != nil && s.quotas.store != nil && s.quotas.store != s.failureStore {
+		s.quotas.store.Close()
+	}
 	if s.failureStore != nil {
+		s.flushSuccessRates()
 		s.failureStore.Close()
 	}
-	return s.httpServer.Shutdown(ctx)
+	return err
 }
 
 func (s *Server) initFreeMode() error {
-	cacheFile := filepath.Join(s.config.ConfigDir, "free-models")
-	os.Setenv("FREE_MODELS_CACHE", cacheFile)
-
-	models, err := s.ensureFreeModelFile(s.config.APIKey, cacheFile)
-	if err != nil {
-		return fmt.Errorf("failed to load free models: %w", err)
-	}
-	s.freeModels = models
-
-	dbFile := filepath.Join(s.config.ConfigDir, "failures.db")
+	dbFile := filepath.Join(s.config.ConfigDir, FailureDBName)
 	os.Setenv("FAILURE_DB", dbFile)
 
 	failureStore, err := NewFailureStore(dbFile)
@@ -103,41 +439,106 @@ func (s *Server) initFreeMode() error {
 		return fmt.Errorf("failed to init failure store: %w", err)
 	}
 	s.failureStore = failureStore
+	s.permanentFails = NewPermanentFailureTracker(failureStore)
 
-	slog.Info("Free mode enabled", "models", len(s.freeModels))
+	models, err := CachedFreeModels(failureStore, s.modelsURL(), s.config.APIKey, s.transport)
+	if err != nil {
+		return fmt.Errorf("failed to load free models: %w", err)
+	}
+	toolUseOnly := strings.ToLower(os.Getenv("TOOL_USE_ONLY")) == "true"
+	s.setFreeModels(s.usableFreeModels(models, toolUseOnly))
+	s.setContextLengths(models)
+
+	s.warnUnknownPriorityModels()
+	s.loadSuccessRates()
+	s.reorderFreeModelsByLatency()
+	s.loadPaidFallbacks()
+
+	slog.Info("Free mode enabled", "models", len(s.freeModelList()))
 	return nil
 }
 
+// freeModelList 返回当前免费模型列表的快照
+func (s *Server) freeModelList() []string {
+	s.freeModelsMu.RLock()
+	defer s.freeModelsMu.RUnlock()
+	return append([]string(nil), s.freeModels...)
+}
+
+func (s *Server) setFreeModels(models []string) {
+	s.freeModelsMu.Lock()
+	defer s.freeModelsMu.Unlock()
+	s.freeModels = models
+}
+
+// usableFreeModels 返回免费模式实际可用的模型 ID：去掉重复的 ID、被过滤器排除的模型和上下文长度
+// 小于 MinContextLength 的模型，toolUseOnly 时只保留支持工具调用的模型。加载时过滤一次，故障转移不必再逐个跳过
+func (s *Server) usableFreeModels(models []ModelInfo, toolUseOnly bool) []string {
+	seen := make(map[string]bool, len(models))
+	ids := make([]string, 0, len(models))
+	for _, id := range modelIDs(FilterMinContext(models, s.config.MinContextLength), toolUseOnly) {
+		parts := strings.Split(id, "/")
+		if seen[id] || !s.isModelInFilter(parts[len(parts)-1]) {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 func (s *Server) loadModelFilter() {
-	file, err := os.Open(s.config.FilterPath)
+	stamp := statFile(s.config.FilterPath)
+	filter, source, err := s.readModelFilter()
 	if err != nil {
-		if !os.IsNotExist(err) {
-			slog.Error("Error loading model filter", "error", err)
-		}
+		slog.Error("Error loading model filter", "error", err)
 		return
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			s.modelFilter[line] = struct{}{}
-		}
-	}
+	s.modelFilterMu.Lock()
+	s.modelFilter = filter
+	s.filterStamp = stamp
+	s.modelFilterMu.Unlock()
 
-	slog.Info("Model filter loaded", "patterns", len(s.modelFilter))
+	slog.Info("Model filter loaded", "source", source, "patterns", len(filter.Patterns()))
 }
 
+// readModelFilter 读取过滤文件并返回过滤器及其来源（file、default 或 none）。
+// 文件不存在时使用内置默认过滤器，DefaultFilter 关闭时不过滤
+func (s *Server) readModelFilter() (*ModelFilter, string, error) {
+	filter, err := LoadModelFilter(s.config.FilterPath)
+	source := "file"
+	switch {
+	case os.IsNotExist(err) && s.config.DefaultFilter:
+		filter, source = DefaultModelFilter(), "default"
+	case os.IsNotExist(err):
+		filter, source = &ModelFilter{}, "none"
+	case err != nil:
+		return nil, "", err
+	}
+	filter.SetIgnoreCase(s.config.CaseInsensitiveModels)
+	return filter, source, nil
+}
 
+// currentModelFilter 返回当前生效的模型过滤器
+func (s *Server) currentModelFilter() *ModelFilter {
+	s.modelFilterMu.RLock()
+	defer s.modelFilterMu.RUnlock()
+	return s.modelFilter
+}
 
 func (s *Server) handleListModels(c *gin.Context) {
 	var newModels []map[string]interface{}
+	// fullIDs 与 newModels 一一对应，记录完整模型 ID 以便按系列分组
+	var fullIDs []string
 	toolUseOnly := strings.ToLower(os.Getenv("TOOL_USE_ONLY")) == "true"
 	currentTime := time.Now().Format(time.RFC3339)
 
 	if s.config.FreeMode {
-		for _, freeModel := range s.freeModels {
+		for _, freeModel := range s.freeModelList() {
+			if s.permanentFails.IsDisabled(freeModel) {
+				continue
+			}
 			skip, err := s.failureStore.ShouldSkip(freeModel)
 			if err != nil {
 				slog.Error("db error checking model", "model", freeModel, "error", err)
@@ -154,6 +555,7 @@ func (s *Server) handleListModels(c *gin.Context) {
 				continue
 			}
 
+			fullIDs = append(fullIDs, freeModel)
 			newModels = append(newModels, map[string]interface{}{
 				"name":        displayName,
 				"model":       displayName,
@@ -172,7 +574,7 @@ func (s *Server) handleListModels(c *gin.Context) {
 		}
 	} else {
 		if toolUseOnly {
-			newModels = s.fetchToolUseModels(c)
+			newModels, fullIDs = s.fetchToolUseModels(c)
 			if newModels == nil {
 				return
 			}
@@ -180,16 +582,15 @@ func (s *Server) handleListModels(c *gin.Context) {
 			models, err := s.provider.GetModels()
 			if err != nil {
 				slog.Error("Error getting models", "error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				writeError(c, http.StatusInternalServerError, err)
 				return
 			}
 			newModels = make([]map[string]interface{}, 0, len(models))
 			for _, m := range models {
-				if len(s.modelFilter) > 0 {
-					if _, ok := s.modelFilter[m.Model]; !ok {
-						continue
-					}
+				if !s.isModelInFilter(m.Model) {
+					continue
 				}
+				fullIDs = append(fullIDs, m.ID)
 				newModels = append(newModels, map[string]interface{}{
 					"name":        m.Name,
 					"model":       m.Model,
@@ -202,53 +603,67 @@ func (s *Server) handleListModels(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"models": newModels})
-}
-
-func (s *Server) isModelInFilter(modelName string) bool {
-	if len(s.modelFilter) == 0 {
-		return true
+	names := make([]string, len(newModels))
+	for i, m := range newModels {
+		names[i], _ = m["name"].(string)
 	}
-	for pattern := range s.modelFilter {
-		if strings.Contains(modelName, pattern) {
-			return true
+	for _, alias := range s.aliasListing(names) {
+		entry := make(map[string]interface{}, len(newModels[alias.index]))
+		for k, v := range newModels[alias.index] {
+			entry[k] = v
 		}
+		entry["name"] = alias.name
+		entry["model"] = alias.name
+		names = append(names, alias.name)
+		fullIDs = append(fullIDs, fullIDs[alias.index])
+		newModels = append(newModels, entry)
 	}
-	return false
+
+	response := gin.H{"models": newModels}
+	if c.Query("group_by") == "family" {
+		response["families"] = groupByFamily(names, fullIDs)
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-func (s *Server) fetchToolUseModels(c *gin.Context) []map[string]interface{} {
-	req, err := http.NewRequest("GET", "https://openrouter.ai/api/v1/models", nil)
+func (s *Server) isModelInFilter(modelName string) bool {
+	return s.currentModelFilter().Match(modelName)
+}
+
+// fetchToolUseModels 返回支持工具调用的模型列表及对应的完整模型 ID，出错时已写出错误响应并返回 nil
+func (s *Server) fetchToolUseModels(c *gin.Context) ([]map[string]interface{}, []string) {
+	req, err := http.NewRequest("GET", s.modelsURL(), nil)
 	if err != nil {
 		slog.Error("Error creating request", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return nil
+		writeError(c, http.StatusInternalServerError, err)
+		return nil, nil
 	}
 	req.Header.Set("Authorization", "Bearer "+s.config.APIKey)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.upstreamClient().Do(req)
 	if err != nil {
 		slog.Error("Error fetching models", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return nil
+		writeError(c, http.StatusInternalServerError, err)
+		return nil, nil
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		slog.Error("Unexpected status", "status", resp.Status)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch models"})
-		return nil
+		writeError(c, http.StatusInternalServerError, errors.New("Failed to fetch models"))
+		return nil, nil
 	}
 
 	var result orModels
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		slog.Error("Error decoding response", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return nil
+		writeError(c, http.StatusInternalServerError, err)
+		return nil, nil
 	}
 
 	currentTime := time.Now().Format(time.RFC3339)
 	newModels := make([]map[string]interface{}, 0)
+	var fullIDs []string
 	for _, m := range result.Data {
 		if !supportsToolUse(m.SupportedParameters) {
 			continue
@@ -261,6 +676,7 @@ func (s *Server) fetchToolUseModels(c *gin.Context) []map[string]interface{} {
 			continue
 		}
 
+		fullIDs = append(fullIDs, m.ID)
 		newModels = append(newModels, map[string]interface{}{
 			"name":        displayName,
 			"model":       displayName,
@@ -277,25 +693,33 @@ func (s *Server) fetchToolUseModels(c *gin.Context) []map[string]interface{} {
 			},
 		})
 	}
-	return newModels
+	return newModels, fullIDs
 }
 
 func (s *Server) handleShowModel(c *gin.Context) {
 	var request map[string]string
 	if err := c.BindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+		writeError(c, http.StatusBadRequest, errors.New("Invalid JSON payload"))
 		return
 	}
 
 	modelName := request["name"]
 	if modelName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Model name is required"})
+		writeError(c, http.StatusBadRequest, errors.New("Model name is required"))
 		return
 	}
 
 	details, err := s.provider.GetModelDetails(modelName)
+	if errors.Is(err, errModelNotFound) {
+		writeError(c, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, errAmbiguousModel) {
+		writeError(c, http.StatusBadRequest, err)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, upstreamErrorStatus(err, http.StatusBadGateway), err)
 		return
 	}
 
@@ -303,66 +727,109 @@ func (s *Server) handleShowModel(c *gin.Context) {
 }
 
 func (s *Server) handleChat(c *gin.Context) {
+	defer s.trackOutcome(c)()
+
 	var request struct {
 		Model    string                         `json:"model"`
 		Messages []openai.ChatCompletionMessage `json:"messages"`
 		Stream   *bool                          `json:"stream"`
+		Format   json.RawMessage                `json:"format"`
+		// KeepAlive 为模型在 /api/ps 中的保留时间
+		KeepAlive json.RawMessage `json:"keep_alive"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
 		slog.Warn("Invalid JSON", "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		writeError(c, http.StatusBadRequest, fmt.Errorf("Invalid JSON: %w", err))
 		return
 	}
 
 	if request.Model == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Model name is required"})
+		writeError(c, http.StatusBadRequest, errors.New("Model name is required"))
+		return
+	}
+	keepAlive, err := parseKeepAlive(request.KeepAlive)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err)
 		return
 	}
 	if len(request.Messages) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Messages cannot be empty"})
+		// 与 Ollama 一致，不带消息但带 keep_alive 的请求只加载或卸载（keep_alive 为 0）模型；
+		// 两者都没有时仍按空消息拒绝
+		if len(request.KeepAlive) == 0 {
+			writeError(c, http.StatusBadRequest, errors.New("Messages cannot be empty"))
+			return
+		}
+		s.running.touch(request.Model, keepAlive)
+		c.JSON(http.StatusOK, gin.H{
+			"model":       request.Model,
+			"created_at":  time.Now().Format(time.RFC3339),
+			"message":     gin.H{"role": "assistant", "content": ""},
+			"done_reason": loadDoneReason(keepAlive),
+			"done":        true,
+		})
 		return
 	}
-
-	streamRequested := true
-	if request.Stream != nil {
-		streamRequested = *request.Stream
+	defer s.keepModelAlive(c, request.Model, keepAlive)
+	messages, err := s.limitMessages(request.Messages)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err)
+		return
+	}
+	responseFormat, err := ollamaResponseFormat(request.Format)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err)
+		return
+	}
+	chatRequest := openai.ChatCompletionRequest{
+		Model:          request.Model,
+		Messages:       messages,
+		ResponseFormat: responseFormat,
 	}
 
-	if !streamRequested {
-		s.handleNonStreamingChat(c, request.Model, request.Messages)
+	stream := s.streamRequested(request.Stream, true)
+	recordChatMode(stream)
+	if !stream {
+		s.handleNonStreamingChat(c, chatRequest)
 	} else {
-		s.handleStreamingChat(c, request.Model, request.Messages)
+		s.handleStreamingChat(c, chatRequest)
 	}
 }
 
-func (s *Server) handleNonStreamingChat(c *gin.Context, model string, messages []openai.ChatCompletionMessage) {
-	var response openai.ChatCompletionResponse
-	var fullModelName string
-	var err error
-
-	if s.config.FreeMode {
-		response, fullModelName, err = s.getFreeChatForModel(messages, model)
-		if err != nil {
-			slog.Error("free mode failed", "error", err)
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
-			return
-		}
-	} else {
-		fullModelName, err = s.provider.GetFullModelName(model)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		response, err = s.provider.Chat(messages, fullModelName)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+func (s *Server) handleNonStreamingChat(c *gin.Context, request openai.ChatCompletionRequest) {
+	cacheKey, response, fullModelName, hit := s.lookupResponse(c, request)
+	// 耗时只统计上游请求，缓存查找不计入
+	startTime := time.Now()
+	if !hit {
+		var err error
+		if s.config.FreeMode {
+			response, fullModelName, err = s.getFreeChatForModel(c.Request.Context(), request)
+			if err != nil {
+				slog.Error("free mode failed", "error", err)
+				s.writeFailoverError(c, upstreamErrorStatus(err, http.StatusServiceUnavailable), err)
+				return
+			}
+		} else {
+			fullModelName, err = s.resolveModel(c.Request.Context(), request.Model)
+			if err != nil {
+				writeError(c, http.StatusNotFound, err)
+				return
+			}
+			upstream := request
+			upstream.Model = fullModelName
+			upstreamDone := timePhase(c.Request.Context(), phaseUpstream)
+			response, err = s.provider.CreateChat(upstream)
+			upstreamDone()
+			if err != nil {
+				writeError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
+				return
+			}
 		}
+		s.storeResponse(cacheKey, response, fullModelName)
 	}
 
 	if len(response.Choices) == 0 {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "No response"})
+		writeError(c, http.StatusInternalServerError, errors.New("No response"))
 		return
 	}
 
@@ -372,47 +839,63 @@ func (s *Server) handleNonStreamingChat(c *gin.Context, model string, messages [
 		finishReason = string(response.Choices[0].FinishReason)
 	}
 
-	c.JSON(http.StatusOK, map[string]interface{}{
-		"model":      fullModelName,
-		"created_at": time.Now().Format(time.RFC3339),
-		"message": map[string]string{
-			"role":    "assistant",
-			"content": content,
-		},
+	setGenerationID(c, response.ID)
+	endTime := time.Now()
+	body := map[string]interface{}{
+		"id":                requestID(c),
+		"model":             fullModelName,
+		"created_at":        endTime.Format(time.RFC3339),
+		"message":           assistantMessage(content, reasoningAt(response.Reasoning, 0)),
 		"done":              true,
 		"finish_reason":     finishReason,
-		"total_duration":    response.Usage.TotalTokens * 10,
-		"load_duration":     0,
 		"prompt_eval_count": response.Usage.PromptTokens,
 		"eval_count":        response.Usage.CompletionTokens,
-		"eval_duration":     response.Usage.CompletionTokens * 10,
-	})
+	}
+	// 缓存命中时没有发生生成，不报告耗时
+	if !hit {
+		durations := responseDurations(startTime, endTime)
+		body["total_duration"] = durations.Total
+		body["load_duration"] = 0
+		body["prompt_eval_duration"] = durations.PromptEval
+		body["eval_duration"] = durations.Eval
+	}
+	c.JSON(http.StatusOK, body)
 }
 
-func (s *Server) handleStreamingChat(c *gin.Context, model string, messages []openai.ChatCompletionMessage) {
-	var stream *openai.ChatCompletionStream
+func (s *Server) handleStreamingChat(c *gin.Context, request openai.ChatCompletionRequest) {
+	var stream ChatStream
 	var fullModelName string
 	var err error
 
+	// 请求上游在流末尾附带 usage，用于最终消息的 prompt_eval_count
+	startTime := time.Now()
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
 	if s.config.FreeMode {
-		stream, fullModelName, err = s.getFreeStreamForModel(messages, model)
+		stream, fullModelName, err = s.getFreeStreamForModel(c.Request.Context(), request)
 		if err != nil {
 			slog.Error("free mode failed", "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			s.writeFailoverError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
 			return
 		}
 	} else {
-		fullModelName, err = s.provider.GetFullModelName(model)
+		fullModelName, err = s.resolveModel(c.Request.Context(), request.Model)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			writeError(c, http.StatusNotFound, err)
 			return
 		}
-		stream, err = s.provider.ChatStream(messages, fullModelName)
+		upstream := request
+		upstream.Model = fullModelName
+		upstreamDone := timePhase(c.Request.Context(), phaseUpstream)
+		stream, err = s.provider.CreateChatStream(upstream)
+		upstreamDone()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
 			return
 		}
 	}
+	capture := s.newStreamCapture(c)
+	stream = capture.wrap(s.dedupeChunks(stream, fullModelName))
 	defer stream.Close()
 
 	c.Writer.Header().Set("Content-Type", "application/x-ndjson")
@@ -426,6 +909,10 @@ func (s *Server) handleStreamingChat(c *gin.Context, model string, messages []op
 	}
 
 	var lastFinishReason string
+	var usage *openai.Usage
+	var firstTokenAt time.Time
+	evalCount := 0
+	hadOutput := false
 
 	for {
 		response, err := stream.Recv()
@@ -439,19 +926,35 @@ func (s *Server) handleStreamingChat(c *gin.Context, model string, messages []op
 			flusher.Flush()
 			return
 		}
+		setGenerationID(c, response.ID)
+		capture.add(response)
+		if capture.detachOnDisconnect(stream) {
+			return
+		}
+		if response.Usage != nil {
+			usage = response.Usage
+		}
+		// 只携带 usage 的末尾分块没有 choices
+		if len(response.Choices) == 0 {
+			continue
+		}
 
-		if len(response.Choices) > 0 && response.Choices[0].FinishReason != "" {
+		if response.Choices[0].FinishReason != "" {
 			lastFinishReason = string(response.Choices[0].FinishReason)
 		}
+		hadOutput = hadOutput || chunkHasOutput(response)
+		if response.Choices[0].Delta.Content != "" {
+			if evalCount == 0 {
+				firstTokenAt = time.Now()
+			}
+			evalCount++
+		}
 
 		responseJSON := map[string]interface{}{
 			"model":      fullModelName,
-			"created_at": time.Now().Format(time.RFC3339),
-			"message": map[string]string{
-				"role":    "assistant",
-				"content": response.Choices[0].Delta.Content,
-			},
-			"done": false,
+			"created_at": time.Now().Format(time.RFC3339Nano),
+			"message":    assistantMessage(response.Choices[0].Delta.Content, reasoningAt(response.Reasoning, 0)),
+			"done":       false,
 		}
 
 		jsonData, _ := json.Marshal(responseJSON)
@@ -459,24 +962,37 @@ func (s *Server) handleStreamingChat(c *gin.Context, model string, messages []op
 		flusher.Flush()
 	}
 
+	capture.finish()
 	if lastFinishReason == "" {
 		lastFinishReason = "stop"
 	}
+	lastFinishReason = s.emptyStreamReason(lastFinishReason, hadOutput)
+
+	// 提示词 token 数优先取上游 usage，没有时按字符数估算；
+	// 耗时以首个内容分块为界分为提示词处理和生成两段
+	endTime := time.Now()
+	promptEvalCount := estimatePromptTokens(request.Messages)
+	if usage != nil && usage.PromptTokens > 0 {
+		promptEvalCount = usage.PromptTokens
+	}
+	durations := streamDurations(startTime, firstTokenAt, endTime)
 
 	finalResponse := map[string]interface{}{
+		"id":         requestID(c),
 		"model":      fullModelName,
-		"created_at": time.Now().Format(time.RFC3339),
+		"created_at": endTime.Format(time.RFC3339Nano),
 		"message": map[string]string{
 			"role":    "assistant",
 			"content": "",
 		},
-		"done":              true,
-		"finish_reason":     lastFinishReason,
-		"total_duration":    0,
-		"load_duration":     0,
-		"prompt_eval_count": 0,
-		"eval_count":        0,
-		"eval_duration":     0,
+		"done":                 true,
+		"finish_reason":        lastFinishReason,
+		"total_duration":       durations.Total,
+		"load_duration":        0,
+		"prompt_eval_count":    promptEvalCount,
+		"prompt_eval_duration": durations.PromptEval,
+		"eval_count":           evalCount,
+		"eval_duration":        durations.Eval,
 	}
 
 	finalJsonData, _ := json.Marshal(finalResponse)
@@ -484,43 +1000,125 @@ func (s *Server) handleStreamingChat(c *gin.Context, model string, messages []op
 	flusher.Flush()
 }
 
+// assistantMessage 构造 Ollama 响应中的 assistant 消息，有推理内容时附带 reasoning 字段
+func assistantMessage(content, reasoning string) map[string]string {
+	message := map[string]string{
+		"role":    "assistant",
+		"content": content,
+	}
+	if reasoning != "" {
+		message["reasoning"] = reasoning
+	}
+	return message
+}
+
+// generationIDHeader 携带上游返回的 OpenRouter generation id，可用于之后查询实际费用
+const generationIDHeader = "X-OR-Generation-Id"
+
+// setGenerationID 在响应头尚未写出时设置 generation id；流式响应取第一个分块的 id
+func setGenerationID(c *gin.Context, id string) {
+	if id == "" || c.Writer.Written() {
+		return
+	}
+	c.Header(generationIDHeader, id)
+}
+
+// upstreamRequest 从客户端的 OpenAI 请求中挑选转发给上游的字段
+func upstreamRequest(request openai.ChatCompletionRequest) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model:             request.Model,
+		Messages:          request.Messages,
+		N:                 request.N,
+		ResponseFormat:    request.ResponseFormat,
+		Tools:             request.Tools,
+		ToolChoice:        request.ToolChoice,
+		ParallelToolCalls: request.ParallelToolCalls,
+		StreamOptions:     request.StreamOptions,
+		MaxTokens:         requestMaxTokens(request),
+	}
+}
+
+// requestMaxTokens 返回请求的生成 token 上限。按 OpenAI 规范，新版客户端发送的 max_completion_tokens
+// 优先于已弃用的 max_tokens；上游统一使用 OpenRouter 支持的 max_tokens
+func requestMaxTokens(request openai.ChatCompletionRequest) int {
+	if request.MaxCompletionTokens > 0 {
+		return request.MaxCompletionTokens
+	}
+	return request.MaxTokens
+}
+
 func (s *Server) handleOpenAIChat(c *gin.Context) {
-	var request openai.ChatCompletionRequest
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+	defer s.trackOutcome(c)()
+
+	var body openAIChatRequest
+	if err := c.ShouldBindBodyWith(&body, binding.JSON); err != nil {
+		writeError(c, http.StatusBadRequest, errors.New("Invalid JSON"))
+		return
+	}
+	request := body.ChatCompletionRequest
+	request.ResponseFormat = body.ResponseFormat.toOpenAI()
+
+	// openai.ChatCompletionRequest.Stream 是普通 bool，无法区分缺省与显式 false，需单独解析
+	var streamField struct {
+		Stream *bool `json:"stream"`
+	}
+	if err := c.ShouldBindBodyWith(&streamField, binding.JSON); err != nil {
+		writeError(c, http.StatusBadRequest, errors.New("Invalid JSON"))
+		return
+	}
+
+	messages, err := s.limitMessages(request.Messages)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err)
 		return
 	}
+	request.Messages = messages
 
-	if request.Stream {
+	stream := s.streamRequested(streamField.Stream, false)
+	recordChatMode(stream)
+	if stream {
 		s.handleOpenAIStreaming(c, request)
 	} else {
 		s.handleOpenAINonStreaming(c, request)
 	}
 }
 
-func (s *Server) handleOpenAIStreaming(c *gin.Context, request openai.ChatCompletionRequest) {
-	var stream *openai.ChatCompletionStream
-	var fullModelName string
+// openOpenAIStream 为 /v1/chat/completions 打开上游流，失败时写出错误响应并返回 ok=false
+func (s *Server) openOpenAIStream(c *gin.Context, request openai.ChatCompletionRequest) (stream ChatStream, fullModelName string, ok bool) {
 	var err error
-
 	if s.config.FreeMode {
-		stream, fullModelName, err = s.getFreeStreamForModel(request.Messages, request.Model)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
-			return
-		}
-	} else {
-		fullModelName, err = s.provider.GetFullModelName(request.Model)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
-			return
-		}
-		stream, err = s.provider.ChatStream(request.Messages, fullModelName)
+		stream, fullModelName, err = s.getFreeStreamForModel(c.Request.Context(), upstreamRequest(request))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
-			return
+			s.writeFailoverError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
+			return nil, "", false
 		}
+		return stream, fullModelName, true
+	}
+
+	fullModelName, err = s.resolveModel(c.Request.Context(), request.Model)
+	if err != nil {
+		writeError(c, http.StatusNotFound, err)
+		return nil, "", false
+	}
+	upstream := upstreamRequest(request)
+	upstream.Model = fullModelName
+	upstreamDone := timePhase(c.Request.Context(), phaseUpstream)
+	stream, err = s.provider.CreateChatStream(upstream)
+	upstreamDone()
+	if err != nil {
+		writeError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
+		return nil, "", false
 	}
+	return stream, fullModelName, true
+}
+
+func (s *Server) handleOpenAIStreaming(c *gin.Context, request openai.ChatCompletionRequest) {
+	stream, fullModelName, ok := s.openOpenAIStream(c, request)
+	if !ok {
+		return
+	}
+	capture := s.newStreamCapture(c)
+	stream = capture.wrap(s.dedupeChunks(stream, fullModelName))
 	defer stream.Close()
 
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
@@ -533,9 +1131,17 @@ func (s *Server) handleOpenAIStreaming(c *gin.Context, request openai.ChatComple
 		return
 	}
 
+	includeUsage := request.StreamOptions != nil && request.StreamOptions.IncludeUsage
+	var usage *openai.Usage
+	hadOutput := false
+
 	for {
 		response, err := stream.Recv()
 		if errors.Is(err, io.EOF) {
+			capture.finish()
+			if includeUsage {
+				writeUsageChunk(w, fullModelName, usage)
+			}
 			fmt.Fprintf(w, "data: [DONE]\n\n")
 			flusher.Flush()
 			break
@@ -543,6 +1149,19 @@ func (s *Server) handleOpenAIStreaming(c *gin.Context, request openai.ChatComple
 		if err != nil {
 			break
 		}
+		setGenerationID(c, response.ID)
+		capture.add(response)
+		if capture.detachOnDisconnect(stream) {
+			return
+		}
+
+		if response.Usage != nil {
+			usage = response.Usage
+		}
+		// 请求 include_usage 时上游在最后发送 choices 为空、只带 usage 的分块，统一在 [DONE] 前输出
+		if len(response.Choices) == 0 {
+			continue
+		}
 
 		openaiResponse := openai.ChatCompletionStreamResponse{
 			ID:      "chatcmpl-" + fmt.Sprintf("%d", time.Now().Unix()),
@@ -553,60 +1172,118 @@ func (s *Server) handleOpenAIStreaming(c *gin.Context, request openai.ChatComple
 				{
 					Index: 0,
 					Delta: openai.ChatCompletionStreamChoiceDelta{
-						Content: response.Choices[0].Delta.Content,
+						Content:   response.Choices[0].Delta.Content,
+						ToolCalls: limitToolCallDeltas(request, response.Choices[0].Delta.ToolCalls),
 					},
 				},
 			},
 		}
 
-		if len(response.Choices) > 0 && response.Choices[0].FinishReason != "" {
-			openaiResponse.Choices[0].FinishReason = response.Choices[0].FinishReason
+		hadOutput = hadOutput || chunkHasOutput(response)
+		if reason := response.Choices[0].FinishReason; reason != "" {
+			openaiResponse.Choices[0].FinishReason = openai.FinishReason(s.emptyStreamReason(string(reason), hadOutput))
 		}
 
-		jsonData, _ := json.Marshal(openaiResponse)
+		jsonData := withReasoning(openaiResponse, "delta", []string{reasoningAt(response.Reasoning, 0)})
 		fmt.Fprintf(w, "data: %s\n\n", string(jsonData))
 		flusher.Flush()
 	}
 }
 
 func (s *Server) handleOpenAINonStreaming(c *gin.Context, request openai.ChatCompletionRequest) {
-	var response openai.ChatCompletionResponse
-	var fullModelName string
-	var err error
+	if s.incrementalNonStreaming(request) {
+		s.handleOpenAIIncremental(c, request)
+		return
+	}
 
-	if s.config.FreeMode {
-		response, fullModelName, err = s.getFreeChatForModel(request.Messages, request.Model)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
-			return
-		}
-	} else {
-		fullModelName, err = s.provider.GetFullModelName(request.Model)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": gin.H{"message": err.Error()}})
-			return
-		}
-		response, err = s.provider.Chat(request.Messages, fullModelName)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
-			return
+	cacheKey, response, fullModelName, hit := s.lookupResponse(c, request)
+	if !hit {
+		var err error
+		if s.config.FreeMode {
+			response, fullModelName, err = s.getFreeChatForModel(c.Request.Context(), upstreamRequest(request))
+			if err != nil {
+				s.writeFailoverError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
+				return
+			}
+		} else {
+			fullModelName, err = s.resolveModel(c.Request.Context(), request.Model)
+			if err != nil {
+				writeError(c, http.StatusNotFound, err)
+				return
+			}
+			upstream := upstreamRequest(request)
+			upstream.Model = fullModelName
+			upstreamDone := timePhase(c.Request.Context(), phaseUpstream)
+			response, err = s.provider.CreateChat(upstream)
+			upstreamDone()
+			if err != nil {
+				writeError(c, upstreamErrorStatus(err, http.StatusInternalServerError), err)
+				return
+			}
 		}
+		s.storeResponse(cacheKey, response, fullModelName)
 	}
 
+	// 复制 choices：它可能与响应缓存中的条目共享底层数组
+	response.Choices = append([]openai.ChatCompletionChoice(nil), response.Choices...)
+	response.Choices = normalizeChoices(response.Choices, request.N, fullModelName)
+	limitToolCalls(request, response.Choices)
+
+	setGenerationID(c, response.ID)
 	response.ID = "chatcmpl-" + fmt.Sprintf("%d", time.Now().Unix())
 	response.Object = "chat.completion"
 	response.Created = time.Now().Unix()
 	response.Model = fullModelName
 
-	c.JSON(http.StatusOK, response)
+	c.Data(http.StatusOK, "application/json; charset=utf-8", withReasoning(response.ChatCompletionResponse, "message", response.Reasoning))
+}
+
+// writeUsageChunk 按 OpenAI 规范写出 choices 为空、带 usage 的最终分块。
+// 上游没有返回用量时不写出，避免给客户端全为 0 的统计
+func writeUsageChunk(w io.Writer, model string, usage *openai.Usage) {
+	if usage == nil {
+		slog.Debug("include_usage requested but upstream returned no usage", "model", model)
+		return
+	}
+	jsonData, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+		ID:      "chatcmpl-" + fmt.Sprintf("%d", time.Now().Unix()),
+		Object:  "chat.completion.chunk",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []openai.ChatCompletionStreamChoice{},
+		Usage:   usage,
+	})
+	fmt.Fprintf(w, "data: %s\n\n", jsonData)
+}
+
+// normalizeChoices 按实际返回的 choices 重新编号。上游返回的数量少于请求的 n 时只记录警告，
+// 不补造空 choice；免费模式下实际数量由最终服务的模型决定。
+func normalizeChoices(choices []openai.ChatCompletionChoice, requested int, model string) []openai.ChatCompletionChoice {
+	if requested > 1 && len(choices) < requested {
+		slog.Warn("upstream returned fewer choices than requested",
+			"model", model, "requested", requested, "returned", len(choices))
+	}
+	for i := range choices {
+		choices[i].Index = i
+	}
+	return choices
 }
 
 func (s *Server) handleOpenAIModels(c *gin.Context) {
 	var models []gin.H
 	toolUseOnly := strings.ToLower(os.Getenv("TOOL_USE_ONLY")) == "true"
 
+	// 非免费模式的工具模型列表直接取自 OpenRouter 模型列表，自带参数信息
+	var params map[string][]string
+	if !toolUseOnly || s.config.FreeMode {
+		params = s.supportedParameters()
+	}
+
 	if s.config.FreeMode {
-		for _, freeModel := range s.freeModels {
+		for _, freeModel := range s.freeModelList() {
+			if s.permanentFails.IsDisabled(freeModel) {
+				continue
+			}
 			skip, err := s.failureStore.ShouldSkip(freeModel)
 			if err != nil {
 				continue
@@ -622,12 +1299,7 @@ func (s *Server) handleOpenAIModels(c *gin.Context) {
 				continue
 			}
 
-			models = append(models, gin.H{
-				"id":       displayName,
-				"object":   "model",
-				"created":  time.Now().Unix(),
-				"owned_by": "openrouter",
-			})
+			models = append(models, openAIModelEntry(displayName, params[freeModel]))
 		}
 	} else {
 		if toolUseOnly {
@@ -638,26 +1310,32 @@ func (s *Server) handleOpenAIModels(c *gin.Context) {
 		} else {
 			providerModels, err := s.provider.GetModels()
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+				writeError(c, http.StatusInternalServerError, err)
 				return
 			}
 
 			for _, m := range providerModels {
-				if len(s.modelFilter) > 0 {
-					if _, ok := s.modelFilter[m.Model]; !ok {
-						continue
-					}
+				if !s.isModelInFilter(m.Model) {
+					continue
 				}
-				models = append(models, gin.H{
-					"id":       m.Model,
-					"object":   "model",
-					"created":  time.Now().Unix(),
-					"owned_by": "openrouter",
-				})
+				models = append(models, openAIModelEntry(m.Model, params[m.ID]))
 			}
 		}
 	}
 
+	ids := make([]string, len(models))
+	for i, m := range models {
+		ids[i], _ = m["id"].(string)
+	}
+	for _, alias := range s.aliasListing(ids) {
+		entry := make(gin.H, len(models[alias.index]))
+		for k, v := range models[alias.index] {
+			entry[k] = v
+		}
+		entry["id"] = alias.name
+		models = append(models, entry)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"object": "list",
 		"data":   models,
@@ -665,28 +1343,28 @@ func (s *Server) handleOpenAIModels(c *gin.Context) {
 }
 
 func (s *Server) fetchOpenAIToolUseModels(c *gin.Context) []gin.H {
-	req, err := http.NewRequest("GET", "https://openrouter.ai/api/v1/models", nil)
+	req, err := http.NewRequest("GET", s.modelsURL(), nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		writeError(c, http.StatusInternalServerError, err)
 		return nil
 	}
 	req.Header.Set("Authorization", "Bearer "+s.config.APIKey)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.upstreamClient().Do(req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		writeError(c, http.StatusInternalServerError, err)
 		return nil
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": "Failed to fetch models"}})
+		writeError(c, http.StatusInternalServerError, errors.New("Failed to fetch models"))
 		return nil
 	}
 
 	var result orModels
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error()}})
+		writeError(c, http.StatusInternalServerError, err)
 		return nil
 	}
 
@@ -703,155 +1381,202 @@ func (s *Server) fetchOpenAIToolUseModels(c *gin.Context) []gin.H {
 			continue
 		}
 
-		models = append(models, gin.H{
-			"id":       displayName,
-			"object":   "model",
-			"created":  time.Now().Unix(),
-			"owned_by": "openrouter",
-		})
+		models = append(models, openAIModelEntry(displayName, m.SupportedParameters))
 	}
 	return models
 }
 
-func (s *Server) getFreeChatForModel(msgs []openai.ChatCompletionMessage, requestedModel string) (openai.ChatCompletionResponse, string, error) {
-	fullModelName := s.resolveDisplayNameToFullModel(requestedModel)
-	if fullModelName != requestedModel || s.contains(s.freeModels, fullModelName) {
-		skip, err := s.failureStore.ShouldSkip(fullModelName)
-		if err == nil && !skip {
-			resp, err := s.provider.Chat(msgs, fullModelName)
-			if err == nil {
-				s.failureStore.ClearFailure(fullModelName)
-				return resp, fullModelName, nil
-			}
-			s.failureStore.MarkFailure(fullModelName)
-		}
+// openAIModelEntry 构造 /v1/models 中的一条模型记录。supported_parameters 是 OpenRouter 的扩展字段，
+// 列出模型支持的请求参数（tools、response_format、seed 等），未知时省略
+func openAIModelEntry(id string, params []string) gin.H {
+	entry := gin.H{
+		"id":       id,
+		"object":   "model",
+		"created":  time.Now().Unix(),
+		"owned_by": "openrouter",
 	}
-	return s.getFreeChat(msgs)
+	if params != nil {
+		entry["supported_parameters"] = params
+	}
+	return entry
 }
 
-func (s *Server) getFreeStreamForModel(msgs []openai.ChatCompletionMessage, requestedModel string) (*openai.ChatCompletionStream, string, error) {
-	fullModelName := s.resolveDisplayNameToFullModel(requestedModel)
-	if fullModelName != requestedModel || s.contains(s.freeModels, fullModelName) {
-		skip, err := s.failureStore.ShouldSkip(fullModelName)
-		if err == nil && !skip {
-			stream, err := s.provider.ChatStream(msgs, fullModelName)
-			if err == nil {
-				s.failureStore.ClearFailure(fullModelName)
-				return stream, fullModelName, nil
-			}
-			s.failureStore.MarkFailure(fullModelName)
+// supportedParameters 从缓存的 OpenRouter 模型元数据中取出各模型（以完整 ID 为键）支持的参数。
+// 这只是 /v1/models 的附加信息，获取失败时返回 nil，列表照常返回
+func (s *Server) supportedParameters() map[string][]string {
+	models, err := s.provider.cachedModelMetadata()
+	if err != nil {
+		slog.Warn("failed to fetch supported parameters", "error", err)
+		return nil
+	}
+	params := make(map[string][]string, len(models))
+	for _, m := range models {
+		if m.SupportedParameters != nil {
+			params[m.ID] = m.SupportedParameters
 		}
 	}
-	return s.getFreeStream(msgs)
+	return params
 }
 
-func (s *Server) getFreeChat(msgs []openai.ChatCompletionMessage) (openai.ChatCompletionResponse, string, error) {
-	var resp openai.ChatCompletionResponse
-	var lastError error
-
-	for _, m := range s.freeModels {
-		if s.permanentFails.IsPermanentlyFailed(m) {
-			continue
+// getFreeChatForModel 优先使用 req.Model 指定的免费模型，失败时故障转移到其他免费模型；
+// req.Model 为 DirectPaidModels 中的完整 ID 时直接请求该付费模型
+func (s *Server) getFreeChatForModel(ctx context.Context, req openai.ChatCompletionRequest) (ChatResponse, string, error) {
+	if paid, ok := s.directPaidModel(req.Model); ok {
+		req.Model = paid
+		start := time.Now()
+		resp, err := s.provider.CreateChat(req)
+		addTiming(ctx, phaseUpstream, time.Since(start))
+		return resp, paid, err
+	}
+	snap := s.modelSnapshotFrom(ctx)
+	ctx = withAttemptGrace(withModelSnapshot(ctx, snap))
+	fullModelName, ok := s.preferredFreeModel(snap, req.Model, estimatePromptTokens(req.Messages))
+	pinned := s.pinnedModel(snap, fullModelName)
+	if pinned && !ok {
+		return ChatResponse{}, fullModelName, pinnedUnavailableError(fullModelName)
+	}
+	var resp ChatResponse
+	var preferredErr error
+	if ok {
+		req.Model = fullModelName
+		acquired, err := s.attemptModel(ctx, fullModelName, s.chatAttempt(ctx, req, &resp))
+		if !acquired {
+			return ChatResponse{}, fullModelName, err
 		}
-
-		parts := strings.Split(m, "/")
-		displayName := parts[len(parts)-1]
-		if !s.isModelInFilter(displayName) {
-			continue
+		if err == nil {
+			return resp, fullModelName, nil
 		}
-
-		skip, err := s.failureStore.ShouldSkip(m)
-		if err != nil || skip {
-			continue
+		if pinned {
+			return ChatResponse{}, fullModelName, withPreferredFailure(fullModelName, err, nil)
 		}
+		preferredErr = err
+	}
+	resp, model, err := s.getFreeChat(ctx, req)
+	if err != nil {
+		err = withPreferredFailure(fullModelName, preferredErr, err)
+	}
+	return resp, model, err
+}
 
-		limiter := s.globalLimiter.GetLimiter(m)
-		limiter.Wait()
-		s.globalLimiter.WaitGlobal()
-
-		resp, err = s.provider.Chat(msgs, m)
-		if err != nil {
-			lastError = err
-			limiter.RecordFailure(err)
-
-			if isPermanentError(err) {
-				s.permanentFails.MarkPermanentFailure(m)
-			} else if isRateLimitError(err) {
-				s.failureStore.MarkFailureWithType(m, "rate_limit")
-				time.Sleep(500 * time.Millisecond)
-			} else {
-				s.failureStore.MarkFailure(m)
-			}
-			continue
+// getFreeStreamForModel 是 getFreeChatForModel 的流式版本
+func (s *Server) getFreeStreamForModel(ctx context.Context, req openai.ChatCompletionRequest) (ChatStream, string, error) {
+	if paid, ok := s.directPaidModel(req.Model); ok {
+		req.Model = paid
+		start := time.Now()
+		stream, err := s.provider.CreateChatStream(req)
+		addTiming(ctx, phaseUpstream, time.Since(start))
+		return stream, paid, err
+	}
+	snap := s.modelSnapshotFrom(ctx)
+	ctx = withAttemptGrace(withModelSnapshot(ctx, snap))
+	fullModelName, ok := s.preferredFreeModel(snap, req.Model, estimatePromptTokens(req.Messages))
+	pinned := s.pinnedModel(snap, fullModelName)
+	if pinned && !ok {
+		return nil, fullModelName, pinnedUnavailableError(fullModelName)
+	}
+	var stream ChatStream
+	var preferredErr error
+	if ok {
+		req.Model = fullModelName
+		acquired, err := s.attemptModel(ctx, fullModelName, s.streamAttempt(ctx, req, &stream))
+		if !acquired {
+			return nil, fullModelName, err
 		}
-
-		limiter.RecordSuccess()
-		s.failureStore.ClearFailure(m)
-		return resp, m, nil
+		if err == nil {
+			return stream, fullModelName, nil
+		}
+		if pinned {
+			return nil, fullModelName, withPreferredFailure(fullModelName, err, nil)
+		}
+		preferredErr = err
 	}
-
-	if lastError != nil {
-		return resp, "", fmt.Errorf("all models failed: %w", lastError)
+	stream, model, err := s.getFreeStream(ctx, req)
+	if err != nil {
+		err = withPreferredFailure(fullModelName, preferredErr, err)
 	}
-	return resp, "", fmt.Errorf("no free models available")
+	return stream, model, err
 }
 
-func (s *Server) getFreeStream(msgs []openai.ChatCompletionMessage) (*openai.ChatCompletionStream, string, error) {
-	var lastError error
+// getFreeChat 依次尝试免费模型，req.Model 会被替换为实际尝试的模型。
+// 请求的第一次尝试（含首选模型）的超时额外延长 FirstAttemptGrace
+func (s *Server) getFreeChat(ctx context.Context, req openai.ChatCompletionRequest) (ChatResponse, string, error) {
+	ctx = withAttemptGrace(ctx)
+	var resp ChatResponse
+	model, err := s.tryFreeModels(ctx, estimatePromptTokens(req.Messages), s.chatAttempt(ctx, req, &resp))
+	return resp, model, err
+}
 
-	for _, m := range s.freeModels {
-		if s.permanentFails.IsPermanentlyFailed(m) {
-			continue
-		}
+func (s *Server) getFreeStream(ctx context.Context, req openai.ChatCompletionRequest) (ChatStream, string, error) {
+	ctx = withAttemptGrace(ctx)
+	var stream ChatStream
+	model, err := s.tryFreeModels(ctx, estimatePromptTokens(req.Messages), s.streamAttempt(ctx, req, &stream))
+	return stream, model, err
+}
 
-		parts := strings.Split(m, "/")
-		displayName := parts[len(parts)-1]
-		if !s.isModelInFilter(displayName) {
-			continue
+// chatAttempt 返回对单个模型发起非流式请求的 attempt，成功的响应写入 resp；
+// 调用方须已占用该模型的并发槽位，attempt 返回前释放
+func (s *Server) chatAttempt(ctx context.Context, req openai.ChatCompletionRequest, resp *ChatResponse) func(string) error {
+	return func(m string) error {
+		defer s.globalLimiter.Release(m)
+		attempt := req
+		attempt.Model = m
+		var err error
+		*resp, err = s.provider.CreateChatWithGrace(ctx, attempt, s.takeAttemptGrace(ctx))
+		if err != nil {
+			return err
 		}
+		return s.checkToolCallMismatch(attempt, *resp)
+	}
+}
 
-		skip, err := s.failureStore.ShouldSkip(m)
-		if err != nil || skip {
-			continue
+// streamAttempt 是 chatAttempt 的流式版本，打开的流写入 stream，并发槽位在流关闭时释放
+func (s *Server) streamAttempt(ctx context.Context, req openai.ChatCompletionRequest, stream *ChatStream) func(string) error {
+	return func(m string) error {
+		attempt := req
+		attempt.Model = m
+		var err error
+		*stream, err = s.openSlotStream(attempt, s.takeAttemptGrace(ctx))
+		if err != nil {
+			return err
 		}
-
-		limiter := s.globalLimiter.GetLimiter(m)
-		limiter.Wait()
-		s.globalLimiter.WaitGlobal()
-
-		stream, err := s.provider.ChatStream(msgs, m)
+		*stream, err = s.guardStream(attempt, *stream)
 		if err != nil {
-			lastError = err
-			limiter.RecordFailure(err)
-
-			if isPermanentError(err) {
-				s.permanentFails.MarkPermanentFailure(m)
-			} else if isRateLimitError(err) {
-				s.failureStore.MarkFailureWithType(m, "rate_limit")
-				time.Sleep(500 * time.Millisecond)
-			} else {
-				s.failureStore.MarkFailure(m)
-			}
-			continue
+			return err
 		}
-
-		limiter.RecordSuccess()
-		s.failureStore.ClearFailure(m)
-		return stream, m, nil
+		*stream, err = s.guardEmptyStream(attempt, *stream)
+		return err
 	}
+}
 
-	if lastError != nil {
-		return nil, "", fmt.Errorf("all models failed: %w", lastError)
+// openSlotStream 打开上游流（流式超时额外延长 grace），并在流关闭时才释放调用方已为 req.Model 占用的并发槽位
+func (s *Server) openSlotStream(req openai.ChatCompletionRequest, grace time.Duration) (ChatStream, error) {
+	model := req.Model
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			s.globalLimiter.Release(model)
+		}
+	}()
+
+	stream, err := s.provider.CreateChatStreamWithGrace(req, grace)
+	if err != nil {
+		return nil, err
 	}
-	return nil, "", fmt.Errorf("no free models available")
+
+	handedOff = true
+	return &closingStream{
+		ChatStream: stream,
+		cleanup:    func() { s.globalLimiter.Release(model) },
+	}, nil
 }
 
 func (s *Server) resolveDisplayNameToFullModel(displayName string) string {
-	for _, fullModel := range s.freeModels {
+	displayName = s.resolveAlias(displayName)
+	for _, fullModel := range s.freeModelList() {
 		parts := strings.Split(fullModel, "/")
 		modelDisplayName := parts[len(parts)-1]
-		if modelDisplayName == displayName {
-			if !s.isModelInFilter(displayName) {
+		if sameModelName(modelDisplayName, displayName, s.config.CaseInsensitiveModels) {
+			if !s.isModelInFilter(modelDisplayName) {
 				continue
 			}
 			return fullModel
@@ -868,104 +1593,3 @@ func (s *Server) contains(slice []string, item string) bool {
 	}
 	return false
 }
-
-func (s *Server) ensureFreeModelFile(apiKey, path string) ([]string, error) {
-	cacheTTL := 24 * time.Hour
-	if ttlStr := os.Getenv("CACHE_TTL_HOURS"); ttlStr != "" {
-		if hours, err := time.ParseDuration(ttlStr + "h"); err == nil {
-			cacheTTL = hours
-		}
-	}
-
-	if stat, err := os.Stat(path); err == nil {
-		if time.Since(stat.ModTime()) < cacheTTL {
-			data, err := os.ReadFile(path)
-			if err != nil {
-				return nil, err
-			}
-			var models []string
-			for _, line := range strings.Split(string(data), "\n") {
-				line = strings.TrimSpace(line)
-				if line != "" {
-					models = append(models, line)
-				}
-			}
-			return models, nil
-		}
-	}
-
-	models, err := s.fetchFreeModels(apiKey)
-	if err != nil {
-		if _, statErr := os.Stat(path); statErr == nil {
-			data, readErr := os.ReadFile(path)
-			if readErr == nil {
-				var cachedModels []string
-				for _, line := range strings.Split(string(data), "\n") {
-					line = strings.TrimSpace(line)
-					if line != "" {
-						cachedModels = append(cachedModels, line)
-					}
-				}
-				return cachedModels, nil
-			}
-		}
-		return nil, err
-	}
-
-	_ = os.WriteFile(path, []byte(strings.Join(models, "\n")), 0644)
-	return models, nil
-}
-
-func (s *Server) fetchFreeModels(apiKey string) ([]string, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	req, err := http.NewRequest("GET", "https://openrouter.ai/api/v1/models", nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
-	}
-
-	var result orModels
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
-	}
-
-	toolUseOnly := strings.ToLower(os.Getenv("TOOL_USE_ONLY")) == "true"
-
-	type item struct {
-		id  string
-		ctx int
-	}
-	var items []item
-	for _, m := range result.Data {
-		if m.Pricing.Prompt == "0" && m.Pricing.Completion == "0" {
-			if toolUseOnly && !supportsToolUse(m.SupportedParameters) {
-				continue
-			}
-
-			ctx := m.TopProvider.ContextLength
-			if ctx == 0 {
-				ctx = m.ContextLength
-			}
-			items = append(items, item{id: m.ID, ctx: ctx})
-		}
-	}
-	sort.Slice(items, func(i, j int) bool { return items[i].ctx > items[j].ctx })
-	models := make([]string, len(items))
-	for i, it := range items {
-		models[i] = it.id
-	}
-	return models, nil
-}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestDefaultStreamAppliesToBothEndpoints(t *testing.T) {
+	boolPtr := func(b bool) *bool { return &b }
+
+	tests := []struct {
+		name          string
+		defaultStream *bool
+		wantOllama    bool
+		wantOpenAI    bool
+	}{
+		{"protocol defaults", nil, true, false},
+		{"configured stream", boolPtr(true), true, true},
+		{"configured non-stream", boolPtr(false), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			s := newTestServer(t, Config{DefaultStream: tt.defaultStream}, upstream)
+			r := s.buildRouter()
+
+			body := `{"model":"model-a","messages":[{"role":"user","content":"hi"}]}`
+
+			w := doJSON(t, r, http.MethodPost, "/api/chat", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("/api/chat status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if got := strings.Contains(w.Header().Get("Content-Type"), "ndjson"); got != tt.wantOllama {
+				t.Errorf("/api/chat streamed = %v, want %v", got, tt.wantOllama)
+			}
+
+			w = doJSON(t, r, http.MethodPost, "/v1/chat/completions", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("/v1/chat/completions status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if got := strings.Contains(w.Header().Get("Content-Type"), "event-stream"); got != tt.wantOpenAI {
+				t.Errorf("/v1/chat/completions streamed = %v, want %v", got, tt.wantOpenAI)
+			}
+		})
+	}
+}
+
+func TestOpenAIFewerChoicesThanRequested(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		// 上游只返回 2 个 choice，且 index 不连续
+		w.Write([]byte(`{"id":"gen-1","object":"chat.completion","model":"org/model-a","choices":[
+			{"index":3,"message":{"role":"assistant","content":"one"},"finish_reason":"stop"},
+			{"index":7,"message":{"role":"assistant","content":"two"},"finish_reason":"stop"}]}`))
+	}
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions",
+		`{"model":"model-a","n":3,"messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	if n, _ := upstream.lastRequest(t)["n"].(float64); n != 3 {
+		t.Errorf("upstream n = %v, want 3", n)
+	}
+
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Choices) != 2 {
+		t.Fatalf("choices = %d, want the 2 actually produced", len(resp.Choices))
+	}
+	for i, c := range resp.Choices {
+		if c.Index != i {
+			t.Errorf("choice %d index = %d, want %d", i, c.Index, i)
+		}
+	}
+}
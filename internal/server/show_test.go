@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestShowModelReturnsRealMetadata(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{
+		ID:                  "org/model-a",
+		ContextLength:       131072,
+		SupportedParameters: []string{"tools", "temperature"},
+		Prompt:              "0.000001",
+		Completion:          "0.000002",
+	})
+	s := newTestServer(t, Config{}, upstream)
+
+	for _, name := range []string{"org/model-a", "model-a"} {
+		w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/show", `{"name":"`+name+`"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body = %s", name, w.Code, w.Body.String())
+		}
+
+		var resp struct {
+			Details struct {
+				Family string `json:"family"`
+			} `json:"details"`
+			ModelInfo struct {
+				ContextLength       int               `json:"context_length"`
+				SupportedParameters []string          `json:"supported_parameters"`
+				Pricing             map[string]string `json:"pricing"`
+			} `json:"model_info"`
+			Capabilities []string `json:"capabilities"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: invalid response: %v", name, err)
+		}
+		if resp.ModelInfo.ContextLength != 131072 {
+			t.Errorf("%s: context_length = %d, want 131072", name, resp.ModelInfo.ContextLength)
+		}
+		if len(resp.ModelInfo.SupportedParameters) != 2 {
+			t.Errorf("%s: supported_parameters = %v", name, resp.ModelInfo.SupportedParameters)
+		}
+		if resp.ModelInfo.Pricing["prompt"] != "0.000001" || resp.ModelInfo.Pricing["completion"] != "0.000002" {
+			t.Errorf("%s: pricing = %v", name, resp.ModelInfo.Pricing)
+		}
+		if resp.Details.Family != "org" {
+			t.Errorf("%s: family = %q, want org", name, resp.Details.Family)
+		}
+		if len(resp.Capabilities) != 2 || resp.Capabilities[1] != "tools" {
+			t.Errorf("%s: capabilities = %v, want [completion tools]", name, resp.Capabilities)
+		}
+	}
+}
+
+func TestShowModelUnknownReturns404(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/show", `{"name":"missing"}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404; body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestShowModelResolvesAliasesAndCase(t *testing.T) {
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "org/model-a", ContextLength: 8192},
+		fakeModel{ID: "org/model-b", ContextLength: 32768},
+	)
+	s := newTestServer(t, Config{
+		CaseInsensitiveModels: true,
+		Aliases:               map[string]string{"gpt-4": "org/model-b"},
+	}, upstream)
+
+	for name, want := range map[string]int{"gpt-4": 32768, "GPT-4": 32768, "Model-A": 8192, "ORG/MODEL-B": 32768} {
+		w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/show", `{"name":"`+name+`"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body = %s", name, w.Code, w.Body.String())
+		}
+		var resp struct {
+			ModelInfo struct {
+				ContextLength int `json:"context_length"`
+			} `json:"model_info"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: invalid response: %v", name, err)
+		}
+		if resp.ModelInfo.ContextLength != want {
+			t.Errorf("%s: context_length = %d, want %d", name, resp.ModelInfo.ContextLength, want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"strings"
+)
+
+// modelSnapshot 是请求开始时的模型过滤器和免费模型列表。过滤器热重载或模型列表刷新
+// 只影响之后的请求，同一个请求的首选模型解析和故障转移始终看到一致的候选集合
+type modelSnapshot struct {
+	filter *ModelFilter
+	// free 为免费模型列表，candidates 为免费模型加付费备选的故障转移顺序
+	free       []string
+	candidates []string
+	// preferFree 为 true 时，请求的基础模型名会解析为对应的 :free 变体
+	preferFree bool
+	// ignoreCase 为 true 时解析模型名忽略大小写
+	ignoreCase bool
+	// aliases 为模型别名表，解析前先把别名替换为目标模型名
+	aliases map[string]string
+}
+
+// modelSnapshotKey 是 modelSnapshot 在请求 context 中的键
+type modelSnapshotKey struct{}
+
+// takeModelSnapshot 记录当前的过滤器和模型列表，以及 ctx 对应请求是否优先免费变体
+func (s *Server) takeModelSnapshot(ctx context.Context) *modelSnapshot {
+	return &modelSnapshot{
+		filter:     s.currentModelFilter(),
+		free:       s.freeModelList(),
+		candidates: s.failoverCandidates(),
+		preferFree: s.preferFreeVariant(ctx),
+		ignoreCase: s.config.CaseInsensitiveModels,
+		aliases:    s.config.Aliases,
+	}
+}
+
+// withModelSnapshot 把 snap 附加到 ctx，之后的故障转移使用同一份快照
+func withModelSnapshot(ctx context.Context, snap *modelSnapshot) context.Context {
+	return context.WithValue(ctx, modelSnapshotKey{}, snap)
+}
+
+// modelSnapshotFrom 返回 ctx 中的快照，没有时记录一份新的
+func (s *Server) modelSnapshotFrom(ctx context.Context) *modelSnapshot {
+	if snap, ok := ctx.Value(modelSnapshotKey{}).(*modelSnapshot); ok {
+		return snap
+	}
+	return s.takeModelSnapshot(ctx)
+}
+
+// inFilter 判断显示名是否通过快照中的过滤器
+func (snap *modelSnapshot) inFilter(displayName string) bool {
+	return snap.filter.Match(displayName)
+}
+
+// resolve 把显示名解析为快照中通过过滤器的免费模型完整 ID；优先免费变体时，
+// 基础模型名（显示名或完整 ID）会解析为对应的 :free 变体。别名先替换为目标模型名。
+// 找不到时返回替换别名后的模型名
+func (snap *modelSnapshot) resolve(displayName string) string {
+	if target, ok := lookupAlias(snap.aliases, displayName); ok {
+		displayName = target
+	}
+	names := []string{displayName}
+	if snap.preferFree && !strings.HasSuffix(displayName, freeVariantSuffix) {
+		names = append(names, displayName+freeVariantSuffix)
+	}
+	for _, name := range names {
+		for _, fullModel := range snap.free {
+			parts := strings.Split(fullModel, "/")
+			shortName := parts[len(parts)-1]
+			matched := sameModelName(shortName, name, snap.ignoreCase) || sameModelName(fullModel, name, snap.ignoreCase)
+			if matched && snap.inFilter(shortName) {
+				return fullModel
+			}
+		}
+	}
+	return displayName
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFilterReloadDuringFailoverKeepsSnapshot(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	var s *Server
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		if body["model"] == "org/model-a:free" {
+			// 首个模型失败时过滤器被改为只保留 model-a
+			if err := os.WriteFile(s.config.FilterPath, []byte("model-a:free\n"), 0644); err != nil {
+				t.Error(err)
+			}
+			s.loadModelFilter()
+			writeUpstreamError(w, http.StatusInternalServerError, "upstream exploded")
+			return
+		}
+		writeChatCompletion(w, body["model"].(string), "from b")
+	}
+	s = newTestServer(t, Config{FreeMode: true}, upstream, "org/model-a:free", "org/model-b:free")
+	r := s.buildRouter()
+
+	body := `{"model":"model-a:free","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, r, http.MethodPost, "/api/chat", body)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "from b") {
+		t.Fatalf("status = %d, body = %s; want failover to model-b from the request's snapshot", w.Code, w.Body.String())
+	}
+	if got := upstream.requestedModels(); strings.Join(got, ",") != "org/model-a:free,org/model-b:free" {
+		t.Errorf("requested models = %v", got)
+	}
+
+	// 之后的请求使用重新加载的过滤器
+	_, skipped := s.freeModelPlan(context.Background(), "model-a:free", 0)
+	found := false
+	for _, sk := range skipped {
+		if sk.Model == "org/model-b:free" && sk.Reason == skipFiltered {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("skipped after reload = %+v, want model-b filtered", skipped)
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stats 是免费模式失败状态和全局限流的汇总，供 status 命令判断免费额度是否耗尽
+type Stats struct {
+	// FreeModels 为当前免费模型列表中的模型数
+	FreeModels int `json:"free_models"`
+	// SkippedModels 为 failures.db 中仍处于冷却期的模型数
+	SkippedModels int `json:"skipped_models"`
+	// UnavailableModels 为免费模型列表中当前被跳过的模型数（冷却、永久失败或自动停用），
+	// 同一模型只计一次
+	UnavailableModels int `json:"unavailable_models"`
+	// PermanentFailures 和 TemporaryFailures 为内存中有效的永久/临时失败标记数
+	PermanentFailures int `json:"permanent_failures"`
+	TemporaryFailures int `json:"temporary_failures"`
+	// LastRequest 为最近一次通过全局限流的时间，尚无请求时省略
+	LastRequest *time.Time `json:"last_request,omitempty"`
+}
+
+// GetStats 汇总当前的失败和限流状态；非免费模式下失败相关计数均为 0
+func (s *Server) GetStats() (Stats, error) {
+	stats := Stats{FreeModels: len(s.freeModelList())}
+
+	if s.failureStore != nil {
+		records, err := s.failureStore.ListFailures()
+		if err != nil {
+			return Stats{}, err
+		}
+		for _, r := range records {
+			if r.Active() {
+				stats.SkippedModels++
+			}
+		}
+	}
+	stats.UnavailableModels = s.skippedFreeModels()
+	if s.permanentFails != nil {
+		stats.PermanentFailures, stats.TemporaryFailures = s.permanentFails.GetStats()
+	}
+	if last := s.globalLimiter.LastGlobal(); !last.IsZero() {
+		stats.LastRequest = &last
+	}
+	return stats, nil
+}
+
+// handleAdminStats 返回 GetStats 的结果
+func (s *Server) handleAdminStats(c *gin.Context) {
+	stats, err := s.GetStats()
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
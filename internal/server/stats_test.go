@@ -0,0 +1,41 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestAdminStatsEndpoint(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/a:free"}, fakeModel{ID: "org/b:free"}, fakeModel{ID: "org/c:free"})
+	s := newTestServer(t, Config{FreeMode: true, AdminEnabled: true}, upstream, "org/a:free", "org/b:free", "org/c:free")
+	s.failureStore.MarkFailureWithType("org/a:free", "rate_limit")
+	s.failureStore.MarkFailureWithType("org/b:free", "rate_limit")
+	s.permanentFails.MarkPermanentFailure("org/c:free")
+	s.permanentFails.MarkTemporaryFailure("org/b:free")
+	// c 同时处于冷却和永久失败，不可用模型数只计一次
+	s.failureStore.MarkFailure("org/c:free")
+
+	r := s.buildRouter()
+	w := doJSON(t, r, http.MethodGet, "/api/admin/stats", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var stats Stats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	want := Stats{FreeModels: 3, SkippedModels: 3, UnavailableModels: 3, PermanentFailures: 1, TemporaryFailures: 1}
+	if stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	s.globalLimiter.WaitGlobal()
+	stats, err := s.GetStats()
+	if err != nil {
+		t.Fatalf("GetStats() error = %v", err)
+	}
+	if stats.LastRequest == nil {
+		t.Error("LastRequest not set after a request passed the global limiter")
+	}
+}
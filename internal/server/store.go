@@ -8,6 +8,9 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// FailureDBName 是配置目录下失败记录数据库的文件名
+const FailureDBName = "failures.db"
+
 type FailureStore struct {
 	db                *sql.DB
 	defaultCooldown   time.Duration
@@ -15,7 +18,8 @@ type FailureStore struct {
 }
 
 func NewFailureStore(path string) (*FailureStore, error) {
-	db, err := sql.Open("sqlite", path)
+	// 并发写入时等待锁释放而不是立即返回 SQLITE_BUSY
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, err
 	}
@@ -30,6 +34,73 @@ func NewFailureStore(path string) (*FailureStore, error) {
 		return nil, err
 	}
 
+	if _, err = db.Exec(`CREATE TABLE IF NOT EXISTS model_latency (
+		model TEXT PRIMARY KEY,
+		avg_ms REAL,
+		updated_at INTEGER
+	)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err = db.Exec(`CREATE TABLE IF NOT EXISTS model_success_rates (
+		model TEXT PRIMARY KEY,
+		rate REAL,
+		updated_at INTEGER
+	)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err = db.Exec(`CREATE TABLE IF NOT EXISTS client_usage (
+		client TEXT PRIMARY KEY,
+		window_start INTEGER,
+		requests INTEGER DEFAULT 0,
+		tokens INTEGER DEFAULT 0
+	)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err = db.Exec(`CREATE TABLE IF NOT EXISTS models (
+		id TEXT PRIMARY KEY,
+		position INTEGER,
+		context_length INTEGER,
+		supports_tools INTEGER,
+		prompt_price TEXT,
+		completion_price TEXT,
+		fetched_at INTEGER
+	)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err = db.Exec(`CREATE TABLE IF NOT EXISTS model_outcomes (
+		model TEXT PRIMARY KEY,
+		attempts INTEGER DEFAULT 0,
+		failures INTEGER DEFAULT 0,
+		disabled_until INTEGER DEFAULT 0
+	)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err = db.Exec(`CREATE TABLE IF NOT EXISTS permanent_failures (
+		model TEXT PRIMARY KEY,
+		failed_at INTEGER
+	)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err = db.Exec(`CREATE TABLE IF NOT EXISTS cooldown_overrides (
+		model TEXT PRIMARY KEY,
+		minutes INTEGER
+	)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	defaultCooldown := 5 * time.Minute
 	if cd := os.Getenv("FAILURE_COOLDOWN_MINUTES"); cd != "" {
 		if minutes, err := time.ParseDuration(cd + "m"); err == nil {
@@ -58,6 +129,7 @@ func (s *FailureStore) MarkFailure(model string) error {
 }
 
 func (s *FailureStore) MarkFailureWithType(model string, failureType string) error {
+	modelFailuresMarkedTotal.inc(failureType)
 	_, err := s.db.Exec(`
 		INSERT INTO failures(model, failed_at, failure_type, failure_count) 
 		VALUES(?, ?, ?, 1) 
@@ -81,20 +153,99 @@ func (s *FailureStore) ShouldSkip(model string) (bool, error) {
 		return false, err
 	}
 
-	var cooldown time.Duration
+	cooldown := s.cooldown(failureType, failureCount)
+	if override, ok, err := s.CooldownOverride(model); err != nil {
+		return false, err
+	} else if ok {
+		cooldown = override
+	}
+	return time.Since(time.Unix(ts, 0)) < cooldown, nil
+}
+
+// SetCooldownOverride 为模型设置固定的冷却时长，替代按失败类型和次数计算的冷却时间；
+// minutes 为 0 时删除覆盖
+func (s *FailureStore) SetCooldownOverride(model string, minutes int) error {
+	if minutes == 0 {
+		_, err := s.db.Exec(`DELETE FROM cooldown_overrides WHERE model=?`, model)
+		return err
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO cooldown_overrides(model, minutes) VALUES(?, ?)
+		ON CONFLICT(model) DO UPDATE SET minutes=excluded.minutes
+	`, model, minutes)
+	return err
+}
+
+// CooldownOverride 返回模型的冷却时长覆盖，未设置时 ok 为 false
+func (s *FailureStore) CooldownOverride(model string) (cooldown time.Duration, ok bool, err error) {
+	var minutes int
+	err = s.db.QueryRow(`SELECT minutes FROM cooldown_overrides WHERE model=?`, model).Scan(&minutes)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return time.Duration(minutes) * time.Minute, true, nil
+}
+
+// cooldown 返回某类失败的冷却时长，普通失败按连续失败次数递增（最多 5 倍）
+func (s *FailureStore) cooldown(failureType string, failureCount int) time.Duration {
 	if failureType == "rate_limit" {
-		cooldown = s.rateLimitCooldown
-	} else {
-		cooldown = s.defaultCooldown
-		if failureCount > 1 {
-			cooldown = cooldown * time.Duration(min(failureCount, 5))
-		}
+		return s.rateLimitCooldown
+	}
+	cooldown := s.defaultCooldown
+	if failureCount > 1 {
+		cooldown = cooldown * time.Duration(min(failureCount, 5))
+	}
+	return cooldown
+}
+
+// FailureRecord 是 failures 表中的一条记录及其剩余冷却时间
+type FailureRecord struct {
+	Model     string
+	Type      string
+	Count     int
+	FailedAt  time.Time
+	Remaining time.Duration
+}
+
+// Active 判断模型是否仍处于冷却期
+func (r FailureRecord) Active() bool {
+	return r.Remaining > 0
+}
+
+// ListFailures 返回所有失败记录，按最近失败时间倒序
+func (s *FailureStore) ListFailures() ([]FailureRecord, error) {
+	rows, err := s.db.Query(`
+		SELECT f.model, f.failed_at, f.failure_type, f.failure_count, COALESCE(o.minutes, 0)
+		FROM failures f LEFT JOIN cooldown_overrides o ON o.model = f.model
+		ORDER BY f.failed_at DESC, f.model`)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	if time.Since(time.Unix(ts, 0)) < cooldown {
-		return true, nil
+	now := time.Now()
+	var records []FailureRecord
+	for rows.Next() {
+		var r FailureRecord
+		var ts int64
+		var overrideMinutes int
+		if err := rows.Scan(&r.Model, &ts, &r.Type, &r.Count, &overrideMinutes); err != nil {
+			return nil, err
+		}
+		r.FailedAt = time.Unix(ts, 0)
+		cooldown := s.cooldown(r.Type, r.Count)
+		if overrideMinutes > 0 {
+			cooldown = time.Duration(overrideMinutes) * time.Minute
+		}
+		if remaining := cooldown - now.Sub(r.FailedAt); remaining > 0 {
+			r.Remaining = remaining
+		}
+		records = append(records, r)
 	}
-	return false, nil
+	return records, rows.Err()
 }
 
 func min(a, b int) int {
@@ -112,7 +263,339 @@ func (s *FailureStore) ClearFailure(model string) error {
 	return err
 }
 
-func (s *FailureStore) ResetAllFailures() error {
-	_, err := s.db.Exec(`DELETE FROM failures`)
+// ResetAllFailures 删除所有失败记录（同时重新启用被自动停用和标记为永久失败的模型），
+// 返回删除的失败记录行数
+func (s *FailureStore) ResetAllFailures() (int64, error) {
+	if _, err := s.db.Exec(`DELETE FROM model_outcomes`); err != nil {
+		return 0, err
+	}
+	if _, err := s.db.Exec(`DELETE FROM permanent_failures`); err != nil {
+		return 0, err
+	}
+	res, err := s.db.Exec(`DELETE FROM failures`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// modelNameMatch 匹配完整 ID 等于参数，或以 "/" + 参数结尾（显示名）的模型，需要绑定同一个参数三次。
+// 用 substr 比较而不是 LIKE，避免模型名中的 _ 和 % 被当作通配符
+const modelNameMatch = `model=? OR substr(model, -(length(?)+1)) = '/' || ?`
+
+// DeleteFailure 删除单个模型的失败记录（与 ClearFailure 只清零计数不同），
+// model 可以是完整 ID 或最后一段显示名，返回删除的行数
+func (s *FailureStore) DeleteFailure(model string) (int64, error) {
+	if _, err := s.db.Exec(`DELETE FROM model_outcomes WHERE `+modelNameMatch, model, model, model); err != nil {
+		return 0, err
+	}
+	if _, err := s.db.Exec(`DELETE FROM permanent_failures WHERE `+modelNameMatch, model, model, model); err != nil {
+		return 0, err
+	}
+	res, err := s.db.Exec(`DELETE FROM failures WHERE `+modelNameMatch, model, model, model)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RecordOutcome 将一次请求结果计入模型的累计尝试和失败次数，返回更新后的计数
+func (s *FailureStore) RecordOutcome(model string, failed bool) (attempts, failures int, err error) {
+	failure := 0
+	if failed {
+		failure = 1
+	}
+	err = s.db.QueryRow(`
+		INSERT INTO model_outcomes(model, attempts, failures)
+		VALUES(?, 1, ?)
+		ON CONFLICT(model) DO UPDATE SET
+			attempts=attempts+1,
+			failures=failures+excluded.failures
+		RETURNING attempts, failures
+	`, model, failure).Scan(&attempts, &failures)
+	return attempts, failures, err
+}
+
+// DisableModel 停用模型直到 until，并清零累计计数，使重新探测后按新的窗口统计
+func (s *FailureStore) DisableModel(model string, until time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO model_outcomes(model, attempts, failures, disabled_until)
+		VALUES(?, 0, 0, ?)
+		ON CONFLICT(model) DO UPDATE SET
+			attempts=0,
+			failures=0,
+			disabled_until=excluded.disabled_until
+	`, model, until.Unix())
 	return err
 }
+
+// IsDisabled 判断模型是否处于自动停用期
+func (s *FailureStore) IsDisabled(model string) (bool, error) {
+	var until int64
+	err := s.db.QueryRow(`SELECT disabled_until FROM model_outcomes WHERE model=?`, model).Scan(&until)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return time.Now().Before(time.Unix(until, 0)), nil
+}
+
+// DisabledModels 返回停用期在 now 之后才结束的自动停用模型及其停用截止时间
+func (s *FailureStore) DisabledModels(now time.Time) (map[string]time.Time, error) {
+	rows, err := s.db.Query(`SELECT model, disabled_until FROM model_outcomes WHERE disabled_until > ?`, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	disabled := make(map[string]time.Time)
+	for rows.Next() {
+		var model string
+		var until int64
+		if err := rows.Scan(&model, &until); err != nil {
+			return nil, err
+		}
+		disabled[model] = time.Unix(until, 0)
+	}
+	return disabled, rows.Err()
+}
+
+// SavePermanentFailure 记录模型在 at 被标记为永久失败
+func (s *FailureStore) SavePermanentFailure(model string, at time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO permanent_failures(model, failed_at) VALUES(?, ?)
+		ON CONFLICT(model) DO UPDATE SET failed_at=excluded.failed_at
+	`, model, at.Unix())
+	return err
+}
+
+// PermanentFailures 返回 since 之后标记的永久失败模型及标记时间
+func (s *FailureStore) PermanentFailures(since time.Time) (map[string]time.Time, error) {
+	rows, err := s.db.Query(`SELECT model, failed_at FROM permanent_failures WHERE failed_at > ?`, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failed := make(map[string]time.Time)
+	for rows.Next() {
+		var model string
+		var ts int64
+		if err := rows.Scan(&model, &ts); err != nil {
+			return nil, err
+		}
+		failed[model] = time.Unix(ts, 0)
+	}
+	return failed, rows.Err()
+}
+
+// LatencyStat 是模型响应延迟的指数移动平均
+type LatencyStat struct {
+	Average   time.Duration
+	UpdatedAt time.Time
+}
+
+// latencySmoothing 为新样本在移动平均中的权重
+const latencySmoothing = 0.3
+
+// RecordLatency 将一次成功请求的延迟计入模型的移动平均
+func (s *FailureStore) RecordLatency(model string, latency time.Duration) error {
+	ms := float64(latency) / float64(time.Millisecond)
+	_, err := s.db.Exec(`
+		INSERT INTO model_latency(model, avg_ms, updated_at)
+		VALUES(?, ?, ?)
+		ON CONFLICT(model) DO UPDATE SET
+			avg_ms=avg_ms*(1-?)+excluded.avg_ms*?,
+			updated_at=excluded.updated_at
+	`, model, ms, time.Now().Unix(), latencySmoothing, latencySmoothing)
+	return err
+}
+
+// Latencies 返回所有模型的延迟统计
+func (s *FailureStore) Latencies() (map[string]LatencyStat, error) {
+	rows, err := s.db.Query(`SELECT model, avg_ms, updated_at FROM model_latency`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]LatencyStat)
+	for rows.Next() {
+		var model string
+		var ms float64
+		var ts int64
+		if err := rows.Scan(&model, &ms, &ts); err != nil {
+			return nil, err
+		}
+		stats[model] = LatencyStat{
+			Average:   time.Duration(ms * float64(time.Millisecond)),
+			UpdatedAt: time.Unix(ts, 0),
+		}
+	}
+	return stats, rows.Err()
+}
+
+// SaveSuccessRates 在一个事务中保存各模型近期成功率的移动平均，重启后由 SuccessRates 恢复
+func (s *FailureStore) SaveSuccessRates(rates map[string]float64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	for model, rate := range rates {
+		if _, err := tx.Exec(`
+			INSERT INTO model_success_rates(model, rate, updated_at)
+			VALUES(?, ?, ?)
+			ON CONFLICT(model) DO UPDATE SET
+				rate=excluded.rate,
+				updated_at=excluded.updated_at
+		`, model, rate, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SuccessRates 返回所有模型保存的成功率
+func (s *FailureStore) SuccessRates() (map[string]float64, error) {
+	rows, err := s.db.Query(`SELECT model, rate FROM model_success_rates`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := make(map[string]float64)
+	for rows.Next() {
+		var model string
+		var rate float64
+		if err := rows.Scan(&model, &rate); err != nil {
+			return nil, err
+		}
+		rates[model] = rate
+	}
+	return rates, rows.Err()
+}
+
+// ClientUsage 是客户端在一个配额窗口内的请求数和 token 数
+type ClientUsage struct {
+	WindowStart time.Time
+	Requests    int
+	Tokens      int
+}
+
+// ClientUsage 返回客户端最近一个配额窗口的用量，没有记录时返回零值
+func (s *FailureStore) ClientUsage(client string) (ClientUsage, error) {
+	var start int64
+	var usage ClientUsage
+	err := s.db.QueryRow(`SELECT window_start, requests, tokens FROM client_usage WHERE client=?`, client).
+		Scan(&start, &usage.Requests, &usage.Tokens)
+	if err == sql.ErrNoRows {
+		return ClientUsage{}, nil
+	}
+	if err != nil {
+		return ClientUsage{}, err
+	}
+	usage.WindowStart = time.Unix(start, 0)
+	return usage, nil
+}
+
+// AddClientUsage 将请求数和 token 数计入客户端在 windowStart 开始的窗口；
+// 已记录的是更早的窗口时先清零再计入
+func (s *FailureStore) AddClientUsage(client string, windowStart time.Time, requests, tokens int) error {
+	_, err := s.db.Exec(`
+		INSERT INTO client_usage(client, window_start, requests, tokens)
+		VALUES(?, ?, ?, ?)
+		ON CONFLICT(client) DO UPDATE SET
+			requests=CASE WHEN window_start=excluded.window_start THEN requests+excluded.requests ELSE excluded.requests END,
+			tokens=CASE WHEN window_start=excluded.window_start THEN tokens+excluded.tokens ELSE excluded.tokens END,
+			window_start=excluded.window_start
+	`, client, windowStart.Unix(), requests, tokens)
+	return err
+}
+
+// ReserveClientRequest 在一条语句中检查并计入客户端的一个请求。记录的窗口开始于 keepSince 之前时视为已过期，
+// 从 windowStart 开始新窗口；当前窗口内请求数已达 maxRequests 或 token 数已达 maxTokens（0 表示不限制）时不计入，
+// ok 为 false。返回计入后（拒绝时为当前）的用量。并发请求不会同时通过最后一个名额的检查
+func (s *FailureStore) ReserveClientRequest(client string, windowStart, keepSince time.Time, maxRequests, maxTokens int) (usage ClientUsage, ok bool, err error) {
+	var start int64
+	err = s.db.QueryRow(`
+		INSERT INTO client_usage(client, window_start, requests, tokens)
+		VALUES(?1, ?2, 1, 0)
+		ON CONFLICT(client) DO UPDATE SET
+			requests=CASE WHEN window_start>=?3 THEN requests+1 ELSE 1 END,
+			tokens=CASE WHEN window_start>=?3 THEN tokens ELSE 0 END,
+			window_start=CASE WHEN window_start>=?3 THEN window_start ELSE excluded.window_start END
+		WHERE window_start<?3 OR ((?4=0 OR requests<?4) AND (?5=0 OR tokens<?5))
+		RETURNING window_start, requests, tokens
+	`, client, windowStart.Unix(), keepSince.Unix(), maxRequests, maxTokens).
+		Scan(&start, &usage.Requests, &usage.Tokens)
+	if err == sql.ErrNoRows {
+		usage, err = s.ClientUsage(client)
+		return usage, false, err
+	}
+	if err != nil {
+		return ClientUsage{}, false, err
+	}
+	usage.WindowStart = time.Unix(start, 0)
+	return usage, true, nil
+}
+
+// SaveModels 用 models 替换缓存的模型列表，保留传入的顺序
+func (s *FailureStore) SaveModels(models []ModelInfo) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM models`); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for i, m := range models {
+		if _, err := tx.Exec(`
+			INSERT INTO models(id, position, context_length, supports_tools, prompt_price, completion_price, fetched_at)
+			VALUES(?, ?, ?, ?, ?, ?, ?)
+		`, m.ID, i, m.ContextLength, m.SupportsTools, m.PromptPrice, m.CompletionPrice, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadModels 按保存时的顺序返回缓存的模型及其获取时间，没有缓存时返回空列表和零时间
+func (s *FailureStore) LoadModels() ([]ModelInfo, time.Time, error) {
+	rows, err := s.db.Query(`
+		SELECT id, context_length, supports_tools, prompt_price, completion_price, fetched_at
+		FROM models ORDER BY position
+	`)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+
+	var models []ModelInfo
+	var fetchedAt int64
+	for rows.Next() {
+		var m ModelInfo
+		var ts int64
+		if err := rows.Scan(&m.ID, &m.ContextLength, &m.SupportsTools, &m.PromptPrice, &m.CompletionPrice, &ts); err != nil {
+			return nil, time.Time{}, err
+		}
+		if fetchedAt == 0 || ts < fetchedAt {
+			fetchedAt = ts
+		}
+		models = append(models, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, time.Time{}, err
+	}
+	if len(models) == 0 {
+		return nil, time.Time{}, nil
+	}
+	return models, time.Unix(fetchedAt, 0), nil
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// FailureExportVersion 是 FailureExport 的格式版本，格式不兼容地变化时递增
+const FailureExportVersion = 1
+
+// FailureExport 是失败数据库中冷却和模型选择相关状态的可移植快照，用于备份、排查和迁移。
+// 模型列表缓存和延迟统计可以重新生成，不包含在内
+type FailureExport struct {
+	Version           int                 `json:"version"`
+	ExportedAt        time.Time           `json:"exported_at"`
+	Failures          []ExportedFailure   `json:"failures"`
+	PermanentFailures []ExportedPermanent `json:"permanent_failures"`
+	Outcomes          []ExportedOutcome   `json:"outcomes"`
+	CooldownOverrides []ExportedCooldown  `json:"cooldown_overrides"`
+	// SuccessRates 在较早版本导出的文件中不存在，导入时视为空
+	SuccessRates []ExportedSuccessRate `json:"success_rates"`
+}
+
+// ExportedFailure 对应 failures 表的一行
+type ExportedFailure struct {
+	Model        string    `json:"model"`
+	FailedAt     time.Time `json:"failed_at"`
+	FailureType  string    `json:"failure_type"`
+	FailureCount int       `json:"failure_count"`
+}
+
+// ExportedPermanent 对应 permanent_failures 表的一行
+type ExportedPermanent struct {
+	Model    string    `json:"model"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// ExportedOutcome 对应 model_outcomes 表的一行，DisabledUntil 在模型从未被自动停用时省略
+type ExportedOutcome struct {
+	Model         string     `json:"model"`
+	Attempts      int        `json:"attempts"`
+	Failures      int        `json:"failures"`
+	DisabledUntil *time.Time `json:"disabled_until,omitempty"`
+}
+
+// ExportedCooldown 对应 cooldown_overrides 表的一行
+type ExportedCooldown struct {
+	Model   string `json:"model"`
+	Minutes int    `json:"minutes"`
+}
+
+// ExportedSuccessRate 对应 model_success_rates 表的一行
+type ExportedSuccessRate struct {
+	Model     string    `json:"model"`
+	Rate      float64   `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Export 导出失败记录、永久失败标记、自动停用统计、冷却覆盖和成功率，各部分按模型名排序
+func (s *FailureStore) Export() (FailureExport, error) {
+	export := FailureExport{
+		Version:           FailureExportVersion,
+		ExportedAt:        time.Now().UTC(),
+		Failures:          []ExportedFailure{},
+		PermanentFailures: []ExportedPermanent{},
+		Outcomes:          []ExportedOutcome{},
+		CooldownOverrides: []ExportedCooldown{},
+		SuccessRates:      []ExportedSuccessRate{},
+	}
+
+	err := queryRows(s.db, `SELECT model, failed_at, failure_type, failure_count FROM failures ORDER BY model`, func(rows *sql.Rows) error {
+		var f ExportedFailure
+		var ts int64
+		if err := rows.Scan(&f.Model, &ts, &f.FailureType, &f.FailureCount); err != nil {
+			return err
+		}
+		f.FailedAt = time.Unix(ts, 0).UTC()
+		export.Failures = append(export.Failures, f)
+		return nil
+	})
+	if err != nil {
+		return FailureExport{}, err
+	}
+
+	err = queryRows(s.db, `SELECT model, failed_at FROM permanent_failures ORDER BY model`, func(rows *sql.Rows) error {
+		var p ExportedPermanent
+		var ts int64
+		if err := rows.Scan(&p.Model, &ts); err != nil {
+			return err
+		}
+		p.FailedAt = time.Unix(ts, 0).UTC()
+		export.PermanentFailures = append(export.PermanentFailures, p)
+		return nil
+	})
+	if err != nil {
+		return FailureExport{}, err
+	}
+
+	err = queryRows(s.db, `SELECT model, attempts, failures, disabled_until FROM model_outcomes ORDER BY model`, func(rows *sql.Rows) error {
+		var o ExportedOutcome
+		var until int64
+		if err := rows.Scan(&o.Model, &o.Attempts, &o.Failures, &until); err != nil {
+			return err
+		}
+		if until > 0 {
+			t := time.Unix(until, 0).UTC()
+			o.DisabledUntil = &t
+		}
+		export.Outcomes = append(export.Outcomes, o)
+		return nil
+	})
+	if err != nil {
+		return FailureExport{}, err
+	}
+
+	err = queryRows(s.db, `SELECT model, minutes FROM cooldown_overrides ORDER BY model`, func(rows *sql.Rows) error {
+		var c ExportedCooldown
+		if err := rows.Scan(&c.Model, &c.Minutes); err != nil {
+			return err
+		}
+		export.CooldownOverrides = append(export.CooldownOverrides, c)
+		return nil
+	})
+	if err != nil {
+		return FailureExport{}, err
+	}
+
+	err = queryRows(s.db, `SELECT model, rate, updated_at FROM model_success_rates ORDER BY model`, func(rows *sql.Rows) error {
+		var r ExportedSuccessRate
+		var ts int64
+		if err := rows.Scan(&r.Model, &r.Rate, &ts); err != nil {
+			return err
+		}
+		r.UpdatedAt = time.Unix(ts, 0).UTC()
+		export.SuccessRates = append(export.SuccessRates, r)
+		return nil
+	})
+	if err != nil {
+		return FailureExport{}, err
+	}
+	return export, nil
+}
+
+// Import 在一个事务中写入 Export 导出的数据，同名模型的现有记录被覆盖，其余记录保留。
+// 返回写入的行数
+func (s *FailureStore) Import(export FailureExport) (int, error) {
+	if export.Version != FailureExportVersion {
+		return 0, fmt.Errorf("unsupported failure export version %d (want %d)", export.Version, FailureExportVersion)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n := 0
+	for _, f := range export.Failures {
+		if _, err := tx.Exec(`
+			INSERT INTO failures(model, failed_at, failure_type, failure_count) VALUES(?, ?, ?, ?)
+			ON CONFLICT(model) DO UPDATE SET
+				failed_at=excluded.failed_at,
+				failure_type=excluded.failure_type,
+				failure_count=excluded.failure_count
+		`, f.Model, f.FailedAt.Unix(), f.FailureType, f.FailureCount); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	for _, p := range export.PermanentFailures {
+		if _, err := tx.Exec(`
+			INSERT INTO permanent_failures(model, failed_at) VALUES(?, ?)
+			ON CONFLICT(model) DO UPDATE SET failed_at=excluded.failed_at
+		`, p.Model, p.FailedAt.Unix()); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	for _, o := range export.Outcomes {
+		var until int64
+		if o.DisabledUntil != nil {
+			until = o.DisabledUntil.Unix()
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO model_outcomes(model, attempts, failures, disabled_until) VALUES(?, ?, ?, ?)
+			ON CONFLICT(model) DO UPDATE SET
+				attempts=excluded.attempts,
+				failures=excluded.failures,
+				disabled_until=excluded.disabled_until
+		`, o.Model, o.Attempts, o.Failures, until); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	for _, c := range export.CooldownOverrides {
+		if _, err := tx.Exec(`
+			INSERT INTO cooldown_overrides(model, minutes) VALUES(?, ?)
+			ON CONFLICT(model) DO UPDATE SET minutes=excluded.minutes
+		`, c.Model, c.Minutes); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	for _, r := range export.SuccessRates {
+		if _, err := tx.Exec(`
+			INSERT INTO model_success_rates(model, rate, updated_at) VALUES(?, ?, ?)
+			ON CONFLICT(model) DO UPDATE SET
+				rate=excluded.rate,
+				updated_at=excluded.updated_at
+		`, r.Model, r.Rate, r.UpdatedAt.Unix()); err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// queryRows 执行查询并对每一行调用 scan
+func queryRows(db *sql.DB, query string, scan func(*sql.Rows) error) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
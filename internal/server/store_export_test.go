@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFailureStoreExportImportRoundTrip(t *testing.T) {
+	src, err := NewFailureStore(filepath.Join(t.TempDir(), "failures.db"))
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	defer src.Close()
+
+	src.MarkFailureWithType("org/a:free", "rate_limit")
+	src.MarkFailureWithType("org/a:free", "rate_limit")
+	src.MarkFailure("org/b:free")
+	src.SavePermanentFailure("org/gone:free", time.Now().Add(-time.Hour))
+	src.RecordOutcome("org/c:free", true)
+	src.DisableModel("org/d:free", time.Now().Add(time.Hour))
+	src.SetCooldownOverride("org/a:free", 30)
+	src.SaveSuccessRates(map[string]float64{"org/b:free": 0.8})
+
+	exported, err := src.Export()
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if len(exported.Failures) != 2 || len(exported.PermanentFailures) != 1 ||
+		len(exported.Outcomes) != 2 || len(exported.CooldownOverrides) != 1 || len(exported.SuccessRates) != 1 {
+		t.Fatalf("Export() = %+v, want every seeded row", exported)
+	}
+
+	// 经过 JSON 编解码，与命令行导出到文件再导入的路径一致
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded FailureExport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := NewFailureStore(filepath.Join(t.TempDir(), "failures.db"))
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	defer dst.Close()
+
+	n, err := dst.Import(decoded)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if n != 7 {
+		t.Errorf("Import() = %d rows, want 7", n)
+	}
+
+	reexported, err := dst.Export()
+	if err != nil {
+		t.Fatalf("Export() after import error = %v", err)
+	}
+	reexported.ExportedAt = exported.ExportedAt
+	if !reflect.DeepEqual(reexported, exported) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", reexported, exported)
+	}
+
+	if skip, _ := dst.ShouldSkip("org/a:free"); !skip {
+		t.Error("imported cooldown not applied")
+	}
+	if disabled, _ := dst.IsDisabled("org/d:free"); !disabled {
+		t.Error("imported auto-disable not applied")
+	}
+	if rates, _ := dst.SuccessRates(); rates["org/b:free"] != 0.8 {
+		t.Errorf("imported success rates = %v, want org/b:free 0.8", rates)
+	}
+}
+
+func TestFailureStoreImportRejectsUnknownVersion(t *testing.T) {
+	store, err := NewFailureStore(filepath.Join(t.TempDir(), "failures.db"))
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Import(FailureExport{Version: FailureExportVersion + 1}); err == nil {
+		t.Error("Import() accepted an unknown export version")
+	}
+}
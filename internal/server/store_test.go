@@ -0,0 +1,206 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListFailures(t *testing.T) {
+	store, err := NewFailureStore(filepath.Join(t.TempDir(), FailureDBName))
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	defer store.Close()
+	store.defaultCooldown = 5 * time.Minute
+	store.rateLimitCooldown = time.Minute
+
+	now := time.Now()
+	seed := []struct {
+		model       string
+		failedAt    time.Time
+		failureType string
+		count       int
+	}{
+		{"org/general:free", now.Add(-2 * time.Minute), "general", 2},
+		{"org/limited:free", now.Add(-30 * time.Second), "rate_limit", 1},
+		{"org/expired:free", now.Add(-time.Hour), "general", 1},
+	}
+	for _, r := range seed {
+		if _, err := store.db.Exec(`INSERT INTO failures(model, failed_at, failure_type, failure_count) VALUES(?, ?, ?, ?)`,
+			r.model, r.failedAt.Unix(), r.failureType, r.count); err != nil {
+			t.Fatalf("seed %s: %v", r.model, err)
+		}
+	}
+
+	records, err := store.ListFailures()
+	if err != nil {
+		t.Fatalf("ListFailures() error = %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("ListFailures() returned %d records, want 3", len(records))
+	}
+
+	// 按最近失败时间倒序
+	wantOrder := []string{"org/limited:free", "org/general:free", "org/expired:free"}
+	for i, want := range wantOrder {
+		if records[i].Model != want {
+			t.Errorf("records[%d].Model = %s, want %s", i, records[i].Model, want)
+		}
+	}
+
+	byModel := make(map[string]FailureRecord)
+	for _, r := range records {
+		byModel[r.Model] = r
+	}
+
+	// 普通失败 2 次：冷却 10 分钟，已过 2 分钟
+	general := byModel["org/general:free"]
+	if general.Type != "general" || general.Count != 2 {
+		t.Errorf("general record = %+v", general)
+	}
+	if general.Remaining < 7*time.Minute || general.Remaining > 8*time.Minute+time.Second {
+		t.Errorf("general remaining = %v, want ~8m", general.Remaining)
+	}
+
+	// 限流：冷却 1 分钟，已过 30 秒
+	limited := byModel["org/limited:free"]
+	if limited.Remaining <= 0 || limited.Remaining > 31*time.Second {
+		t.Errorf("rate_limit remaining = %v, want ~30s", limited.Remaining)
+	}
+
+	if expired := byModel["org/expired:free"]; expired.Active() || expired.Remaining != 0 {
+		t.Errorf("expired record = %+v, want no remaining cooldown", expired)
+	}
+
+	for _, r := range records {
+		skip, err := store.ShouldSkip(r.Model)
+		if err != nil {
+			t.Fatalf("ShouldSkip(%s) error = %v", r.Model, err)
+		}
+		if skip != r.Active() {
+			t.Errorf("%s: ShouldSkip = %v, Active = %v", r.Model, skip, r.Active())
+		}
+	}
+}
+
+func TestDeleteFailureTreatsWildcardsLiterally(t *testing.T) {
+	store, err := NewFailureStore(filepath.Join(t.TempDir(), FailureDBName))
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	defer store.Close()
+
+	models := []string{"org/a_b:free", "org/axb:free", "other/a_b:free", "org/100%:free"}
+	for _, m := range models {
+		store.MarkFailure(m)
+		store.SavePermanentFailure(m, time.Now())
+	}
+
+	// _ 和 % 按字面匹配，显示名同时命中所有提供方下的同名模型
+	if n, err := store.DeleteFailure("a_b:free"); err != nil || n != 2 {
+		t.Fatalf("DeleteFailure(a_b:free) = %d, %v, want 2", n, err)
+	}
+	if n, err := store.DeleteFailure("%:free"); err != nil || n != 0 {
+		t.Errorf("DeleteFailure(%%:free) = %d, %v, want 0", n, err)
+	}
+	if n, err := store.DeleteFailure("org/100%:free"); err != nil || n != 1 {
+		t.Errorf("DeleteFailure(org/100%%:free) = %d, %v, want 1", n, err)
+	}
+
+	records, err := store.ListFailures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Model != "org/axb:free" {
+		t.Errorf("remaining failures = %+v, want only org/axb:free", records)
+	}
+	permanent, err := store.PermanentFailures(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := permanent["org/axb:free"]; len(permanent) != 1 || !ok {
+		t.Errorf("remaining permanent failures = %v, want only org/axb:free", permanent)
+	}
+}
+
+func TestModelsRoundTrip(t *testing.T) {
+	store, err := NewFailureStore(filepath.Join(t.TempDir(), FailureDBName))
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	defer store.Close()
+
+	if models, fetchedAt, err := store.LoadModels(); err != nil || len(models) != 0 || !fetchedAt.IsZero() {
+		t.Fatalf("LoadModels() on empty store = %v, %v, %v", models, fetchedAt, err)
+	}
+
+	want := []ModelInfo{
+		{ID: "org/big:free", ContextLength: 131072, SupportsTools: true, PromptPrice: "0", CompletionPrice: "0"},
+		{ID: "org/small:free", ContextLength: 8192, PromptPrice: "0", CompletionPrice: "0"},
+	}
+	before := time.Now().Add(-time.Second)
+	if err := store.SaveModels(want); err != nil {
+		t.Fatalf("SaveModels() error = %v", err)
+	}
+
+	got, fetchedAt, err := store.LoadModels()
+	if err != nil {
+		t.Fatalf("LoadModels() error = %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("LoadModels() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("model %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if fetchedAt.Before(before) || fetchedAt.After(time.Now()) {
+		t.Errorf("fetchedAt = %v, want about now", fetchedAt)
+	}
+
+	// 再次保存会替换旧列表
+	if err := store.SaveModels(want[1:]); err != nil {
+		t.Fatalf("SaveModels() error = %v", err)
+	}
+	if got, _, _ := store.LoadModels(); len(got) != 1 || got[0].ID != "org/small:free" {
+		t.Errorf("LoadModels() after replace = %+v", got)
+	}
+}
+
+func TestCachedFreeModels(t *testing.T) {
+	upstream := newFakeUpstream(t,
+		fakeModel{ID: "org/small:free", ContextLength: 8192},
+		fakeModel{ID: "org/big:free", ContextLength: 131072, SupportedParameters: []string{"tools"}},
+		fakeModel{ID: "org/paid", ContextLength: 200000, Prompt: "0.001", Completion: "0.002"},
+	)
+	store, err := NewFailureStore(filepath.Join(t.TempDir(), FailureDBName))
+	if err != nil {
+		t.Fatalf("NewFailureStore() error = %v", err)
+	}
+	defer store.Close()
+
+	models, err := CachedFreeModels(store, upstream.URL+"/models", "key", nil)
+	if err != nil {
+		t.Fatalf("CachedFreeModels() error = %v", err)
+	}
+	if ids := modelIDs(models, false); len(ids) != 2 || ids[0] != "org/big:free" || ids[1] != "org/small:free" {
+		t.Fatalf("free models = %v, want [org/big:free org/small:free]", ids)
+	}
+	if ids := modelIDs(models, true); len(ids) != 1 || ids[0] != "org/big:free" {
+		t.Errorf("tool models = %v, want [org/big:free]", ids)
+	}
+
+	// 缓存未过期时不再请求上游
+	upstream.Close()
+	if cached, err := CachedFreeModels(store, upstream.URL+"/models", "key", nil); err != nil || len(cached) != 2 {
+		t.Fatalf("CachedFreeModels() from cache = %v, %v", cached, err)
+	}
+
+	// 缓存过期且上游不可用时退回旧缓存
+	t.Setenv("CACHE_TTL_HOURS", "0")
+	if stale, err := CachedFreeModels(store, upstream.URL+"/models", "key", nil); err != nil || len(stale) != 2 {
+		t.Fatalf("CachedFreeModels() stale fallback = %v, %v", stale, err)
+	}
+}
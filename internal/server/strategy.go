@@ -0,0 +1,204 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 故障转移策略
+const (
+	// StrategyOrdered 按固定顺序（优先级、延迟）尝试免费模型，为默认策略
+	StrategyOrdered = "ordered"
+	// StrategyWeighted 按权重随机选出第一个尝试的免费模型，其余模型仍按固定顺序
+	StrategyWeighted = "weighted"
+)
+
+const (
+	// successRateSmoothing 为新结果在成功率移动平均中的权重
+	successRateSmoothing = 0.2
+	// defaultContextLength 是不知道上下文长度的模型在计算权重时使用的值
+	defaultContextLength = 4096
+	// successRateFlushInterval 为把有变化的成功率批量写入 failures.db 的间隔
+	successRateFlushInterval = 30 * time.Second
+)
+
+// validateFailoverStrategy 检查 failover.strategy 的取值
+func validateFailoverStrategy(strategy string) error {
+	switch strategy {
+	case "", StrategyOrdered, StrategyWeighted:
+		return nil
+	default:
+		return fmt.Errorf("failover.strategy must be %s or %s, got %q", StrategyOrdered, StrategyWeighted, strategy)
+	}
+}
+
+// successRates 记录每个模型近期成功率的指数移动平均，没有数据的模型视为 1。
+// dirty 为上次 takeDirty 之后有变化、尚未持久化的模型
+type successRates struct {
+	mu    sync.Mutex
+	rates map[string]float64
+	dirty map[string]bool
+}
+
+func newSuccessRates() *successRates {
+	return &successRates{rates: make(map[string]float64), dirty: make(map[string]bool)}
+}
+
+// record 计入一次请求结果，返回更新后的成功率
+func (r *successRates) record(model string, success bool) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sample := 0.0
+	if success {
+		sample = 1
+	}
+	rate, ok := r.rates[model]
+	if !ok {
+		rate = 1
+	}
+	rate = rate*(1-successRateSmoothing) + sample*successRateSmoothing
+	r.rates[model] = rate
+	r.dirty[model] = true
+	return rate
+}
+
+// takeDirty 返回有变化的模型的当前成功率，并清空变化标记
+func (r *successRates) takeDirty() map[string]float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.dirty) == 0 {
+		return nil
+	}
+	rates := make(map[string]float64, len(r.dirty))
+	for model := range r.dirty {
+		rates[model] = r.rates[model]
+	}
+	r.dirty = make(map[string]bool)
+	return rates
+}
+
+// load 用持久化的成功率替换当前记录
+func (r *successRates) load(rates map[string]float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rates = rates
+}
+
+func (r *successRates) get(model string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rate, ok := r.rates[model]; ok {
+		return rate
+	}
+	return 1
+}
+
+// recordSuccessRate 在内存中计入一次请求结果。更新后的成功率由 flushSuccessRates 批量保存，
+// 请求路径上不写数据库
+func (s *Server) recordSuccessRate(model string, success bool) {
+	s.successRates.record(model, success)
+}
+
+// flushSuccessRates 把有变化的成功率写入 failures.db，重启后仍能据此加权选择模型
+func (s *Server) flushSuccessRates() {
+	rates := s.successRates.takeDirty()
+	if len(rates) == 0 {
+		return
+	}
+	if err := s.failureStore.SaveSuccessRates(rates); err != nil {
+		slog.Error("failed to save success rates", "models", len(rates), "error", err)
+	}
+}
+
+// persistSuccessRates 每隔 interval 保存一次有变化的成功率，直到服务器关闭。
+// 关闭时剩余的变化由 Shutdown 在请求处理完后保存
+func (s *Server) persistSuccessRates(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.flushSuccessRates()
+		}
+	}
+}
+
+// loadSuccessRates 从 failures.db 恢复上次运行记录的成功率
+func (s *Server) loadSuccessRates() {
+	rates, err := s.failureStore.SuccessRates()
+	if err != nil {
+		slog.Error("failed to load success rates", "error", err)
+		return
+	}
+	s.successRates.load(rates)
+}
+
+// setContextLengths 保存免费模型的上下文长度，供加权选择使用
+func (s *Server) setContextLengths(models []ModelInfo) {
+	lengths := make(map[string]int, len(models))
+	for _, m := range models {
+		lengths[m.ID] = m.ContextLength
+	}
+	s.freeModelsMu.Lock()
+	defer s.freeModelsMu.Unlock()
+	s.contextLengths = lengths
+}
+
+// modelWeight 返回模型被选为第一个尝试的权重：近期成功率乘以上下文长度
+func (s *Server) modelWeight(model string) float64 {
+	s.freeModelsMu.RLock()
+	length := s.contextLengths[model]
+	s.freeModelsMu.RUnlock()
+	if length <= 0 {
+		length = defaultContextLength
+	}
+	return s.successRates.get(model) * float64(length)
+}
+
+// weightedStart 在 eligible 中按权重随机选出一个模型并移到 candidates 最前，
+// 其余模型保持原有顺序；返回新的切片，不修改 candidates
+func (s *Server) weightedStart(candidates, eligible []string) []string {
+	var total float64
+	weights := make([]float64, len(eligible))
+	for i, m := range eligible {
+		weights[i] = s.modelWeight(m)
+		total += weights[i]
+	}
+	if total <= 0 {
+		return candidates
+	}
+
+	pick := s.random() * total
+	chosen := eligible[len(eligible)-1]
+	for i, w := range weights {
+		if pick < w {
+			chosen = eligible[i]
+			break
+		}
+		pick -= w
+	}
+
+	ordered := make([]string, 0, len(candidates))
+	ordered = append(ordered, chosen)
+	for _, m := range candidates {
+		if m != chosen {
+			ordered = append(ordered, m)
+		}
+	}
+	return ordered
+}
+
+// random 返回 [0, 1) 的随机数，测试中可替换
+func (s *Server) random() float64 {
+	if s.randFloat != nil {
+		return s.randFloat()
+	}
+	return rand.Float64()
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestWeightedStartDistribution(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	models := []string{"org/a:free", "org/b:free", "org/c:free"}
+	s := newTestServer(t, Config{FreeMode: true, FailoverStrategy: StrategyWeighted}, upstream, models...)
+	s.setContextLengths([]ModelInfo{
+		{ID: "org/a:free", ContextLength: 1000},
+		{ID: "org/b:free", ContextLength: 1000},
+		{ID: "org/c:free", ContextLength: 2000},
+	})
+	s.successRates.rates = map[string]float64{"org/a:free": 1, "org/b:free": 0.25, "org/c:free": 0.5}
+	s.randFloat = rand.New(rand.NewSource(1)).Float64
+
+	// 权重：a = 1×1000，b = 0.25×1000，c = 0.5×2000
+	want := map[string]float64{"org/a:free": 1000.0 / 2250, "org/b:free": 250.0 / 2250, "org/c:free": 1000.0 / 2250}
+
+	const iterations = 20000
+	counts := make(map[string]int)
+	for i := 0; i < iterations; i++ {
+		ordered := s.weightedStart(models, models)
+		if len(ordered) != len(models) {
+			t.Fatalf("weightedStart() = %v, want a permutation of %v", ordered, models)
+		}
+		counts[ordered[0]]++
+	}
+	for m, p := range want {
+		got := float64(counts[m]) / iterations
+		if math.Abs(got-p) > 0.02 {
+			t.Errorf("%s chosen first %.3f of the time, want about %.3f", m, got, p)
+		}
+	}
+}
+
+func TestWeightedStrategyStartsWithWeightedModel(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true, FailoverStrategy: StrategyWeighted}, upstream, "org/a:free", "org/b:free")
+	s.successRates.rates = map[string]float64{"org/a:free": 0}
+
+	req := openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	for i := 0; i < 5; i++ {
+		if _, model, err := s.getFreeChat(context.Background(), req); err != nil || model != "org/b:free" {
+			t.Fatalf("getFreeChat() = %q, %v; want org/b:free as the only model with weight", model, err)
+		}
+	}
+	if got := upstream.requestedModels(); len(got) != 5 {
+		t.Errorf("requested models = %v, want only the chosen model each time", got)
+	}
+
+	if err := validateFailoverStrategy("random"); err == nil {
+		t.Error("validateFailoverStrategy(random) should fail")
+	}
+}
+
+func TestSuccessRatesPersistAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	upstream := newFakeUpstream(t)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		model, _ := body["model"].(string)
+		if model == "org/a:free" {
+			writeUpstreamError(w, http.StatusBadGateway, "bad gateway")
+			return
+		}
+		writeChatCompletion(w, model, "ok")
+	}
+	cfg := Config{FreeMode: true, FailoverStrategy: StrategyWeighted, ConfigDir: dir}
+	models := []string{"org/a:free", "org/b:free"}
+
+	s := newTestServer(t, cfg, upstream, models...)
+	s.randFloat = func() float64 { return 0 }
+	req := openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	if _, _, err := s.getFreeChat(context.Background(), req); err != nil {
+		t.Fatalf("getFreeChat() error = %v", err)
+	}
+	// 请求路径上不写数据库，成功率在 flushSuccessRates 时批量保存
+	if got, err := s.failureStore.SuccessRates(); err != nil || len(got) != 0 {
+		t.Fatalf("SuccessRates() before flush = %v, %v; want none", got, err)
+	}
+	s.flushSuccessRates()
+	want := map[string]float64{"org/a:free": 1 - successRateSmoothing, "org/b:free": 1}
+	if got, err := s.failureStore.SuccessRates(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("SuccessRates() = %v, %v; want %v", got, err, want)
+	}
+	if rates := s.successRates.takeDirty(); rates != nil {
+		t.Errorf("dirty rates after flush = %v, want none", rates)
+	}
+
+	// 重启后，a 的成功率降为 0 的记录让加权选择一开始就跳过它
+	if err := s.failureStore.SaveSuccessRates(map[string]float64{"org/a:free": 0}); err != nil {
+		t.Fatal(err)
+	}
+	s.failureStore.Close()
+
+	restarted := newTestServer(t, cfg, upstream, models...)
+	restarted.loadSuccessRates()
+	if got := restarted.successRates.get("org/a:free"); got != 0 {
+		t.Errorf("restored success rate = %v, want 0", got)
+	}
+	if ordered := restarted.weightedStart(models, models); ordered[0] != "org/b:free" {
+		t.Errorf("weightedStart() = %v, want org/b:free first", ordered)
+	}
+}
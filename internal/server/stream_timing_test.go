@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamingChatFinalMessageTiming(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	deltas := []string{"Hel", "lo", ",", " world", "!"}
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		writeChatStream(w, "org/model-a", deltas...)
+	}
+	s := newTestServer(t, Config{}, upstream)
+
+	body := `{"model":"model-a","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var final map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", line, err)
+		}
+		createdAt, _ := chunk["created_at"].(string)
+		if _, err := time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			t.Errorf("created_at %q is not RFC3339Nano: %v", createdAt, err)
+		}
+		if chunk["done"] == true {
+			final = chunk
+		}
+	}
+	if final == nil {
+		t.Fatal("no final done message")
+	}
+
+	if got := int(final["eval_count"].(float64)); got != len(deltas) {
+		t.Errorf("eval_count = %d, want %d", got, len(deltas))
+	}
+	if got := final["total_duration"].(float64); got <= 0 {
+		t.Errorf("total_duration = %v, want > 0", got)
+	}
+	if got := final["prompt_eval_count"].(float64); got <= 0 {
+		t.Errorf("prompt_eval_count = %v, want > 0", got)
+	}
+	if upstream.lastRequest(t)["stream_options"] == nil {
+		t.Error("stream_options not forwarded upstream")
+	}
+}
+
+func TestStreamingGenerateEvalCountSkipsEmptyChunks(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	deltas := []string{"Hel", "lo"}
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		// writeChatStream 以只携带 finish_reason 的分块结束
+		writeChatStream(w, "org/model-a", deltas...)
+	}
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/generate", `{"model":"model-a","prompt":"hi","stream":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	var final GenerateResponse
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &final); err != nil || !final.Done {
+		t.Fatalf("last line %q is not the final message: %v", lines[len(lines)-1], err)
+	}
+	if final.EvalCount != len(deltas) {
+		t.Errorf("eval_count = %d, want %d", final.EvalCount, len(deltas))
+	}
+}
+
+func TestStreamingGenerateReportsPromptEvalCountFromUsage(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = writeStreamWithUsage
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/generate", `{"model":"model-a","prompt":"hi","stream":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	var final GenerateResponse
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &final); err != nil || !final.Done {
+		t.Fatalf("last line %q is not the final message: %v", lines[len(lines)-1], err)
+	}
+	if final.PromptEvalCount != 3 {
+		t.Errorf("prompt_eval_count = %d, want 3 from the usage chunk", final.PromptEvalCount)
+	}
+}
+
+func TestStreamingGenerateReportsStreamErrors(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"gen-test","model":"org/model-a","choices":[{"index":0,"delta":{"content":"part"}}]}`+"\n\n")
+		fmt.Fprint(w, "data: {not json\n\n")
+	}
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/generate", `{"model":"model-a","prompt":"hi","stream":true}`)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	last := lines[len(lines)-1]
+	if !strings.Contains(last, `"error"`) || strings.Contains(w.Body.String(), `"done":true`) {
+		t.Errorf("body = %s, want the truncated stream to end in an error frame without done", w.Body.String())
+	}
+}
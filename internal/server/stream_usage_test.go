@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// writeStreamWithUsage 在请求 include_usage 时于 [DONE] 前追加 choices 为空的 usage 分块
+func writeStreamWithUsage(w http.ResponseWriter, body map[string]interface{}) {
+	model, _ := body["model"].(string)
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprintf(w, `data: {"id":"gen-test","model":%q,"choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":"stop"}]}`+"\n\n", model)
+	if opts, _ := body["stream_options"].(map[string]interface{}); opts["include_usage"] == true {
+		fmt.Fprintf(w, `data: {"id":"gen-test","model":%q,"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`+"\n\n", model)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func TestOpenAIStreamIncludeUsage(t *testing.T) {
+	for _, include := range []bool{true, false} {
+		t.Run(fmt.Sprintf("include_usage=%v", include), func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			upstream.chat = writeStreamWithUsage
+			s := newTestServer(t, Config{}, upstream)
+
+			body := fmt.Sprintf(`{"model":"model-a","stream":true,"stream_options":{"include_usage":%v},"messages":[{"role":"user","content":"hi"}]}`, include)
+			w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			var frames []string
+			for _, line := range strings.Split(w.Body.String(), "\n") {
+				if data, ok := strings.CutPrefix(line, "data: "); ok {
+					frames = append(frames, data)
+				}
+			}
+			if len(frames) < 2 || frames[len(frames)-1] != "[DONE]" {
+				t.Fatalf("frames = %v, want a stream ending in [DONE]", frames)
+			}
+
+			var last openai.ChatCompletionStreamResponse
+			if err := json.Unmarshal([]byte(frames[len(frames)-2]), &last); err != nil {
+				t.Fatal(err)
+			}
+			if !include {
+				if last.Usage != nil {
+					t.Errorf("usage chunk sent without include_usage: %s", frames[len(frames)-2])
+				}
+				return
+			}
+			if last.Usage == nil || last.Usage.TotalTokens != 4 {
+				t.Fatalf("last chunk before [DONE] = %s, want usage", frames[len(frames)-2])
+			}
+			if !strings.Contains(frames[len(frames)-2], `"choices":[]`) {
+				t.Errorf("usage chunk choices = %s, want an empty array", frames[len(frames)-2])
+			}
+		})
+	}
+}
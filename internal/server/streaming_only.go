@@ -0,0 +1,155 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// validateStreamingOnly 检查只支持流式请求的模型通配符是否合法
+func validateStreamingOnly(patterns []string) error {
+	for _, p := range patterns {
+		if p == "" {
+			return fmt.Errorf("streaming_only: pattern cannot be empty")
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("streaming_only: invalid pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// isStreamingOnly 判断模型是否配置为只支持流式请求
+func (o *OpenrouterProvider) isStreamingOnly(model string) bool {
+	for _, p := range o.streamingOnly {
+		if matchModelPattern(p, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// createChatViaStream 以流式请求调用上游，并把分块聚合为非流式响应，
+// 用于在非流式请求上报错的模型。流式请求不做原地重试
+func (o *OpenrouterProvider) createChatViaStream(req openai.ChatCompletionRequest, grace time.Duration) (ChatResponse, error) {
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	stream, err := o.CreateChatStreamWithGrace(req, grace)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer stream.Close()
+
+	resp, err := aggregateChatStream(stream)
+	if err != nil {
+		return ChatResponse{}, wrapUpstreamError("chat completion failed", err)
+	}
+	if resp.Model == "" {
+		resp.Model = req.Model
+	}
+	return resp, nil
+}
+
+// aggregateChatStream 读取整个流，按 choice 拼接内容和工具调用，得到等价的非流式响应
+func aggregateChatStream(stream ChatStream) (ChatResponse, error) {
+	var resp ChatResponse
+	contents := make(map[int]*strings.Builder)
+	reasoning := make(map[int]*strings.Builder)
+	choices := make(map[int]*openai.ChatCompletionChoice)
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ChatResponse{}, err
+		}
+
+		if resp.ID == "" {
+			resp.ID = chunk.ID
+			resp.Created = chunk.Created
+			resp.Model = chunk.Model
+			resp.SystemFingerprint = chunk.SystemFingerprint
+		}
+		if chunk.Usage != nil {
+			resp.Usage = *chunk.Usage
+		}
+
+		for i, delta := range chunk.Choices {
+			choice, ok := choices[delta.Index]
+			if !ok {
+				choice = &openai.ChatCompletionChoice{
+					Index:   delta.Index,
+					Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant},
+				}
+				choices[delta.Index] = choice
+				contents[delta.Index] = &strings.Builder{}
+				reasoning[delta.Index] = &strings.Builder{}
+			}
+			contents[delta.Index].WriteString(delta.Delta.Content)
+			reasoning[delta.Index].WriteString(reasoningAt(chunk.Reasoning, i))
+			choice.Message.ToolCalls, err = mergeToolCallDeltas(choice.Message.ToolCalls, delta.Delta.ToolCalls)
+			if err != nil {
+				return ChatResponse{}, err
+			}
+			if delta.FinishReason != "" {
+				choice.FinishReason = delta.FinishReason
+			}
+		}
+	}
+
+	resp.Object = "chat.completion"
+	indexes := make([]int, 0, len(choices))
+	for i := range choices {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		choice := choices[i]
+		choice.Message.Content = contents[i].String()
+		resp.Choices = append(resp.Choices, *choice)
+		resp.Reasoning = append(resp.Reasoning, reasoning[i].String())
+	}
+	if strings.Join(resp.Reasoning, "") == "" {
+		resp.Reasoning = nil
+	}
+	return resp, nil
+}
+
+// mergeToolCallDeltas 将流式工具调用增量按 index 合并：ID、类型和函数名取首次出现的值，参数依次拼接。
+// index 为负数或超过 len(calls)+1 时返回错误，避免异常的上游数据分配过大的切片
+func mergeToolCallDeltas(calls []openai.ToolCall, deltas []openai.ToolCall) ([]openai.ToolCall, error) {
+	for _, d := range deltas {
+		idx := len(calls)
+		if d.Index != nil {
+			idx = *d.Index
+		}
+		if idx < 0 || idx > len(calls)+1 {
+			return nil, fmt.Errorf("invalid tool call index %d in stream delta", idx)
+		}
+		for len(calls) <= idx {
+			calls = append(calls, openai.ToolCall{})
+		}
+		call := &calls[idx]
+		if call.ID == "" {
+			call.ID = d.ID
+		}
+		if call.Type == "" {
+			call.Type = d.Type
+		}
+		if call.Function.Name == "" {
+			call.Function.Name = d.Function.Name
+		}
+		call.Function.Arguments += d.Function.Arguments
+	}
+	for i := range calls {
+		calls[i].Index = nil
+	}
+	return calls, nil
+}
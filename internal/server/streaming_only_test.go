@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestStreamingOnlyModelAggregatesResponse(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/stream-only"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		if stream, _ := body["stream"].(bool); !stream {
+			writeUpstreamError(w, http.StatusBadRequest, "only streaming is supported")
+			return
+		}
+		writeChatStream(w, "org/stream-only", "Hel", "lo", " there")
+	}
+	s := newTestServer(t, Config{StreamingOnly: []string{"stream-*"}}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions",
+		`{"model":"org/stream-only","messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not a chat completion: %v; body = %s", err, w.Body.String())
+	}
+	if len(resp.Choices) != 1 {
+		t.Fatalf("choices = %d, want 1", len(resp.Choices))
+	}
+	if got := resp.Choices[0].Message.Content; got != "Hello there" {
+		t.Errorf("content = %q, want %q", got, "Hello there")
+	}
+	if got := resp.Choices[0].FinishReason; got != openai.FinishReasonStop {
+		t.Errorf("finish_reason = %q, want stop", got)
+	}
+	if stream, _ := upstream.lastRequest(t)["stream"].(bool); !stream {
+		t.Error("upstream request was not streaming")
+	}
+}
+
+func TestStreamingOnlyLeavesOtherModelsAlone(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/regular"})
+	s := newTestServer(t, Config{StreamingOnly: []string{"stream-*"}}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions",
+		`{"model":"org/regular","messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if stream, _ := upstream.lastRequest(t)["stream"].(bool); stream {
+		t.Error("non-streaming request for a regular model was sent as a stream")
+	}
+}
+
+func TestMergeToolCallDeltas(t *testing.T) {
+	zero, one := 0, 1
+	calls, err := mergeToolCallDeltas(nil, []openai.ToolCall{
+		{Index: &zero, ID: "call_a", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup", Arguments: `{"q":`}},
+		{Index: &one, ID: "call_b", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "now"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls, err = mergeToolCallDeltas(calls, []openai.ToolCall{
+		{Index: &zero, Function: openai.FunctionCall{Arguments: `"x"}`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) != 2 {
+		t.Fatalf("calls = %d, want 2", len(calls))
+	}
+	if calls[0].ID != "call_a" || calls[0].Function.Name != "lookup" || calls[0].Function.Arguments != `{"q":"x"}` {
+		t.Errorf("calls[0] = %+v", calls[0])
+	}
+	if calls[1].ID != "call_b" || calls[1].Function.Name != "now" {
+		t.Errorf("calls[1] = %+v", calls[1])
+	}
+}
+
+func TestMergeToolCallDeltasRejectsNegativeIndex(t *testing.T) {
+	negative := -1
+	if _, err := mergeToolCallDeltas(nil, []openai.ToolCall{{Index: &negative, ID: "call_a"}}); err == nil {
+		t.Error("negative tool call index accepted")
+	}
+}
+
+func TestMergeToolCallDeltasRejectsIndexOutOfRange(t *testing.T) {
+	huge := 1 << 30
+	if _, err := mergeToolCallDeltas(nil, []openai.ToolCall{{Index: &huge, ID: "call_a"}}); err == nil {
+		t.Error("out-of-range tool call index accepted")
+	}
+	two := 2
+	calls, err := mergeToolCallDeltas([]openai.ToolCall{{ID: "call_a"}}, []openai.ToolCall{{Index: &two, ID: "call_c"}})
+	if err != nil || len(calls) != 3 {
+		t.Errorf("index len(calls)+1: calls = %d, error = %v, want 3 calls", len(calls), err)
+	}
+	three := 3
+	if _, err := mergeToolCallDeltas([]openai.ToolCall{{ID: "call_a"}}, []openai.ToolCall{{Index: &three}}); err == nil {
+		t.Error("index above len(calls)+1 accepted")
+	}
+}
+
+func TestValidateStreamingOnly(t *testing.T) {
+	if err := validateStreamingOnly([]string{"org/*", "model-?"}); err != nil {
+		t.Errorf("valid patterns rejected: %v", err)
+	}
+	if err := validateStreamingOnly([]string{"[bad"}); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+	if err := validateStreamingOnly([]string{""}); err == nil {
+		t.Error("empty pattern accepted")
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestOpenAIModelsIncludeSupportedParameters(t *testing.T) {
+	cases := []struct {
+		name        string
+		cfg         Config
+		free        []string
+		toolUseOnly bool
+		id          string
+	}{
+		{"paid", Config{}, nil, false, "model-a"},
+		{"paid tool-use only", Config{}, nil, true, "model-a"},
+		{"free", Config{FreeMode: true}, []string{"org/model-a"}, false, "model-a"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.toolUseOnly {
+				t.Setenv("TOOL_USE_ONLY", "true")
+			}
+			upstream := newFakeUpstream(t,
+				fakeModel{ID: "org/model-a", SupportedParameters: []string{"tools", "response_format", "seed"}},
+				fakeModel{ID: "org/model-b"},
+			)
+			s := newTestServer(t, tc.cfg, upstream, tc.free...)
+
+			w := doJSON(t, s.buildRouter(), http.MethodGet, "/v1/models", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Data []struct {
+					ID                  string   `json:"id"`
+					SupportedParameters []string `json:"supported_parameters"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			found := false
+			for _, m := range resp.Data {
+				if m.ID != tc.id {
+					continue
+				}
+				found = true
+				if got := fmt.Sprint(m.SupportedParameters); got != "[tools response_format seed]" {
+					t.Errorf("supported_parameters = %s, want [tools response_format seed]", got)
+				}
+			}
+			if !found {
+				t.Fatalf("model %s missing from %s", tc.id, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSupportedParametersUseCachedMetadata(t *testing.T) {
+	srv, calls := countingModelsServer(t, "org/model-a")
+	s := New(Config{FreeMode: true})
+	s.provider = NewOpenrouterProvider("key", WithBaseURL(srv.URL+"/"), WithModelListTTL(time.Minute))
+	now := time.Now()
+	s.provider.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		s.supportedParameters()
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("upstream calls within TTL = %d, want 1", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	s.supportedParameters()
+	if got := calls.Load(); got != 2 {
+		t.Errorf("upstream calls after expiry = %d, want 2", got)
+	}
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"github.com/sashabaranov/go-openai"
+)
+
+// withSystemPrefix 在消息开头注入配置的系统提示词。客户端的第一条消息是纯文本 system 消息时
+// 与之合并（前缀在前），否则插入一条新的 system 消息。返回新的切片，不修改 messages
+func (o *OpenrouterProvider) withSystemPrefix(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	if o.systemPrefix == "" {
+		return messages
+	}
+	if len(messages) > 0 && messages[0].Role == openai.ChatMessageRoleSystem && len(messages[0].MultiContent) == 0 {
+		merged := append([]openai.ChatCompletionMessage(nil), messages...)
+		merged[0].Content = o.systemPrefix + "\n\n" + merged[0].Content
+		return merged
+	}
+	prefixed := make([]openai.ChatCompletionMessage, 0, len(messages)+1)
+	prefixed = append(prefixed, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: o.systemPrefix})
+	return append(prefixed, messages...)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// upstreamMessages 返回上游最近一次聊天请求中各消息的 role 和 content
+func upstreamMessages(t *testing.T, upstream *fakeUpstream) [][2]string {
+	t.Helper()
+	raw, _ := upstream.lastRequest(t)["messages"].([]interface{})
+	messages := make([][2]string, 0, len(raw))
+	for _, m := range raw {
+		msg, _ := m.(map[string]interface{})
+		role, _ := msg["role"].(string)
+		content, _ := msg["content"].(string)
+		messages = append(messages, [2]string{role, content})
+	}
+	return messages
+}
+
+func TestSystemPrefixInjected(t *testing.T) {
+	const prefix = "Answer in English."
+	cases := []struct {
+		name, path, body string
+		want             [][2]string
+	}{
+		{
+			"chat without system", "/api/chat",
+			`{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`,
+			[][2]string{{"system", prefix}, {"user", "hi"}},
+		},
+		{
+			"chat merges client system", "/api/chat",
+			`{"model":"model-a","stream":true,"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}]}`,
+			[][2]string{{"system", prefix + "\n\nBe brief."}, {"user", "hi"}},
+		},
+		{
+			"generate with system", "/api/generate",
+			`{"model":"model-a","stream":false,"system":"Be brief.","prompt":"hi"}`,
+			[][2]string{{"system", prefix + "\n\nBe brief."}, {"user", "hi"}},
+		},
+		{
+			"openai", "/v1/chat/completions",
+			`{"model":"model-a","messages":[{"role":"user","content":"hi"}]}`,
+			[][2]string{{"system", prefix}, {"user", "hi"}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			s := newTestServer(t, Config{SystemPrefix: prefix}, upstream)
+
+			if w := doJSON(t, s.buildRouter(), http.MethodPost, tc.path, tc.body); w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if got := upstreamMessages(t, upstream); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("upstream messages = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSystemPrefixEmptyLeavesMessages(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+		`{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := upstreamMessages(t, upstream); len(got) != 1 || got[0] != [2]string{"user", "hi"} {
+		t.Errorf("upstream messages = %q, want only the user message", got)
+	}
+}
+
+func TestSystemPrefixNotStoredInGenerateContext(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{SystemPrefix: "House rules."}, upstream)
+	r := s.buildRouter()
+
+	w := doJSON(t, r, http.MethodPost, "/api/generate", `{"model":"model-a","stream":false,"prompt":"one"}`)
+	var first GenerateResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &first); err != nil {
+		t.Fatalf("decode first turn: %v", err)
+	}
+
+	ctx, _ := json.Marshal(first.Context)
+	body := `{"model":"model-a","stream":false,"prompt":"two","context":` + string(ctx) + `}`
+	if w := doJSON(t, r, http.MethodPost, "/api/generate", body); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	got := upstreamMessages(t, upstream)
+	want := [][2]string{{"system", "House rules."}, {"user", "one"}, {"assistant", "hello world"}, {"user", "two"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("second turn messages = %q, want %q", got, want)
+	}
+}
+
+func TestSystemPrefixSkipsRawCompletions(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/llama-base"})
+	completions := handleCompletions(upstream)
+	s := newTestServer(t, Config{SystemPrefix: "Answer in English.", BaseModels: []string{"*-base"}}, upstream)
+	r := s.buildRouter()
+
+	for _, tc := range []struct{ path, body string }{
+		{"/v1/completions", `{"model":"llama-base","prompt":"Once"}`},
+		{"/api/generate", `{"model":"llama-base","stream":false,"prompt":"Once"}`},
+	} {
+		if w := doJSON(t, r, http.MethodPost, tc.path, tc.body); w.Code != http.StatusOK {
+			t.Fatalf("%s status = %d, body = %s", tc.path, w.Code, w.Body.String())
+		}
+	}
+	got := completions()
+	if len(got) != 2 {
+		t.Fatalf("completions requests = %d, want 2", len(got))
+	}
+	for i, req := range got {
+		if req["prompt"] != "Once" {
+			t.Errorf("completion request %d prompt = %q, want the raw prompt without the system prefix", i, req["prompt"])
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newSlowUpstream 返回一个在 delay 后才响应非流式请求的假上游
+func newSlowUpstream(t *testing.T, delay time.Duration, models ...fakeModel) *fakeUpstream {
+	t.Helper()
+
+	upstream := newFakeUpstream(t, models...)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		time.Sleep(delay)
+		model, _ := body["model"].(string)
+		writeChatCompletion(w, model, "slow answer")
+	}
+	return upstream
+}
+
+func TestNonStreamingUpstreamTimeoutReturns504(t *testing.T) {
+	tests := []struct {
+		name     string
+		freeMode bool
+		path     string
+	}{
+		{"openai", false, "/v1/chat/completions"},
+		{"ollama chat", false, "/api/chat"},
+		{"ollama generate", false, "/api/generate"},
+		{"free mode openai", true, "/v1/chat/completions"},
+		{"free mode ollama", true, "/api/chat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newSlowUpstream(t, 300*time.Millisecond, fakeModel{ID: "org/model-a:free"})
+			s := newTestServer(t, Config{FreeMode: tt.freeMode}, upstream, "org/model-a:free")
+			s.provider.chatTimeout = 50 * time.Millisecond
+			r := s.buildRouter()
+
+			body := `{"model":"model-a:free","stream":false,"prompt":"hi","messages":[{"role":"user","content":"hi"}]}`
+			w := doJSON(t, r, http.MethodPost, tt.path, body)
+			if w.Code != http.StatusGatewayTimeout {
+				t.Fatalf("status = %d, want 504; body = %s", w.Code, w.Body.String())
+			}
+			var resp map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("504 body is not valid JSON: %v; body = %s", err, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestNonStreamingSlowUpstreamWithinBudget(t *testing.T) {
+	upstream := newSlowUpstream(t, 200*time.Millisecond, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+	r := s.buildRouter()
+
+	body := `{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, r, http.MethodPost, "/v1/chat/completions", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "slow answer" {
+		t.Errorf("choices = %+v, want the full slow answer", resp.Choices)
+	}
+}
+
+func TestConfiguredUpstreamTimeouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		stream bool
+		want   int
+	}{
+		{"short chat timeout", Config{UpstreamTimeout: 50 * time.Millisecond}, false, http.StatusGatewayTimeout},
+		{"short stream timeout", Config{StreamTimeout: 50 * time.Millisecond}, true, http.StatusGatewayTimeout},
+		{"zero stream timeout is unlimited", Config{StreamTimeout: 0}, true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+				time.Sleep(300 * time.Millisecond)
+				if stream, _ := body["stream"].(bool); stream {
+					writeChatStream(w, "org/model-a", "slow answer")
+					return
+				}
+				writeChatCompletion(w, "org/model-a", "slow answer")
+			}
+			s := newTestServer(t, tt.cfg, upstream)
+
+			body := fmt.Sprintf(`{"model":"model-a","stream":%v,"messages":[{"role":"user","content":"hi"}]}`, tt.stream)
+			w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d; body = %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
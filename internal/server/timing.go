@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timingHeader 是调试模式下返回的请求耗时分解响应头，格式与 Server-Timing 相同，
+// 例如 queue;dur=12.0, attempts;dur=850.3, upstream;dur=1204.7, total;dur=2071.9（单位毫秒）
+const timingHeader = "X-Timing"
+
+// 请求耗时的各个阶段
+const (
+	// phaseQueue 为等待限流退避、全局请求间隔和模型并发槽位的时间
+	phaseQueue = "queue"
+	// phaseAttempts 为失败的模型尝试所花费的时间
+	phaseAttempts = "attempts"
+	// phaseUpstream 为最终成功的上游调用时间；流式请求为打开上游流的时间
+	phaseUpstream = "upstream"
+)
+
+// timingPhases 为 X-Timing 中各阶段的输出顺序
+var timingPhases = []string{phaseQueue, phaseAttempts, phaseUpstream}
+
+// requestTiming 累计一次请求各阶段的耗时，故障转移中可能被多次累加
+type requestTiming struct {
+	start  time.Time
+	phases map[string]*atomic.Int64
+}
+
+type requestTimingKey struct{}
+
+// timingFrom 返回上下文中的耗时记录，未开启时返回 nil
+func timingFrom(ctx context.Context) *requestTiming {
+	t, _ := ctx.Value(requestTimingKey{}).(*requestTiming)
+	return t
+}
+
+// addTiming 把 d 计入请求的 phase 阶段，未开启耗时记录时为空操作
+func addTiming(ctx context.Context, phase string, d time.Duration) {
+	if t := timingFrom(ctx); t != nil {
+		t.phases[phase].Add(int64(d))
+	}
+}
+
+// timePhase 开始计时，返回的函数把经过的时间计入请求的 phase 阶段
+func timePhase(ctx context.Context, phase string) func() {
+	start := time.Now()
+	return func() { addTiming(ctx, phase, time.Since(start)) }
+}
+
+// header 生成 X-Timing 的值，total 为从请求开始到现在的时间
+func (t *requestTiming) header() string {
+	parts := make([]string, 0, len(timingPhases)+1)
+	for _, phase := range timingPhases {
+		parts = append(parts, formatTiming(phase, time.Duration(t.phases[phase].Load())))
+	}
+	parts = append(parts, formatTiming("total", time.Since(t.start)))
+	return strings.Join(parts, ", ")
+}
+
+func formatTiming(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.1f", name, float64(d)/float64(time.Millisecond))
+}
+
+// timingMiddleware 在调试模式下为请求开启耗时记录，并在响应头写出前附加 X-Timing
+func timingMiddleware(c *gin.Context) {
+	t := &requestTiming{start: time.Now(), phases: make(map[string]*atomic.Int64, len(timingPhases))}
+	for _, phase := range timingPhases {
+		t.phases[phase] = &atomic.Int64{}
+	}
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestTimingKey{}, t))
+	c.Writer = &timingWriter{ResponseWriter: c.Writer, timing: t}
+	c.Next()
+}
+
+// timingWriter 在第一次写出响应时设置 X-Timing 头，此时故障转移已经结束
+type timingWriter struct {
+	gin.ResponseWriter
+	timing *requestTiming
+	once   sync.Once
+}
+
+func (w *timingWriter) setHeader() {
+	w.once.Do(func() {
+		if !w.ResponseWriter.Written() {
+			w.ResponseWriter.Header().Set(timingHeader, w.timing.header())
+		}
+	})
+}
+
+func (w *timingWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timingWriter) Write(data []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timingWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timingWriter) Flush() {
+	w.setHeader()
+	w.ResponseWriter.Flush()
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseTiming 把 X-Timing 头解析为阶段名到毫秒数的映射
+func parseTiming(t *testing.T, header string) map[string]float64 {
+	t.Helper()
+	phases := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, dur, ok := strings.Cut(strings.TrimSpace(part), ";dur=")
+		if !ok {
+			t.Fatalf("malformed X-Timing entry %q in %q", part, header)
+		}
+		ms, err := strconv.ParseFloat(dur, 64)
+		if err != nil {
+			t.Fatalf("malformed duration in %q: %v", part, err)
+		}
+		phases[name] = ms
+	}
+	return phases
+}
+
+func TestTimingHeaderBreaksDownFailover(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		time.Sleep(20 * time.Millisecond)
+		if body["model"] == "org/a:free" {
+			writeUpstreamError(w, http.StatusInternalServerError, "upstream exploded")
+			return
+		}
+		writeChatCompletion(w, "org/b:free", "hello")
+	}
+
+	for _, stream := range []string{"false", "true"} {
+		// 每轮使用独立的服务器，避免上一轮的失败记录让 org/a 被跳过
+		s := newTestServer(t, Config{FreeMode: true, LogLevel: "debug"}, upstream, "org/a:free", "org/b:free")
+		w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+			`{"model":"unknown","stream":`+stream+`,"messages":[{"role":"user","content":"hi"}]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("stream=%s: status = %d, body = %s", stream, w.Code, w.Body.String())
+		}
+
+		header := w.Header().Get(timingHeader)
+		phases := parseTiming(t, header)
+		for _, phase := range []string{phaseQueue, phaseAttempts, phaseUpstream, "total"} {
+			if phases[phase] <= 0 {
+				t.Errorf("stream=%s: %s = %v, want > 0 (header %q)", stream, phase, phases[phase], header)
+			}
+		}
+		if phases["total"] < phases[phaseAttempts]+phases[phaseUpstream] {
+			t.Errorf("stream=%s: total shorter than its phases: %q", stream, header)
+		}
+	}
+}
+
+func TestTimingHeaderOnlyInDebug(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	s := newTestServer(t, Config{}, upstream)
+
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat",
+		`{"model":"model-a","stream":false,"messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(timingHeader); got != "" {
+		t.Errorf("X-Timing = %q without debug logging, want none", got)
+	}
+}
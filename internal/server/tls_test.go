@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert 生成 127.0.0.1 的自签名证书，返回证书和私钥文件路径以及可信任它的证书池
+func writeSelfSignedCert(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ollama-router test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+// freePort 返回本机当前空闲的 TCP 端口
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func TestStartServesTLS(t *testing.T) {
+	certFile, keyFile, pool := writeSelfSignedCert(t)
+	upstream := newFakeUpstream(t)
+	port := freePort(t)
+	s := New(Config{
+		Host:        "127.0.0.1",
+		Port:        port,
+		BaseURL:     upstream.URL + "/",
+		ConfigDir:   t.TempDir(),
+		TLSCertFile: certFile,
+		TLSKeyFile:  keyFile,
+	})
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.Start() }()
+
+	client := &http.Client{
+		Timeout:   time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	url := "https://127.0.0.1:" + port + "/health"
+	var resp *http.Response
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var err error
+		resp, err = client.Get(url)
+		if err == nil {
+			break
+		}
+		select {
+		case startErr := <-errc:
+			t.Fatalf("Start() error = %v", startErr)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Errorf("status = %d, TLS = %v; want 200 over TLS", resp.StatusCode, resp.TLS != nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if err := <-errc; err != http.ErrServerClosed {
+		t.Errorf("Start() returned %v after shutdown, want http.ErrServerClosed", err)
+	}
+}
+
+func TestStartRejectsPartialTLSConfig(t *testing.T) {
+	tests := []struct {
+		cert, key string
+		missing   string
+	}{
+		{cert: "cert.pem", missing: "tls_key"},
+		{key: "key.pem", missing: "tls_cert"},
+	}
+	for _, tt := range tests {
+		s := New(Config{TLSCertFile: tt.cert, TLSKeyFile: tt.key})
+		err := s.Start()
+		if err == nil || !strings.Contains(err.Error(), tt.missing+" is missing") {
+			t.Errorf("Start() with cert=%q key=%q error = %v, want %s missing", tt.cert, tt.key, err, tt.missing)
+		}
+	}
+}
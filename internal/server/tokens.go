@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 粗略估算：平均每 4 个字符约 1 个 token，另加每条消息的格式开销
+const (
+	charsPerToken         = 4
+	tokensPerMessageExtra = 4
+)
+
+// errPromptTooLarge 是估算的提示词超过所有候选模型的上下文长度（或 max_prompt_tokens）时返回的错误
+var errPromptTooLarge = errors.New("prompt is too large for the context window of every available model")
+
+// estimatePromptTokens 粗略估算消息的 token 数，只用于提前跳过明显放不下的模型
+func estimatePromptTokens(messages []openai.ChatCompletionMessage) int {
+	chars := 0
+	for _, msg := range messages {
+		chars += utf8.RuneCountInString(msg.Content)
+		for _, part := range msg.MultiContent {
+			chars += utf8.RuneCountInString(part.Text)
+		}
+	}
+	return (chars+charsPerToken-1)/charsPerToken + len(messages)*tokensPerMessageExtra
+}
+
+// ModelLimit 是单个模型的请求限制，Model 可以是完整 ID 或显示名
+type ModelLimit struct {
+	Model           string `mapstructure:"model"`
+	MaxPromptTokens int    `mapstructure:"max_prompt_tokens"`
+}
+
+// maxPromptTokens 返回模型配置的提示词 token 上限，0 表示不限制
+func (s *Server) maxPromptTokens(model string) int {
+	parts := strings.Split(model, "/")
+	displayName := parts[len(parts)-1]
+	for _, l := range s.config.ModelLimits {
+		if l.Model == model || l.Model == displayName {
+			return l.MaxPromptTokens
+		}
+	}
+	return 0
+}
+
+// contextLength 返回免费模型缓存的上下文长度，未知时返回 0
+func (s *Server) contextLength(model string) int {
+	s.freeModelsMu.RLock()
+	defer s.freeModelsMu.RUnlock()
+	return s.contextLengths[model]
+}
+
+// fitsPromptLimit 判断估算的提示词 token 数是否在模型的 max_prompt_tokens 和缓存的上下文长度之内，
+// 上下文长度未知时不限制
+func (s *Server) fitsPromptLimit(model string, promptTokens int) bool {
+	limit := s.maxPromptTokens(model)
+	if limit > 0 && promptTokens > limit {
+		slog.Debug("skipping model: prompt exceeds max_prompt_tokens",
+			"model", model, "estimated_tokens", promptTokens, "max_prompt_tokens", limit)
+		return false
+	}
+	if length := s.contextLength(model); length > 0 && promptTokens > length {
+		slog.Debug("skipping model: prompt exceeds context length",
+			"model", model, "estimated_tokens", promptTokens, "context_length", length)
+		return false
+	}
+	return true
+}
+
+// orderForPrompt 把缓存的上下文长度小于估算提示词的模型移到最后，其余模型保持原有顺序
+// （即故障转移策略、权重和延迟排序的结果）。返回新的切片，不修改 candidates
+func (s *Server) orderForPrompt(candidates []string, promptTokens int) []string {
+	ordered := make([]string, 0, len(candidates))
+	var tooSmall []string
+	for _, m := range candidates {
+		if length := s.contextLength(m); length > 0 && promptTokens > length {
+			tooSmall = append(tooSmall, m)
+			continue
+		}
+		ordered = append(ordered, m)
+	}
+	return append(ordered, tooSmall...)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEstimatePromptTokens(t *testing.T) {
+	messages := []openai.ChatCompletionMessage{
+		{Role: "user", Content: strings.Repeat("a", 400)},
+		{Role: "user", MultiContent: []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: strings.Repeat("b", 40)}}},
+	}
+	if got, want := estimatePromptTokens(messages), 110+2*tokensPerMessageExtra; got != want {
+		t.Errorf("estimatePromptTokens() = %d, want %d", got, want)
+	}
+}
+
+func TestLargePromptSkipsModelWithLowPromptCap(t *testing.T) {
+	limits := []ModelLimit{{Model: "small-cap:free", MaxPromptTokens: 100}}
+
+	tests := []struct {
+		name   string
+		prompt string
+		want   string
+	}{
+		{"large prompt", strings.Repeat("x", 2000), "org/big-cap:free"},
+		{"small prompt", "hi", "org/small-cap:free"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t)
+			s := newTestServer(t, Config{FreeMode: true, ModelLimits: limits}, upstream,
+				"org/small-cap:free", "org/big-cap:free")
+			r := s.buildRouter()
+
+			body := `{"model":"small-cap:free","stream":false,"messages":[{"role":"user","content":"` + tt.prompt + `"}]}`
+			w := doJSON(t, r, http.MethodPost, "/v1/chat/completions", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			got := upstream.requestedModels()
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("upstream models = %v, want [%s]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLargePromptSkipsSmallContextModels(t *testing.T) {
+	// 约 12000 token，超过 small 的上下文；small 移到最后，其余模型保持原有顺序，先尝试 medium
+	prompt := strings.Repeat("x", 48000)
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true}, upstream, "org/small:free", "org/medium:free", "org/large:free")
+	s.setContextLengths([]ModelInfo{
+		{ID: "org/small:free", ContextLength: 8192},
+		{ID: "org/medium:free", ContextLength: 32768},
+		{ID: "org/large:free", ContextLength: 131072},
+	})
+
+	body := `{"model":"small:free","stream":false,"messages":[{"role":"user","content":"` + prompt + `"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := upstream.requestedModels(); len(got) != 1 || got[0] != "org/medium:free" {
+		t.Errorf("upstream models = %v, want [org/medium:free]", got)
+	}
+
+	plan, skipped := s.freeModelPlan(context.Background(), "small:free", estimatePromptTokens(
+		[]openai.ChatCompletionMessage{{Role: "user", Content: prompt}}))
+	if want := []string{"org/medium:free", "org/large:free"}; !reflect.DeepEqual(plan, want) {
+		t.Errorf("plan = %v, want %v", plan, want)
+	}
+	if want := []SkippedModel{{Model: "org/small:free", Reason: skipPromptTooLarge}}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped = %v, want %v", skipped, want)
+	}
+}
+
+func TestPromptLargerThanEveryContextReturns413(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true}, upstream, "org/small:free", "org/medium:free")
+	s.setContextLengths([]ModelInfo{
+		{ID: "org/small:free", ContextLength: 1024},
+		{ID: "org/medium:free", ContextLength: 2048},
+	})
+
+	for _, path := range []string{"/api/chat", "/v1/chat/completions"} {
+		body := `{"model":"small:free","stream":true,"messages":[{"role":"user","content":"` + strings.Repeat("x", 20000) + `"}]}`
+		w := doJSON(t, s.buildRouter(), http.MethodPost, path, body)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s status = %d, want 413, body = %s", path, w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), errPromptTooLarge.Error()) {
+			t.Errorf("%s body = %s, want %q", path, w.Body.String(), errPromptTooLarge)
+		}
+	}
+	if got := upstream.requestedModels(); len(got) != 0 {
+		t.Errorf("upstream models = %v, want no upstream requests", got)
+	}
+}
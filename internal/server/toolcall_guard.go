@@ -0,0 +1,128 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// errUnexpectedToolCall 表示请求没有提供工具，模型却返回了工具调用
+var errUnexpectedToolCall = errors.New("model returned a tool call but the request provided no tools")
+
+// requestHasTools 判断请求是否向模型提供了工具或函数
+func requestHasTools(req openai.ChatCompletionRequest) bool {
+	return len(req.Tools) > 0 || len(req.Functions) > 0
+}
+
+func chunkHasToolCall(chunk ChatChunk) bool {
+	for _, choice := range chunk.Choices {
+		if len(choice.Delta.ToolCalls) > 0 || choice.Delta.FunctionCall != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func chunkHasContent(chunk ChatChunk) bool {
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkToolCallMismatch 在开启 ToolCallMismatchFailover 时检查非流式响应，
+// 请求未提供工具却收到工具调用时返回 errUnexpectedToolCall，以便故障转移到下一个模型
+func (s *Server) checkToolCallMismatch(req openai.ChatCompletionRequest, resp ChatResponse) error {
+	if !s.config.ToolCallMismatchFailover || requestHasTools(req) {
+		return nil
+	}
+	for _, choice := range resp.Choices {
+		if len(choice.Message.ToolCalls) > 0 || choice.Message.FunctionCall != nil {
+			slog.Warn("model returned an unexpected tool call", "model", req.Model)
+			return errUnexpectedToolCall
+		}
+	}
+	return nil
+}
+
+// guardStream 在开启 ToolCallMismatchFailover 时预读流的开头，直到出现文本内容或工具调用。
+// 请求未提供工具却先出现工具调用时关闭流并返回 errUnexpectedToolCall；
+// 此时尚未向客户端写出任何内容，调用方可以安全地故障转移。预读的分块会在之后原样返回
+func (s *Server) guardStream(req openai.ChatCompletionRequest, stream ChatStream) (ChatStream, error) {
+	if !s.config.ToolCallMismatchFailover || requestHasTools(req) {
+		return stream, nil
+	}
+
+	var buffered []ChatChunk
+	for {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return &replayStream{ChatStream: stream, buffered: buffered, err: err}, nil
+		}
+		if chunkHasToolCall(chunk) {
+			slog.Warn("model streamed an unexpected tool call", "model", req.Model)
+			stream.Close()
+			return nil, errUnexpectedToolCall
+		}
+		buffered = append(buffered, chunk)
+		if chunkHasContent(chunk) {
+			return &replayStream{ChatStream: stream, buffered: buffered}, nil
+		}
+	}
+}
+
+// replayStream 先返回预读的分块和预读时遇到的错误，再继续读取底层流
+type replayStream struct {
+	ChatStream
+	buffered []ChatChunk
+	err      error
+}
+
+func (r *replayStream) Recv() (ChatChunk, error) {
+	if len(r.buffered) > 0 {
+		chunk := r.buffered[0]
+		r.buffered = r.buffered[1:]
+		return chunk, nil
+	}
+	if r.err != nil {
+		return ChatChunk{}, r.err
+	}
+	return r.ChatStream.Recv()
+}
+
+// parallelToolCallsDisabled 判断客户端是否显式设置了 parallel_tool_calls: false
+func parallelToolCallsDisabled(req openai.ChatCompletionRequest) bool {
+	enabled, ok := req.ParallelToolCalls.(bool)
+	return ok && !enabled
+}
+
+// limitToolCalls 在禁用并行工具调用时只保留每个 choice 的第一个工具调用。
+// 部分上游模型会忽略 parallel_tool_calls，这里保证客户端看到的结果符合其要求
+func limitToolCalls(req openai.ChatCompletionRequest, choices []openai.ChatCompletionChoice) {
+	if !parallelToolCallsDisabled(req) {
+		return
+	}
+	for i := range choices {
+		if calls := choices[i].Message.ToolCalls; len(calls) > 1 {
+			slog.Warn("dropping parallel tool calls", "model", req.Model, "returned", len(calls))
+			choices[i].Message.ToolCalls = calls[:1]
+		}
+	}
+}
+
+// limitToolCallDeltas 是 limitToolCalls 的流式版本，丢弃 index 大于 0 的工具调用分块
+func limitToolCallDeltas(req openai.ChatCompletionRequest, calls []openai.ToolCall) []openai.ToolCall {
+	if !parallelToolCallsDisabled(req) || len(calls) == 0 {
+		return calls
+	}
+	kept := calls[:0]
+	for _, call := range calls {
+		if call.Index == nil || *call.Index == 0 {
+			kept = append(kept, call)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// writeToolCallStream 模拟模型直接以工具调用开始的流式响应
+func writeToolCallStream(w http.ResponseWriter, model string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprintf(w, `data: {"id":"gen-tool","model":%q,"choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"lookup","arguments":""}}]}}]}`+"\n\n", model)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func TestUnexpectedToolCallFailover(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		stream     bool
+		wantModels []string
+		wantBody   string
+	}{
+		{"stream enabled", true, true, []string{"org/tooly:free", "org/good:free"}, "hello"},
+		{"stream disabled", false, true, []string{"org/tooly:free"}, "chat.completion.chunk"},
+		{"non-stream enabled", true, false, []string{"org/tooly:free", "org/good:free"}, "hello world"},
+		{"non-stream disabled", false, false, []string{"org/tooly:free"}, "chat.completion"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t)
+			upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+				model, _ := body["model"].(string)
+				stream, _ := body["stream"].(bool)
+				switch {
+				case model == "org/tooly:free" && stream:
+					writeToolCallStream(w, model)
+				case model == "org/tooly:free":
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprintf(w, `{"id":"gen-tool","model":%q,"choices":[{"index":0,"message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`, model)
+				case stream:
+					writeChatStream(w, model, "hello", " world")
+				default:
+					writeChatCompletion(w, model, "hello world")
+				}
+			}
+			s := newTestServer(t, Config{FreeMode: true, ToolCallMismatchFailover: tt.enabled}, upstream,
+				"org/tooly:free", "org/good:free")
+
+			body := fmt.Sprintf(`{"model":"tooly:free","stream":%v,"messages":[{"role":"user","content":"hi"}]}`, tt.stream)
+			w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if got := upstream.requestedModels(); strings.Join(got, ",") != strings.Join(tt.wantModels, ",") {
+				t.Errorf("upstream models = %v, want %v", got, tt.wantModels)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestGuardStreamReplaysBufferedChunks(t *testing.T) {
+	upstream := newFakeUpstream(t)
+	s := newTestServer(t, Config{FreeMode: true, ToolCallMismatchFailover: true}, upstream, "org/model-a:free")
+
+	body := `{"model":"model-a:free","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+	out := w.Body.String()
+	if !strings.Contains(out, `"content":"hello"`) || !strings.Contains(out, `"content":" world"`) || !strings.Contains(out, "[DONE]") {
+		t.Errorf("stream lost chunks: %s", out)
+	}
+}
+
+const lookupTool = `"tools":[{"type":"function","function":{"name":"lookup","parameters":{"type":"object"}}}]`
+
+func TestParallelToolCallsForwarded(t *testing.T) {
+	for _, flag := range []string{"false", "true"} {
+		t.Run(flag, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			s := newTestServer(t, Config{}, upstream)
+
+			body := `{"model":"model-a","parallel_tool_calls":` + flag + `,` + lookupTool + `,"messages":[{"role":"user","content":"hi"}]}`
+			if w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body); w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			got := upstream.lastRequest(t)
+			if fmt.Sprint(got["parallel_tool_calls"]) != flag {
+				t.Errorf("parallel_tool_calls = %v, want %s", got["parallel_tool_calls"], flag)
+			}
+			if tools, _ := got["tools"].([]interface{}); len(tools) != 1 {
+				t.Errorf("tools = %v, want the client's tool", got["tools"])
+			}
+		})
+	}
+}
+
+func TestParallelToolCallsDisabledKeepsFirstCall(t *testing.T) {
+	upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+	upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+		model, _ := body["model"].(string)
+		if stream, _ := body["stream"].(bool); stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 0; i < 2; i++ {
+				fmt.Fprintf(w, `data: {"id":"gen-tool","model":%q,"choices":[{"index":0,"delta":{"tool_calls":[{"index":%d,"id":"call_%d","type":"function","function":{"name":"lookup","arguments":"{}"}}]}}]}`+"\n\n", model, i, i)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"gen-tool","model":%q,"choices":[{"index":0,"message":{"role":"assistant","tool_calls":[{"id":"call_0","type":"function","function":{"name":"lookup","arguments":"{}"}},{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`, model)
+	}
+	s := newTestServer(t, Config{}, upstream)
+
+	for _, stream := range []bool{false, true} {
+		body := fmt.Sprintf(`{"model":"model-a","stream":%v,"parallel_tool_calls":false,%s,"messages":[{"role":"user","content":"hi"}]}`, stream, lookupTool)
+		w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("stream=%v status = %d, body = %s", stream, w.Code, w.Body.String())
+		}
+		out := w.Body.String()
+		if !strings.Contains(out, "call_0") || strings.Contains(out, "call_1") {
+			t.Errorf("stream=%v body = %s, want only call_0", stream, out)
+		}
+	}
+}
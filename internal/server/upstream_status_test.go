@@ -0,0 +1,68 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestUpstreamErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"rate limited", wrapUpstreamError("chat completion failed", &openai.APIError{HTTPStatusCode: 429}), http.StatusTooManyRequests},
+		{"no credits", wrapUpstreamError("chat completion failed", &openai.APIError{HTTPStatusCode: 402}), http.StatusPaymentRequired},
+		{"bad proxy key", wrapUpstreamError("chat completion failed", &openai.APIError{HTTPStatusCode: 401}), http.StatusBadGateway},
+		{"request error", wrapUpstreamError("stream creation failed", &openai.RequestError{HTTPStatusCode: 503}), http.StatusServiceUnavailable},
+		{"failover", &FailoverError{Last: wrapUpstreamError("chat completion failed", &openai.APIError{HTTPStatusCode: 429})}, http.StatusTooManyRequests},
+		{"no status", wrapUpstreamError("chat completion failed", errors.New("boom")), http.StatusInternalServerError},
+		{"plain", fmt.Errorf("model name cannot be empty"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := upstreamErrorStatus(tt.err, http.StatusInternalServerError); got != tt.want {
+				t.Errorf("upstreamErrorStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlersEchoUpstreamStatus(t *testing.T) {
+	tests := []struct {
+		path     string
+		stream   bool
+		upstream int
+		want     int
+	}{
+		{"/v1/chat/completions", false, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		{"/v1/chat/completions", true, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		{"/v1/chat/completions", false, http.StatusPaymentRequired, http.StatusPaymentRequired},
+		{"/api/chat", false, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		{"/api/chat", true, http.StatusPaymentRequired, http.StatusPaymentRequired},
+		{"/api/generate", false, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		{"/api/generate", true, http.StatusTooManyRequests, http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		name := fmt.Sprintf("%s stream=%v %d", tt.path, tt.stream, tt.upstream)
+		t.Run(name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "org/model-a"})
+			upstream.chat = func(w http.ResponseWriter, body map[string]interface{}) {
+				writeUpstreamError(w, tt.upstream, "upstream refused")
+			}
+			s := newTestServer(t, Config{}, upstream)
+
+			body := fmt.Sprintf(`{"model":"model-a","stream":%v,"prompt":"hi","messages":[{"role":"user","content":"hi"}]}`, tt.stream)
+			w := doJSON(t, s.buildRouter(), http.MethodPost, tt.path, body)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body = %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
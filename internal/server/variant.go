@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// preferFreeVariantHeader 按请求覆盖 PreferFreeVariant：false 强制使用请求的付费基础模型，true 强制优先免费变体
+const preferFreeVariantHeader = "X-Prefer-Free-Variant"
+
+// freeVariantSuffix 是 OpenRouter 免费变体模型 ID 的后缀
+const freeVariantSuffix = ":free"
+
+// preferFreeVariantKey 是请求头覆盖值在 context 中的键
+type preferFreeVariantKey struct{}
+
+// variantMiddleware 把 X-Prefer-Free-Variant 请求头（可解析为布尔值时）保存到请求 context
+func variantMiddleware(c *gin.Context) {
+	if v, err := strconv.ParseBool(c.GetHeader(preferFreeVariantHeader)); err == nil {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), preferFreeVariantKey{}, v))
+	}
+	c.Next()
+}
+
+// preferFreeVariant 判断本次请求是否优先使用免费变体：请求头优先，其次是配置，
+// 未配置时免费模式下开启、否则关闭
+func (s *Server) preferFreeVariant(ctx context.Context) bool {
+	if v, ok := ctx.Value(preferFreeVariantKey{}).(bool); ok {
+		return v
+	}
+	if s.config.PreferFreeVariant != nil {
+		return *s.config.PreferFreeVariant
+	}
+	return s.config.FreeMode
+}
+
+// resolveModel 把客户端请求的模型解析为完整 ID。优先使用免费变体时，
+// 请求的是基础模型名且存在对应的 :free 变体，则返回免费变体
+func (s *Server) resolveModel(ctx context.Context, name string) (string, error) {
+	full, err := s.provider.GetFullModelName(name)
+	if err != nil || strings.HasSuffix(full, freeVariantSuffix) || !s.preferFreeVariant(ctx) {
+		return full, err
+	}
+	if s.provider.hasModel(full + freeVariantSuffix) {
+		return full + freeVariantSuffix, nil
+	}
+	return full, nil
+}
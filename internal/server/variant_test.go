@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPreferFreeVariantInFreeMode(t *testing.T) {
+	body := `{"model":"gemma","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	tests := []struct {
+		name    string
+		headers []string
+		want    string
+	}{
+		{"default on", nil, "google/gemma:free"},
+		{"header forces base", []string{preferFreeVariantHeader, "false"}, "org/other:free"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t)
+			s := newTestServer(t, Config{FreeMode: true}, upstream, "org/other:free", "google/gemma:free")
+
+			if w := doJSON(t, s.buildRouter(), http.MethodPost, "/api/chat", body, tt.headers...); w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if got := upstream.requestedModels()[0]; got != tt.want {
+				t.Errorf("first requested model = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreferFreeVariantInPaidMode(t *testing.T) {
+	on, off := true, false
+	body := `{"model":"gemma","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+	tests := []struct {
+		name    string
+		prefer  *bool
+		headers []string
+		want    string
+	}{
+		{"default off outside free mode", nil, nil, "google/gemma"},
+		{"toggle on", &on, nil, "google/gemma:free"},
+		{"header forces paid base", &on, []string{preferFreeVariantHeader, "false"}, "google/gemma"},
+		{"header forces free variant", &off, []string{preferFreeVariantHeader, "true"}, "google/gemma:free"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newFakeUpstream(t, fakeModel{ID: "google/gemma", Prompt: "0.1"}, fakeModel{ID: "google/gemma:free"})
+			s := newTestServer(t, Config{PreferFreeVariant: tt.prefer}, upstream)
+
+			if w := doJSON(t, s.buildRouter(), http.MethodPost, "/v1/chat/completions", body, tt.headers...); w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if got := upstream.lastRequest(t)["model"]; got != tt.want {
+				t.Errorf("upstream model = %v, want %q", got, tt.want)
+			}
+		})
+	}
+}